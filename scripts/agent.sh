@@ -329,6 +329,7 @@ Wants=network-online.target
 [Service]
 Type=simple
 User=root
+ExecStartPre=-/bin/sh -c 'test ! -f $INSTALL_DIR/vstats-agent.update.json || exec $INSTALL_DIR/vstats-agent.bak check-update $INSTALL_DIR/vstats-agent --boot'
 ExecStart=$INSTALL_DIR/vstats-agent run --config $CONFIG_DIR/vstats-agent.json
 Restart=always
 RestartSec=10
@@ -24,6 +24,20 @@ type AgentConfig struct {
 	MaxOfflineRecords    int    `json:"max_offline_records"`    // Max records to store offline (default: 10000)
 	AggregationSecs      int    `json:"aggregation_secs"`       // Aggregation interval in seconds (default: 60)
 	BatchSize            int    `json:"batch_size"`             // Max metrics per batch when syncing (default: 100)
+	// Optional collectors (default: all enabled)
+	Collectors CollectorSettings `json:"collectors,omitempty"`
+}
+
+// Settings returns the settings of the config file that the server can
+// override
+func (c *AgentConfig) Settings() AgentSettings {
+	return AgentSettings{
+		IntervalSecs:      c.IntervalSecs,
+		MaxOfflineRecords: c.MaxOfflineRecords,
+		AggregationSecs:   c.AggregationSecs,
+		BatchSize:         c.BatchSize,
+		Collectors:        c.Collectors,
+	}
 }
 
 func DefaultConfigPath() string {
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -45,6 +46,9 @@ func main() {
 		case "show-config":
 			handleShowConfig()
 			return
+		case "check-update":
+			handleCheckUpdate()
+			return
 		}
 	}
 
@@ -244,6 +248,11 @@ func handleShowConfig() {
 }
 
 func installSystemd(exe, configPath string) {
+	// Self-updates keep their state and backup next to the resolved binary
+	realExe, err := filepath.EvalSymlinks(exe)
+	if err != nil {
+		realExe = exe
+	}
 	serviceContent := fmt.Sprintf(`[Unit]
 Description=vStats Monitoring Agent
 After=network-online.target
@@ -252,14 +261,15 @@ Wants=network-online.target
 [Service]
 Type=simple
 User=root
-ExecStart=%s run --config %s
+ExecStartPre=-/bin/sh -c 'test ! -f %[3]s.update.json || exec %[3]s.bak check-update %[3]s --boot'
+ExecStart=%[1]s run --config %[2]s
 Restart=always
 RestartSec=10
 Environment=RUST_LOG=info
 
 [Install]
 WantedBy=multi-user.target
-`, exe, configPath)
+`, exe, configPath, realExe)
 
 	servicePath := "/etc/systemd/system/vstats-agent.service"
 	if err := os.WriteFile(servicePath, []byte(serviceContent), 0644); err != nil {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
@@ -32,6 +33,15 @@ type PingAggData struct {
 	FailCount    int
 }
 
+// pingState tracks when a ping target runs next and its latest result
+type pingState struct {
+	config    PingTargetConfig
+	next      time.Time
+	running   bool
+	result    *PingTarget
+	timestamp int64
+}
+
 // MetricsCollector collects system metrics
 type MetricsCollector struct {
 	mu                sync.RWMutex
@@ -42,12 +52,15 @@ type MetricsCollector struct {
 	lastDiskIOTime    time.Time
 	pingResults       *PingMetrics
 	pingResultsMu     sync.RWMutex
+	pingStates        map[string]*pingState // Per-target schedule and latest result, guarded by pingResultsMu
+	pingOrder         []string              // Target names in configured order
 	customPingTargets []PingTargetConfig
 	customTargetsMu   sync.RWMutex
 	gatewayIP         string
 	ipAddresses       []string
 	dailyTrafficStats *DailyTrafficStats
-	pingInterval time.Duration // Ping collection interval (matches metrics interval)
+	pingInterval time.Duration // Default ping target interval (matches metrics interval)
+	collectors   CollectorSettings // Optional collectors, see SetCollectors
 	// Ping aggregation (all granularities, computed by Agent)
 	pingAgg       map[string]map[PingAggKey]*PingAggData // key: "2min", "15min", "hourly", "daily"
 	pingAggMu     sync.RWMutex
@@ -64,6 +77,7 @@ func NewMetricsCollector(intervalSecs uint64) *MetricsCollector {
 		lastDiskIO:        make(map[string]disk.IOCountersStat),
 		lastDiskIOTime:    time.Now(),
 		pingResults:       nil, // Will be set when ping targets are configured
+		pingStates:        make(map[string]*pingState),
 		dailyTrafficStats: loadDailyTrafficStats(),
 		pingInterval:      time.Duration(intervalSecs) * time.Second,
 		pingAgg: map[string]map[PingAggKey]*PingAggData{
@@ -108,6 +122,23 @@ func NewMetricsCollector(intervalSecs uint64) *MetricsCollector {
 	return mc
 }
 
+// SetInterval changes the ping collection interval to match a new metrics interval
+func (mc *MetricsCollector) SetInterval(intervalSecs uint64) {
+	if intervalSecs == 0 {
+		return
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.pingInterval = time.Duration(intervalSecs) * time.Second
+}
+
+// SetCollectors switches the optional collectors on or off
+func (mc *MetricsCollector) SetCollectors(collectors CollectorSettings) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.collectors = collectors
+}
+
 // SetPingTargets sets the ping targets configuration
 func (mc *MetricsCollector) SetPingTargets(targets []PingTargetConfig) {
 	mc.customTargetsMu.Lock()
@@ -157,11 +188,20 @@ func (mc *MetricsCollector) Collect() SystemMetrics {
 	// Memory metrics
 	memInfo, _ := mem.VirtualMemory()
 	swapInfo := collectSwapInfo()
-	memoryModules := collectMemoryModules()
+	mc.mu.RLock()
+	collectors := mc.collectors
+	mc.mu.RUnlock()
+	var memoryModules []MemoryModule
+	if common.Enabled(collectors.MemoryModules) {
+		memoryModules = collectMemoryModules()
+	}
 
 	// Disk metrics - collect physical disks with IO speed
 	mc.mu.Lock()
-	diskIO, _ := disk.IOCounters()
+	var diskIO map[string]disk.IOCountersStat
+	if common.Enabled(collectors.DiskIO) {
+		diskIO, _ = disk.IOCounters()
+	}
 	diskMetrics := collectPhysicalDisks(diskIO, mc.lastDiskIO, mc.lastDiskIOTime)
 	mc.lastDiskIO = diskIO
 	mc.lastDiskIOTime = time.Now()
@@ -215,7 +255,10 @@ func (mc *MetricsCollector) Collect() SystemMetrics {
 	}
 
 	// GPU metrics
-	gpuMetrics := collectGPUMetrics()
+	var gpuMetrics *GPUMetrics
+	if common.Enabled(collectors.GPU) {
+		gpuMetrics = collectGPUMetrics()
+	}
 
 	metrics := SystemMetrics{
 		Timestamp: time.Now().UTC(),
@@ -282,28 +325,114 @@ var pingBucketKeep = map[string]int64{
 	"daily":  2,  // Current + previous
 }
 
-// pingLoop runs in the background to periodically collect ping metrics
+// pingTick is how often pingLoop looks for due targets
+const pingTick = time.Second
+
+// pingLoop runs in the background and starts each ping target when it is
+// due, at its own interval or the metrics interval
 func (mc *MetricsCollector) pingLoop() {
-	// Use same interval as metrics sending for accurate sampling
-	ticker := time.NewTicker(mc.pingInterval)
+	ticker := time.NewTicker(pingTick)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for now := range ticker.C {
 		mc.customTargetsMu.RLock()
 		customTargets := mc.customPingTargets
 		mc.customTargetsMu.RUnlock()
 
-		results := collectPingMetrics(mc.gatewayIP, customTargets)
+		mc.mu.RLock()
+		interval := mc.pingInterval
+		mc.mu.RUnlock()
 
-		// Update all granularity aggregations
-		if results != nil && len(results.Targets) > 0 {
-			mc.updatePingAggAll(results.Targets, results.Timestamp)
+		for _, ct := range mc.duePingTargets(customTargets, interval, now) {
+			go mc.runPingTarget(ct)
 		}
+	}
+}
 
-		mc.pingResultsMu.Lock()
-		mc.pingResults = results
-		mc.pingResultsMu.Unlock()
+// duePingTargets returns the targets to start now and forgets targets that
+// were removed. Results are aggregated by name, so a name is probed once.
+func (mc *MetricsCollector) duePingTargets(targets []PingTargetConfig, interval time.Duration, now time.Time) []PingTargetConfig {
+	mc.pingResultsMu.Lock()
+	defer mc.pingResultsMu.Unlock()
+
+	var due []PingTargetConfig
+	var order []string
+	seen := make(map[string]bool)
+	for _, ct := range targets {
+		if ct.Host == "" || seen[ct.Name] {
+			continue
+		}
+		seen[ct.Name] = true
+		order = append(order, ct.Name)
+
+		state := mc.pingStates[ct.Name]
+		if state == nil || !reflect.DeepEqual(state.config, ct) {
+			// New or changed target, run it right away
+			state = &pingState{config: ct}
+			mc.pingStates[ct.Name] = state
+		}
+		// Ticks are not exact, a target due within half a tick runs now
+		if state.running || now.Add(pingTick/2).Before(state.next) {
+			continue
+		}
+		targetInterval := interval
+		if ct.IntervalSecs > 0 {
+			targetInterval = time.Duration(ct.IntervalSecs) * time.Second
+		}
+		state.running = true
+		state.next = now.Add(targetInterval)
+		due = append(due, ct)
+	}
+
+	for name := range mc.pingStates {
+		if !seen[name] {
+			delete(mc.pingStates, name)
+		}
+	}
+	mc.pingOrder = order
+	mc.publishPingResults()
+	return due
+}
+
+// runPingTarget probes a target and records its result
+func (mc *MetricsCollector) runPingTarget(ct PingTargetConfig) {
+	result := probeTarget(ct)
+	timestamp := time.Now().Unix()
+
+	// Update all granularity aggregations
+	mc.updatePingAggAll([]PingTarget{result}, timestamp)
+
+	mc.pingResultsMu.Lock()
+	defer mc.pingResultsMu.Unlock()
+	state := mc.pingStates[ct.Name]
+	if state == nil || !reflect.DeepEqual(state.config, ct) {
+		return // Removed or changed while running
+	}
+	state.running = false
+	state.result = &result
+	state.timestamp = timestamp
+	mc.publishPingResults()
+}
+
+// publishPingResults sets the latest result of every target as the ping
+// metrics. Must be called with pingResultsMu held.
+func (mc *MetricsCollector) publishPingResults() {
+	var results PingMetrics
+	for _, name := range mc.pingOrder {
+		state := mc.pingStates[name]
+		if state == nil || state.result == nil {
+			continue
+		}
+		results.Targets = append(results.Targets, *state.result)
+		if state.timestamp > results.Timestamp {
+			results.Timestamp = state.timestamp // When the newest result was collected
+		}
+	}
+	if len(results.Targets) == 0 {
+		mc.pingResults = nil
+		return
 	}
+	mc.pingResults = &results
 }
 
 // updatePingAggAll updates ping aggregation for all granularities
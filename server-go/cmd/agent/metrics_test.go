@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestPingCollector() *MetricsCollector {
+	return &MetricsCollector{
+		pingStates: make(map[string]*pingState),
+		pingAgg: map[string]map[PingAggKey]*PingAggData{
+			"2min":   make(map[PingAggKey]*PingAggData),
+			"15min":  make(map[PingAggKey]*PingAggData),
+			"hourly": make(map[PingAggKey]*PingAggData),
+			"daily":  make(map[PingAggKey]*PingAggData),
+		},
+	}
+}
+
+// TestDuePingTargets tests scheduling ping targets at their own intervals
+func TestDuePingTargets(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	mc := newTestPingCollector()
+	interval := 10 * time.Second
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := PingTargetConfig{Name: "a", Host: "127.0.0.1", Type: "tcp", Port: port, TimeoutSecs: 1}
+	b := PingTargetConfig{Name: "b", Host: "127.0.0.1", Type: "tcp", Port: port, TimeoutSecs: 1, IntervalSecs: 30}
+	targets := []PingTargetConfig{a, b, {Name: "a", Host: "10.0.0.1"}, {Name: "no host"}}
+
+	due := func(targets []PingTargetConfig, now time.Time, want ...string) {
+		t.Helper()
+		var names []string
+		for _, ct := range mc.duePingTargets(targets, interval, now) {
+			names = append(names, ct.Name)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("At %v: expected %v due, got %v", now.Sub(start), want, names)
+		}
+	}
+
+	// New targets run right away; duplicate names and targets without host are skipped
+	due(targets, start, "a", "b")
+	if len(mc.pingOrder) != 2 {
+		t.Errorf("Expected 2 targets in order, got %v", mc.pingOrder)
+	}
+
+	// Running targets are not started again, however late
+	due(targets, start.Add(time.Minute), []string(nil)...)
+
+	mc.runPingTarget(a)
+	mc.runPingTarget(b)
+	if mc.pingResults == nil || len(mc.pingResults.Targets) != 2 || mc.pingResults.Targets[0].Name != "a" || mc.pingResults.Targets[0].Status != "ok" {
+		t.Fatalf("Expected results for a and b in order, got %+v", mc.pingResults)
+	}
+
+	// Each target keeps its interval; a target due within half a tick runs now
+	due(targets, start.Add(interval-pingTick/2-time.Millisecond), []string(nil)...)
+	due(targets, start.Add(interval-pingTick/2+time.Millisecond), "a")
+	mc.runPingTarget(a)
+	due(targets, start.Add(19*time.Second), []string(nil)...)
+	due(targets, start.Add(20*time.Second), "a")
+	mc.runPingTarget(a)
+	due(targets, start.Add(30*time.Second), "a", "b")
+	mc.runPingTarget(a)
+	mc.runPingTarget(b)
+
+	// A changed target restarts right away, even while the old one runs
+	changed := a
+	changed.Count = 2
+	targets[0] = changed
+	due(targets, start.Add(31*time.Second), "a")
+	if mc.pingResults == nil || len(mc.pingResults.Targets) != 1 || mc.pingResults.Targets[0].Name != "b" {
+		t.Errorf("Expected only the result of b until the changed target reports, got %+v", mc.pingResults)
+	}
+	mc.runPingTarget(a) // Result of the old config is dropped
+	if state := mc.pingStates["a"]; !state.running || state.result != nil {
+		t.Errorf("Expected the changed target to stay running without result, got %+v", state)
+	}
+	mc.runPingTarget(changed)
+	if state := mc.pingStates["a"]; state.running || state.result == nil {
+		t.Errorf("Expected the result of the changed target, got %+v", state)
+	}
+
+	// Removed targets are forgotten and their late results dropped
+	due(targets[:1], start.Add(32*time.Second), []string(nil)...)
+	if _, ok := mc.pingStates["b"]; ok {
+		t.Error("Expected the removed target to be forgotten")
+	}
+	mc.runPingTarget(b)
+	if _, ok := mc.pingStates["b"]; ok {
+		t.Error("Expected the result of a removed target to be dropped")
+	}
+	if len(mc.pingResults.Targets) != 1 || mc.pingResults.Targets[0].Name != "a" {
+		t.Errorf("Expected only the result of a, got %+v", mc.pingResults.Targets)
+	}
+
+	// A removed target that comes back runs right away
+	due(targets, start.Add(33*time.Second), "b")
+}
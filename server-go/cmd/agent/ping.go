@@ -11,101 +11,101 @@ import (
 	"time"
 )
 
-// collectPingMetrics collects ping metrics for configured targets
-func collectPingMetrics(gatewayIP string, customTargets []PingTargetConfig) *PingMetrics {
-	// If no custom targets configured, return nil (no ping)
-	if len(customTargets) == 0 {
-		return nil
-	}
+// Default probe timeouts and counts, see PingTargetConfig
+const (
+	defaultICMPTimeout = 2 * time.Second
+	defaultTCPTimeout  = 3 * time.Second
+	defaultICMPCount   = 3
+)
 
-	var targets []PingTarget
-	pingedHosts := make(map[string]bool)
+// probeTarget runs one ping target and returns its result
+func probeTarget(ct PingTargetConfig) PingTarget {
+	// Determine type (default to icmp)
+	targetType := ct.Type
+	if targetType == "" {
+		targetType = "icmp"
+	}
+	target := PingTarget{Name: ct.Name, Host: ct.Host, Type: targetType, Port: ct.Port}
+	timeout := time.Duration(ct.TimeoutSecs) * time.Second
 
-	// Only ping custom targets from dashboard configuration
-	for _, ct := range customTargets {
-		if ct.Host == "" || pingedHosts[ct.Host] {
-			continue
+	switch targetType {
+	case "http", "dns", "tls":
+		if timeout <= 0 {
+			timeout = probeTimeout
 		}
-
-		// Determine type (default to icmp)
-		targetType := ct.Type
-		if targetType == "" {
-			targetType = "icmp"
+		runProbe(ct, &target, timeout)
+	case "tcp":
+		// Use TCP connection test
+		port := ct.Port
+		if port == 0 {
+			port = 80 // Default to HTTP port
 		}
-
-		var latency *float64
-		var packetLoss float64
-		var status string
-
-		if targetType == "tcp" {
-			// Use TCP connection test
-			port := ct.Port
-			if port == 0 {
-				port = 80 // Default to HTTP port
-			}
-			latency, status = testTCPConnection(ct.Host, port)
-			if status == "ok" {
-				packetLoss = 0.0
-			} else {
-				packetLoss = 100.0
-			}
-		} else {
-			// Use ICMP ping
-			latency, packetLoss, status = pingHost(ct.Host)
+		if timeout <= 0 {
+			timeout = defaultTCPTimeout
 		}
-
-		targets = append(targets, PingTarget{
-			Name:       ct.Name,
-			Host:       ct.Host,
-			Type:       targetType,
-			Port:       ct.Port,
-			LatencyMs:  latency,
-			PacketLoss: packetLoss,
-			Status:     status,
-		})
-		pingedHosts[ct.Host] = true
-	}
-
-	// Return nil if no valid targets after filtering
-	if len(targets) == 0 {
-		return nil
-	}
-
-	return &PingMetrics{
-		Targets:   targets,
-		Timestamp: time.Now().Unix(), // Record when ping was actually collected
+		target.LatencyMs, target.PacketLoss, target.Status = testTCPConnection(ct.Host, port, ct.Count, timeout)
+	default:
+		// Use ICMP ping
+		count := ct.Count
+		if count <= 0 {
+			count = defaultICMPCount
+		}
+		if timeout <= 0 {
+			timeout = defaultICMPTimeout
+		}
+		target.LatencyMs, target.PacketLoss, target.Status = pingHost(ct.Host, count, timeout)
 	}
+	return target
 }
 
-// testTCPConnection tests TCP connection latency
-func testTCPConnection(host string, port int) (*float64, string) {
+// testTCPConnection tests TCP connection latency over count connections
+func testTCPConnection(host string, port, count int, timeout time.Duration) (*float64, float64, string) {
+	if count <= 0 {
+		count = 1
+	}
 	address := net.JoinHostPort(host, strconv.Itoa(port))
-	start := time.Now()
 
-	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
-	if err != nil {
-		return nil, "error"
+	var total float64
+	var ok int
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		total += float64(time.Since(start).Nanoseconds()) / 1000000.0 // Convert to milliseconds
+		ok++
 	}
-	defer conn.Close()
 
-	latency := float64(time.Since(start).Nanoseconds()) / 1000000.0 // Convert to milliseconds
-	return &latency, "ok"
+	packetLoss := float64(count-ok) / float64(count) * 100.0
+	if ok == 0 {
+		return nil, packetLoss, "error"
+	}
+	latency := total / float64(ok)
+	return &latency, packetLoss, "ok"
 }
 
-// pingHost performs ICMP ping to a host
-func pingHost(host string) (*float64, float64, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// pingHost performs ICMP ping to a host, sending count packets and waiting up
+// to timeout for each reply
+func pingHost(host string, count int, timeout time.Duration) (*float64, float64, string) {
+	// Packets are sent a second apart
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(count-1)*time.Second+timeout+time.Second)
 	defer cancel()
 
+	n := strconv.Itoa(count)
+	waitMs := strconv.FormatInt(timeout.Milliseconds(), 10)
+	waitSecs := strconv.Itoa(int((timeout + time.Second - 1) / time.Second))
+
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(ctx, "ping", "-n", "3", "-w", "2000", host)
+		cmd = exec.CommandContext(ctx, "ping", "-n", n, "-w", waitMs, host)
 	} else if runtime.GOOS == "darwin" {
 		// macOS uses -W with milliseconds
-		cmd = exec.CommandContext(ctx, "ping", "-c", "3", "-W", "2000", host)
+		cmd = exec.CommandContext(ctx, "ping", "-c", n, "-W", waitMs, host)
 	} else {
 		// Linux uses -W with seconds
-		cmd = exec.CommandContext(ctx, "ping", "-c", "3", "-W", "2", host)
+		cmd = exec.CommandContext(ctx, "ping", "-c", n, "-W", waitSecs, host)
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// HTTP, DNS and TLS Probes
+// ============================================================================
+
+const (
+	probeTimeout      = 10 * time.Second // Default timeout
+	probeMaxBodyBytes = 1 << 20          // Body read when looking for body_contains
+)
+
+// runProbe runs an http, dns or tls probe and fills in the result
+func runProbe(ct PingTargetConfig, target *PingTarget, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	switch target.Type {
+	case "http":
+		err = probeHTTP(ctx, ct, target)
+	case "dns":
+		err = probeDNS(ctx, ct, target)
+	case "tls":
+		err = probeTLS(ctx, ct, target)
+	default:
+		err = fmt.Errorf("unknown probe type %q", target.Type)
+	}
+	latency := msSince(start)
+	target.LatencyMs = &latency
+
+	switch {
+	case err == nil:
+		target.Status = "ok"
+	case ctx.Err() == context.DeadlineExceeded:
+		target.Status = "timeout"
+		target.Error = err.Error()
+		target.LatencyMs = nil
+	default:
+		target.Status = "error"
+		target.Error = err.Error()
+	}
+	if target.Status != "ok" {
+		target.PacketLoss = 100.0
+	}
+}
+
+// probeHTTP sends one request without following redirects, so that a
+// redirect can be the expected status
+func probeHTTP(ctx context.Context, ct PingTargetConfig, target *PingTarget) error {
+	url := ct.URL
+	if url == "" {
+		host := ct.Host
+		if ct.Port != 0 {
+			host = net.JoinHostPort(ct.Host, strconv.Itoa(ct.Port))
+		}
+		url = "https://" + host + "/"
+	}
+	method := strings.ToUpper(ct.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "vstats-agent/"+AgentVersion)
+
+	var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, wrote, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { connectDone = time.Now() },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true, Proxy: http.ProxyFromEnvironment},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	target.StatusCode = resp.StatusCode
+	target.Timings = &ProbeTimings{
+		DNSMs:     msBetween(dnsStart, dnsDone),
+		ConnectMs: msBetween(connectStart, connectDone),
+		TLSMs:     msBetween(tlsStart, tlsDone),
+		TTFBMs:    msBetween(wrote, firstByte),
+	}
+	if resp.TLS != nil {
+		if days, ok := certExpiryDays(*resp.TLS); ok {
+			target.CertExpiryDays = &days
+		}
+	}
+
+	if ct.ExpectedStatus != 0 {
+		if resp.StatusCode != ct.ExpectedStatus {
+			return fmt.Errorf("status %d, expected %d", resp.StatusCode, ct.ExpectedStatus)
+		}
+	} else if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	if ct.BodyContains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, probeMaxBodyBytes))
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		if !strings.Contains(string(body), ct.BodyContains) {
+			return fmt.Errorf("body does not contain %q", ct.BodyContains)
+		}
+	}
+	return nil
+}
+
+// probeDNS resolves Host, optionally against a specific resolver
+func probeDNS(ctx context.Context, ct PingTargetConfig, target *PingTarget) error {
+	resolver := net.DefaultResolver
+	if ct.Resolver != "" {
+		address := ct.Resolver
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, address)
+			},
+		}
+	}
+
+	var answers []string
+	switch recordType := strings.ToUpper(ct.RecordType); recordType {
+	case "", "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, ct.Host)
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, ct.Host)
+		if err != nil {
+			return err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		records, err := resolver.LookupMX(ctx, ct.Host)
+		if err != nil {
+			return err
+		}
+		for _, mx := range records {
+			answers = append(answers, mx.Host)
+		}
+	case "NS":
+		records, err := resolver.LookupNS(ctx, ct.Host)
+		if err != nil {
+			return err
+		}
+		for _, ns := range records {
+			answers = append(answers, ns.Host)
+		}
+	case "TXT":
+		records, err := resolver.LookupTXT(ctx, ct.Host)
+		if err != nil {
+			return err
+		}
+		answers = records
+	default:
+		return fmt.Errorf("unsupported record type %s", ct.RecordType)
+	}
+	target.Answers = answers
+
+	if len(answers) == 0 {
+		return fmt.Errorf("no answers")
+	}
+	if ct.Expected != "" {
+		want := strings.TrimSuffix(ct.Expected, ".")
+		for _, answer := range answers {
+			if strings.EqualFold(strings.TrimSuffix(answer, "."), want) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected answer %s not found", ct.Expected)
+	}
+	return nil
+}
+
+// probeTLS connects to Host and reports the days until its certificate
+// expires. The certificate is verified separately so that the expiry is
+// reported for invalid certificates too.
+func probeTLS(ctx context.Context, ct PingTargetConfig, target *PingTarget) error {
+	port := ct.Port
+	if port == 0 {
+		port = 443
+	}
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: ct.Host, InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ct.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	days, ok := certExpiryDays(state)
+	if !ok {
+		return fmt.Errorf("no certificate")
+	}
+	target.CertExpiryDays = &days
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{DNSName: ct.Host, Intermediates: intermediates})
+	return err
+}
+
+// certExpiryDays returns the days until the server certificate expires,
+// negative once it has
+func certExpiryDays(state tls.ConnectionState) (float64, bool) {
+	if len(state.PeerCertificates) == 0 {
+		return 0, false
+	}
+	days := time.Until(state.PeerCertificates[0].NotAfter).Hours() / 24
+	return float64(int(days*10)) / 10, true
+}
+
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Nanoseconds()) / 1000000.0
+}
+
+// msBetween returns the milliseconds between two trace events, 0 if either
+// did not happen (e.g. no DNS lookup for an IP address)
+func msBetween(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return float64(end.Sub(start).Nanoseconds()) / 1000000.0
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestProbeHTTP tests the status and body checks of HTTP probes
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte("hello from vstats"))
+		case "/redirect":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		ct         PingTargetConfig
+		status     string
+		statusCode int
+	}{
+		{"ok", PingTargetConfig{URL: server.URL + "/"}, "ok", http.StatusOK},
+		{"head", PingTargetConfig{URL: server.URL + "/", Method: "head"}, "ok", http.StatusOK},
+		{"not found", PingTargetConfig{URL: server.URL + "/missing"}, "error", http.StatusNotFound},
+		{"expected not found", PingTargetConfig{URL: server.URL + "/missing", ExpectedStatus: http.StatusNotFound}, "ok", http.StatusNotFound},
+		{"status mismatch", PingTargetConfig{URL: server.URL + "/", ExpectedStatus: http.StatusNoContent}, "error", http.StatusOK},
+		{"redirect not followed", PingTargetConfig{URL: server.URL + "/redirect"}, "ok", http.StatusFound},
+		{"expected redirect", PingTargetConfig{URL: server.URL + "/redirect", ExpectedStatus: http.StatusFound}, "ok", http.StatusFound},
+		{"redirect instead of page", PingTargetConfig{URL: server.URL + "/redirect", ExpectedStatus: http.StatusOK}, "error", http.StatusFound},
+		{"body contains", PingTargetConfig{URL: server.URL + "/", BodyContains: "vstats"}, "ok", http.StatusOK},
+		{"body without text", PingTargetConfig{URL: server.URL + "/", BodyContains: "maintenance"}, "error", http.StatusOK},
+		{"timeout", PingTargetConfig{URL: server.URL + "/slow", TimeoutSecs: 1}, "timeout", 0},
+	}
+	for _, tt := range tests {
+		tt.ct.Name, tt.ct.Type = tt.name, "http"
+		target := probeTarget(tt.ct)
+		if target.Status != tt.status || target.StatusCode != tt.statusCode {
+			t.Errorf("%s: expected %s with status %d, got %s with status %d (%s)", tt.name, tt.status, tt.statusCode, target.Status, target.StatusCode, target.Error)
+		}
+		if target.Status == "ok" && (target.LatencyMs == nil || target.Timings == nil || target.PacketLoss != 0) {
+			t.Errorf("%s: expected latency and timings, got %+v", tt.name, target)
+		}
+		if target.Status != "ok" && (target.Error == "" || target.PacketLoss != 100) {
+			t.Errorf("%s: expected an error and full loss, got %+v", tt.name, target)
+		}
+	}
+}
+
+// TestProbeDNS tests DNS probes against a local resolver
+func TestProbeDNS(t *testing.T) {
+	resolver := startDNSServer(t, net.IPv4(192, 0, 2, 10))
+
+	tests := []struct {
+		name    string
+		ct      PingTargetConfig
+		status  string
+		answers int
+	}{
+		{"any answer", PingTargetConfig{Host: "probe.test"}, "ok", 1},
+		{"expected answer", PingTargetConfig{Host: "probe.test", Expected: "192.0.2.10"}, "ok", 1},
+		{"other answer", PingTargetConfig{Host: "probe.test", Expected: "192.0.2.11"}, "error", 1},
+		{"no records", PingTargetConfig{Host: "probe.test", RecordType: "AAAA"}, "error", 0},
+		{"unsupported record type", PingTargetConfig{Host: "probe.test", RecordType: "SRV"}, "error", 0},
+	}
+	for _, tt := range tests {
+		tt.ct.Name, tt.ct.Type, tt.ct.Resolver, tt.ct.TimeoutSecs = tt.name, "dns", resolver, 2
+		target := probeTarget(tt.ct)
+		if target.Status != tt.status || len(target.Answers) != tt.answers {
+			t.Errorf("%s: expected %s with %d answers, got %s with %v (%s)", tt.name, tt.status, tt.answers, target.Status, target.Answers, target.Error)
+		}
+	}
+}
+
+// startDNSServer answers A queries for any name with ip and other queries
+// without records. It returns the address to use as resolver.
+func startDNSServer(t *testing.T, ip net.IP) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			if n < 12 {
+				continue
+			}
+			// Skip the question name to find its type
+			end := 12
+			for end < n && query[end] != 0 {
+				end += int(query[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(query[end-4:])
+
+			resp := append([]byte{}, query[:end]...)
+			binary.BigEndian.PutUint16(resp[2:], 0x8180) // Response, recursion available
+			binary.BigEndian.PutUint16(resp[6:], 0)      // Answers
+			binary.BigEndian.PutUint16(resp[8:], 0)      // Authorities
+			binary.BigEndian.PutUint16(resp[10:], 0)     // Additional records
+			if qtype == 1 {
+				binary.BigEndian.PutUint16(resp[6:], 1)
+				resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, ip.To4()...)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// TestProbeTLS tests that TLS probes report the certificate expiry of
+// invalid certificates too
+func TestProbeTLS(t *testing.T) {
+	selfSigned := httptest.NewTLSServer(http.NotFoundHandler())
+	defer selfSigned.Close()
+
+	expired := httptest.NewUnstartedServer(http.NotFoundHandler())
+	expired.TLS = &tls.Config{Certificates: []tls.Certificate{newTestCertificate(t, time.Now().Add(-24*time.Hour))}}
+	expired.StartTLS()
+	defer expired.Close()
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		port    int
+		minDays float64
+		maxDays float64
+	}{
+		{"untrusted certificate", portOf(t, selfSigned.URL), 365, 1e6},
+		{"expired certificate", portOf(t, expired.URL), -2, 0},
+	}
+	for _, tt := range tests {
+		target := probeTarget(PingTargetConfig{Name: tt.name, Type: "tls", Host: "127.0.0.1", Port: tt.port, TimeoutSecs: 2})
+		if target.Status != "error" || target.Error == "" {
+			t.Errorf("%s: expected a verification error, got %s", tt.name, target.Status)
+		}
+		if target.CertExpiryDays == nil || *target.CertExpiryDays < tt.minDays || *target.CertExpiryDays > tt.maxDays {
+			t.Errorf("%s: expected the expiry between %v and %v days, got %v", tt.name, tt.minDays, tt.maxDays, target.CertExpiryDays)
+		}
+	}
+
+	target := probeTarget(PingTargetConfig{Name: "closed", Type: "tls", Host: "127.0.0.1", Port: closedPort, TimeoutSecs: 2})
+	if target.Status != "error" || target.CertExpiryDays != nil {
+		t.Errorf("Expected an error without expiry for a closed port, got %+v", target)
+	}
+}
+
+func portOf(t *testing.T, url string) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(url[len("https://"):])
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", url, err)
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// newTestCertificate returns a self-signed certificate for 127.0.0.1
+func newTestCertificate(t *testing.T, notAfter time.Time) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vstats test"},
+		NotBefore:    notAfter.Add(-30 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
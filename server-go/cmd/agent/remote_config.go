@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Remote Configuration
+// ============================================================================
+
+// Limits for settings received from the server; values outside them are
+// ignored and reported back in the acknowledgement
+const (
+	minIntervalSecs    = 1
+	maxIntervalSecs    = 3600
+	minOfflineRecords  = 100
+	minAggregationSecs = 10
+	minBatchSize       = 1
+	maxBatchSize       = 1000
+)
+
+// applySettings applies effective settings to the collector and local store
+func (wsc *WebSocketClient) applySettings(settings AgentSettings) {
+	wsc.settingsMu.Lock()
+	wsc.settings = settings
+	wsc.settingsMu.Unlock()
+
+	wsc.collector.SetInterval(settings.IntervalSecs)
+	wsc.collector.SetCollectors(settings.Collectors)
+	if wsc.store != nil {
+		wsc.store.SetLimits(settings.MaxOfflineRecords, time.Duration(settings.AggregationSecs)*time.Second)
+	}
+}
+
+// applyRemoteConfig merges the settings sent by the server over the config
+// file and acknowledges the applied version. Settings the server no longer
+// sends fall back to the config file.
+func (wsc *WebSocketClient) applyRemoteConfig(remote *RemoteAgentConfig) {
+	if remote == nil {
+		return
+	}
+
+	settings := wsc.config.Settings()
+	override, problems := validateSettings(remote.AgentSettings)
+	settings.Merge(override)
+	wsc.applySettings(settings)
+
+	ack := ConfigAckMessage{Type: "config_ack", ConfigVersion: remote.Version}
+	if len(problems) > 0 {
+		ack.Error = strings.Join(problems, "; ")
+		log.Printf("Applied remote config %s, ignored: %s", remote.Version, ack.Error)
+	} else {
+		log.Printf("Applied remote config %s (interval=%ds)", remote.Version, settings.IntervalSecs)
+	}
+
+	select {
+	case wsc.configAcks <- ack:
+	default:
+		// A newer config is already waiting to be acknowledged
+	}
+}
+
+// validateSettings drops the settings that are out of range
+func validateSettings(s AgentSettings) (AgentSettings, []string) {
+	var problems []string
+	if s.IntervalSecs != 0 && (s.IntervalSecs < minIntervalSecs || s.IntervalSecs > maxIntervalSecs) {
+		problems = append(problems, fmt.Sprintf("interval_secs %d out of range", s.IntervalSecs))
+		s.IntervalSecs = 0
+	}
+	if s.MaxOfflineRecords != 0 && s.MaxOfflineRecords < minOfflineRecords {
+		problems = append(problems, fmt.Sprintf("max_offline_records %d below %d", s.MaxOfflineRecords, minOfflineRecords))
+		s.MaxOfflineRecords = 0
+	}
+	if s.AggregationSecs != 0 && s.AggregationSecs < minAggregationSecs {
+		problems = append(problems, fmt.Sprintf("aggregation_secs %d below %d", s.AggregationSecs, minAggregationSecs))
+		s.AggregationSecs = 0
+	}
+	if s.BatchSize != 0 && (s.BatchSize < minBatchSize || s.BatchSize > maxBatchSize) {
+		problems = append(problems, fmt.Sprintf("batch_size %d out of range", s.BatchSize))
+		s.BatchSize = 0
+	}
+	return s, problems
+}
+
+// interval returns the current metrics interval
+func (wsc *WebSocketClient) interval() time.Duration {
+	wsc.settingsMu.RLock()
+	defer wsc.settingsMu.RUnlock()
+	if wsc.settings.IntervalSecs == 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(wsc.settings.IntervalSecs) * time.Second
+}
+
+// batchSize returns the current number of metrics per offline sync batch
+func (wsc *WebSocketClient) batchSize() int {
+	wsc.settingsMu.RLock()
+	defer wsc.settingsMu.RUnlock()
+	if wsc.settings.BatchSize <= 0 {
+		return 100
+	}
+	return wsc.settings.BatchSize
+}
@@ -849,6 +849,19 @@ func aggregateMetricsList(metrics []*SystemMetrics) *AggregatedMetrics {
 	return agg
 }
 
+// SetLimits changes the offline record limit and the age at which raw
+// metrics are aggregated; zero values keep the current setting
+func (s *LocalStore) SetLimits(maxRecords int, aggregation time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxRecords > 0 {
+		s.maxRecords = maxRecords
+	}
+	if aggregation > 0 {
+		s.aggregation = aggregation
+	}
+}
+
 // cleanupLoop periodically cleans up old data
 func (s *LocalStore) cleanupLoop() {
 	ticker := time.NewTicker(5 * time.Minute)
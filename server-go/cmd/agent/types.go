@@ -16,6 +16,7 @@ type NetworkInterface = common.NetworkInterface
 type LoadAverage = common.LoadAverage
 type PingMetrics = common.PingMetrics
 type PingTarget = common.PingTarget
+type ProbeTimings = common.ProbeTimings
 type PingTargetConfig = common.PingTargetConfig
 type GPUMetrics = common.GPUMetrics
 type GPU = common.GPU
@@ -25,6 +26,12 @@ type ServerResponse = common.ServerResponse
 type RegisterRequest = common.RegisterRequest
 type RegisterResponse = common.RegisterResponse
 type TrafficConfig = common.TrafficConfig
+type AgentUpdateStatus = common.AgentUpdateStatus
+type UpdateStatusMessage = common.UpdateStatusMessage
+type AgentSettings = common.AgentSettings
+type CollectorSettings = common.CollectorSettings
+type RemoteAgentConfig = common.RemoteAgentConfig
+type ConfigAckMessage = common.ConfigAckMessage
 
 // Batch metrics types for offline sync
 type BatchMetricsMessage = common.BatchMetricsMessage
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// TestReleaseFile tests picking the binary of a manifest
+func TestReleaseFile(t *testing.T) {
+	manifest := &common.ReleaseManifest{Version: "v1.2.3", Files: map[string]common.ReleaseFile{
+		"linux-amd64": {Name: "vstats-agent-linux-amd64"},
+	}}
+
+	tests := []struct {
+		name      string
+		requested string
+		platform  string
+		valid     bool
+	}{
+		{"latest", "", "linux-amd64", true},
+		{"requested version", "1.2.3", "linux-amd64", true},
+		{"requested tag", "v1.2.3", "linux-amd64", true},
+		{"other version", "1.3.0", "linux-amd64", false},
+		{"downgrade", "1.2.4", "linux-amd64", false},
+		{"unknown platform", "", "plan9-386", false},
+	}
+	for _, tt := range tests {
+		file, err := releaseFile(manifest, tt.requested, tt.platform)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+			continue
+		}
+		if tt.valid && file.Name != "vstats-agent-linux-amd64" {
+			t.Errorf("%s: unexpected file %+v", tt.name, file)
+		}
+	}
+}
+
+// TestFetchManifest tests downloading and verifying a manifest
+func TestFetchManifest(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	data, _ := json.Marshal(common.ReleaseManifest{Version: "1.2.3", Files: map[string]common.ReleaseFile{"linux-amd64": {Name: "a"}}})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json", "/unsigned.json":
+			w.Write(data)
+		case "/manifest.json.sig":
+			w.Write([]byte(common.SignManifest(data, private)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if manifest, err := fetchManifest(server.URL+"/manifest.json", []ed25519.PublicKey{public}); err != nil || manifest.Version != "1.2.3" {
+		t.Errorf("Expected the manifest, got %+v (%v)", manifest, err)
+	}
+	if _, err := fetchManifest(server.URL+"/manifest.json", []ed25519.PublicKey{other}); err == nil {
+		t.Error("Expected a manifest signed with another key to be rejected")
+	}
+	if _, err := fetchManifest(server.URL+"/unsigned.json", []ed25519.PublicKey{public}); err == nil {
+		t.Error("Expected a manifest without signature to be rejected")
+	}
+}
+
+// TestDownloadVerified tests checking downloads against the manifest
+func TestDownloadVerified(t *testing.T) {
+	binary := []byte("new agent binary")
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(binary)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		path  string
+		file  common.ReleaseFile
+		valid bool
+	}{
+		{"valid", "/agent", common.ReleaseFile{SHA256: checksum, Size: int64(len(binary))}, true},
+		{"sha mismatch", "/agent", common.ReleaseFile{SHA256: hex.EncodeToString(make([]byte, sha256.Size)), Size: int64(len(binary))}, false},
+		{"size mismatch", "/agent", common.ReleaseFile{SHA256: checksum, Size: 4}, false},
+		{"larger than listed", "/agent", common.ReleaseFile{SHA256: checksum, Size: int64(len(binary)) + 1}, false},
+		{"invalid checksum", "/agent", common.ReleaseFile{SHA256: "xyz", Size: int64(len(binary))}, false},
+		{"not found", "/missing", common.ReleaseFile{SHA256: checksum, Size: int64(len(binary))}, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "vstats-agent.new")
+		err := downloadVerified(server.URL+tt.path, path, tt.file)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+			continue
+		}
+		data, readErr := os.ReadFile(path)
+		if tt.valid && string(data) != string(binary) {
+			t.Errorf("%s: expected the binary at %s, got %q (%v)", tt.name, path, data, readErr)
+		}
+		if !tt.valid && !os.IsNotExist(readErr) {
+			t.Errorf("%s: expected nothing left at %s", tt.name, path)
+		}
+	}
+}
+
+// TestCheckUpdate tests the supervisor rolling back updates that missed the
+// deadline or kept restarting
+func TestCheckUpdate(t *testing.T) {
+	startedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	setup := func(t *testing.T, state *updateState) string {
+		t.Helper()
+		exe := filepath.Join(t.TempDir(), "vstats-agent")
+		os.WriteFile(exe, []byte("new"), 0755)
+		os.WriteFile(exe+".bak", []byte("old"), 0755)
+		if state != nil {
+			if err := writeUpdateState(exe, state); err != nil {
+				t.Fatalf("Failed to write state: %v", err)
+			}
+		}
+		return exe
+	}
+	restarting := func(boots int) *updateState {
+		return &updateState{Status: common.UpdateRestarting, FromVersion: "1.0.0", ToVersion: "1.1.0", Boots: boots, StartedAt: startedAt, Supervised: true}
+	}
+
+	tests := []struct {
+		name       string
+		state      *updateState
+		boot       bool
+		now        time.Time
+		rolledBack bool
+		boots      int // Recorded starts when not rolled back
+	}{
+		{"no update", nil, true, startedAt, false, 0},
+		{"first start", restarting(0), true, startedAt.Add(5 * time.Second), false, 1},
+		{"within the deadline", restarting(1), false, startedAt.Add(UpdateHealthDeadline - time.Second), false, 1},
+		{"deadline missed", restarting(1), false, startedAt.Add(UpdateHealthDeadline), true, 0},
+		{"start after the deadline", restarting(1), true, startedAt.Add(time.Hour), true, 0},
+		{"last allowed start", restarting(updateMaxBoots - 1), true, startedAt.Add(time.Minute), false, updateMaxBoots},
+		{"crash loop", restarting(updateMaxBoots), true, startedAt.Add(time.Minute), true, 0},
+		{"already rolled back", &updateState{Status: common.UpdateRolledBack, StartedAt: startedAt}, false, startedAt.Add(time.Hour), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exe := setup(t, tt.state)
+			rolledBack, err := checkUpdate(exe, tt.boot, tt.now)
+			if err != nil {
+				t.Fatalf("checkUpdate failed: %v", err)
+			}
+			if rolledBack != tt.rolledBack {
+				t.Fatalf("Expected rolledBack=%v, got %v", tt.rolledBack, rolledBack)
+			}
+
+			current, _ := os.ReadFile(exe)
+			state, _ := readUpdateState(exe)
+			if !tt.rolledBack {
+				if string(current) != "new" {
+					t.Errorf("Expected the new version to stay, got %q", current)
+				}
+				if tt.state != nil && tt.state.Status == common.UpdateRestarting && state.Boots != tt.boots {
+					t.Errorf("Expected %d starts recorded, got %d", tt.boots, state.Boots)
+				}
+				return
+			}
+
+			failed, _ := os.ReadFile(exe + ".failed")
+			if string(current) != "old" || string(failed) != "new" {
+				t.Errorf("Expected the backup restored and the new version kept as .failed, got %q and %q", current, failed)
+			}
+			if _, err := os.Stat(exe + ".bak"); !os.IsNotExist(err) {
+				t.Error("Expected the backup to be moved back")
+			}
+			if state == nil || state.Status != common.UpdateRolledBack || state.Error == "" {
+				t.Errorf("Expected the rollback to be recorded for the old version, got %+v", state)
+			}
+
+			// Later checks leave the restored version alone
+			if again, _ := checkUpdate(exe, true, tt.now.Add(time.Hour)); again {
+				t.Error("Expected no second rollback")
+			}
+		})
+	}
+
+	t.Run("missing backup", func(t *testing.T) {
+		exe := setup(t, restarting(0))
+		os.Remove(exe + ".bak")
+		if _, err := checkUpdate(exe, false, startedAt.Add(time.Hour)); err == nil {
+			t.Error("Expected an error without a backup")
+		}
+		if state, _ := readUpdateState(exe); state != nil {
+			t.Errorf("Expected the state to be dropped, got %+v", state)
+		}
+	})
+}
@@ -3,14 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
-	"os/exec"
-	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,12 +28,27 @@ type WebSocketClient struct {
 	connected    bool
 	connectedMu  sync.RWMutex
 	lastSentTime time.Time
+
+	// Self-update state (see update.go)
+	updating      atomic.Bool
+	updateReports chan AgentUpdateStatus
+	authenticated chan struct{} // Closed after the first successful authentication
+	authOnce      sync.Once
+
+	// Effective settings, the config file merged with the server's (see remote_config.go)
+	settings   AgentSettings
+	settingsMu sync.RWMutex
+	configAcks chan ConfigAckMessage
 }
 
 func NewWebSocketClient(config *AgentConfig) *WebSocketClient {
 	wsc := &WebSocketClient{
 		config:    config,
 		collector: NewMetricsCollector(config.IntervalSecs),
+
+		updateReports: make(chan AgentUpdateStatus, 16),
+		authenticated: make(chan struct{}),
+		configAcks:    make(chan ConfigAckMessage, 4),
 	}
 
 	// Initialize local storage if enabled
@@ -52,6 +62,11 @@ func NewWebSocketClient(config *AgentConfig) *WebSocketClient {
 		}
 	}
 
+	wsc.applySettings(config.Settings())
+
+	// Finish or report an update from the previous run
+	wsc.resumeUpdate()
+
 	return wsc
 }
 
@@ -99,10 +114,15 @@ func (wsc *WebSocketClient) Run() {
 
 // offlineCollector collects metrics and stores them locally when disconnected
 func (wsc *WebSocketClient) offlineCollector(metricsCh chan<- *SystemMetrics) {
-	ticker := time.NewTicker(time.Duration(wsc.config.IntervalSecs) * time.Second)
+	interval := wsc.interval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
+		if current := wsc.interval(); current != interval {
+			interval = current
+			ticker.Reset(interval)
+		}
 		if !wsc.isConnected() && wsc.store != nil {
 			// Collect metrics while offline and store with aggregation
 			metrics := wsc.collector.Collect()
@@ -179,6 +199,9 @@ func (wsc *WebSocketClient) connectAndRun(offlineMetricsCh chan<- *SystemMetrics
 		wsc.collector.SetTrafficConfig(response.TrafficConfig)
 	}
 
+	// Apply the settings managed on the server
+	wsc.applyRemoteConfig(response.AgentConfig)
+
 	// Store last seen timestamp from server (for deduplication)
 	if response.LastSeen != nil {
 		log.Printf("Server last seen timestamp: %s", *response.LastSeen)
@@ -192,6 +215,7 @@ func (wsc *WebSocketClient) connectAndRun(offlineMetricsCh chan<- *SystemMetrics
 	}
 
 	log.Println("Authentication successful!")
+	wsc.authOnce.Do(func() { close(wsc.authenticated) })
 
 	// Reset read deadline
 	conn.SetReadDeadline(time.Time{})
@@ -206,7 +230,8 @@ func (wsc *WebSocketClient) connectAndRun(offlineMetricsCh chan<- *SystemMetrics
 	go wsc.syncOfflineData(conn)
 
 	// Start metrics sending loop
-	metricsTicker := time.NewTicker(time.Duration(wsc.config.IntervalSecs) * time.Second)
+	interval := wsc.interval()
+	metricsTicker := time.NewTicker(interval)
 	defer metricsTicker.Stop()
 
 	pingTicker := time.NewTicker(PingInterval)
@@ -249,14 +274,17 @@ func (wsc *WebSocketClient) connectAndRun(offlineMetricsCh chan<- *SystemMetrics
 					} else {
 						log.Println("Received update command from server")
 					}
-					wsc.handleUpdateCommand(response.DownloadURL, response.Force)
+					go wsc.handleUpdateCommand(response)
 				}
 			case "config":
 				// Handle runtime config update (e.g., ping targets, traffic config)
+				if response.AgentConfig != nil {
+					wsc.applyRemoteConfig(response.AgentConfig)
+				}
 				if len(response.PingTargets) > 0 {
 					log.Printf("Received updated ping targets from server: %d targets", len(response.PingTargets))
 					wsc.collector.SetPingTargets(response.PingTargets)
-				} else if response.TrafficConfig == nil {
+				} else if response.TrafficConfig == nil && response.AgentConfig == nil {
 					// Only clear ping targets if this is a ping-only config update
 					log.Println("Received config update: clearing ping targets")
 					wsc.collector.SetPingTargets(nil)
@@ -276,6 +304,10 @@ func (wsc *WebSocketClient) connectAndRun(offlineMetricsCh chan<- *SystemMetrics
 	for {
 		select {
 		case <-metricsTicker.C:
+			if current := wsc.interval(); current != interval {
+				interval = current
+				metricsTicker.Reset(interval)
+			}
 			metrics := wsc.collector.Collect()
 			
 			// Store metrics with aggregation locally
@@ -308,6 +340,26 @@ func (wsc *WebSocketClient) connectAndRun(offlineMetricsCh chan<- *SystemMetrics
 				return fmt.Errorf("failed to send ping: %w", err)
 			}
 
+		case update := <-wsc.updateReports:
+			data, err := json.Marshal(UpdateStatusMessage{Type: "update_status", Update: update})
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				// Report it again after reconnecting
+				wsc.reportUpdate(update)
+				return fmt.Errorf("failed to send update status: %w", err)
+			}
+
+		case ack := <-wsc.configAcks:
+			data, err := json.Marshal(ack)
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return fmt.Errorf("failed to send config ack: %w", err)
+			}
+
 		case err := <-done:
 			return err
 		}
@@ -412,10 +464,7 @@ func (wsc *WebSocketClient) syncOfflineData(conn *websocket.Conn) {
 	log.Printf("Syncing %d offline metrics to server...", pendingCount)
 
 	// Send in batches
-	batchSize := wsc.config.BatchSize
-	if batchSize <= 0 {
-		batchSize = 100
-	}
+	batchSize := wsc.batchSize()
 
 	for wsc.isConnected() {
 		// Get pending metrics
@@ -510,194 +559,3 @@ func (wsc *WebSocketClient) syncOfflineData(conn *websocket.Conn) {
 		log.Println("Offline sync complete")
 	}
 }
-
-func (wsc *WebSocketClient) handleUpdateCommand(downloadURL string, force bool) {
-	if force {
-		log.Println("Starting FORCE self-update process (will update regardless of version)...")
-	} else {
-		log.Println("Starting self-update process...")
-	}
-
-	// Get the current executable path
-	currentExe, err := os.Executable()
-	if err != nil {
-		log.Printf("Failed to get current executable path: %v", err)
-		return
-	}
-
-	// Determine download URL and check version
-	url := downloadURL
-	var latestVersion string
-	if url == "" {
-		// Build GitHub Releases URL based on OS and architecture
-		osName := runtime.GOOS
-		arch := runtime.GOARCH
-		
-		// Map Go architecture names to release naming
-		if arch == "amd64" {
-			arch = "amd64"
-		} else if arch == "arm64" {
-			arch = "arm64"
-		} else if arch == "386" {
-			arch = "386"
-		}
-		
-		// Determine binary name
-		binaryName := fmt.Sprintf("vstats-agent-%s-%s", osName, arch)
-		if osName == "windows" {
-			binaryName += ".exe"
-		}
-		
-		// Try to get latest version from GitHub API
-		latestVersion = "latest"
-		if latest, err := fetchLatestGitHubVersion("zsai001", "vstats"); err == nil && latest != nil {
-			latestVersion = *latest
-			
-			// Skip update if already on latest version (unless force is true)
-			// Compare versions without 'v' prefix
-			latestVersionClean := strings.TrimPrefix(latestVersion, "v")
-			currentVersionClean := strings.TrimPrefix(AgentVersion, "v")
-			if !force && latestVersionClean == currentVersionClean {
-				log.Printf("Already on latest version %s, skipping update", AgentVersion)
-				return
-			}
-			log.Printf("Update available: current=%s, latest=%s", AgentVersion, latestVersion)
-		}
-		
-		// Build GitHub Releases download URL
-		url = fmt.Sprintf("https://github.com/zsai001/vstats/releases/download/%s/%s", latestVersion, binaryName)
-		log.Printf("No download URL provided, using GitHub Releases: %s", url)
-	} else {
-		log.Printf("Using provided download URL: %s", url)
-	}
-	
-	if force {
-		log.Printf("Force update enabled, current version: %s", AgentVersion)
-	}
-
-	log.Printf("Downloading update from: %s", url)
-
-	// Download to a temporary file
-	tempPath := currentExe + ".new"
-
-	if err := downloadFile(url, tempPath); err != nil {
-		log.Printf("Failed to download update: %v", err)
-		return
-	}
-
-	log.Println("Download complete, applying update...")
-
-	// On Unix, set execute permissions
-	if runtime.GOOS != "windows" {
-		if err := os.Chmod(tempPath, 0755); err != nil {
-			log.Printf("Failed to set permissions: %v", err)
-			os.Remove(tempPath)
-			return
-		}
-	}
-
-	// Backup current executable
-	backupPath := currentExe + ".backup"
-	if err := os.Rename(currentExe, backupPath); err != nil {
-		log.Printf("Failed to backup current executable: %v", err)
-		os.Remove(tempPath)
-		return
-	}
-
-	// Move new executable to current path
-	if err := os.Rename(tempPath, currentExe); err != nil {
-		log.Printf("Failed to install new executable: %v", err)
-		// Try to restore backup
-		os.Rename(backupPath, currentExe)
-		return
-	}
-
-	// Remove backup
-	os.Remove(backupPath)
-
-	log.Println("Update installed successfully! Restarting...")
-
-	// Restart the agent using systemd-run to avoid being killed by cgroup
-	if runtime.GOOS == "linux" {
-		// Use systemd-run --no-block to run restart in an independent transient unit
-		// This prevents the restart command from being killed when vstats-agent stops
-		cmd := exec.Command("systemd-run", "--no-block", "systemctl", "restart", "vstats-agent")
-		if err := cmd.Start(); err != nil {
-			log.Printf("Failed to schedule restart via systemd-run: %v", err)
-			// Fallback to direct systemctl (may not work in all cases)
-			exec.Command("systemctl", "restart", "vstats-agent").Start()
-		} else {
-			log.Println("Restart scheduled via systemd-run")
-		}
-	} else if runtime.GOOS == "windows" {
-		// On Windows, use sc.exe to restart the service
-		cmd := exec.Command("cmd", "/C", "sc", "stop", "vstats-agent", "&&", "timeout", "/t", "2", "&&", "sc", "start", "vstats-agent")
-		cmd.Start()
-	}
-
-	// Give systemd-run a moment to register the restart command
-	time.Sleep(500 * time.Millisecond)
-
-	// Exit to allow restart
-	os.Exit(0)
-}
-
-// downloadFile downloads a file from URL to path
-func downloadFile(url, path string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
-	}
-
-	out, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		os.Remove(path)
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	return nil
-}
-
-// fetchLatestGitHubVersion fetches the latest release version from GitHub
-func fetchLatestGitHubVersion(owner, repo string) (*string, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", owner, repo)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("User-Agent", "vstats-agent")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API returned status: %d", resp.StatusCode)
-	}
-
-	body, _ := io.ReadAll(resp.Body)
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	tagName, ok := result["tag_name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("no tag_name in response")
-	}
-
-	// Keep the original tag name (with 'v' prefix) for download URL
-	return &tagName, nil
-}
@@ -0,0 +1,144 @@
+// Command release-manifest writes the signed agent release manifest that
+// agents verify before installing a self-update.
+//
+//	release-manifest -genkey
+//	VSTATS_RELEASE_KEY=<private key> release-manifest -version 1.2.3 -out release release/vstats-agent-*
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vstats/internal/common"
+)
+
+// KeyEnv holds the base64 ed25519 private key (or its 32-byte seed)
+const KeyEnv = "VSTATS_RELEASE_KEY"
+
+func main() {
+	genkey := flag.Bool("genkey", false, "print a new signing key pair and exit")
+	version := flag.String("version", "", "release version")
+	out := flag.String("out", ".", "directory to write the manifest and signature to")
+	flag.Parse()
+
+	if *genkey {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("public key (main.UpdatePublicKeys): %s\n", base64.StdEncoding.EncodeToString(public))
+		fmt.Printf("private key (%s): %s\n", KeyEnv, base64.StdEncoding.EncodeToString(private))
+		return
+	}
+
+	if *version == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: release-manifest -version <version> [-out dir] <agent binaries...>")
+		os.Exit(2)
+	}
+	key, err := loadKey(os.Getenv(KeyEnv))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	path, manifest, err := writeManifest(*version, *out, flag.Args(), key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Signed %s with %d binaries\n", path, len(manifest.Files))
+}
+
+// writeManifest describes the binaries, writes the manifest to dir and signs
+// it. Returns the path of the manifest.
+func writeManifest(version, dir string, binaries []string, key ed25519.PrivateKey) (string, *common.ReleaseManifest, error) {
+	manifest := &common.ReleaseManifest{Version: version, Files: make(map[string]common.ReleaseFile)}
+	for _, path := range binaries {
+		platform, ok := platformOf(filepath.Base(path))
+		if !ok {
+			return "", nil, fmt.Errorf("%s is not named vstats-agent-<os>-<arch>", path)
+		}
+		if _, dup := manifest.Files[platform]; dup {
+			return "", nil, fmt.Errorf("%s: more than one binary for %s", path, platform)
+		}
+		file, err := describe(path)
+		if err != nil {
+			return "", nil, err
+		}
+		manifest.Files[platform] = file
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, common.AgentManifestName)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(path+".sig", []byte(common.SignManifest(data, key)+"\n"), 0644); err != nil {
+		return "", nil, err
+	}
+	return path, manifest, nil
+}
+
+// loadKey decodes a base64 private key or seed
+func loadKey(s string) (ed25519.PrivateKey, error) {
+	if s == "" {
+		return nil, fmt.Errorf("%s is not set", KeyEnv)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", KeyEnv, err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, fmt.Errorf("invalid %s: unexpected key length %d", KeyEnv, len(raw))
+}
+
+// platformOf returns the platform key of a vstats-agent-<os>-<arch>[.exe] file
+func platformOf(name string) (string, bool) {
+	name = strings.TrimSuffix(name, ".exe")
+	rest, ok := strings.CutPrefix(name, "vstats-agent-")
+	if !ok {
+		return "", false
+	}
+	goos, goarch, ok := strings.Cut(rest, "-")
+	if !ok || goos == "" || goarch == "" {
+		return "", false
+	}
+	return common.PlatformKey(goos, goarch), true
+}
+
+// describe hashes a binary
+func describe(path string) (common.ReleaseFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return common.ReleaseFile{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return common.ReleaseFile{}, err
+	}
+	return common.ReleaseFile{
+		Name:   filepath.Base(path),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+		Size:   size,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vstats/internal/common"
+)
+
+// TestPlatformOf tests reading the platform from binary names
+func TestPlatformOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		ok       bool
+	}{
+		{"vstats-agent-linux-amd64", "linux-amd64", true},
+		{"vstats-agent-windows-arm64.exe", "windows-arm64", true},
+		{"vstats-agent-linux", "", false},
+		{"vstats-agent--amd64", "", false},
+		{"vstats-server-linux-amd64", "", false},
+	}
+	for _, tt := range tests {
+		platform, ok := platformOf(tt.name)
+		if ok != tt.ok || platform != tt.platform {
+			t.Errorf("%s: expected %q (%v), got %q (%v)", tt.name, tt.platform, tt.ok, platform, ok)
+		}
+	}
+}
+
+// TestLoadKey tests decoding the signing key
+func TestLoadKey(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"private key", base64.StdEncoding.EncodeToString(private), true},
+		{"seed", base64.StdEncoding.EncodeToString(private.Seed()) + "\n", true},
+		{"unset", "", false},
+		{"not base64", "not a key", false},
+		{"wrong length", base64.StdEncoding.EncodeToString([]byte("short")), false},
+	}
+	for _, tt := range tests {
+		key, err := loadKey(tt.input)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+			continue
+		}
+		if tt.valid && !key.Equal(private) {
+			t.Errorf("%s: expected the generated key", tt.name)
+		}
+	}
+}
+
+// TestWriteManifest tests that agents accept the manifests written by the tool
+func TestWriteManifest(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	dir := t.TempDir()
+	binaries := map[string]string{
+		"vstats-agent-linux-amd64":       "linux binary",
+		"vstats-agent-windows-amd64.exe": "windows binary",
+	}
+	var paths []string
+	for name, content := range binaries {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0755)
+		paths = append(paths, path)
+	}
+
+	out := t.TempDir()
+	path, _, err := writeManifest("1.2.3", out, paths, private)
+	if err != nil {
+		t.Fatalf("writeManifest failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	signature, _ := os.ReadFile(path + ".sig")
+
+	manifest, err := common.VerifyManifest(data, string(signature), []ed25519.PublicKey{public})
+	if err != nil {
+		t.Fatalf("Expected the manifest to verify, got %v", err)
+	}
+	sum := sha256.Sum256([]byte("linux binary"))
+	file := manifest.Files["linux-amd64"]
+	if manifest.Version != "1.2.3" || len(manifest.Files) != 2 || file.Name != "vstats-agent-linux-amd64" ||
+		file.SHA256 != hex.EncodeToString(sum[:]) || file.Size != int64(len("linux binary")) {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	if _, err := common.VerifyManifest(data, string(signature), []ed25519.PublicKey{other}); err == nil {
+		t.Error("Expected the manifest to be rejected with another key")
+	}
+
+	invalid := [][]string{
+		{filepath.Join(dir, "agent.bin")},
+		{filepath.Join(dir, "vstats-agent-linux-arm64")}, // Missing
+		{paths[0], paths[0]},                             // Same platform twice
+	}
+	for _, binaries := range invalid {
+		if _, _, err := writeManifest("1.2.3", t.TempDir(), binaries, private); err == nil {
+			t.Errorf("Expected an error for %v", binaries)
+		}
+	}
+}
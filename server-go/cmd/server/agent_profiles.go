@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"vstats/internal/common"
+
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Agent Config Profiles
+// ============================================================================
+
+// AgentProfile holds agent settings for a set of servers. A profile without
+// servers or dimensions applies to every agent; otherwise the server must be
+// listed (when servers are set) and match every dimension option.
+type AgentProfile struct {
+	ID         string               `json:"id"`
+	Name       string               `json:"name"`
+	Servers    []string             `json:"servers,omitempty"`
+	Dimensions map[string]string    `json:"dimensions,omitempty"` // Dimension key or id -> option id or name
+	Settings   common.AgentSettings `json:"settings"`
+}
+
+// level orders profiles from general to specific: profiles for all
+// servers, then per-dimension, then per-server
+func (p AgentProfile) level() int {
+	switch {
+	case len(p.Servers) > 0:
+		return 2
+	case len(p.Dimensions) > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Matches reports whether the profile applies to a server
+func (p AgentProfile) Matches(server RemoteServer, dimensions []GroupDimension) bool {
+	return ruleSelectsServer(CustomAlertRule{Servers: p.Servers, Selector: p.Dimensions}, server, dimensions)
+}
+
+// validateAgentProfiles checks the profiles and fills in missing IDs
+func validateAgentProfiles(profiles []AgentProfile) error {
+	seen := make(map[string]bool)
+	for i := range profiles {
+		p := &profiles[i]
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			return fmt.Errorf("profile %d: name is required", i+1)
+		}
+		if p.ID == "" {
+			p.ID = uuid.New().String()
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("profile %s: duplicate id", p.Name)
+		}
+		seen[p.ID] = true
+
+		s := p.Settings
+		if s.IntervalSecs != 0 && (s.IntervalSecs < 1 || s.IntervalSecs > 3600) {
+			return fmt.Errorf("profile %s: interval_secs must be between 1 and 3600", p.Name)
+		}
+		if s.BatchSize != 0 && (s.BatchSize < 1 || s.BatchSize > 1000) {
+			return fmt.Errorf("profile %s: batch_size must be between 1 and 1000", p.Name)
+		}
+		if s.AggregationSecs != 0 && s.AggregationSecs < 10 {
+			return fmt.Errorf("profile %s: aggregation_secs must be at least 10", p.Name)
+		}
+		if s.MaxOfflineRecords != 0 && s.MaxOfflineRecords < 100 {
+			return fmt.Errorf("profile %s: max_offline_records must be at least 100", p.Name)
+		}
+	}
+	return nil
+}
+
+// matchingProfiles returns the profiles applying to a server, in the
+// order they are merged
+func matchingProfiles(cfg *AppConfig, server RemoteServer) []AgentProfile {
+	var matched []AgentProfile
+	for level := 0; level <= 2; level++ {
+		for _, p := range cfg.AgentProfiles {
+			if p.level() == level && p.Matches(server, cfg.GroupDimensions) {
+				matched = append(matched, p)
+			}
+		}
+	}
+	return matched
+}
+
+// agentConfigFor returns the effective remote config of a server. It is
+// sent even when no profile matches, so that agents drop settings of
+// removed profiles.
+func agentConfigFor(cfg *AppConfig, server RemoteServer) *common.RemoteAgentConfig {
+	var settings common.AgentSettings
+	for _, p := range matchingProfiles(cfg, server) {
+		settings.Merge(p.Settings)
+	}
+	return &common.RemoteAgentConfig{Version: settings.Version(), AgentSettings: settings}
+}
+
+// PushAgentConfigs sends the effective config to every agent that has not
+// applied it yet. Must be called without holding ConfigMu.
+func (s *AppState) PushAgentConfigs() {
+	s.sendAgentConfigs(s.SendToAgent)
+}
+
+// sendAgentConfigs builds the configs that agents have not applied yet and
+// hands them to send
+func (s *AppState) sendAgentConfigs(send func(serverID string, data []byte) error) {
+	acks := loadAgentConfigAcks()
+	messages := make(map[string][]byte)
+	s.ConfigMu.RLock()
+	for _, server := range s.Config.Servers {
+		config := agentConfigFor(s.Config, server)
+		if config.Version == acks[server.ID].Version {
+			continue
+		}
+		msg := map[string]interface{}{
+			"type":         "config",
+			"agent_config": config,
+		}
+		// Older agents treat a config message without ping targets as clearing them
+		if targets := pingTargetsFor(s.Config, server); len(targets) > 0 {
+			msg["ping_targets"] = targets
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		messages[server.ID] = data
+	}
+	s.ConfigMu.RUnlock()
+
+	for serverID, data := range messages {
+		if err := send(serverID, data); err == nil {
+			log.Printf("Sent agent config to %s", serverID)
+		} else if err != ErrAgentNotConnected {
+			log.Printf("Failed to send agent config to %s: %v", serverID, err)
+		}
+	}
+}
+
+// loadAgentConfigAcks returns the config versions the agents applied. On
+// errors it returns none, so that every agent is sent its config again.
+func loadAgentConfigAcks() map[string]agentConfigAck {
+	if dbWriter == nil {
+		return nil
+	}
+	acks, err := getAgentConfigAcks(dbWriter.GetDB())
+	if err != nil {
+		log.Printf("Failed to load agent config acks: %v", err)
+		return nil
+	}
+	return acks
+}
+
+// recordConfigAck records the config version an agent applied
+func (s *AppState) recordConfigAck(serverID, version, errMsg string) {
+	if errMsg != "" {
+		log.Printf("Agent %s applied config %s with errors: %s", serverID, version, errMsg)
+	}
+	if dbWriter == nil {
+		return
+	}
+	err := dbWriter.WriteSync(func(db *sql.DB) error {
+		return saveAgentConfigAck(db, serverID, agentConfigAck{Version: version, Error: errMsg})
+	})
+	if err != nil {
+		log.Printf("Failed to record config ack of %s: %v", serverID, err)
+	}
+}
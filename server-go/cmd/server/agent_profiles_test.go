@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vstats/internal/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAgentConfigFor tests merging the profiles that apply to a server
+func TestAgentConfigFor(t *testing.T) {
+	off := false
+	cfg := &AppConfig{
+		GroupDimensions: []GroupDimension{{ID: "d1", Key: "region", Options: []GroupOption{{ID: "o1", Name: "Asia"}}}},
+		Servers: []RemoteServer{
+			{ID: "s1", GroupValues: map[string]string{"d1": "o1"}},
+			{ID: "s2"},
+		},
+		AgentProfiles: []AgentProfile{
+			// Listed from specific to general, merged from general to specific
+			{ID: "server", Name: "s1", Servers: []string{"s1"}, Settings: common.AgentSettings{IntervalSecs: 2}},
+			{ID: "asia", Name: "Asia", Dimensions: map[string]string{"region": "asia"}, Settings: common.AgentSettings{IntervalSecs: 10, BatchSize: 50, Collectors: common.CollectorSettings{GPU: &off}}},
+			{ID: "all", Name: "All", Settings: common.AgentSettings{IntervalSecs: 30, MaxOfflineRecords: 5000}},
+		},
+	}
+
+	s1 := agentConfigFor(cfg, cfg.Servers[0])
+	if s1.IntervalSecs != 2 || s1.BatchSize != 50 || s1.MaxOfflineRecords != 5000 || common.Enabled(s1.Collectors.GPU) {
+		t.Errorf("Unexpected config for s1: %+v", s1.AgentSettings)
+	}
+	s2 := agentConfigFor(cfg, cfg.Servers[1])
+	if s2.IntervalSecs != 30 || s2.BatchSize != 0 || !common.Enabled(s2.Collectors.GPU) {
+		t.Errorf("Unexpected config for s2: %+v", s2.AgentSettings)
+	}
+	if s1.Version == s2.Version || s1.Version != agentConfigFor(cfg, cfg.Servers[0]).Version {
+		t.Errorf("Expected versions to follow the settings, got %s and %s", s1.Version, s2.Version)
+	}
+
+	// Without profiles agents get an empty config to fall back to their own
+	if empty := agentConfigFor(&AppConfig{}, cfg.Servers[1]); empty.Version != (common.AgentSettings{}).Version() || empty.IntervalSecs != 0 {
+		t.Errorf("Unexpected config without profiles: %+v", empty)
+	}
+}
+
+// TestAgentProfiles tests updating profiles and pushing them to agents
+func TestAgentProfiles(t *testing.T) {
+	forEachBackend(t, testAgentProfiles)
+}
+
+func testAgentProfiles(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	state := &AppState{
+		Config: &AppConfig{Servers: []RemoteServer{
+			{ID: "s1", Name: "a", Tag: "prod"},
+			{ID: "s2", Name: "b"},
+		}},
+		AgentConns: map[string]*AgentConnection{
+			"s1": {SendChan: make(chan []byte, 10)},
+			"s2": {SendChan: make(chan []byte, 10)},
+		},
+	}
+
+	router := gin.New()
+	router.GET("/api/agent-profiles", state.GetAgentProfiles)
+	router.PUT("/api/agent-profiles", state.UpdateAgentProfiles)
+	router.GET("/api/servers/:id/agent-config", state.GetServerAgentConfig)
+	put := func(profiles []AgentProfile) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(profiles)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/agent-profiles", bytes.NewReader(data)))
+		return w
+	}
+	sent := func(id string) *common.ServerResponse {
+		select {
+		case data := <-state.AgentConns[id].SendChan:
+			var msg common.ServerResponse
+			json.Unmarshal(data, &msg)
+			return &msg
+		default:
+			return nil
+		}
+	}
+
+	invalid := [][]AgentProfile{
+		{{Name: ""}},
+		{{Name: "fast", Settings: common.AgentSettings{IntervalSecs: 7200}}},
+		{{Name: "batch", Settings: common.AgentSettings{BatchSize: 5000}}},
+		{{ID: "p", Name: "a"}, {ID: "p", Name: "b"}},
+	}
+	for _, profiles := range invalid {
+		if w := put(profiles); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %+v, got %d", http.StatusBadRequest, profiles, w.Code)
+		}
+	}
+
+	w := put([]AgentProfile{{Name: "prod", Dimensions: map[string]string{"tag": "prod"}, Settings: common.AgentSettings{IntervalSecs: 10}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var saved []AgentProfile
+	json.Unmarshal(w.Body.Bytes(), &saved)
+	if len(saved) != 1 || saved[0].ID == "" {
+		t.Fatalf("Expected the profile with an id, got %s", w.Body.String())
+	}
+
+	// Every agent gets its effective config, matching or not
+	msg := sent("s1")
+	if msg == nil || msg.Type != "config" || msg.AgentConfig == nil || msg.AgentConfig.IntervalSecs != 10 {
+		t.Fatalf("Expected the profile config for s1, got %+v", msg)
+	}
+	if other := sent("s2"); other == nil || other.AgentConfig == nil || other.AgentConfig.IntervalSecs != 0 {
+		t.Fatalf("Expected an empty config for s2, got %+v", other)
+	}
+
+	// Acknowledged configs are not sent again
+	state.recordConfigAck("s1", msg.AgentConfig.Version, "")
+	state.PushAgentConfigs()
+	if again := sent("s1"); again != nil {
+		t.Errorf("Expected no config for an agent in sync, got %+v", again)
+	}
+	if again := sent("s2"); again == nil {
+		t.Error("Expected the config again for an agent that did not acknowledge it")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/servers/s1/agent-config", nil))
+	var status AgentConfigStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if !status.InSync || len(status.Profiles) != 1 || status.Profiles[0] != saved[0].ID {
+		t.Errorf("Expected s1 to be in sync with the profile, got %s", w.Body.String())
+	}
+	state.recordConfigAck("s1", "old", "interval_secs 0 out of range")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/servers/s1/agent-config", nil))
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status.InSync || status.Error == "" {
+		t.Errorf("Expected s1 to be out of sync with an error, got %s", w.Body.String())
+	}
+
+	// Acks of deleted servers are dropped
+	if err := deleteAgentStatus(helper.db, "s1"); err != nil {
+		t.Fatalf("deleteAgentStatus failed: %v", err)
+	}
+	if acks, err := getAgentConfigAcks(helper.db); err != nil || len(acks) != 0 {
+		t.Errorf("Expected no acks left, got %+v (%v)", acks, err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/servers/missing/agent-config", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown server, got %d", http.StatusNotFound, w.Code)
+	}
+}
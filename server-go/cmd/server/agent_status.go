@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ============================================================================
+// Agent Status
+// ============================================================================
+//
+// Reports from agents are stored in their own tables rather than in
+// RemoteServer, so that they do not create config revisions.
+
+var ErrNoAgentUpdate = errors.New("no update reported")
+
+// saveAgentUpdateStatus stores the latest self-update report of an agent
+func saveAgentUpdateStatus(db *sql.DB, serverID string, update *AgentUpdateStatus) error {
+	reportedAt := update.Time
+	if reportedAt == "" {
+		reportedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	_, err := db.Exec(`
+		INSERT INTO agent_update_status (server_id, status, from_version, to_version, error, reported_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(server_id) DO UPDATE SET
+			status = excluded.status,
+			from_version = excluded.from_version,
+			to_version = excluded.to_version,
+			error = excluded.error,
+			reported_at = excluded.reported_at`,
+		serverID, update.Status, update.FromVersion, update.ToVersion, update.Error, reportedAt)
+	return err
+}
+
+// getAgentUpdateStatus returns the latest self-update report of an agent
+func getAgentUpdateStatus(db *sql.DB, serverID string) (*AgentUpdateStatus, error) {
+	var update AgentUpdateStatus
+	err := db.QueryRow(`
+		SELECT status, from_version, to_version, error, reported_at
+		FROM agent_update_status WHERE server_id = ?`, serverID,
+	).Scan(&update.Status, &update.FromVersion, &update.ToVersion, &update.Error, &update.Time)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoAgentUpdate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// agentConfigAck is the remote config version an agent last applied
+type agentConfigAck struct {
+	Version string
+	Error   string // Settings the agent could not apply
+}
+
+// saveAgentConfigAck stores the remote config version an agent applied
+func saveAgentConfigAck(db *sql.DB, serverID string, ack agentConfigAck) error {
+	_, err := db.Exec(`
+		INSERT INTO agent_config_acks (server_id, version, error, acked_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(server_id) DO UPDATE SET
+			version = excluded.version,
+			error = excluded.error,
+			acked_at = excluded.acked_at`,
+		serverID, ack.Version, ack.Error, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// getAgentConfigAcks returns the config versions the agents applied, by server
+func getAgentConfigAcks(db *sql.DB) (map[string]agentConfigAck, error) {
+	rows, err := db.Query("SELECT server_id, version, error FROM agent_config_acks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acks := make(map[string]agentConfigAck)
+	for rows.Next() {
+		var serverID string
+		var ack agentConfigAck
+		if err := rows.Scan(&serverID, &ack.Version, &ack.Error); err != nil {
+			return nil, err
+		}
+		acks[serverID] = ack
+	}
+	return acks, rows.Err()
+}
+
+// deleteAgentStatus drops the reports of a deleted server
+func deleteAgentStatus(db *sql.DB, serverID string) error {
+	if _, err := db.Exec("DELETE FROM agent_update_status WHERE server_id = ?", serverID); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM agent_config_acks WHERE server_id = ?", serverID)
+	return err
+}
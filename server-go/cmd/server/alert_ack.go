@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Alert Acknowledgement
+// ============================================================================
+//
+// Acknowledging an alert records who is handling it. It stays listed and
+// still resolves normally, but escalations and reminders stop. Notifications
+// carry a signed link in AlertEvent.AckURL so an alert can be acknowledged
+// straight from the notification.
+
+// alertAckCall changes the acknowledgement of an alert on the leader
+type alertAckCall struct {
+	AlertID string    `json:"alert_id"`
+	Ack     bool      `json:"ack"`
+	By      string    `json:"by,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// AcknowledgeAlert marks an active alert as being handled. Returns the
+// updated alert, or nil when no active alert has the ID.
+func (e *AlertEngine) AcknowledgeAlert(alertID, by, comment string) *AlertState {
+	return e.setAcknowledged(alertAckCall{AlertID: alertID, Ack: true, By: by, Comment: comment, At: time.Now()})
+}
+
+// UnacknowledgeAlert clears an alert's acknowledgement so that escalation
+// resumes
+func (e *AlertEngine) UnacknowledgeAlert(alertID string) *AlertState {
+	return e.setAcknowledged(alertAckCall{AlertID: alertID, At: time.Now()})
+}
+
+// setAcknowledged applies an acknowledgement change. Followers forward it to
+// the leader, which owns the alert state.
+func (e *AlertEngine) setAcknowledged(call alertAckCall) *AlertState {
+	if !isLeader() {
+		var alert *AlertState
+		if err := cluster.CallLeader("alerts.ack", call, &alert); err != nil {
+			fmt.Printf("⚠️ Failed to forward acknowledgement to cluster leader: %v\n", err)
+			return nil
+		}
+		if alert != nil {
+			e.ackLocal(call)
+		}
+		return alert
+	}
+
+	alert := e.ackLocal(call)
+	if alert == nil {
+		return nil
+	}
+	e.saveState()
+	return alert
+}
+
+func (e *AlertEngine) ackLocal(call alertAckCall) *AlertState {
+	e.alertsMu.Lock()
+	defer e.alertsMu.Unlock()
+
+	for _, alert := range e.activeAlerts {
+		if alert.ID != call.AlertID {
+			continue
+		}
+		if call.Ack {
+			at := call.At.UTC()
+			alert.AcknowledgedBy = call.By
+			alert.AcknowledgedAt = &at
+			alert.AckComment = call.Comment
+		} else {
+			alert.AcknowledgedBy = ""
+			alert.AcknowledgedAt = nil
+			alert.AckComment = ""
+		}
+		a := *alert
+		return &a
+	}
+	return nil
+}
+
+// awaitingAck reports whether an alert is firing and nobody acknowledged it
+func (e *AlertEngine) awaitingAck(alertID string) bool {
+	e.alertsMu.RLock()
+	defer e.alertsMu.RUnlock()
+
+	for _, alert := range e.activeAlerts {
+		if alert.ID == alertID {
+			return !alert.acknowledged()
+		}
+	}
+	return false
+}
+
+// alertAckLinkTTL is how long an acknowledge link stays valid
+const alertAckLinkTTL = 7 * 24 * time.Hour
+
+// alertAckToken signs an alert ID and the expiry of the acknowledge link.
+// The token is "<expiry unix>.<signature>".
+func alertAckToken(alertID string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + alertAckSignature(alertID, expiry)
+}
+
+func alertAckSignature(alertID, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(GetJWTSecret()))
+	mac.Write([]byte("alert-ack:" + alertID + ":" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validAlertAckToken checks a token from an acknowledge link and that it has
+// not expired at now
+func validAlertAckToken(alertID, token string, now time.Time) bool {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(alertAckSignature(alertID, expiry))) {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && now.Unix() < expires
+}
+
+// alertAckURL returns the acknowledge link for an alert
+func alertAckURL(publicURL, alertID string) string {
+	return fmt.Sprintf("%s/api/alerts/%s/ack/link?token=%s",
+		publicURL, url.PathEscape(alertID), alertAckToken(alertID, time.Now().Add(alertAckLinkTTL)))
+}
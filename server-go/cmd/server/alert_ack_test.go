@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAlertAcknowledgement tests acknowledging alerts from the API and from
+// notification links
+func TestAlertAcknowledgement(t *testing.T) {
+	forEachBackend(t, testAlertAcknowledgement)
+}
+
+func testAlertAcknowledgement(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter, oldEngine := dbWriter, alertEngine
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter, alertEngine = oldWriter, oldEngine
+	}()
+
+	var received []AlertEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload AlertEvent
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload)
+	}))
+	defer hook.Close()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.PublicURL = "https://status.example.com"
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": hook.URL}},
+		{ID: "pager", Type: "webhook", Name: "Pager", Enabled: true, Config: map[string]string{"url": "http://127.0.0.1:1"}},
+	}
+	alertConfig.Routes = []AlertRoute{{
+		ID:          "all",
+		Channels:    []string{"hook"},
+		Escalations: []RouteEscalation{{After: 10, Channels: []string{"pager"}}},
+	}}
+	state := &AppState{
+		Config:       &AppConfig{AlertConfig: &alertConfig, Servers: []RemoteServer{{ID: "s1", Name: "Tokyo"}}},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+	engine := NewAlertEngine(state, helper.db)
+	alertEngine = engine
+
+	alert := &AlertState{ID: "a1", Type: "cpu", ServerID: "s1", ServerName: "Tokyo", Severity: "critical", Status: "firing", StartedAt: time.Now(), Message: "CPU 95%"}
+	engine.activeAlerts["cpu:s1"] = alert
+	engine.notify(alert, &alertConfig)
+	engine.queue.processDue(time.Now())
+
+	if len(received) != 1 || received[0].AckURL == "" {
+		t.Fatalf("Expected the webhook to carry an acknowledge link, got %+v", received)
+	}
+	link, _ := url.Parse(received[0].AckURL)
+	if link.Host != "status.example.com" || link.Path != "/api/alerts/a1/ack/link" {
+		t.Errorf("Unexpected acknowledge link %s", link)
+	}
+
+	router := gin.New()
+	router.POST("/api/alerts/:id/ack", state.AcknowledgeAlert)
+	router.DELETE("/api/alerts/:id/ack", state.UnacknowledgeAlert)
+	router.GET("/api/alerts/:id/ack/link", state.AcknowledgeAlertLink)
+	router.POST("/api/alerts/:id/ack/link", state.AcknowledgeAlertLink)
+	request := func(method, path, accept string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Forged and missing tokens are rejected
+	if w := request("POST", "/api/alerts/a1/ack/link?token=forged", "application/json", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a forged token, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := request("POST", "/api/alerts/a1/ack/link", "application/json", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Expired links are rejected, and the expiry cannot be extended
+	expired := alertAckToken("a1", time.Now().Add(-time.Minute))
+	if w := request("GET", "/api/alerts/a1/ack/link?token="+expired, "application/json", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for an expired token, got %d", http.StatusForbidden, w.Code)
+	}
+	_, signature, _ := strings.Cut(expired, ".")
+	extended := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "." + signature
+	if w := request("GET", "/api/alerts/a1/ack/link?token="+extended, "application/json", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a token with a changed expiry, got %d", http.StatusForbidden, w.Code)
+	}
+	if expires := time.Now().Add(alertAckLinkTTL); !validAlertAckToken("a1", link.Query().Get("token"), expires.Add(-time.Minute)) ||
+		validAlertAckToken("a1", link.Query().Get("token"), expires.Add(time.Minute)) {
+		t.Error("Expected notification links to expire after alertAckLinkTTL")
+	}
+
+	// Opening the link only asks for confirmation
+	w := request("GET", link.RequestURI(), "text/html", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<form") || engine.activeAlerts["cpu:s1"].acknowledged() {
+		t.Fatalf("Expected a confirmation page without acknowledging, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("POST", link.RequestURI(), "application/json", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if a := engine.activeAlerts["cpu:s1"]; a.AcknowledgedBy != "link" || a.AcknowledgedAt == nil {
+		t.Errorf("Expected the link to acknowledge the alert, got %+v", a)
+	}
+
+	// Acknowledged alerts do not escalate
+	alert.StartedAt = time.Now().Add(-15 * time.Minute)
+	engine.processEscalations(&alertConfig)
+	if events, _, _ := ListNotifications(helper.db, NotificationFilter{ChannelID: "pager"}, 10, 0); len(events) != 0 {
+		t.Errorf("Expected no escalation for an acknowledged alert, got %+v", events)
+	}
+
+	// Clearing the acknowledgement resumes escalation
+	if w := request("DELETE", "/api/alerts/a1/ack", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	engine.processEscalations(&alertConfig)
+	if events, _, _ := ListNotifications(helper.db, NotificationFilter{ChannelID: "pager"}, 10, 0); len(events) != 1 {
+		t.Errorf("Expected the alert to escalate once unacknowledged, got %+v", events)
+	}
+
+	w = request("POST", "/api/alerts/a1/ack", "", AcknowledgeAlertRequest{Comment: "rebooting"})
+	var acked AlertState
+	json.Unmarshal(w.Body.Bytes(), &acked)
+	if w.Code != http.StatusOK || acked.AckComment != "rebooting" || acked.AcknowledgedAt == nil {
+		t.Fatalf("Expected the alert to be acknowledged, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("POST", "/api/alerts/missing/ack", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown alert, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// The acknowledgement is kept in the history
+	engine.resolveAlert("cpu:s1", &alertConfig)
+	dbWriter.WriteSync(func(db *sql.DB) error { return nil }) // Wait for queued history writes
+	var comment string
+	var acknowledgedAt sql.NullString
+	helper.db.QueryRow("SELECT ack_comment, acknowledged_at FROM alert_history WHERE alert_id = ?", "a1").Scan(&comment, &acknowledgedAt)
+	if comment != "rebooting" || !acknowledgedAt.Valid {
+		t.Errorf("Expected the acknowledgement in the history, got %q %v", comment, acknowledgedAt)
+	}
+
+	// Links for resolved alerts no longer work
+	if w := request("POST", link.RequestURI(), "application/json", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a resolved alert, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Custom Rule Alert Detection
+// ============================================================================
+
+// customAlertKey returns the active alert key of a custom rule on a server
+func customAlertKey(ruleID, serverID string) string {
+	return fmt.Sprintf("custom:%s:%s", ruleID, serverID)
+}
+
+// checkCustomAlerts evaluates the enabled custom rules against the latest
+// metrics of every online server
+func (e *AlertEngine) checkCustomAlerts(servers []serverState, config *AlertConfig) {
+	var rules []CustomAlertRule
+	compiled := make(map[string]*alertExpr)
+	for _, rule := range config.Rules.Custom {
+		if !rule.Enabled {
+			continue
+		}
+		// Rules are validated when saved; skip ones broken by hand edits
+		expr, err := compileAlertExpr(rule.Expr)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+		compiled[rule.ID] = expr
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	e.state.ConfigMu.RLock()
+	remotes := make(map[string]RemoteServer, len(e.state.Config.Servers))
+	for _, server := range e.state.Config.Servers {
+		remotes[server.ID] = server
+	}
+	dimensions := e.state.Config.GroupDimensions
+	e.state.ConfigMu.RUnlock()
+
+	envs := make(map[string]map[string]interface{})
+	e.state.AgentMetricsMu.RLock()
+	for _, server := range servers {
+		if metrics, ok := e.state.AgentMetrics[server.ID]; ok && server.Online {
+			envs[server.ID] = metricsEnv(&metrics.Metrics)
+		}
+	}
+	e.state.AgentMetricsMu.RUnlock()
+
+	for _, rule := range rules {
+		for _, server := range servers {
+			alertKey := customAlertKey(rule.ID, server.ID)
+			if !ruleSelectsServer(rule, remotes[server.ID], dimensions) {
+				e.clearCustomAlert(alertKey, config)
+				continue
+			}
+			// Offline servers keep their state; the offline rule covers them
+			env, ok := envs[server.ID]
+			if !ok {
+				continue
+			}
+
+			result, err := compiled[rule.ID].Eval(env)
+			if err != nil || !result.Matched {
+				e.clearCustomAlert(alertKey, config)
+				continue
+			}
+			e.fireCustomAlert(alertKey, rule, server, result, config)
+		}
+	}
+}
+
+// clearCustomAlert resets the pending duration of a custom rule and resolves
+// its alert
+func (e *AlertEngine) clearCustomAlert(alertKey string, config *AlertConfig) {
+	e.thresholdMu.Lock()
+	delete(e.thresholdState, alertKey)
+	e.thresholdMu.Unlock()
+
+	e.alertsMu.RLock()
+	existing := e.activeAlerts[alertKey]
+	e.alertsMu.RUnlock()
+
+	if existing != nil {
+		e.resolveAlert(alertKey, config)
+	}
+}
+
+// fireCustomAlert raises or updates the alert of a custom rule whose
+// expression holds, once it has held for the rule's duration
+func (e *AlertEngine) fireCustomAlert(alertKey string, rule CustomAlertRule, server serverState, result exprResult, config *AlertConfig) {
+	severity := rule.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+
+	e.thresholdMu.Lock()
+	check := e.thresholdState[alertKey]
+	if check == nil {
+		check = &thresholdCheck{startTime: time.Now(), severity: severity}
+		e.thresholdState[alertKey] = check
+	}
+	check.value = result.Value
+	pending := time.Since(check.startTime) < time.Duration(rule.For)*time.Second
+	e.thresholdMu.Unlock()
+
+	if pending {
+		return
+	}
+
+	message := rule.Message
+	if message == "" {
+		message = fmt.Sprintf("服务器 %s 触发规则 %s", server.Name, rule.Name)
+	}
+
+	e.alertsMu.RLock()
+	existing := e.activeAlerts[alertKey]
+	e.alertsMu.RUnlock()
+
+	if existing == nil {
+		if !e.checkCooldown(alertKey, rule.Cooldown) {
+			return
+		}
+		alert := &AlertState{
+			ID:         GenerateRandomString(16),
+			Type:       "custom",
+			RuleID:     rule.ID,
+			RuleName:   rule.Name,
+			ServerID:   server.ID,
+			ServerName: server.Name,
+			Severity:   severity,
+			Status:     "firing",
+			Value:      result.Value,
+			Threshold:  result.Threshold,
+			Message:    message,
+			StartedAt:  check.startTime,
+			UpdatedAt:  time.Now(),
+		}
+
+		e.alertsMu.Lock()
+		e.activeAlerts[alertKey] = alert
+		e.alertsMu.Unlock()
+
+		e.notify(alert, config)
+		e.setCooldown(alertKey, rule.Cooldown)
+		return
+	}
+
+	// The rule may have been edited while the alert was firing
+	escalated := severity == "critical" && existing.Severity == "warning"
+	existing.Severity = severity
+	existing.RuleName = rule.Name
+	existing.Value = result.Value
+	existing.Threshold = result.Threshold
+	existing.Message = message
+	existing.UpdatedAt = time.Now()
+	if escalated {
+		e.notify(existing, config)
+		e.setCooldown(alertKey, rule.Cooldown)
+	}
+}
+
+// ruleSelectsServer reports whether a custom rule applies to a server. A
+// selector key names a group dimension (by key or id) and matches the
+// option id or name; id, name, location, provider and tag match the server
+// fields of the same name.
+func ruleSelectsServer(rule CustomAlertRule, server RemoteServer, dimensions []GroupDimension) bool {
+	if contains(rule.Exclude, server.ID) {
+		return false
+	}
+	if len(rule.Servers) > 0 && !contains(rule.Servers, server.ID) {
+		return false
+	}
+
+	for key, want := range rule.Selector {
+		var values []string
+		switch key {
+		case "id":
+			values = []string{server.ID}
+		case "name":
+			values = []string{server.Name}
+		case "location":
+			values = []string{server.Location}
+		case "provider":
+			values = []string{server.Provider}
+		case "tag":
+			values = []string{server.Tag}
+		default:
+			values = dimensionValues(key, server, dimensions)
+		}
+
+		matched := false
+		for _, value := range values {
+			if value != "" && strings.EqualFold(value, want) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// dimensionValues returns the id and name of the option a server has in a
+// group dimension
+func dimensionValues(key string, server RemoteServer, dimensions []GroupDimension) []string {
+	for _, dim := range dimensions {
+		if dim.Key != key && dim.ID != key {
+			continue
+		}
+		optionID := server.GroupValues[dim.ID]
+		if optionID == "" {
+			return nil
+		}
+		for _, option := range dim.Options {
+			if option.ID == optionID {
+				return []string{option.ID, option.Name}
+			}
+		}
+		return []string{optionID}
+	}
+	return nil
+}
+
+// findCustomRule returns the custom rule with the given ID
+func findCustomRule(config *AlertConfig, id string) *CustomAlertRule {
+	for i := range config.Rules.Custom {
+		if config.Rules.Custom[i].ID == id {
+			return &config.Rules.Custom[i]
+		}
+	}
+	return nil
+}
+
+// validateCustomRule checks a custom rule before it is saved and fills in
+// defaults
+func validateCustomRule(rule *CustomAlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, err := compileAlertExpr(rule.Expr); err != nil {
+		return fmt.Errorf("invalid expression: %v", err)
+	}
+	switch rule.Severity {
+	case "":
+		rule.Severity = "warning"
+	case "warning", "critical":
+	default:
+		return fmt.Errorf("severity must be warning or critical")
+	}
+	if rule.For < 0 || rule.Cooldown < 0 {
+		return fmt.Errorf("for and cooldown must not be negative")
+	}
+	if rule.Servers == nil {
+		rule.Servers = []string{}
+	}
+	if rule.Exclude == nil {
+		rule.Exclude = []string{}
+	}
+	if rule.Channels == nil {
+		rule.Channels = []string{}
+	}
+	return nil
+}
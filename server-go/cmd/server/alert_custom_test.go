@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestCustomAlertRules tests managing and evaluating custom rules
+func TestCustomAlertRules(t *testing.T) {
+	forEachBackend(t, testCustomAlertRules)
+}
+
+func testCustomAlertRules(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+	t.Setenv("VSTATS_CONFIG_PATH", t.TempDir()+"/vstats-config.json")
+	defer FlushConfig()
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": "http://127.0.0.1:1"}},
+	}
+	state := &AppState{
+		Config: &AppConfig{
+			AlertConfig: &alertConfig,
+			GroupDimensions: []GroupDimension{
+				{ID: "dim-region", Key: "region", Name: "Region", Options: []GroupOption{{ID: "opt-asia", Name: "Asia"}, {ID: "opt-eu", Name: "Europe"}}},
+			},
+			Servers: []RemoteServer{
+				{ID: "s1", Name: "Tokyo", GroupValues: map[string]string{"dim-region": "opt-asia"}},
+				{ID: "s2", Name: "Paris", GroupValues: map[string]string{"dim-region": "opt-eu"}},
+			},
+		},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+	setMetrics := func(five float64) {
+		now := time.Now()
+		for _, id := range []string{"s1", "s2"} {
+			metrics := *testMetrics()
+			metrics.LoadAverage.Five = five
+			state.AgentMetrics[id] = &AgentMetricsData{ServerID: id, Metrics: metrics, LastUpdated: now}
+		}
+	}
+
+	router := gin.New()
+	router.GET("/api/alerts/rules/custom", state.GetCustomRules)
+	router.POST("/api/alerts/rules/custom", state.AddCustomRule)
+	router.POST("/api/alerts/rules/custom/preview", state.PreviewCustomRule)
+	router.PUT("/api/alerts/rules/custom/:id", state.UpdateCustomRule)
+	router.DELETE("/api/alerts/rules/custom/:id", state.DeleteCustomRule)
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(data)))
+		return w
+	}
+
+	// Invalid expressions are rejected
+	if w := request("POST", "/api/alerts/rules/custom", CustomAlertRule{Name: "Bad", Expr: "load_average.five >"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid expression, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := request("POST", "/api/alerts/rules/custom", CustomAlertRule{
+		Name:     "High load",
+		Enabled:  true,
+		Expr:     "load_average.five > cores * 1.5",
+		Selector: map[string]string{"region": "asia"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var rule CustomAlertRule
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if rule.ID == "" || rule.Severity != "warning" {
+		t.Fatalf("Expected a saved rule with defaults, got %+v", rule)
+	}
+
+	setMetrics(7)
+	w = request("POST", "/api/alerts/rules/custom/preview", rule)
+	var preview struct {
+		Results []struct {
+			ServerID string `json:"server_id"`
+			Matched  bool   `json:"matched"`
+		} `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if len(preview.Results) != 1 || preview.Results[0].ServerID != "s1" || !preview.Results[0].Matched {
+		t.Errorf("Expected preview to match only s1, got %s", w.Body.String())
+	}
+
+	engine := NewAlertEngine(state, helper.db)
+	engine.checkAlerts()
+
+	alerts := engine.GetActiveAlerts()
+	if len(alerts) != 1 || alerts[0].ServerID != "s1" || alerts[0].RuleID != rule.ID || alerts[0].Value != 7 || alerts[0].Threshold != 6 {
+		t.Fatalf("Expected one custom alert for s1, got %+v", alerts)
+	}
+	events, _, _ := ListNotifications(helper.db, NotificationFilter{Type: "custom"}, 10, 0)
+	if len(events) != 1 || events[0].Title != "[warning] Tokyo High load" {
+		t.Errorf("Expected a notification for the custom alert, got %+v", events)
+	}
+
+	// A rule with a duration waits before firing
+	rule.For = 300
+	rule.Severity = "critical"
+	rule.Selector = map[string]string{"region": "opt-eu"}
+	if w := request("PUT", "/api/alerts/rules/custom/"+rule.ID, rule); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	engine.checkAlerts()
+	if alerts := engine.GetActiveAlerts(); len(alerts) != 0 {
+		t.Errorf("Expected s1 to be resolved and s2 to be pending, got %+v", alerts)
+	}
+
+	// Deleting the rule drops its pending state
+	if w := request("DELETE", "/api/alerts/rules/custom/"+rule.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	engine.checkAlerts()
+	if len(engine.thresholdState) != 0 {
+		t.Errorf("Expected no pending custom rules, got %+v", engine.thresholdState)
+	}
+	if w := request("DELETE", "/api/alerts/rules/custom/"+rule.ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
 	"sync"
 	"text/template"
 	"time"
@@ -30,11 +34,36 @@ type AlertEngine struct {
 	cooldowns      map[string]time.Time // key: type:server_id
 	cooldownsMu    sync.RWMutex
 	
+	// Whether this node was the cluster leader on the previous check
+	wasLeader      bool
+	
+	// Servers without metrics since startedAt count as offline from then
+	startedAt      time.Time
+	
+	// Serialized state last written to the database
+	savedState     []byte
+	saveMu         sync.Mutex
+	
+	// Persistent delivery of notifications
+	queue          *NotificationQueue
+	
+	// Grouped notifications: recoveries waiting for their group and when
+	// each group was last sent
+	pendingRecoveries []pendingRecovery
+	groupSentAt    map[string]time.Time
+	groupsMu       sync.Mutex
+	
+	// When anomaly and forecast rules were last evaluated
+	trendCheckedAt time.Time
+	
 	// Stop channel
 	stopCh         chan struct{}
 	wg             sync.WaitGroup
 }
 
+// cooldownRetention is how long notification times are kept for cooldowns
+const cooldownRetention = 31 * 24 * time.Hour
+
 // thresholdCheck tracks how long a metric has exceeded threshold
 type thresholdCheck struct {
 	startTime time.Time
@@ -42,22 +71,35 @@ type thresholdCheck struct {
 	severity  string
 }
 
-// NewAlertEngine creates a new alert engine
+// NewAlertEngine creates a new alert engine and restores the alert state
+// saved before the last shutdown
 func NewAlertEngine(state *AppState, db *sql.DB) *AlertEngine {
-	return &AlertEngine{
+	e := &AlertEngine{
 		state:          state,
 		db:             db,
 		activeAlerts:   make(map[string]*AlertState),
 		thresholdState: make(map[string]*thresholdCheck),
 		cooldowns:      make(map[string]time.Time),
+		groupSentAt:    make(map[string]time.Time),
+		wasLeader:      cluster == nil,
+		startedAt:      time.Now(),
+		queue:          NewNotificationQueue(state, db),
 		stopCh:         make(chan struct{}),
 	}
+	if db != nil {
+		e.loadState()
+		if len(e.activeAlerts) > 0 {
+			fmt.Printf("🔔 Restored %d active alerts\n", len(e.activeAlerts))
+		}
+	}
+	return e
 }
 
 // Start begins the alert monitoring loop
 func (e *AlertEngine) Start() {
 	e.wg.Add(1)
 	go e.monitorLoop()
+	e.queue.Start()
 	fmt.Println("🔔 Alert engine started")
 }
 
@@ -65,6 +107,7 @@ func (e *AlertEngine) Start() {
 func (e *AlertEngine) Stop() {
 	close(e.stopCh)
 	e.wg.Wait()
+	e.queue.Stop()
 	fmt.Println("🔔 Alert engine stopped")
 }
 
@@ -87,6 +130,11 @@ func (e *AlertEngine) monitorLoop() {
 
 // checkAlerts runs all alert checks
 func (e *AlertEngine) checkAlerts() {
+	if !e.syncLeadership() {
+		return
+	}
+	defer e.saveState()
+	
 	e.state.ConfigMu.RLock()
 	config := e.state.Config
 	alertConfig := config.AlertConfig
@@ -118,6 +166,111 @@ func (e *AlertEngine) checkAlerts() {
 	if alertConfig.Rules.Expiry.Enabled {
 		e.checkExpiryAlerts(alertConfig)
 	}
+	
+	// Check custom rules
+	e.checkCustomAlerts(servers, alertConfig)
+	
+	// Check anomaly and forecast rules
+	e.checkTrendAlerts(servers, alertConfig)
+	
+	e.dropStaleAlerts(servers, alertConfig)
+	e.applySilences(alertConfig)
+	e.processEscalations(alertConfig)
+	e.flushGroups(alertConfig)
+}
+
+// applySilences records which silences cover each active alert and sends
+// the notifications that were held back once their silences end
+func (e *AlertEngine) applySilences(config *AlertConfig) {
+	e.alertsMu.RLock()
+	alerts := make([]*AlertState, 0, len(e.activeAlerts))
+	for _, alert := range e.activeAlerts {
+		alerts = append(alerts, alert)
+	}
+	e.alertsMu.RUnlock()
+	
+	for _, alert := range alerts {
+		wasSilenced := len(alert.SilencedBy) > 0
+		alert.SilencedBy = e.silencedBy(alert)
+		if wasSilenced && len(alert.SilencedBy) == 0 && alert.NotifiedAt == nil {
+			e.notify(alert, config)
+		}
+	}
+}
+
+// silencedBy returns the IDs of the silences suppressing an alert
+func (e *AlertEngine) silencedBy(alert *AlertState) []string {
+	if silenceStore == nil {
+		return nil
+	}
+	server, dimensions := e.serverInfo(alert.ServerID)
+	return silenceStore.Match(alert, server, dimensions, time.Now())
+}
+
+// serverInfo returns a server's configuration and the group dimensions, for
+// matching alerts against silences and routes
+func (e *AlertEngine) serverInfo(serverID string) (RemoteServer, []GroupDimension) {
+	e.state.ConfigMu.RLock()
+	defer e.state.ConfigMu.RUnlock()
+	
+	for _, server := range e.state.Config.Servers {
+		if server.ID == serverID {
+			return server, e.state.Config.GroupDimensions
+		}
+	}
+	return RemoteServer{ID: serverID}, e.state.Config.GroupDimensions
+}
+
+// dropStaleAlerts closes alerts of servers that were deleted, of custom
+// rules that were deleted or disabled and of disabled anomaly and forecast
+// rules, which would otherwise stay active forever
+func (e *AlertEngine) dropStaleAlerts(servers []serverState, config *AlertConfig) {
+	known := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		known[server.ID] = true
+	}
+	stale := func(alert *AlertState) bool {
+		if !known[alert.ServerID] {
+			return true
+		}
+		switch alert.Type {
+		case "custom":
+			rule := findCustomRule(config, alert.RuleID)
+			return rule == nil || !rule.Enabled
+		case "anomaly":
+			return !config.Rules.Anomaly.Enabled
+		case "forecast":
+			return !config.Rules.Forecast.Enabled
+		}
+		return false
+	}
+	
+	e.thresholdMu.Lock()
+	for key := range e.thresholdState {
+		if parts := strings.SplitN(key, ":", 3); len(parts) == 3 && parts[0] == "custom" {
+			if rule := findCustomRule(config, parts[1]); rule == nil || !rule.Enabled {
+				delete(e.thresholdState, key)
+			}
+		}
+	}
+	e.thresholdMu.Unlock()
+	
+	var dropped []*AlertState
+	e.alertsMu.Lock()
+	for key, alert := range e.activeAlerts {
+		if stale(alert) {
+			now := time.Now()
+			alert.Status = "resolved"
+			alert.ResolvedAt = &now
+			delete(e.activeAlerts, key)
+			dropped = append(dropped, alert)
+		}
+	}
+	e.alertsMu.Unlock()
+	
+	for _, alert := range dropped {
+		e.storeAlertHistory(alert)
+	}
 }
 
 // serverState represents the current state of a server for alerting
@@ -191,7 +344,12 @@ func (e *AlertEngine) checkOfflineAlerts(servers []serverState, config *AlertCon
 		alertKey := fmt.Sprintf("offline:%s", server.ID)
 		
 		if !server.Online {
-			offlineDuration := time.Since(server.LastSeen)
+			// Give agents time to reconnect after a server restart
+			lastSeen := server.LastSeen
+			if lastSeen.Before(e.startedAt) {
+				lastSeen = e.startedAt
+			}
+			offlineDuration := time.Since(lastSeen)
 			
 			// Check if past grace period
 			if offlineDuration >= gracePeriod {
@@ -209,7 +367,7 @@ func (e *AlertEngine) checkOfflineAlerts(servers []serverState, config *AlertCon
 						Severity:   "critical",
 						Status:     "firing",
 						Message:    fmt.Sprintf("服务器 %s 已离线 %s", server.Name, formatDuration(offlineDuration)),
-						StartedAt:  server.LastSeen,
+						StartedAt:  lastSeen,
 						UpdatedAt:  time.Now(),
 					}
 					
@@ -629,33 +787,18 @@ func (e *AlertEngine) checkServerExpiry(serverID, serverName, expiryDateStr, pro
 		UpdatedAt:  now,
 	}
 	
+	// Remind again once the silence ends
+	if len(e.silencedBy(alert)) > 0 {
+		return
+	}
+	
 	// Render and send notification
 	e.notifyExpiry(alert, expiryDate.Format("2006-01-02"), daysLeft, provider, priceDisplay, config)
 	e.setCooldown(alertKey, 24*3600) // 24 hour cooldown per day threshold
 }
 
 func (e *AlertEngine) notifyExpiry(alert *AlertState, expiryDate string, daysLeft int, provider, price string, config *AlertConfig) {
-	rule := config.Rules.Expiry
-	channelIDs := rule.Channels
-	
-	// Use all channels if none specified
-	if len(channelIDs) == 0 {
-		for _, ch := range config.Channels {
-			if ch.Enabled {
-				channelIDs = append(channelIDs, ch.ID)
-			}
-		}
-	}
-	
-	// Render message from template
-	tmpl, ok := config.Templates["expiry"]
-	if !ok {
-		tmpl = AlertTemplate{
-			Title:  "[提醒] {{ .ServerName }} 即将到期",
-			Body:   "服务器 {{ .ServerName }} 将于 {{ .ExpiryDate }} 到期，剩余 {{ .DaysLeft }} 天。\n服务商: {{ .Provider }}\n价格: {{ .Price }}",
-			Format: "text",
-		}
-	}
+	channelIDs := e.routeAlert(alert, config).Channels
 	
 	data := map[string]interface{}{
 		"Severity":   alert.Severity,
@@ -667,34 +810,11 @@ func (e *AlertEngine) notifyExpiry(alert *AlertState, expiryDate string, daysLef
 		"Price":      price,
 	}
 	
-	title := renderTemplateString(tmpl.Title, data)
-	body := renderTemplateString(tmpl.Body, data)
-	
-	// Send to each channel
-	for _, chID := range channelIDs {
-		var channel *NotificationChannel
-		for _, ch := range config.Channels {
-			if ch.ID == chID && ch.Enabled {
-				channel = &ch
-				break
-			}
-		}
-		if channel == nil {
-			continue
-		}
-		
-		notifier, err := CreateNotifier(*channel)
-		if err != nil {
-			fmt.Printf("⚠️ Failed to create notifier for channel %s: %v\n", channel.Name, err)
-			continue
-		}
-		
-		if err := notifier.Send(title, body); err != nil {
-			fmt.Printf("⚠️ Failed to send expiry notification via %s: %v\n", channel.Name, err)
-		} else {
-			fmt.Printf("📢 Expiry notification sent via %s: %s\n", channel.Name, title)
-		}
-	}
+	// Render message from each channel's template
+	e.dispatch(channelIDs, config, func(channel NotificationChannel) *AlertEvent {
+		tmpl, _ := alertTemplate("expiry", channel, config)
+		return renderEvent(newAlertEvent(alert), tmpl, data)
+	})
 	
 	now := time.Now()
 	alert.NotifiedAt = &now
@@ -705,54 +825,27 @@ func (e *AlertEngine) notifyExpiry(alert *AlertState, expiryDate string, daysLef
 // ============================================================================
 
 func (e *AlertEngine) notify(alert *AlertState, config *AlertConfig) {
-	// Find channels for this alert type
-	var channelIDs []string
-	switch alert.Type {
-	case "offline":
-		channelIDs = config.Rules.Offline.Channels
-	case "cpu", "memory", "disk":
-		channelIDs = config.Rules.Load.Channels
-	case "traffic":
-		channelIDs = config.Rules.Traffic.Channels
+	// Silenced alerts are notified when their silence ends
+	alert.SilencedBy = e.silencedBy(alert)
+	if len(alert.SilencedBy) > 0 {
+		return
 	}
 	
-	// Use all channels if none specified
-	if len(channelIDs) == 0 {
-		for _, ch := range config.Channels {
-			if ch.Enabled {
-				channelIDs = append(channelIDs, ch.ID)
-			}
-		}
+	e.sendNotification(alert, e.routeAlert(alert, config).Channels, config)
+}
+
+// sendNotification renders an alert and queues it for the given channels,
+// or holds it for its group when grouping is on
+func (e *AlertEngine) sendNotification(alert *AlertState, channelIDs []string, config *AlertConfig) {
+	if config.Grouping.enabled() {
+		e.holdForGroup(alert, channelIDs)
+		return
 	}
 	
-	// Render message from template
-	title, body := e.renderTemplate(alert, config)
-	
-	// Send to each channel
-	for _, chID := range channelIDs {
-		var channel *NotificationChannel
-		for _, ch := range config.Channels {
-			if ch.ID == chID && ch.Enabled {
-				channel = &ch
-				break
-			}
-		}
-		if channel == nil {
-			continue
-		}
-		
-		notifier, err := CreateNotifier(*channel)
-		if err != nil {
-			fmt.Printf("⚠️ Failed to create notifier for channel %s: %v\n", channel.Name, err)
-			continue
-		}
-		
-		if err := notifier.Send(title, body); err != nil {
-			fmt.Printf("⚠️ Failed to send notification via %s: %v\n", channel.Name, err)
-		} else {
-			fmt.Printf("📢 Alert notification sent via %s: %s\n", channel.Name, title)
-		}
-	}
+	// Render message from each channel's template
+	e.dispatch(channelIDs, config, func(channel NotificationChannel) *AlertEvent {
+		return e.renderAlert(alert, channel, config)
+	})
 	
 	now := time.Now()
 	alert.NotifiedAt = &now
@@ -762,21 +855,50 @@ func (e *AlertEngine) notifyRecovery(alert *AlertState, config *AlertConfig) {
 	if !config.RecoveryNotify {
 		return
 	}
+	// Nothing to report for alerts that were silenced throughout
+	if alert.NotifiedAt == nil && len(alert.SilencedBy) > 0 {
+		return
+	}
+	if len(e.silencedBy(alert)) > 0 {
+		return
+	}
+	// Alerts that resolved while waiting for their group were never sent
+	if alert.NotifiedAt == nil && len(alert.PendingChannels) > 0 {
+		return
+	}
+	
+	// Everyone who was told about the alert hears that it recovered
+	channelIDs := e.routeAlert(alert, config).notifiedChannels(alert)
+	if config.Grouping.enabled() {
+		e.groupsMu.Lock()
+		e.pendingRecoveries = append(e.pendingRecoveries, pendingRecovery{alert: alert, channels: channelIDs})
+		e.groupsMu.Unlock()
+		return
+	}
 	
+	e.dispatch(channelIDs, config, func(channel NotificationChannel) *AlertEvent {
+		return e.renderRecovery(alert, channel, config)
+	})
+}
+
+// renderRecovery renders the recovery notification of an alert
+func (e *AlertEngine) renderRecovery(alert *AlertState, channel NotificationChannel, config *AlertConfig) *AlertEvent {
 	// Create recovery template data
 	data := map[string]interface{}{
 		"ServerName": alert.ServerName,
 		"ServerID":   alert.ServerID,
-		"AlertType":  getMetricName(alert.Type),
-		"Duration":   formatDuration(time.Since(alert.StartedAt)),
+		"AlertType":  alertTypeName(alert),
+		"Duration":   formatDuration(alert.ResolvedAt.Sub(alert.StartedAt)),
 	}
 	
 	// Render recovery template
-	tmpl := config.Templates["recovery"]
-	title := renderTemplateString(tmpl.Title, data)
-	body := renderTemplateString(tmpl.Body, data)
-	
-	// Find channels for this alert type
+	tmpl, _ := alertTemplate("recovery", channel, config)
+	return renderEvent(newAlertEvent(alert), tmpl, data)
+}
+
+// alertChannels returns the channels configured for an alert's rule, or all
+// enabled channels if the rule has none
+func alertChannels(alert *AlertState, config *AlertConfig) []string {
 	var channelIDs []string
 	switch alert.Type {
 	case "offline":
@@ -787,8 +909,17 @@ func (e *AlertEngine) notifyRecovery(alert *AlertState, config *AlertConfig) {
 		channelIDs = config.Rules.Traffic.Channels
 	case "expiry":
 		channelIDs = config.Rules.Expiry.Channels
+	case "anomaly":
+		channelIDs = config.Rules.Anomaly.Channels
+	case "forecast":
+		channelIDs = config.Rules.Forecast.Channels
+	case "custom":
+		if rule := findCustomRule(config, alert.RuleID); rule != nil {
+			channelIDs = rule.Channels
+		}
 	}
 	
+	// Use all channels if none specified
 	if len(channelIDs) == 0 {
 		for _, ch := range config.Channels {
 			if ch.Enabled {
@@ -796,30 +927,48 @@ func (e *AlertEngine) notifyRecovery(alert *AlertState, config *AlertConfig) {
 			}
 		}
 	}
-	
-	for _, chID := range channelIDs {
-		var channel *NotificationChannel
-		for _, ch := range config.Channels {
-			if ch.ID == chID && ch.Enabled {
-				channel = &ch
-				break
-			}
-		}
-		if channel == nil {
-			continue
-		}
-		
-		notifier, err := CreateNotifier(*channel)
-		if err != nil {
-			continue
-		}
-		
-		if err := notifier.Send(title, body); err != nil {
-			fmt.Printf("⚠️ Failed to send recovery notification via %s: %v\n", channel.Name, err)
-		} else {
-			fmt.Printf("✅ Recovery notification sent via %s: %s\n", channel.Name, title)
+	return channelIDs
+}
+
+// dispatch queues a notification for each enabled channel in channelIDs,
+// in order of channel priority, rendered for each channel by render
+func (e *AlertEngine) dispatch(channelIDs []string, config *AlertConfig, render func(channel NotificationChannel) *AlertEvent) {
+	for _, channel := range enabledChannels(channelIDs, config) {
+		e.enqueue(channel, render(channel))
+	}
+}
+
+// enqueue queues a notification for one channel
+func (e *AlertEngine) enqueue(channel NotificationChannel, alertEvent *AlertEvent) {
+	event := NotificationEvent{
+		AlertID:     alertEvent.AlertID(),
+		ChannelID:   channel.ID,
+		ChannelName: channel.Name,
+		Type:        alertEvent.Type,
+		ServerID:    alertEvent.ServerID(),
+		Title:       alertEvent.Title,
+		Message:     alertEvent.Message,
+		Resolved:    alertEvent.Resolved(),
+		Payload:     alertEvent,
+	}
+	if err := e.queue.Enqueue(event); err != nil {
+		fmt.Printf("⚠️ Failed to queue notification for %s: %v\n", channel.Name, err)
+	}
+}
+
+// enabledChannels returns the enabled channels in channelIDs, ordered by
+// priority
+func enabledChannels(channelIDs []string, config *AlertConfig) []NotificationChannel {
+	var channels []NotificationChannel
+	for _, ch := range config.Channels {
+		if ch.Enabled && contains(channelIDs, ch.ID) {
+			channels = append(channels, ch)
 		}
 	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Priority < channels[j].Priority
+	})
+	return channels
 }
 
 func (e *AlertEngine) resolveAlert(alertKey string, config *AlertConfig) {
@@ -855,23 +1004,31 @@ func (e *AlertEngine) storeAlertHistory(alert *AlertState) {
 	
 	dbWriter.WriteAsync(func(db *sql.DB) error {
 		_, err := db.Exec(`
-			INSERT INTO alert_history (alert_id, type, server_id, server_name, severity, value, threshold, message, started_at, resolved_at, duration, notified)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			INSERT INTO alert_history (alert_id, type, server_id, server_name, severity, value, threshold, message, started_at, resolved_at, duration, notified,
+				acknowledged_by, acknowledged_at, ack_comment)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			alert.ID, alert.Type, alert.ServerID, alert.ServerName,
 			alert.Severity, alert.Value, alert.Threshold, alert.Message,
 			alert.StartedAt.Format(time.RFC3339),
 			formatNullableTime(alert.ResolvedAt),
 			duration,
 			alert.NotifiedAt != nil,
+			alert.AcknowledgedBy,
+			formatNullableTime(alert.AcknowledgedAt),
+			alert.AckComment,
 		)
 		return err
 	})
 }
 
-func (e *AlertEngine) renderTemplate(alert *AlertState, config *AlertConfig) (string, string) {
-	tmpl, ok := config.Templates[alert.Type]
+// renderAlert renders the notification of a firing alert for a channel
+func (e *AlertEngine) renderAlert(alert *AlertState, channel NotificationChannel, config *AlertConfig) *AlertEvent {
+	event := newAlertEvent(alert)
+	tmpl, ok := alertTemplate(alert.Type, channel, config)
 	if !ok {
-		return alert.Type + " Alert", alert.Message
+		event.Title = alert.Type + " Alert"
+		event.Message = alert.Message
+		return event
 	}
 	
 	data := map[string]interface{}{
@@ -882,7 +1039,12 @@ func (e *AlertEngine) renderTemplate(alert *AlertState, config *AlertConfig) (st
 		"Threshold":  alert.Threshold,
 		"Duration":   formatDuration(time.Since(alert.StartedAt)),
 		"LastSeen":   alert.StartedAt.Format("2006-01-02 15:04:05"),
-		"AlertType":  getMetricName(alert.Type),
+		"AlertType":  alertTypeName(alert),
+		"RuleName":   alert.RuleName,
+		"Message":    alert.Message,
+	}
+	if rule := findCustomRule(config, alert.RuleID); alert.Type == "custom" && rule != nil {
+		data["Expr"] = rule.Expr
 	}
 	
 	// Calculate percent for traffic alerts
@@ -890,10 +1052,36 @@ func (e *AlertEngine) renderTemplate(alert *AlertState, config *AlertConfig) (st
 		data["Percent"] = fmt.Sprintf("%.1f", (alert.Value/alert.Threshold)*100)
 	}
 	
-	title := renderTemplateString(tmpl.Title, data)
-	body := renderTemplateString(tmpl.Body, data)
-	
-	return title, body
+	return renderEvent(event, tmpl, data)
+}
+
+// alertTemplate returns a channel's own template for name, or else the
+// configured one
+func alertTemplate(name string, channel NotificationChannel, config *AlertConfig) (AlertTemplate, bool) {
+	if tmpl, ok := channel.Templates[name]; ok {
+		return tmpl, true
+	}
+	if tmpl, ok := config.Templates[name]; ok {
+		return tmpl, true
+	}
+	// Configs saved before a template was added fall back to the default
+	tmpl, ok := GetDefaultAlertConfig().Templates[name]
+	return tmpl, ok
+}
+
+// renderEvent fills in the title and message of an event from a template
+func renderEvent(event *AlertEvent, tmpl AlertTemplate, data interface{}) *AlertEvent {
+	event.Format = tmpl.Format
+	if event.Format == "" {
+		event.Format = FormatText
+	}
+	event.Title = renderTemplateString(tmpl.Title, data)
+	if event.Format == FormatHTML {
+		event.Message = renderHTMLTemplateString(tmpl.Body, data)
+	} else {
+		event.Message = renderTemplateString(tmpl.Body, data)
+	}
+	return event
 }
 
 // ============================================================================
@@ -970,8 +1158,29 @@ func (e *AlertEngine) GetAlertStats() AlertStats {
 	return stats
 }
 
-// MuteAlert mutes an alert
+// MuteAlert mutes an alert. Followers forward the request to the leader,
+// which owns the alert state.
 func (e *AlertEngine) MuteAlert(alertID string) bool {
+	if !isLeader() {
+		var muted bool
+		if err := cluster.CallLeader("alerts.mute", alertID, &muted); err != nil {
+			fmt.Printf("⚠️ Failed to forward mute to cluster leader: %v\n", err)
+			return false
+		}
+		if muted {
+			e.muteLocal(alertID)
+		}
+		return muted
+	}
+	
+	if !e.muteLocal(alertID) {
+		return false
+	}
+	e.saveState()
+	return true
+}
+
+func (e *AlertEngine) muteLocal(alertID string) bool {
 	e.alertsMu.Lock()
 	defer e.alertsMu.Unlock()
 	
@@ -984,6 +1193,115 @@ func (e *AlertEngine) MuteAlert(alertID string) bool {
 	return false
 }
 
+// ============================================================================
+// Persistent and Cluster State
+// ============================================================================
+
+// syncLeadership keeps followers in sync with the leader's alert state and
+// restores the saved state on a node that has just become leader, so firing
+// alerts, mutes and cooldowns survive a failover. Returns whether this node
+// should evaluate alerts.
+func (e *AlertEngine) syncLeadership() bool {
+	leader := isLeader()
+	if cluster != nil {
+		if !leader {
+			e.loadSharedState()
+		} else if !e.wasLeader {
+			e.loadState()
+		}
+	}
+	e.wasLeader = leader
+	return leader
+}
+
+// loadState replaces the in-memory alert state with the one saved in the
+// database
+func (e *AlertEngine) loadState() {
+	alerts, cooldowns, err := loadAlertState(e.db)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load saved alert state: %v\n", err)
+		return
+	}
+	e.replaceState(alerts, cooldowns)
+	
+	e.saveMu.Lock()
+	e.savedState = nil
+	e.saveMu.Unlock()
+}
+
+// loadSharedState replaces the in-memory alert state with the leader's copy
+func (e *AlertEngine) loadSharedState() {
+	alerts, cooldowns, err := cluster.LoadAlertState()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load shared alert state: %v\n", err)
+		return
+	}
+	e.replaceState(alerts, cooldowns)
+}
+
+func (e *AlertEngine) replaceState(alerts map[string]*AlertState, cooldowns map[string]time.Time) {
+	e.alertsMu.Lock()
+	e.activeAlerts = alerts
+	e.alertsMu.Unlock()
+	
+	e.cooldownsMu.Lock()
+	e.cooldowns = cooldowns
+	e.cooldownsMu.Unlock()
+	
+	// Duration tracking restarts; alerts that already fired stay active
+	e.thresholdMu.Lock()
+	e.thresholdState = make(map[string]*thresholdCheck)
+	e.thresholdMu.Unlock()
+}
+
+// saveState writes the leader's alert state to the database and publishes
+// it to the cluster
+func (e *AlertEngine) saveState() {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	
+	e.alertsMu.RLock()
+	alerts := make(map[string]*AlertState, len(e.activeAlerts))
+	for key, alert := range e.activeAlerts {
+		a := *alert
+		alerts[key] = &a
+	}
+	e.alertsMu.RUnlock()
+	
+	// Cooldowns are at most days long; forget ones that can no longer apply
+	e.cooldownsMu.Lock()
+	cooldowns := make(map[string]time.Time, len(e.cooldowns))
+	for key, t := range e.cooldowns {
+		if time.Since(t) > cooldownRetention {
+			delete(e.cooldowns, key)
+			continue
+		}
+		cooldowns[key] = t
+	}
+	e.cooldownsMu.Unlock()
+	
+	if e.db != nil {
+		// Skip the write when nothing changed since the last check
+		data, _ := json.Marshal(struct {
+			Alerts    map[string]*AlertState
+			Cooldowns map[string]time.Time
+		}{alerts, cooldowns})
+		if !bytes.Equal(data, e.savedState) {
+			if err := saveAlertState(alerts, cooldowns); err != nil {
+				fmt.Printf("⚠️ Failed to save alert state: %v\n", err)
+			} else {
+				e.savedState = data
+			}
+		}
+	}
+	
+	if cluster != nil {
+		if err := cluster.SaveAlertState(alerts, cooldowns); err != nil {
+			fmt.Printf("⚠️ Failed to save shared alert state: %v\n", err)
+		}
+	}
+}
+
 // ============================================================================
 // Helper Functions
 // ============================================================================
@@ -1011,11 +1329,23 @@ func getMetricName(metricType string) string {
 		return "流量"
 	case "expiry":
 		return "到期"
+	case "anomaly":
+		return "异常"
+	case "forecast":
+		return "容量预测"
 	default:
 		return metricType
 	}
 }
 
+// alertTypeName returns the display name of an alert's type
+func alertTypeName(alert *AlertState) string {
+	if alert.Type == "custom" && alert.RuleName != "" {
+		return alert.RuleName
+	}
+	return getMetricName(alert.Type)
+}
+
 func getSeverityName(severity string) string {
 	switch severity {
 	case "critical":
@@ -1059,3 +1389,39 @@ func renderTemplateString(tmplStr string, data interface{}) string {
 	}
 	return buf.String()
 }
+
+// renderHTMLTemplateString renders an HTML template, escaping the values
+func renderHTMLTemplateString(tmplStr string, data interface{}) string {
+	tmpl, err := htmltemplate.New("alert").Parse(tmplStr)
+	if err != nil {
+		return tmplStr
+	}
+	
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return tmplStr
+	}
+	return buf.String()
+}
+
+// validateTemplates checks that templates parse and have a known format
+func validateTemplates(templates map[string]AlertTemplate) error {
+	for name, tmpl := range templates {
+		switch tmpl.Format {
+		case "", FormatText, FormatMarkdown:
+			if _, err := template.New(name).Parse(tmpl.Title + tmpl.Body); err != nil {
+				return fmt.Errorf("template %s: %v", name, err)
+			}
+		case FormatHTML:
+			if _, err := htmltemplate.New(name).Parse(tmpl.Body); err != nil {
+				return fmt.Errorf("template %s: %v", name, err)
+			}
+			if _, err := template.New(name).Parse(tmpl.Title); err != nil {
+				return fmt.Errorf("template %s: %v", name, err)
+			}
+		default:
+			return fmt.Errorf("template %s: format must be text, html or markdown", name)
+		}
+	}
+	return nil
+}
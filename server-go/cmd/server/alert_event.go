@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Alert Events
+// ============================================================================
+//
+// An AlertEvent is what notifiers receive: the title and message rendered
+// from the channel's template, together with the alerts they are about, so
+// that each channel can format them natively. The generic webhook sends it
+// as JSON; AlertEventVersion is bumped when fields are removed or change
+// meaning, not when fields are added.
+
+// AlertEventVersion is the version of the AlertEvent JSON schema
+const AlertEventVersion = 1
+
+// Template formats
+const (
+	FormatText     = "text"
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+)
+
+// AlertEvent is a notification about one or more alerts
+type AlertEvent struct {
+	Version  int          `json:"version"`
+	Status   string       `json:"status"`   // firing, resolved
+	Type     string       `json:"type"`     // Alert type; "group" for mixed types, "test" or "system" for other messages
+	Severity string       `json:"severity"` // critical, warning, info
+	Title    string       `json:"title"`
+	Message  string       `json:"message"`
+	Format   string       `json:"format"` // text, html, markdown
+	Alerts   []EventAlert `json:"alerts"`
+	AckURL   string       `json:"ack_url,omitempty"` // Acknowledge link, only while an alert awaits acknowledgement
+	Time     time.Time    `json:"time"`
+}
+
+// EventAlert describes an alert of an AlertEvent
+type EventAlert struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"` // firing, resolved
+	Type       string     `json:"type"`
+	RuleName   string     `json:"rule_name,omitempty"`
+	Severity   string     `json:"severity"`
+	ServerID   string     `json:"server_id"`
+	ServerName string     `json:"server_name"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	Message    string     `json:"message,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// newAlertEvent creates the event for a notification about alerts; it is
+// resolved when all of them are
+func newAlertEvent(alerts ...*AlertState) *AlertEvent {
+	event := &AlertEvent{
+		Version: AlertEventVersion,
+		Status:  "resolved",
+		Format:  FormatText,
+		Alerts:  make([]EventAlert, 0, len(alerts)),
+		Time:    time.Now(),
+	}
+	for _, alert := range alerts {
+		status := "firing"
+		if alert.ResolvedAt != nil {
+			status = "resolved"
+		} else {
+			event.Status = "firing"
+		}
+		if event.Type == "" {
+			event.Type = alert.Type
+		} else if event.Type != alert.Type {
+			event.Type = "group"
+		}
+		if severityRank(alert.Severity) > severityRank(event.Severity) {
+			event.Severity = alert.Severity
+		}
+		event.Alerts = append(event.Alerts, EventAlert{
+			ID:         alert.ID,
+			Status:     status,
+			Type:       alert.Type,
+			RuleName:   alert.RuleName,
+			Severity:   alert.Severity,
+			ServerID:   alert.ServerID,
+			ServerName: alert.ServerName,
+			Value:      alert.Value,
+			Threshold:  alert.Threshold,
+			Message:    alert.Message,
+			StartedAt:  alert.StartedAt,
+			ResolvedAt: alert.ResolvedAt,
+		})
+	}
+	if len(alerts) == 0 {
+		event.Status = "firing"
+	}
+	if event.Severity == "" {
+		event.Severity = "info"
+	}
+	return event
+}
+
+// messageEvent creates an event for a message that is not about an alert,
+// such as a test notification
+func messageEvent(eventType, title, message string) *AlertEvent {
+	event := newAlertEvent()
+	event.Type = eventType
+	event.Title = title
+	event.Message = message
+	return event
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 3
+	case "warning":
+		return 2
+	case "info":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Resolved reports whether the event announces a recovery
+func (e *AlertEvent) Resolved() bool {
+	return e.Status == "resolved"
+}
+
+// Alert returns the alert of a notification about a single alert
+func (e *AlertEvent) Alert() *EventAlert {
+	if len(e.Alerts) != 1 {
+		return nil
+	}
+	return &e.Alerts[0]
+}
+
+// AlertID returns the ID of the alert of a single-alert notification
+func (e *AlertEvent) AlertID() string {
+	if alert := e.Alert(); alert != nil {
+		return alert.ID
+	}
+	return ""
+}
+
+// ServerID returns the server of a single-alert notification
+func (e *AlertEvent) ServerID() string {
+	if alert := e.Alert(); alert != nil {
+		return alert.ServerID
+	}
+	return ""
+}
+
+// ============================================================================
+// Formatting
+// ============================================================================
+
+// Color returns the color of the event as 0xRRGGBB: green when resolved,
+// otherwise by severity
+func (e *AlertEvent) Color() int {
+	if e.Resolved() {
+		return 0x2ECC71
+	}
+	switch e.Severity {
+	case "critical":
+		return 0xE74C3C
+	case "warning":
+		return 0xF39C12
+	default:
+		return 0x3498DB
+	}
+}
+
+// HexColor returns Color as #rrggbb
+func (e *AlertEvent) HexColor() string {
+	return fmt.Sprintf("#%06x", e.Color())
+}
+
+// Emoji returns a status marker for titles
+func (e *AlertEvent) Emoji() string {
+	if e.Resolved() {
+		return "✅"
+	}
+	switch e.Severity {
+	case "critical":
+		return "🔴"
+	case "warning":
+		return "🟠"
+	default:
+		return "ℹ️"
+	}
+}
+
+// PlainMessage returns the message without markup
+func (e *AlertEvent) PlainMessage() string {
+	if e.Format == FormatHTML {
+		return stripHTML(e.Message)
+	}
+	return e.Message
+}
+
+// MarkdownMessage returns the message for channels that render Markdown.
+// Plain text is passed through, as it rarely contains markup.
+func (e *AlertEvent) MarkdownMessage() string {
+	if e.Format == FormatHTML {
+		return stripHTML(e.Message)
+	}
+	return e.Message
+}
+
+// HTMLMessage returns the message as HTML
+func (e *AlertEvent) HTMLMessage() string {
+	switch e.Format {
+	case FormatHTML:
+		return e.Message
+	case FormatMarkdown:
+		return markdownToHTML(e.Message)
+	default:
+		return strings.ReplaceAll(html.EscapeString(e.Message), "\n", "<br>")
+	}
+}
+
+var (
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+
+	// Inline Markdown: **bold**, *italic* or _italic_, `code` and [text](url)
+	markdownInlinePattern = regexp.MustCompile("\\*\\*(.+?)\\*\\*|\\*([^*\\n]+)\\*|_([^_\\n]+)_|`([^`\\n]+)`|\\[([^\\]\\n]+)\\]\\(([^)\\s]+)\\)")
+)
+
+// stripHTML converts HTML to plain text, keeping line breaks
+func stripHTML(s string) string {
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// markdownInline rewrites the inline Markdown of s: plain text runs are
+// passed to text and each element to the function for its kind
+func markdownInline(s string, text func(string) string, element func(kind, content, url string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range markdownInlinePattern.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(text(s[last:m[0]]))
+		group := func(i int) string { return s[m[2*i]:m[2*i+1]] }
+		switch {
+		case m[2] >= 0:
+			b.WriteString(element("bold", group(1), ""))
+		case m[4] >= 0:
+			b.WriteString(element("italic", group(2), ""))
+		case m[6] >= 0:
+			b.WriteString(element("italic", group(3), ""))
+		case m[8] >= 0:
+			b.WriteString(element("code", group(4), ""))
+		default:
+			b.WriteString(element("link", group(5), group(6)))
+		}
+		last = m[1]
+	}
+	b.WriteString(text(s[last:]))
+	return b.String()
+}
+
+// markdownToHTML converts inline Markdown and line breaks to HTML
+func markdownToHTML(s string) string {
+	converted := markdownInline(s, html.EscapeString, func(kind, content, url string) string {
+		content = html.EscapeString(content)
+		switch kind {
+		case "bold":
+			return "<b>" + content + "</b>"
+		case "italic":
+			return "<i>" + content + "</i>"
+		case "code":
+			return "<code>" + content + "</code>"
+		default:
+			return `<a href="` + html.EscapeString(url) + `">` + content + "</a>"
+		}
+	})
+	return strings.ReplaceAll(converted, "\n", "<br>")
+}
@@ -0,0 +1,875 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// Alert Expressions
+// ============================================================================
+//
+// Custom alert rules are boolean expressions over the metrics an agent
+// reports, using the JSON field names of SystemMetrics:
+//
+//	load_average.five > cores * 1.5
+//	disk[mount="/data"].usage_percent > 90
+//	ping[name="hk"].packet_loss > 20 and ping[name="hk"].packet_loss < 100
+//	max(gpu.temperature) >= 85
+//
+// Paths that end in a list compare element by element and match when any
+// element does, so `disk.usage_percent > 90` fires for any full disk.
+// Comparisons with missing data (no GPU, unknown ping target, no latency)
+// are false.
+
+// alertExpr is a compiled alert expression
+type alertExpr struct {
+	source string
+	root   exprNode
+}
+
+// exprResult is the outcome of evaluating an expression for one server
+type exprResult struct {
+	Matched   bool
+	Value     float64 // Left side of the comparison that matched
+	Threshold float64 // Right side of the comparison that matched
+}
+
+// compileAlertExpr parses an alert expression
+func compileAlertExpr(source string) (*alertExpr, error) {
+	p := &exprParser{src: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+	}
+	if !isBooleanNode(root) {
+		return nil, fmt.Errorf("expression must be a comparison, e.g. cpu.usage > 90")
+	}
+	return &alertExpr{source: source, root: root}, nil
+}
+
+// Eval evaluates the expression against a metrics environment
+func (x *alertExpr) Eval(env map[string]interface{}) (exprResult, error) {
+	ctx := &evalContext{env: env}
+	v, err := x.root.eval(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+	matched, _ := v.(bool)
+	res := exprResult{Matched: matched}
+	if matched && ctx.hit != nil {
+		res.Value, res.Threshold = ctx.hit[0], ctx.hit[1]
+	}
+	return res, nil
+}
+
+// ----------------------------------------------------------------------------
+// Environment
+// ----------------------------------------------------------------------------
+
+// metricsEnv builds the evaluation environment for one agent's metrics. On
+// top of the SystemMetrics fields it provides shorthands: cores, disk (with
+// a mount field listing mount points), ping (the ping targets), gpu (the
+// GPU list), interfaces and memory.swap_percent.
+func metricsEnv(m *SystemMetrics) map[string]interface{} {
+	env := map[string]interface{}{}
+	data, _ := json.Marshal(m)
+	json.Unmarshal(data, &env)
+
+	env["cores"] = float64(m.CPU.Cores)
+
+	disks := []interface{}{}
+	if list, ok := env["disks"].([]interface{}); ok {
+		for _, d := range list {
+			if disk, ok := d.(map[string]interface{}); ok {
+				mounts, _ := disk["mount_points"].([]interface{})
+				if mounts == nil {
+					mounts = []interface{}{}
+				}
+				disk["mount"] = mounts
+				disks = append(disks, disk)
+			}
+		}
+	}
+	env["disks"] = disks
+	env["disk"] = disks
+
+	ping := []interface{}{}
+	if p, ok := env["ping"].(map[string]interface{}); ok {
+		if targets, ok := p["targets"].([]interface{}); ok {
+			ping = targets
+		}
+	}
+	env["ping"] = ping
+
+	gpus := []interface{}{}
+	if g, ok := env["gpu"].(map[string]interface{}); ok {
+		if list, ok := g["gpus"].([]interface{}); ok {
+			gpus = list
+		}
+	}
+	env["gpu"] = gpus
+
+	if network, ok := env["network"].(map[string]interface{}); ok {
+		env["interfaces"] = network["interfaces"]
+	}
+	if memory, ok := env["memory"].(map[string]interface{}); ok && m.Memory.SwapTotal > 0 {
+		memory["swap_percent"] = float64(m.Memory.SwapUsed) / float64(m.Memory.SwapTotal) * 100
+	}
+	return env
+}
+
+// ----------------------------------------------------------------------------
+// Tokenizer
+// ----------------------------------------------------------------------------
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	i      int
+}
+
+func (p *exprParser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(s[start:i], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q at position %d", s[start:i], start+1)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokNumber, text: s[start:i], num: n, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var b strings.Builder
+			for i < len(s) && s[i] != c {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return fmt.Errorf("unterminated string at position %d", start+1)
+			}
+			i++
+			p.tokens = append(p.tokens, exprToken{kind: tokString, text: b.String(), pos: start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z' || s[i] >= '0' && s[i] <= '9') {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokIdent, text: s[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range []string{">=", "<=", "==", "!=", "&&", "||", ">", "<", "=", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("unexpected character %q at position %d", c, i+1)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, exprToken{kind: tokEOF, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.i] }
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators or
+// keywords
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp && tok.kind != tokIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.i++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q but found %q at position %d", op, tok.text, tok.pos+1)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Parser
+// ----------------------------------------------------------------------------
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "or", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "and", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept(">", ">=", "<", "<=", "==", "!=", "=")
+	if !ok {
+		return left, nil
+	}
+	if op == "=" {
+		op = "=="
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithNode{op: "-", left: &literalNode{value: 0.0}, right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return &literalNode{value: tok.num}, nil
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+	case tokOp:
+		if tok.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		return p.parsePath(tok)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	if _, ok := exprFuncs[name.text]; !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos+1)
+	}
+	arg, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &callNode{name: name.text, arg: arg}, nil
+}
+
+func (p *exprParser) parsePath(first exprToken) (exprNode, error) {
+	node := &pathNode{root: first.text}
+	for {
+		if _, ok := p.accept("."); ok {
+			tok := p.next()
+			if tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at position %d", tok.pos+1)
+			}
+			node.steps = append(node.steps, pathStep{field: tok.text})
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			step, err := p.parseSelector()
+			if err != nil {
+				return nil, err
+			}
+			node.steps = append(node.steps, step)
+			continue
+		}
+		return node, nil
+	}
+}
+
+// parseSelector parses [0], [name="hk"] or [mount!="/"]
+func (p *exprParser) parseSelector() (pathStep, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		if tok.num != math.Trunc(tok.num) || tok.num < 0 {
+			return pathStep{}, fmt.Errorf("invalid index %s at position %d", tok.text, tok.pos+1)
+		}
+		if err := p.expect("]"); err != nil {
+			return pathStep{}, err
+		}
+		return pathStep{index: int(tok.num), isIndex: true}, nil
+	case tokIdent:
+		op, ok := p.accept("=", "==", "!=")
+		if !ok {
+			return pathStep{}, fmt.Errorf("expected = or != after %q at position %d", tok.text, tok.pos+1)
+		}
+		value := p.next()
+		if value.kind != tokString && value.kind != tokNumber {
+			return pathStep{}, fmt.Errorf("expected a quoted value at position %d", value.pos+1)
+		}
+		if err := p.expect("]"); err != nil {
+			return pathStep{}, err
+		}
+		return pathStep{key: tok.text, value: value.text, negate: op == "!="}, nil
+	}
+	return pathStep{}, fmt.Errorf("invalid selector at position %d", tok.pos+1)
+}
+
+// ----------------------------------------------------------------------------
+// Evaluation
+// ----------------------------------------------------------------------------
+
+// noData is the value of paths that do not exist in the metrics
+type noData struct{}
+
+type evalContext struct {
+	env map[string]interface{}
+	hit *[2]float64 // Operands of the first comparison that matched
+}
+
+type exprNode interface {
+	eval(ctx *evalContext) (interface{}, error)
+}
+
+func isBooleanNode(n exprNode) bool {
+	switch n := n.(type) {
+	case *compareNode, *logicalNode, *notNode:
+		return true
+	case *literalNode:
+		_, ok := n.value.(bool)
+		return ok
+	}
+	return false
+}
+
+type literalNode struct{ value interface{} }
+
+func (n *literalNode) eval(*evalContext) (interface{}, error) { return n.value, nil }
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(ctx *evalContext) (interface{}, error) {
+	l, err := evalBool(ctx, n.left)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "and" && !l || n.op == "or" && l {
+		return l, nil
+	}
+	return evalBool(ctx, n.right)
+}
+
+type notNode struct{ operand exprNode }
+
+func (n *notNode) eval(ctx *evalContext) (interface{}, error) {
+	// Values of a negated comparison are not meaningful for the alert
+	inner := &evalContext{env: ctx.env}
+	v, err := evalBool(inner, n.operand)
+	return !v, err
+}
+
+func evalBool(ctx *evalContext, n exprNode) (bool, error) {
+	v, err := n.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case noData:
+		return false, nil
+	}
+	return false, fmt.Errorf("expected a comparison, got %v", v)
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) eval(ctx *evalContext) (interface{}, error) {
+	l, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lists match when any element does
+	for _, lv := range flatten(l) {
+		for _, rv := range flatten(r) {
+			ok, err := compareValues(n.op, lv, rv)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if ctx.hit == nil {
+					lf, _ := lv.(float64)
+					rf, _ := rv.(float64)
+					ctx.hit = &[2]float64{lf, rf}
+				}
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func flatten(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{v}
+}
+
+func compareValues(op string, l, r interface{}) (bool, error) {
+	if _, ok := l.(noData); ok {
+		return false, nil
+	}
+	if _, ok := r.(noData); ok {
+		return false, nil
+	}
+	if l == nil || r == nil {
+		return false, nil
+	}
+
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare text %q with %v", ls, r)
+		}
+		switch op {
+		case "==":
+			return ls == rs, nil
+		case "!=":
+			return ls != rs, nil
+		}
+		return false, fmt.Errorf("text only supports == and !=")
+	}
+	if lb, ok := l.(bool); ok {
+		rb, ok := r.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return false, fmt.Errorf("cannot compare %v %s %v", l, op, r)
+		}
+		return (lb == rb) == (op == "=="), nil
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return false, fmt.Errorf("cannot compare %v %s %v", l, op, r)
+	}
+	switch op {
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case "==":
+		return lf == rf, nil
+	case "!=":
+		return lf != rf, nil
+	}
+	return false, fmt.Errorf("unknown operator %s", op)
+}
+
+type arithNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *arithNode) eval(ctx *evalContext) (interface{}, error) {
+	l, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ll, lIsList := l.([]interface{})
+	rl, rIsList := r.([]interface{})
+	switch {
+	case lIsList && rIsList:
+		return nil, fmt.Errorf("cannot combine two lists with %s; use max(), min() or avg()", n.op)
+	case lIsList:
+		out := make([]interface{}, 0, len(ll))
+		for _, v := range ll {
+			out = append(out, arith(n.op, v, r))
+		}
+		return out, nil
+	case rIsList:
+		out := make([]interface{}, 0, len(rl))
+		for _, v := range rl {
+			out = append(out, arith(n.op, l, v))
+		}
+		return out, nil
+	}
+	return arith(n.op, l, r), nil
+}
+
+func arith(op string, l, r interface{}) interface{} {
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return noData{}
+	}
+	switch op {
+	case "+":
+		return lf + rf
+	case "-":
+		return lf - rf
+	case "*":
+		return lf * rf
+	case "/":
+		if rf == 0 {
+			return noData{}
+		}
+		return lf / rf
+	case "%":
+		if rf == 0 {
+			return noData{}
+		}
+		return math.Mod(lf, rf)
+	}
+	return noData{}
+}
+
+type callNode struct {
+	name string
+	arg  exprNode
+}
+
+// exprFuncs aggregate a list of numbers (a single number counts as a list
+// of one)
+var exprFuncs = map[string]func([]float64) interface{}{
+	"max": func(v []float64) interface{} {
+		if len(v) == 0 {
+			return noData{}
+		}
+		m := v[0]
+		for _, x := range v[1:] {
+			m = math.Max(m, x)
+		}
+		return m
+	},
+	"min": func(v []float64) interface{} {
+		if len(v) == 0 {
+			return noData{}
+		}
+		m := v[0]
+		for _, x := range v[1:] {
+			m = math.Min(m, x)
+		}
+		return m
+	},
+	"avg": func(v []float64) interface{} {
+		if len(v) == 0 {
+			return noData{}
+		}
+		sum := 0.0
+		for _, x := range v {
+			sum += x
+		}
+		return sum / float64(len(v))
+	},
+	"sum": func(v []float64) interface{} {
+		sum := 0.0
+		for _, x := range v {
+			sum += x
+		}
+		return sum
+	},
+	"count": func(v []float64) interface{} {
+		return float64(len(v))
+	},
+	"abs": func(v []float64) interface{} {
+		if len(v) != 1 {
+			return noData{}
+		}
+		return math.Abs(v[0])
+	},
+}
+
+func (n *callNode) eval(ctx *evalContext) (interface{}, error) {
+	v, err := n.arg.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var nums []float64
+	for _, item := range flatten(v) {
+		switch item := item.(type) {
+		case float64:
+			nums = append(nums, item)
+		case noData, nil:
+		default:
+			if n.name != "count" {
+				return nil, fmt.Errorf("%s() needs numbers, got %v", n.name, item)
+			}
+			nums = append(nums, 0)
+		}
+	}
+	return exprFuncs[n.name](nums), nil
+}
+
+type pathStep struct {
+	field   string
+	key     string
+	value   string
+	negate  bool
+	index   int
+	isIndex bool
+}
+
+type pathNode struct {
+	root  string
+	steps []pathStep
+}
+
+func (n *pathNode) eval(ctx *evalContext) (interface{}, error) {
+	cur, ok := ctx.env[n.root]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", n.root)
+	}
+	for _, step := range n.steps {
+		cur = applyStep(cur, step)
+		if _, missing := cur.(noData); missing {
+			return cur, nil
+		}
+	}
+	if cur == nil {
+		return noData{}, nil
+	}
+	return cur, nil
+}
+
+func applyStep(cur interface{}, step pathStep) interface{} {
+	switch {
+	case step.isIndex:
+		list, ok := cur.([]interface{})
+		if !ok || step.index >= len(list) {
+			return noData{}
+		}
+		return list[step.index]
+
+	case step.key != "":
+		list, ok := cur.([]interface{})
+		if !ok {
+			return noData{}
+		}
+		out := []interface{}{}
+		for _, item := range list {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if matchesSelector(obj[step.key], step.value) != step.negate {
+				out = append(out, item)
+			}
+		}
+		if len(out) == 0 {
+			return noData{}
+		}
+		return out
+
+	default:
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			field, ok := v[step.field]
+			if !ok || field == nil {
+				return noData{}
+			}
+			return field
+		case []interface{}:
+			out := []interface{}{}
+			for _, item := range v {
+				if obj, ok := item.(map[string]interface{}); ok {
+					if field, ok := obj[step.field]; ok && field != nil {
+						out = append(out, field)
+					}
+				}
+			}
+			if len(out) == 0 {
+				return noData{}
+			}
+			return out
+		}
+		return noData{}
+	}
+}
+
+// matchesSelector compares a field with a selector value; list fields match
+// when they contain the value
+func matchesSelector(field interface{}, want string) bool {
+	switch f := field.(type) {
+	case string:
+		return f == want
+	case float64:
+		w, err := strconv.ParseFloat(want, 64)
+		return err == nil && f == w
+	case bool:
+		return strconv.FormatBool(f) == want
+	case []interface{}:
+		for _, item := range f {
+			if matchesSelector(item, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"vstats/internal/common"
+)
+
+func testMetrics() *SystemMetrics {
+	latency := 180.0
+	return &SystemMetrics{
+		CPU:    common.CpuMetrics{Cores: 4, Usage: 35},
+		Memory: common.MemoryMetrics{UsagePercent: 72, SwapTotal: 1000, SwapUsed: 600},
+		Disks: []common.DiskMetrics{
+			{Name: "sda", MountPoints: []string{"/", "/boot"}, UsagePercent: 40},
+			{Name: "sdb", MountPoints: []string{"/data"}, UsagePercent: 93},
+		},
+		LoadAverage: common.LoadAverage{One: 8.2, Five: 7, Fifteen: 3},
+		Ping: &common.PingMetrics{Targets: []common.PingTarget{
+			{Name: "hk", Host: "1.1.1.1", LatencyMs: &latency, PacketLoss: 25},
+			{Name: "us", Host: "8.8.8.8", PacketLoss: 100, Status: "timeout"},
+		}},
+	}
+}
+
+// TestAlertExprEval tests evaluating alert expressions
+func TestAlertExprEval(t *testing.T) {
+	env := metricsEnv(testMetrics())
+
+	tests := []struct {
+		expr      string
+		matched   bool
+		value     float64
+		threshold float64
+	}{
+		{"load_average.five > cores * 1.5", true, 7, 6},
+		{"load_average.five > cores * 2", false, 0, 0},
+		{`disk[mount="/data"].usage_percent > 90`, true, 93, 90},
+		{`disk[mount="/"].usage_percent > 90`, false, 0, 0},
+		{`disk[mount!="/data"].usage_percent < 50`, true, 40, 50},
+		{"disk.usage_percent > 90", true, 93, 90},
+		{"disks[0].usage_percent >= 40", true, 40, 40},
+		{`ping[name="hk"].packet_loss > 20`, true, 25, 20},
+		{`ping[name="hk"].latency_ms > 150 and ping[name="hk"].packet_loss < 50`, true, 180, 150},
+		{`ping[name="us"].latency_ms > 150`, false, 0, 0},
+		{`ping[name="nowhere"].packet_loss > 20`, false, 0, 0},
+		{`not ping[name="nowhere"].packet_loss > 20`, true, 0, 0},
+		{"max(gpu.temperature) > 80", false, 0, 0},
+		{"count(disk) == 2", true, 2, 2},
+		{"avg(disk.usage_percent) > 60", true, 66.5, 60},
+		{"memory.swap_percent > 50 || cpu.usage > 90", true, 60, 50},
+		{"cpu.usage > 90 || memory.usage_percent >= 72", true, 72, 72},
+		{`ping[name='us'].status == "timeout"`, true, 0, 0},
+		{"(cpu.usage + 5) / 2 == 20", true, 20, 20},
+		{"-cpu.usage < 0", true, -35, 0},
+	}
+	for _, tt := range tests {
+		expr, err := compileAlertExpr(tt.expr)
+		if err != nil {
+			t.Errorf("compileAlertExpr(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		res, err := expr.Eval(env)
+		if err != nil {
+			t.Errorf("Eval(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if res.Matched != tt.matched || res.Value != tt.value || res.Threshold != tt.threshold {
+			t.Errorf("Eval(%q) = %+v, want matched=%v value=%v threshold=%v", tt.expr, res, tt.matched, tt.value, tt.threshold)
+		}
+	}
+}
+
+// TestAlertExprErrors tests rejecting invalid expressions
+func TestAlertExprErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"cpu.usage",
+		"cpu.usage >",
+		"cpu.usage > 90)",
+		`disk[mount="/data".usage_percent > 90`,
+		`disk[mount].usage_percent > 90`,
+		"median(disk.usage_percent) > 90",
+		`ping[name="hk].packet_loss > 20`,
+		"cpu.usage > 90 $",
+	} {
+		if _, err := compileAlertExpr(src); err == nil {
+			t.Errorf("Expected compileAlertExpr(%q) to fail", src)
+		}
+	}
+
+	// Compiles but refers to a metric that does not exist
+	expr, err := compileAlertExpr("cpus.usage > 90")
+	if err != nil {
+		t.Fatalf("compileAlertExpr failed: %v", err)
+	}
+	if _, err := expr.Eval(metricsEnv(testMetrics())); err == nil {
+		t.Error("Expected an error for an unknown metric")
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Alert Grouping
+// ============================================================================
+//
+// With grouping on, notifications are not sent right away. Alerts are held
+// per group (alerts sharing the values of the grouping keys) and each
+// channel receives one message listing every alert of the group that fired
+// or recovered since the group was last sent. A group waits Wait seconds
+// after its first alert to collect related ones, and is sent at most once
+// per Interval.
+
+const (
+	defaultGroupWait     = 30 * time.Second
+	defaultGroupInterval = 5 * time.Minute
+)
+
+// AlertGrouping configures how alerts are collapsed into notifications
+type AlertGrouping struct {
+	By       []string `json:"by,omitempty"`       // type, severity, server, provider, location, tag or a dimension key; off when empty
+	Wait     int      `json:"wait,omitempty"`     // Seconds to collect alerts before a group is first sent (default 30)
+	Interval int      `json:"interval,omitempty"` // Minimum seconds between messages of a group (default 300)
+}
+
+func (g AlertGrouping) enabled() bool {
+	return len(g.By) > 0
+}
+
+func (g AlertGrouping) wait() time.Duration {
+	if g.Wait > 0 {
+		return time.Duration(g.Wait) * time.Second
+	}
+	return defaultGroupWait
+}
+
+func (g AlertGrouping) interval() time.Duration {
+	if g.Interval > 0 {
+		return time.Duration(g.Interval) * time.Second
+	}
+	return defaultGroupInterval
+}
+
+// Validate checks the grouping settings
+func (g AlertGrouping) Validate() error {
+	if g.Wait < 0 || g.Interval < 0 {
+		return fmt.Errorf("group wait and interval must not be negative")
+	}
+	for _, key := range g.By {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("group keys must not be empty")
+		}
+	}
+	return nil
+}
+
+// pendingRecovery is a resolved alert whose recovery waits for its group
+type pendingRecovery struct {
+	alert    *AlertState
+	channels []string
+}
+
+// alertGroup collects the alerts sent together in one message per channel
+type alertGroup struct {
+	key      string
+	summary  string
+	since    time.Time // When the oldest held alert was added
+	firing   []*AlertState
+	resolved []pendingRecovery
+}
+
+// groupLabels returns the value of each grouping key for an alert
+func groupLabels(by []string, alert *AlertState, server RemoteServer, dimensions []GroupDimension) []string {
+	labels := make([]string, len(by))
+	for i, key := range by {
+		switch key {
+		case "type":
+			labels[i] = alertTypeName(alert)
+		case "severity":
+			labels[i] = alert.Severity
+		case "server":
+			labels[i] = alert.ServerName
+		case "provider":
+			labels[i] = server.Provider
+		case "location":
+			labels[i] = server.Location
+		case "tag":
+			labels[i] = server.Tag
+		default:
+			// Prefer the option name, which is what people read
+			if values := dimensionValues(key, server, dimensions); len(values) > 0 {
+				labels[i] = values[len(values)-1]
+			}
+		}
+	}
+	return labels
+}
+
+// holdForGroup keeps an alert's notification until its group is sent
+func (e *AlertEngine) holdForGroup(alert *AlertState, channelIDs []string) {
+	if alert.PendingSince == nil {
+		now := time.Now()
+		alert.PendingSince = &now
+	}
+	alert.PendingChannels = appendUnique(alert.PendingChannels, channelIDs...)
+}
+
+// flushGroups sends the groups that are due. When grouping has been turned
+// off, everything still held is sent right away.
+func (e *AlertEngine) flushGroups(config *AlertConfig) {
+	grouping := config.Grouping
+	now := time.Now()
+
+	groups := make(map[string]*alertGroup)
+	groupOf := func(alert *AlertState) *alertGroup {
+		server, dimensions := e.serverInfo(alert.ServerID)
+		labels := groupLabels(grouping.By, alert, server, dimensions)
+
+		var keyParts, summary []string
+		for i, label := range labels {
+			keyParts = append(keyParts, grouping.By[i]+"="+label)
+			if label != "" {
+				summary = append(summary, label)
+			}
+		}
+		key := strings.Join(keyParts, ",")
+		group := groups[key]
+		if group == nil {
+			group = &alertGroup{key: key, summary: strings.Join(summary, " / "), since: now}
+			if group.summary == "" {
+				group.summary = "告警"
+			}
+			groups[key] = group
+		}
+		return group
+	}
+
+	e.alertsMu.RLock()
+	var held []*AlertState
+	for _, alert := range e.activeAlerts {
+		if len(alert.PendingChannels) > 0 && len(alert.SilencedBy) == 0 {
+			held = append(held, alert)
+		}
+	}
+	e.alertsMu.RUnlock()
+
+	e.groupsMu.Lock()
+	recoveries := e.pendingRecoveries
+	e.groupsMu.Unlock()
+
+	if len(held) == 0 && len(recoveries) == 0 {
+		return
+	}
+
+	for _, alert := range held {
+		group := groupOf(alert)
+		group.firing = append(group.firing, alert)
+		if alert.PendingSince != nil && alert.PendingSince.Before(group.since) {
+			group.since = *alert.PendingSince
+		}
+	}
+	for _, recovery := range recoveries {
+		group := groupOf(recovery.alert)
+		group.resolved = append(group.resolved, recovery)
+		if recovery.alert.ResolvedAt != nil && recovery.alert.ResolvedAt.Before(group.since) {
+			group.since = *recovery.alert.ResolvedAt
+		}
+	}
+
+	e.groupsMu.Lock()
+	defer e.groupsMu.Unlock()
+
+	sent := make(map[*AlertState]bool)
+	for _, group := range groups {
+		if grouping.enabled() {
+			if now.Sub(group.since) < grouping.wait() || now.Sub(e.groupSentAt[group.key]) < grouping.interval() {
+				continue
+			}
+		}
+		e.sendGroup(group, config)
+		e.groupSentAt[group.key] = now
+
+		for _, alert := range group.firing {
+			alert.PendingChannels = nil
+			alert.PendingSince = nil
+			notifiedAt := now
+			alert.NotifiedAt = &notifiedAt
+		}
+		for _, recovery := range group.resolved {
+			sent[recovery.alert] = true
+		}
+	}
+
+	// Keep recoveries that are still waiting, including any added meanwhile
+	remaining := e.pendingRecoveries[:0:0]
+	for _, recovery := range e.pendingRecoveries {
+		if !sent[recovery.alert] {
+			remaining = append(remaining, recovery)
+		}
+	}
+	e.pendingRecoveries = remaining
+
+	for key, sentAt := range e.groupSentAt {
+		if now.Sub(sentAt) > grouping.interval() && groups[key] == nil {
+			delete(e.groupSentAt, key)
+		}
+	}
+}
+
+// sendGroup queues one message per channel with the group's alerts for
+// that channel. A message about a single alert uses the alert's own
+// template.
+func (e *AlertEngine) sendGroup(group *alertGroup, config *AlertConfig) {
+	sort.Slice(group.firing, func(i, j int) bool {
+		return group.firing[i].ServerName < group.firing[j].ServerName
+	})
+	sort.Slice(group.resolved, func(i, j int) bool {
+		return group.resolved[i].alert.ServerName < group.resolved[j].alert.ServerName
+	})
+
+	var channelIDs []string
+	for _, alert := range group.firing {
+		channelIDs = appendUnique(channelIDs, alert.PendingChannels...)
+	}
+	for _, recovery := range group.resolved {
+		channelIDs = appendUnique(channelIDs, recovery.channels...)
+	}
+
+	for _, channel := range enabledChannels(channelIDs, config) {
+		var firing []*AlertState
+		var resolved []*AlertState
+		for _, alert := range group.firing {
+			if contains(alert.PendingChannels, channel.ID) {
+				firing = append(firing, alert)
+			}
+		}
+		for _, recovery := range group.resolved {
+			if contains(recovery.channels, channel.ID) {
+				resolved = append(resolved, recovery.alert)
+			}
+		}
+
+		switch {
+		case len(firing) == 1 && len(resolved) == 0:
+			e.enqueue(channel, e.renderAlert(firing[0], channel, config))
+		case len(firing) == 0 && len(resolved) == 1:
+			e.enqueue(channel, e.renderRecovery(resolved[0], channel, config))
+		default:
+			e.enqueue(channel, renderGroupTemplate(group.summary, firing, resolved, channel, config))
+		}
+	}
+	fmt.Printf("🔔 Sent alert group %s: %d firing, %d resolved\n", group.key, len(group.firing), len(group.resolved))
+}
+
+// renderGroupTemplate renders a message about several alerts for a channel
+func renderGroupTemplate(summary string, firing, resolved []*AlertState, channel NotificationChannel, config *AlertConfig) *AlertEvent {
+	tmpl, _ := alertTemplate("group", channel, config)
+
+	severity := "warning"
+	firingData := make([]map[string]interface{}, 0, len(firing))
+	for _, alert := range firing {
+		if alert.Severity == "critical" {
+			severity = "critical"
+		}
+		firingData = append(firingData, map[string]interface{}{
+			"ServerName": alert.ServerName,
+			"ServerID":   alert.ServerID,
+			"AlertType":  alertTypeName(alert),
+			"Severity":   alert.Severity,
+			"Value":      alert.Value,
+			"Threshold":  alert.Threshold,
+			"Message":    alert.Message,
+			"Duration":   formatDuration(time.Since(alert.StartedAt)),
+		})
+	}
+	resolvedData := make([]map[string]interface{}, 0, len(resolved))
+	for _, alert := range resolved {
+		resolvedData = append(resolvedData, map[string]interface{}{
+			"ServerName": alert.ServerName,
+			"ServerID":   alert.ServerID,
+			"AlertType":  alertTypeName(alert),
+			"Duration":   formatDuration(alert.ResolvedAt.Sub(alert.StartedAt)),
+		})
+	}
+
+	data := map[string]interface{}{
+		"Summary":       summary,
+		"Severity":      severity,
+		"FiringCount":   len(firing),
+		"ResolvedCount": len(resolved),
+		"Firing":        firingData,
+		"Resolved":      resolvedData,
+	}
+	event := renderEvent(newAlertEvent(append(append([]*AlertState(nil), firing...), resolved...)...), tmpl, data)
+	event.Message = strings.TrimRight(event.Message, "\n")
+	return event
+}
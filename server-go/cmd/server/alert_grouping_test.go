@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlertGrouping tests collapsing related alerts into one notification
+func TestAlertGrouping(t *testing.T) {
+	forEachBackend(t, testAlertGrouping)
+}
+
+func testAlertGrouping(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.RecoveryNotify = true
+	alertConfig.Rules.Offline.Enabled = true
+	alertConfig.Rules.Offline.GracePeriod = 0
+	alertConfig.Grouping = AlertGrouping{By: []string{"type", "provider"}, Wait: 30, Interval: 300}
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": "http://127.0.0.1:1"}},
+	}
+	state := &AppState{
+		Config: &AppConfig{
+			AlertConfig: &alertConfig,
+			Servers: []RemoteServer{
+				{ID: "s1", Name: "Tokyo", Provider: "Vultr"},
+				{ID: "s2", Name: "Osaka", Provider: "Vultr"},
+				{ID: "s3", Name: "Berlin", Provider: "Hetzner"},
+			},
+		},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+	engine := NewAlertEngine(state, helper.db)
+	engine.startedAt = time.Now().Add(-time.Hour)
+
+	titles := func() []string {
+		events, _, _ := ListNotifications(helper.db, NotificationFilter{}, 100, 0)
+		var titles []string
+		for _, event := range events {
+			titles = append(titles, event.Title)
+		}
+		sort.Strings(titles)
+		return titles
+	}
+	age := func(d time.Duration) {
+		past := time.Now().Add(-d)
+		for _, alert := range engine.activeAlerts {
+			alert.PendingSince = &past
+		}
+		for _, recovery := range engine.pendingRecoveries {
+			recovery.alert.ResolvedAt = &past
+		}
+		for key := range engine.groupSentAt {
+			engine.groupSentAt[key] = past
+		}
+	}
+
+	// All servers go offline; nothing is sent during the group wait
+	engine.checkAlerts()
+	if alerts := engine.GetActiveAlerts(); len(alerts) != 3 {
+		t.Fatalf("Expected 3 offline alerts, got %+v", alerts)
+	}
+	if got := titles(); len(got) != 0 {
+		t.Fatalf("Expected notifications to wait for their group, got %v", got)
+	}
+
+	age(time.Minute)
+	engine.checkAlerts()
+	want := []string{"[critical] Berlin 离线告警", "[critical] 离线 / Vultr: 2 个告警"}
+	if got := titles(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for _, alert := range engine.activeAlerts {
+		if alert.NotifiedAt == nil || len(alert.PendingChannels) != 0 {
+			t.Errorf("Expected %s to be marked as notified, got %+v", alert.ServerName, alert)
+		}
+	}
+
+	// The Vultr servers recover; the combined recovery waits for the group interval
+	now := time.Now()
+	state.AgentMetrics["s1"] = &AgentMetricsData{ServerID: "s1", LastUpdated: now}
+	state.AgentMetrics["s2"] = &AgentMetricsData{ServerID: "s2", LastUpdated: now}
+	engine.checkAlerts()
+	age(time.Minute)
+	engine.checkAlerts()
+	if got := titles(); len(got) != 2 {
+		t.Fatalf("Expected the recovery to wait for the group interval, got %v", got)
+	}
+
+	age(10 * time.Minute)
+	engine.checkAlerts()
+	if got := titles(); len(got) != 3 || got[2] != "[恢复] 离线 / Vultr: 2 个告警已恢复" {
+		t.Fatalf("Expected one combined recovery, got %v", got)
+	}
+
+	// An alert that recovers before its group is sent is never announced
+	delete(state.AgentMetrics, "s1")
+	engine.checkAlerts()
+	state.AgentMetrics["s1"] = &AgentMetricsData{ServerID: "s1", LastUpdated: time.Now()}
+	engine.checkAlerts()
+	age(10 * time.Minute)
+	engine.checkAlerts()
+	if got := titles(); len(got) != 3 {
+		t.Errorf("Expected no notifications for a flapping server, got %v", got)
+	}
+
+	if err := (AlertGrouping{By: []string{""}}).Validate(); err == nil {
+		t.Error("Expected an empty group key to be rejected")
+	}
+}
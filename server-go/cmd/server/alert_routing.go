@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ============================================================================
+// Alert Routing
+// ============================================================================
+//
+// Routes decide which channels an alert goes to. They are tried in order;
+// a matching route hands the alert to the first of its child routes that
+// matches, and stops the search unless it sets continue. Child routes
+// inherit the channels, escalations and repeat interval they leave unset.
+// Alerts that match no route use the channels of their rule.
+
+// AlertMatcher selects alerts. Every field that is set must match; an empty
+// matcher matches everything.
+type AlertMatcher struct {
+	Servers    []string          `json:"servers,omitempty"`    // Server IDs
+	Dimensions map[string]string `json:"dimensions,omitempty"` // Dimension key or id (or tag, location, provider) -> value
+	Types      []string          `json:"types,omitempty"`      // offline, cpu, memory, disk, traffic, expiry, custom
+	Severities []string          `json:"severities,omitempty"` // warning, critical
+}
+
+// Empty reports whether the matcher has no conditions
+func (m AlertMatcher) Empty() bool {
+	return len(m.Servers) == 0 && len(m.Dimensions) == 0 && len(m.Types) == 0 && len(m.Severities) == 0
+}
+
+// Matches reports whether an alert on server is selected
+func (m AlertMatcher) Matches(alert *AlertState, server RemoteServer, dimensions []GroupDimension) bool {
+	if len(m.Servers) > 0 && !contains(m.Servers, alert.ServerID) {
+		return false
+	}
+	if len(m.Types) > 0 && !contains(m.Types, alert.Type) {
+		return false
+	}
+	if len(m.Severities) > 0 && !contains(m.Severities, alert.Severity) {
+		return false
+	}
+	if len(m.Dimensions) > 0 {
+		return ruleSelectsServer(CustomAlertRule{Selector: m.Dimensions}, server, dimensions)
+	}
+	return true
+}
+
+// AlertRoute sends matching alerts to a set of channels
+type AlertRoute struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name,omitempty"`
+	Match          AlertMatcher      `json:"match"`
+	Channels       []string          `json:"channels,omitempty"`
+	Escalations    []RouteEscalation `json:"escalations,omitempty"`
+	RepeatInterval int               `json:"repeat_interval,omitempty"` // Minutes between reminders while firing
+	Continue       bool              `json:"continue,omitempty"`        // Also try the following routes
+	Routes         []AlertRoute      `json:"routes,omitempty"`
+}
+
+// RouteEscalation notifies more channels when an alert has been firing
+// without being acknowledged for After minutes
+type RouteEscalation struct {
+	After    int      `json:"after"`
+	Channels []string `json:"channels"`
+}
+
+// routePlan is the combined outcome of routing one alert
+type routePlan struct {
+	Routes         []string // IDs of the matched routes
+	Channels       []string
+	Escalations    []RouteEscalation // Ordered by After
+	RepeatInterval time.Duration
+}
+
+// matchRoutes returns the routes an alert ends up in, with inherited
+// settings filled in
+func matchRoutes(routes []AlertRoute, parent AlertRoute, alert *AlertState, server RemoteServer, dimensions []GroupDimension) []AlertRoute {
+	var matched []AlertRoute
+	for _, route := range routes {
+		if !route.Match.Matches(alert, server, dimensions) {
+			continue
+		}
+		if len(route.Channels) == 0 {
+			route.Channels = parent.Channels
+		}
+		if route.Escalations == nil {
+			route.Escalations = parent.Escalations
+		}
+		if route.RepeatInterval == 0 {
+			route.RepeatInterval = parent.RepeatInterval
+		}
+
+		if children := matchRoutes(route.Routes, route, alert, server, dimensions); len(children) > 0 {
+			matched = append(matched, children...)
+		} else {
+			matched = append(matched, route)
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	return matched
+}
+
+// routeAlert works out the channels, escalations and reminders for an alert
+func (e *AlertEngine) routeAlert(alert *AlertState, config *AlertConfig) routePlan {
+	var plan routePlan
+	if len(config.Routes) > 0 {
+		server, dimensions := e.serverInfo(alert.ServerID)
+		for _, route := range matchRoutes(config.Routes, AlertRoute{}, alert, server, dimensions) {
+			plan.Routes = append(plan.Routes, route.ID)
+			plan.Channels = appendUnique(plan.Channels, route.Channels...)
+			plan.Escalations = append(plan.Escalations, route.Escalations...)
+			interval := time.Duration(route.RepeatInterval) * time.Minute
+			if interval > 0 && (plan.RepeatInterval == 0 || interval < plan.RepeatInterval) {
+				plan.RepeatInterval = interval
+			}
+		}
+		sort.SliceStable(plan.Escalations, func(i, j int) bool {
+			return plan.Escalations[i].After < plan.Escalations[j].After
+		})
+	}
+	if len(plan.Routes) == 0 {
+		plan.Channels = alertChannels(alert, config)
+	}
+	return plan
+}
+
+// notifiedChannels returns the channels that have been told about an alert:
+// its route's channels plus those of the escalations already reached
+func (p routePlan) notifiedChannels(alert *AlertState) []string {
+	channels := append([]string(nil), p.Channels...)
+	for i := 0; i < alert.EscalationLevel && i < len(p.Escalations); i++ {
+		channels = appendUnique(channels, p.Escalations[i].Channels...)
+	}
+	return channels
+}
+
+// processEscalations escalates alerts that nobody acknowledged and repeats
+// notifications for alerts that keep firing
+func (e *AlertEngine) processEscalations(config *AlertConfig) {
+	if len(config.Routes) == 0 {
+		return
+	}
+
+	e.alertsMu.RLock()
+	alerts := make([]*AlertState, 0, len(e.activeAlerts))
+	for _, alert := range e.activeAlerts {
+		alerts = append(alerts, alert)
+	}
+	e.alertsMu.RUnlock()
+
+	now := time.Now()
+	for _, alert := range alerts {
+		// Alerts that were never sent are still held back by a silence
+		if alert.NotifiedAt == nil || len(alert.SilencedBy) > 0 || alert.acknowledged() {
+			continue
+		}
+		plan := e.routeAlert(alert, config)
+
+		for alert.EscalationLevel < len(plan.Escalations) {
+			step := plan.Escalations[alert.EscalationLevel]
+			if now.Sub(alert.StartedAt) < time.Duration(step.After)*time.Minute {
+				break
+			}
+			alert.EscalationLevel++
+			fmt.Printf("🔔 Escalating alert %s (%s) after %d minutes\n", alert.ID, alert.ServerName, step.After)
+			e.sendNotification(alert, step.Channels, config)
+		}
+
+		if plan.RepeatInterval > 0 && now.Sub(*alert.NotifiedAt) >= plan.RepeatInterval {
+			e.sendNotification(alert, plan.notifiedChannels(alert), config)
+		}
+	}
+}
+
+// validateRoutes checks a routing tree against the configured channels and
+// assigns IDs to new routes
+func validateRoutes(routes []AlertRoute, channels []NotificationChannel) error {
+	known := make(map[string]bool, len(channels))
+	for _, ch := range channels {
+		known[ch.ID] = true
+	}
+	checkChannels := func(ids []string) error {
+		for _, id := range ids {
+			if !known[id] {
+				return fmt.Errorf("unknown channel %q", id)
+			}
+		}
+		return nil
+	}
+
+	for i := range routes {
+		route := &routes[i]
+		if route.ID == "" {
+			route.ID = GenerateRandomString(12)
+		}
+		if err := checkChannels(route.Channels); err != nil {
+			return err
+		}
+		if route.RepeatInterval < 0 {
+			return fmt.Errorf("route %s: repeat_interval must not be negative", route.ID)
+		}
+		for _, step := range route.Escalations {
+			if step.After <= 0 {
+				return fmt.Errorf("route %s: escalation after must be at least 1 minute", route.ID)
+			}
+			if len(step.Channels) == 0 {
+				return fmt.Errorf("route %s: escalation needs channels", route.ID)
+			}
+			if err := checkChannels(step.Channels); err != nil {
+				return err
+			}
+		}
+		if err := validateRoutes(route.Routes, channels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendUnique appends the items not already in list
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
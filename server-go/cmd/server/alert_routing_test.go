@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRouteAlert tests choosing channels from the routing tree
+func TestRouteAlert(t *testing.T) {
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Rules.Load.Channels = []string{"rule"}
+	alertConfig.Routes = []AlertRoute{
+		{
+			ID:             "critical",
+			Match:          AlertMatcher{Severities: []string{"critical"}},
+			Channels:       []string{"oncall"},
+			RepeatInterval: 60,
+			Continue:       true,
+			Routes: []AlertRoute{
+				{ID: "critical-asia", Match: AlertMatcher{Dimensions: map[string]string{"region": "asia"}}, Channels: []string{"asia-oncall"}},
+				{ID: "critical-db", Match: AlertMatcher{Dimensions: map[string]string{"tag": "db"}}, RepeatInterval: 15},
+			},
+		},
+		{ID: "offline", Match: AlertMatcher{Types: []string{"offline"}}, Channels: []string{"ops"}},
+		{ID: "never", Match: AlertMatcher{Types: []string{"offline"}}, Channels: []string{"unused"}},
+	}
+	state := &AppState{Config: &AppConfig{
+		AlertConfig: &alertConfig,
+		GroupDimensions: []GroupDimension{
+			{ID: "dim-region", Key: "region", Options: []GroupOption{{ID: "asia", Name: "Asia"}}},
+		},
+		Servers: []RemoteServer{
+			{ID: "tokyo", Tag: "db", GroupValues: map[string]string{"dim-region": "asia"}},
+			{ID: "paris", Tag: "db"},
+			{ID: "berlin"},
+		},
+	}}
+	engine := &AlertEngine{state: state}
+
+	tests := []struct {
+		alert    AlertState
+		routes   []string
+		channels []string
+		repeat   time.Duration
+	}{
+		{AlertState{Type: "offline", Severity: "critical", ServerID: "tokyo"}, []string{"critical-asia", "offline"}, []string{"asia-oncall", "ops"}, time.Hour},
+		{AlertState{Type: "cpu", Severity: "critical", ServerID: "paris"}, []string{"critical-db"}, []string{"oncall"}, 15 * time.Minute},
+		{AlertState{Type: "cpu", Severity: "critical", ServerID: "berlin"}, []string{"critical"}, []string{"oncall"}, time.Hour},
+		{AlertState{Type: "cpu", Severity: "warning", ServerID: "berlin"}, nil, []string{"rule"}, 0},
+	}
+	for _, tt := range tests {
+		plan := engine.routeAlert(&tt.alert, &alertConfig)
+		if !reflect.DeepEqual(plan.Routes, tt.routes) || !reflect.DeepEqual(plan.Channels, tt.channels) || plan.RepeatInterval != tt.repeat {
+			t.Errorf("routeAlert(%s on %s) = %+v, want routes %v channels %v repeat %v",
+				tt.alert.Severity, tt.alert.ServerID, plan, tt.routes, tt.channels, tt.repeat)
+		}
+	}
+
+	if err := validateRoutes([]AlertRoute{{Channels: []string{"missing"}}}, nil); err == nil {
+		t.Error("Expected routes with unknown channels to be rejected")
+	}
+	if err := validateRoutes([]AlertRoute{{Escalations: []RouteEscalation{{After: 0, Channels: []string{"a"}}}}}, []NotificationChannel{{ID: "a"}}); err == nil {
+		t.Error("Expected an escalation without a delay to be rejected")
+	}
+}
+
+// TestAlertEscalation tests escalating and repeating unacknowledged alerts
+func TestAlertEscalation(t *testing.T) {
+	forEachBackend(t, testAlertEscalation)
+}
+
+func testAlertEscalation(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	hook := func(id string, priority int) NotificationChannel {
+		return NotificationChannel{ID: id, Type: "webhook", Name: id, Enabled: true, Priority: priority, Config: map[string]string{"url": "http://127.0.0.1:1"}}
+	}
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.Channels = []NotificationChannel{hook("chat", 2), hook("pager", 1), hook("manager", 0)}
+	alertConfig.Routes = []AlertRoute{{
+		ID:             "all",
+		Channels:       []string{"chat", "pager"},
+		RepeatInterval: 30,
+		Escalations: []RouteEscalation{
+			{After: 20, Channels: []string{"manager"}},
+		},
+	}}
+	state := &AppState{
+		Config:       &AppConfig{AlertConfig: &alertConfig, Servers: []RemoteServer{{ID: "s1", Name: "Tokyo"}}},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+	engine := NewAlertEngine(state, helper.db)
+
+	sent := func() []string {
+		events, _, _ := ListNotifications(helper.db, NotificationFilter{}, 100, 0)
+		var channels []string
+		for i := len(events) - 1; i >= 0; i-- {
+			channels = append(channels, events[i].ChannelID)
+		}
+		return channels
+	}
+
+	alert := &AlertState{ID: "a1", Type: "cpu", ServerID: "s1", ServerName: "Tokyo", Severity: "critical", Status: "firing", StartedAt: time.Now()}
+	engine.activeAlerts["cpu:s1"] = alert
+	engine.notify(alert, &alertConfig)
+	if got := sent(); !reflect.DeepEqual(got, []string{"pager", "chat"}) {
+		t.Fatalf("Expected the route's channels in priority order, got %v", got)
+	}
+
+	// Nothing happens before the escalation is due
+	engine.processEscalations(&alertConfig)
+	if got := sent(); len(got) != 2 {
+		t.Fatalf("Expected no escalation yet, got %v", got)
+	}
+
+	alert.StartedAt = time.Now().Add(-25 * time.Minute)
+	engine.processEscalations(&alertConfig)
+	engine.processEscalations(&alertConfig)
+	if got := sent(); !reflect.DeepEqual(got, []string{"pager", "chat", "manager"}) {
+		t.Fatalf("Expected a single escalation to the manager, got %v", got)
+	}
+
+	// Reminders go to everyone notified so far
+	notifiedAt := time.Now().Add(-31 * time.Minute)
+	alert.NotifiedAt = &notifiedAt
+	engine.processEscalations(&alertConfig)
+	if got := sent(); !reflect.DeepEqual(got[3:], []string{"manager", "pager", "chat"}) {
+		t.Fatalf("Expected a reminder to all notified channels, got %v", got)
+	}
+
+	// Acknowledged alerts are not repeated
+	alert.Muted = true
+	alert.NotifiedAt = &notifiedAt
+	engine.processEscalations(&alertConfig)
+	if got := sent(); len(got) != 6 {
+		t.Errorf("Expected no reminder for an acknowledged alert, got %v", got)
+	}
+
+	engine.resolveAlert("cpu:s1", &alertConfig)
+	if got := sent(); !reflect.DeepEqual(got[6:], []string{"manager", "pager", "chat"}) {
+		t.Errorf("Expected the recovery to reach all notified channels, got %v", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ============================================================================
+// Alert State Persistence
+// ============================================================================
+
+// loadAlertState reads the firing alerts and cooldowns saved by
+// saveAlertState
+func loadAlertState(db *sql.DB) (map[string]*AlertState, map[string]time.Time, error) {
+	alerts := make(map[string]*AlertState)
+	rows, err := db.Query("SELECT alert_key, alert FROM alert_state")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, data string
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, nil, err
+		}
+		var alert AlertState
+		if json.Unmarshal([]byte(data), &alert) == nil {
+			alerts[key] = &alert
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	cooldowns := make(map[string]time.Time)
+	rows, err = db.Query("SELECT cooldown_key, last_notified FROM alert_cooldowns")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, lastNotified string
+		if err := rows.Scan(&key, &lastNotified); err != nil {
+			return nil, nil, err
+		}
+		if t, err := time.Parse(time.RFC3339, lastNotified); err == nil {
+			cooldowns[key] = t
+		}
+	}
+	return alerts, cooldowns, rows.Err()
+}
+
+// saveAlertState replaces the stored alert state
+func saveAlertState(alerts map[string]*AlertState, cooldowns map[string]time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return dbWriter.WriteSync(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("DELETE FROM alert_state"); err != nil {
+			return err
+		}
+		for key, alert := range alerts {
+			data, err := json.Marshal(alert)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("INSERT INTO alert_state (alert_key, alert, updated_at) VALUES (?, ?, ?)", key, string(data), now); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM alert_cooldowns"); err != nil {
+			return err
+		}
+		for key, t := range cooldowns {
+			if _, err := tx.Exec("INSERT INTO alert_cooldowns (cooldown_key, last_notified) VALUES (?, ?)", key, t.UTC().Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// TestAlertStatePersistence tests restoring alert state after a restart
+func TestAlertStatePersistence(t *testing.T) {
+	forEachBackend(t, testAlertStatePersistence)
+}
+
+func testAlertStatePersistence(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.Rules.Offline.Enabled = true
+	alertConfig.Rules.Load.Enabled = true
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": "http://127.0.0.1:1"}},
+	}
+	state := &AppState{
+		Config: &AppConfig{
+			AlertConfig: &alertConfig,
+			Servers: []RemoteServer{
+				{ID: "s1", Name: "Tokyo"},
+				{ID: "s2", Name: "Paris"},
+				{ID: "s3", Name: "Berlin"},
+			},
+		},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+
+	started := time.Now().Add(-time.Hour)
+	before := NewAlertEngine(state, helper.db)
+	before.activeAlerts["offline:s1"] = &AlertState{ID: "a1", Type: "offline", ServerID: "s1", ServerName: "Tokyo", Severity: "critical", Status: "firing", StartedAt: started}
+	before.activeAlerts["cpu:s2"] = &AlertState{ID: "a2", Type: "cpu", ServerID: "s2", ServerName: "Paris", Severity: "warning", Status: "firing", StartedAt: started}
+	before.activeAlerts["offline:gone"] = &AlertState{ID: "a3", Type: "offline", ServerID: "gone", Status: "firing", StartedAt: started}
+	before.setCooldown("cpu:s2", 300)
+	if !before.MuteAlert("a1") {
+		t.Fatal("MuteAlert failed")
+	}
+
+	// Restart
+	after := NewAlertEngine(state, helper.db)
+	alerts := after.GetActiveAlerts()
+	if len(alerts) != 3 {
+		t.Fatalf("Expected 3 restored alerts, got %+v", alerts)
+	}
+	if a := after.activeAlerts["offline:s1"]; a == nil || !a.Muted || !a.StartedAt.Equal(started) {
+		t.Errorf("Expected muted offline alert to be restored, got %+v", a)
+	}
+	if after.checkCooldown("cpu:s2", 300) {
+		t.Error("Expected cooldown to be restored")
+	}
+
+	// Both servers recovered while the server was down; s3 has not
+	// reconnected yet and is still within the grace period
+	now := time.Now()
+	state.AgentMetrics["s1"] = &AgentMetricsData{ServerID: "s1", LastUpdated: now}
+	state.AgentMetrics["s2"] = &AgentMetricsData{ServerID: "s2", LastUpdated: now}
+	after.checkAlerts()
+
+	if alerts := after.GetActiveAlerts(); len(alerts) != 0 {
+		t.Errorf("Expected all alerts to be resolved, got %+v", alerts)
+	}
+
+	events, _, err := ListNotifications(helper.db, NotificationFilter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListNotifications failed: %v", err)
+	}
+	recovered := map[string]bool{}
+	for _, event := range events {
+		recovered[event.AlertID] = true
+	}
+	if len(events) != 2 || !recovered["a1"] || !recovered["a2"] {
+		t.Errorf("Expected recovery notifications for a1 and a2 only, got %+v", events)
+	}
+
+	var stored int
+	helper.db.QueryRow("SELECT COUNT(*) FROM alert_state").Scan(&stored)
+	if stored != 0 {
+		t.Errorf("Expected resolved alerts to be removed from the saved state, got %d", stored)
+	}
+	var history int
+	dbWriter.WriteSync(func(db *sql.DB) error { return nil }) // Wait for queued history writes
+	helper.db.QueryRow("SELECT COUNT(*) FROM alert_history").Scan(&history)
+	if history != 3 {
+		t.Errorf("Expected 3 history entries, got %d", history)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Anomaly and Forecast Alert Detection
+// ============================================================================
+//
+// Anomaly alerts compare a server with its own history: the average of the
+// last few minutes against the same hour of previous weeks, taken from
+// metrics_hourly_agg. Forecast alerts extrapolate the current growth of disk
+// usage (metrics_hourly_agg) and of the monthly traffic (TrafficManager).
+// The aggregates only record the first disk of each server.
+
+// trendCheckInterval is how often anomaly and forecast rules are evaluated;
+// they are based on aggregates that change slowly
+const trendCheckInterval = 5 * time.Minute
+
+// minBaselineWeeks is the least history an anomaly baseline needs
+const minBaselineWeeks = 2
+
+// minDiskTrendPoints is the least hourly points a disk forecast needs
+const minDiskTrendPoints = 6
+
+// minTrafficForecastAge is how far into a billing period traffic is
+// forecast, so that the first hours do not set the rate
+const minTrafficForecastAge = 24 * time.Hour
+
+// checkTrendAlerts evaluates the anomaly and forecast rules
+func (e *AlertEngine) checkTrendAlerts(servers []serverState, config *AlertConfig) {
+	if !config.Rules.Anomaly.Enabled && !config.Rules.Forecast.Enabled {
+		return
+	}
+	if e.db == nil || time.Since(e.trendCheckedAt) < trendCheckInterval {
+		return
+	}
+	e.trendCheckedAt = time.Now()
+
+	if config.Rules.Anomaly.Enabled {
+		e.checkAnomalyAlerts(servers, config)
+	}
+	if config.Rules.Forecast.Enabled {
+		e.checkForecastAlerts(servers, config)
+	}
+}
+
+// trendAlertKey returns the active alert key of an anomaly or forecast
+func trendAlertKey(alertType, metric, serverID string) string {
+	return fmt.Sprintf("%s:%s:%s", alertType, metric, serverID)
+}
+
+// ruleCoversServer applies a rule's server and exclude lists
+func ruleCoversServer(servers, exclude []string, serverID string) bool {
+	if contains(exclude, serverID) {
+		return false
+	}
+	return len(servers) == 0 || contains(servers, serverID)
+}
+
+// setTrendAlert raises, updates or resolves an anomaly or forecast alert
+func (e *AlertEngine) setTrendAlert(alertKey string, alert AlertState, firing bool, cooldown int, config *AlertConfig) {
+	e.alertsMu.RLock()
+	existing := e.activeAlerts[alertKey]
+	e.alertsMu.RUnlock()
+
+	if !firing {
+		if existing != nil {
+			e.resolveAlert(alertKey, config)
+		}
+		return
+	}
+	if alert.Severity == "" {
+		alert.Severity = "warning"
+	}
+
+	if existing != nil {
+		existing.Severity = alert.Severity
+		existing.Value = alert.Value
+		existing.Threshold = alert.Threshold
+		existing.Message = alert.Message
+		existing.UpdatedAt = time.Now()
+		return
+	}
+	if !e.checkCooldown(alertKey, cooldown) {
+		return
+	}
+
+	alert.ID = GenerateRandomString(16)
+	alert.Status = "firing"
+	alert.StartedAt = time.Now()
+	alert.UpdatedAt = alert.StartedAt
+
+	e.alertsMu.Lock()
+	e.activeAlerts[alertKey] = &alert
+	e.alertsMu.Unlock()
+
+	e.notify(&alert, config)
+	e.setCooldown(alertKey, cooldown)
+}
+
+// ============================================================================
+// Anomaly Detection
+// ============================================================================
+
+// metricBaseline is the mean and spread of a metric over previous weeks
+type metricBaseline struct {
+	Mean   float64
+	StdDev float64
+	Weeks  int
+}
+
+// anomalyMetrics maps anomaly metrics to their aggregate column
+var anomalyMetrics = map[string]string{
+	"cpu":    "cpu_sum",
+	"memory": "memory_sum",
+}
+
+func (e *AlertEngine) checkAnomalyAlerts(servers []serverState, config *AlertConfig) {
+	rule := config.Rules.Anomaly
+	metrics := rule.Metrics
+	if len(metrics) == 0 {
+		metrics = []string{"cpu", "memory"}
+	}
+	sigma := rule.Sigma
+	if sigma <= 0 {
+		sigma = 3
+	}
+	minDelta := rule.MinDelta
+	if minDelta <= 0 {
+		minDelta = 10
+	}
+	weeks := rule.Weeks
+	if weeks <= 0 || weeks > 4 {
+		weeks = 4 // Hourly aggregates are kept for 32 days
+	}
+	window := rule.Window
+	if window <= 0 {
+		window = 30
+	}
+
+	now := time.Now()
+	for _, server := range servers {
+		covered := ruleCoversServer(rule.Servers, rule.Exclude, server.ID)
+		for _, metric := range metrics {
+			column, ok := anomalyMetrics[metric]
+			if !ok {
+				continue
+			}
+			alertKey := trendAlertKey("anomaly", metric, server.ID)
+			// Offline servers keep their state; the offline rule covers them
+			if covered && !server.Online {
+				continue
+			}
+
+			var firing bool
+			alert := AlertState{Type: "anomaly", ServerID: server.ID, ServerName: server.Name, Severity: rule.Severity}
+			if covered {
+				current, okCurrent := e.recentAverage(server.ID, column, now, window)
+				baseline, okBaseline := e.hourlyBaseline(server.ID, column, now, weeks)
+				if okCurrent && okBaseline {
+					threshold := baseline.Mean + math.Max(sigma*baseline.StdDev, minDelta)
+					firing = current > threshold
+					alert.Value = math.Round(current*10) / 10
+					alert.Threshold = math.Round(threshold*10) / 10
+					alert.Message = fmt.Sprintf("服务器 %s 最近 %d 分钟%s平均使用率 %.1f%%，过去 %d 周同一时段为 %.1f%%（标准差 %.1f）",
+						server.Name, window, getMetricName(metric), current, baseline.Weeks, baseline.Mean, baseline.StdDev)
+				}
+			}
+			e.setTrendAlert(alertKey, alert, firing, rule.Cooldown, config)
+		}
+	}
+}
+
+// recentAverage returns the average of a metric over the last minutes,
+// from the 2-minute aggregates
+func (e *AlertEngine) recentAverage(serverID, column string, now time.Time, minutes int) (float64, bool) {
+	since := now.Add(-time.Duration(minutes)*time.Minute).Unix() / 120
+	var sum, samples float64
+	err := e.db.QueryRow(`
+		SELECT COALESCE(SUM(`+column+`), 0), COALESCE(SUM(sample_count), 0)
+		FROM metrics_2min WHERE server_id = ? AND bucket >= ?`, serverID, since).Scan(&sum, &samples)
+	if err != nil || samples == 0 {
+		return 0, false
+	}
+	return sum / samples, true
+}
+
+// hourlyBaseline returns the mean and standard deviation of a metric in the
+// same hour of the previous weeks
+func (e *AlertEngine) hourlyBaseline(serverID, column string, now time.Time, weeks int) (metricBaseline, bool) {
+	hour := now.Unix() / 3600
+	buckets := make([]interface{}, 0, weeks+1)
+	buckets = append(buckets, serverID)
+	for week := 1; week <= weeks; week++ {
+		buckets = append(buckets, hour-int64(week)*7*24)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", weeks), ", ")
+
+	rows, err := e.db.Query(`
+		SELECT `+column+` / sample_count FROM metrics_hourly_agg
+		WHERE server_id = ? AND sample_count > 0 AND bucket IN (`+placeholders+`)`, buckets...)
+	if err != nil {
+		return metricBaseline{}, false
+	}
+	defer rows.Close()
+
+	var values []float64
+	for rows.Next() {
+		var value float64
+		if rows.Scan(&value) == nil {
+			values = append(values, value)
+		}
+	}
+	if len(values) < minBaselineWeeks {
+		return metricBaseline{}, false
+	}
+
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values) - 1)
+	return metricBaseline{Mean: mean, StdDev: math.Sqrt(variance), Weeks: len(values)}, true
+}
+
+// ============================================================================
+// Exhaustion Forecasts
+// ============================================================================
+
+func (e *AlertEngine) checkForecastAlerts(servers []serverState, config *AlertConfig) {
+	rule := config.Rules.Forecast
+	diskHours := rule.DiskHours
+	if diskHours <= 0 {
+		diskHours = 72
+	}
+	window := rule.Window
+	if window <= 0 {
+		window = 24
+	}
+
+	var traffic map[string]TrafficStats
+	if rule.Traffic && trafficManager != nil {
+		traffic = make(map[string]TrafficStats)
+		for _, stats := range trafficManager.GetAllStats() {
+			traffic[stats.ServerID] = stats
+		}
+	}
+
+	now := time.Now()
+	for _, server := range servers {
+		covered := ruleCoversServer(rule.Servers, rule.Exclude, server.ID)
+
+		// Disk: only while online, as the live usage is the starting point
+		if !covered || !rule.Disk || server.Online {
+			alert := AlertState{Type: "forecast", ServerID: server.ID, ServerName: server.Name, Severity: rule.Severity}
+			var firing bool
+			if covered && rule.Disk {
+				if slope, ok := e.diskGrowthRate(server.ID, now, window); ok && slope > 0 && server.Disk < 100 {
+					hoursLeft := (100 - float64(server.Disk)) / slope
+					firing = hoursLeft < float64(diskHours)
+					alert.Value = math.Round(hoursLeft*10) / 10
+					alert.Threshold = float64(diskHours)
+					alert.Message = fmt.Sprintf("服务器 %s 磁盘使用率 %.1f%%，按最近 %d 小时每小时 %.2f%% 的增长，预计 %s 后写满",
+						server.Name, server.Disk, window, slope, formatDuration(time.Duration(hoursLeft*float64(time.Hour))))
+				}
+			}
+			e.setTrendAlert(trendAlertKey("forecast", "disk", server.ID), alert, firing, rule.Cooldown, config)
+		}
+
+		alert := AlertState{Type: "forecast", ServerID: server.ID, ServerName: server.Name, Severity: rule.Severity}
+		var firing bool
+		if stats, ok := traffic[server.ID]; ok && covered {
+			firing = trafficForecast(stats, now, &alert)
+		}
+		e.setTrendAlert(trendAlertKey("forecast", "traffic", server.ID), alert, firing, rule.Cooldown, config)
+	}
+}
+
+// diskGrowthRate returns the growth of disk usage in percentage points per
+// hour, fitted over the last hours of aggregates
+func (e *AlertEngine) diskGrowthRate(serverID string, now time.Time, hours int) (float64, bool) {
+	since := now.Add(-time.Duration(hours)*time.Hour).Unix() / 3600
+	rows, err := e.db.Query(`
+		SELECT bucket, disk_sum / sample_count FROM metrics_hourly_agg
+		WHERE server_id = ? AND sample_count > 0 AND bucket >= ?`, serverID, since)
+	if err != nil {
+		return 0, false
+	}
+	defer rows.Close()
+
+	var xs, ys []float64
+	for rows.Next() {
+		var bucket int64
+		var usage float64
+		if rows.Scan(&bucket, &usage) == nil {
+			xs = append(xs, float64(bucket))
+			ys = append(ys, usage)
+		}
+	}
+	if len(xs) < minDiskTrendPoints {
+		return 0, false
+	}
+	return linearSlope(xs, ys)
+}
+
+// linearSlope fits a least-squares line and returns its slope
+func linearSlope(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var num, den float64
+	for i := range xs {
+		num += (xs[i] - meanX) * (ys[i] - meanY)
+		den += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
+
+// trafficForecast reports whether a server's traffic will pass its monthly
+// limit before the period resets, at the average rate of the period so far,
+// and fills in the alert's values
+func trafficForecast(stats TrafficStats, now time.Time, alert *AlertState) bool {
+	elapsed := now.Sub(stats.PeriodStart)
+	period := stats.PeriodEnd.Sub(stats.PeriodStart)
+	used := stats.CalculateUsage()
+	if stats.MonthlyLimitGB <= 0 || elapsed < minTrafficForecastAge || period <= elapsed || used <= 0 {
+		return false
+	}
+	// Already over the limit: the traffic rule reports that
+	if used >= stats.MonthlyLimitGB {
+		return false
+	}
+
+	scale := float64(period) / float64(elapsed)
+	projected := stats
+	projected.TxBytesGB *= scale
+	projected.RxBytesGB *= scale
+	projected.TotalBytesGB *= scale
+	total := projected.CalculateUsage()
+	if total <= stats.MonthlyLimitGB {
+		return false
+	}
+
+	exceedAt := stats.PeriodStart.Add(time.Duration(float64(elapsed) * stats.MonthlyLimitGB / used))
+	alert.Value = math.Round(total*10) / 10
+	alert.Threshold = stats.MonthlyLimitGB
+	alert.Message = fmt.Sprintf("服务器 %s 本周期流量已用 %.1fGB / %.1fGB，按当前速度预计 %s 超出限额（%s 重置），周期结束时约 %.1fGB",
+		alert.ServerName, used, stats.MonthlyLimitGB, exceedAt.Local().Format("01-02 15:04"), stats.PeriodEnd.Local().Format("01-02"), total)
+	return true
+}
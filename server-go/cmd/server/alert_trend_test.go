@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTrendAlerts tests baseline anomaly and capacity forecast alerts
+func TestTrendAlerts(t *testing.T) {
+	forEachBackend(t, testTrendAlerts)
+}
+
+func testTrendAlerts(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter, oldTraffic := dbWriter, trafficManager
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter, trafficManager = oldWriter, oldTraffic
+	}()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.Rules.Anomaly.Enabled = true
+	alertConfig.Rules.Forecast.Enabled = true
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": "http://127.0.0.1:1"}},
+	}
+	now := time.Now()
+	state := &AppState{
+		Config: &AppConfig{
+			AlertConfig: &alertConfig,
+			Servers:     []RemoteServer{{ID: "s1", Name: "Tokyo"}, {ID: "s2", Name: "Berlin"}},
+		},
+		AgentMetrics: map[string]*AgentMetricsData{
+			"s1": {ServerID: "s1", LastUpdated: now, Metrics: SystemMetrics{Disks: []DiskMetrics{{UsagePercent: 90}}}},
+			"s2": {ServerID: "s2", LastUpdated: now, Metrics: SystemMetrics{Disks: []DiskMetrics{{UsagePercent: 40}}}},
+		},
+	}
+	engine := NewAlertEngine(state, helper.db)
+
+	insert := func(table, serverID string, bucket int64, cpu, memory, disk float64) {
+		t.Helper()
+		_, err := helper.db.Exec("INSERT INTO "+table+" (server_id, bucket, cpu_sum, memory_sum, disk_sum, sample_count) VALUES (?, ?, ?, ?, ?, 10)",
+			serverID, bucket, cpu*10, memory*10, disk*10)
+		if err != nil {
+			t.Fatalf("Failed to insert %s: %v", table, err)
+		}
+	}
+
+	// Tokyo normally idles at 20% CPU and 40% memory in this hour; Berlin at 60% CPU
+	hour := now.Unix() / 3600
+	for week, cpu := range []float64{20, 22, 18, 21} {
+		insert("metrics_hourly_agg", "s1", hour-int64(week+1)*168, cpu, 40, 50)
+		insert("metrics_hourly_agg", "s2", hour-int64(week+1)*168, 60+cpu/10, 40, 40)
+	}
+	// Tokyo's disk has grown by 1% per hour over the last half day
+	for i := int64(1); i <= 12; i++ {
+		insert("metrics_hourly_agg", "s1", hour-i, 0, 0, 90-float64(i))
+	}
+	bucket := now.Unix() / 120
+	insert("metrics_2min", "s1", bucket, 85, 42, 90)
+	insert("metrics_2min", "s2", bucket, 65, 40, 40)
+
+	// Berlin used 600GB of 1TB in the first third of its period
+	trafficManager = NewTrafficManager(state, helper.db)
+	trafficManager.stats["s2"] = &TrafficStats{
+		ServerID:       "s2",
+		PeriodStart:    now.Add(-10 * 24 * time.Hour),
+		PeriodEnd:      now.Add(20 * 24 * time.Hour),
+		TotalBytesGB:   600,
+		MonthlyLimitGB: 1000,
+		ThresholdType:  string(TrafficTypeSum),
+	}
+
+	check := func() map[string]*AlertState {
+		engine.trendCheckedAt = time.Time{}
+		engine.checkAlerts()
+		alerts := make(map[string]*AlertState)
+		for key, alert := range engine.activeAlerts {
+			alerts[key] = alert
+		}
+		return alerts
+	}
+
+	alerts := check()
+	want := []string{"anomaly:cpu:s1", "forecast:disk:s1", "forecast:traffic:s2"}
+	if len(alerts) != len(want) {
+		t.Fatalf("Expected alerts %v, got %v", want, alerts)
+	}
+	for _, key := range want {
+		if alerts[key] == nil {
+			t.Fatalf("Expected alert %s, got %v", key, alerts)
+		}
+	}
+	if a := alerts["forecast:disk:s1"]; a.Value < 9 || a.Value > 11 || a.Threshold != 72 {
+		t.Errorf("Expected about 10 hours until the disk is full, got %+v", a)
+	}
+	if a := alerts["forecast:traffic:s2"]; a.Value != 1800 || !strings.Contains(a.Message, "600.0GB / 1000.0GB") {
+		t.Errorf("Expected a projection of 1800GB, got %+v", a)
+	}
+	if events, _, _ := ListNotifications(helper.db, NotificationFilter{}, 100, 0); len(events) != 3 {
+		t.Errorf("Expected 3 notifications, got %d", len(events))
+	}
+
+	// Checks are throttled between runs
+	engine.checkAlerts()
+	if len(engine.activeAlerts) != 3 {
+		t.Errorf("Expected unchanged alerts, got %v", engine.activeAlerts)
+	}
+
+	// The CPU load returns to its usual level
+	if _, err := helper.db.Exec("UPDATE metrics_2min SET cpu_sum = 250 WHERE server_id = ?", "s1"); err != nil {
+		t.Fatalf("Failed to update metrics: %v", err)
+	}
+	if alerts := check(); alerts["anomaly:cpu:s1"] != nil {
+		t.Errorf("Expected the anomaly to resolve, got %+v", alerts["anomaly:cpu:s1"])
+	}
+
+	// Excluded servers are not forecast
+	alertConfig.Rules.Forecast.Exclude = []string{"s2"}
+	if alerts := check(); alerts["forecast:traffic:s2"] != nil || alerts["forecast:disk:s1"] == nil {
+		t.Errorf("Expected only Tokyo's disk forecast, got %v", alerts)
+	}
+
+	// Disabling the rules closes their alerts
+	alertConfig.Rules.Forecast.Enabled = false
+	if alerts := check(); len(alerts) != 0 {
+		t.Errorf("Expected no alerts, got %v", alerts)
+	}
+}
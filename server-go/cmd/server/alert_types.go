@@ -16,24 +16,48 @@ type AlertConfig struct {
 	Templates       map[string]AlertTemplate `json:"templates,omitempty"`
 	GlobalCooldown  int                      `json:"global_cooldown,omitempty"`  // Seconds between same type alerts
 	RecoveryNotify  bool                     `json:"recovery_notify,omitempty"` // Send notification when alert recovers
+	Routes          []AlertRoute             `json:"routes,omitempty"`          // Routing tree; rule channels are used when empty
+	PublicURL       string                   `json:"public_url,omitempty"`      // Dashboard address used for acknowledge links
+	Grouping        AlertGrouping            `json:"grouping"`                  // Collapse related alerts into one notification
 }
 
 // NotificationChannel represents a configured notification channel
 type NotificationChannel struct {
-	ID       string            `json:"id"`
-	Type     string            `json:"type"` // email, telegram, discord, webhook, bark, serverchan
-	Name     string            `json:"name"`
-	Enabled  bool              `json:"enabled"`
-	Config   map[string]string `json:"config"`
-	Priority int               `json:"priority,omitempty"` // Lower priority = notify first
+	ID        string                   `json:"id"`
+	Type      string                   `json:"type"` // email, telegram, discord, webhook, bark, serverchan, slack, teams, matrix, ntfy, gotify, pagerduty, dingtalk, feishu, wecom
+	Name      string                   `json:"name"`
+	Enabled   bool                     `json:"enabled"`
+	Config    map[string]string        `json:"config"`
+	Priority  int                      `json:"priority,omitempty"`  // Lower priority = notify first
+	Templates map[string]AlertTemplate `json:"templates,omitempty"` // Overrides of the alert templates for this channel
 }
 
 // AlertRules contains all alert rule configurations
 type AlertRules struct {
-	Offline OfflineAlertRule `json:"offline"`
-	Load    LoadAlertRule    `json:"load"`
-	Traffic TrafficAlertRule `json:"traffic"`
-	Expiry  ExpiryAlertRule  `json:"expiry"`
+	Offline OfflineAlertRule  `json:"offline"`
+	Load    LoadAlertRule     `json:"load"`
+	Traffic TrafficAlertRule  `json:"traffic"`
+	Expiry  ExpiryAlertRule   `json:"expiry"`
+	Custom  []CustomAlertRule `json:"custom,omitempty"`
+	Anomaly  AnomalyAlertRule  `json:"anomaly"`
+	Forecast ForecastAlertRule `json:"forecast"`
+}
+
+// CustomAlertRule fires when an expression over agent metrics holds
+// (see alert_expr.go for the syntax)
+type CustomAlertRule struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Enabled     bool              `json:"enabled"`
+	Expr        string            `json:"expr"`               // e.g. load_average.five > cores * 1.5
+	For         int               `json:"for,omitempty"`      // Seconds the expression must hold before firing
+	Severity    string            `json:"severity"`           // warning, critical
+	Selector    map[string]string `json:"selector,omitempty"` // Dimension key (or id, name, location, provider, tag) -> value
+	Servers     []string          `json:"servers"`            // Server IDs to monitor (empty = all)
+	Exclude     []string          `json:"exclude"`            // Server IDs to exclude
+	Channels    []string          `json:"channels"`
+	Cooldown    int               `json:"cooldown,omitempty"` // Seconds between alerts for same server
+	Message     string            `json:"message,omitempty"`  // Description included in notifications
 }
 
 // ExpiryAlertRule configures expiry reminder alerts
@@ -74,6 +98,37 @@ type ThresholdConfig struct {
 	Duration  int     `json:"duration,omitempty"`  // Seconds above threshold before alert
 }
 
+// AnomalyAlertRule fires when a metric rises well above the server's own
+// baseline for the same hour in previous weeks
+type AnomalyAlertRule struct {
+	Enabled     bool     `json:"enabled"`
+	Metrics     []string `json:"metrics,omitempty"`   // cpu, memory (default both)
+	Sigma       float64  `json:"sigma,omitempty"`     // Standard deviations above the baseline (default 3)
+	MinDelta    float64  `json:"min_delta,omitempty"` // Minimum rise over the baseline in percentage points (default 10)
+	Weeks       int      `json:"weeks,omitempty"`     // Weeks of history in the baseline (default and maximum 4)
+	Window      int      `json:"window,omitempty"`    // Minutes averaged for the current value (default 30)
+	Severity    string   `json:"severity,omitempty"`  // warning, critical (default warning)
+	Channels    []string `json:"channels"`
+	Servers     []string `json:"servers"`
+	Exclude     []string `json:"exclude"`
+	Cooldown    int      `json:"cooldown,omitempty"` // Seconds between alerts for same server/metric
+}
+
+// ForecastAlertRule fires when a resource will run out soon at its current
+// rate of growth
+type ForecastAlertRule struct {
+	Enabled     bool     `json:"enabled"`
+	Disk        bool     `json:"disk"`                 // Predict when the disk fills up
+	DiskHours   int      `json:"disk_hours,omitempty"` // Alert when full within this many hours (default 72)
+	Window      int      `json:"window,omitempty"`     // Hours of disk history used for the growth rate (default 24)
+	Traffic     bool     `json:"traffic"`              // Predict traffic over the monthly limit before the reset day
+	Severity    string   `json:"severity,omitempty"`   // warning, critical (default warning)
+	Channels    []string `json:"channels"`
+	Servers     []string `json:"servers"`
+	Exclude     []string `json:"exclude"`
+	Cooldown    int      `json:"cooldown,omitempty"` // Seconds between alerts for same server/resource
+}
+
 // TrafficAlertRule configures traffic/bandwidth alerts
 type TrafficAlertRule struct {
 	Enabled     bool               `json:"enabled"`
@@ -105,7 +160,9 @@ type AlertTemplate struct {
 // AlertState tracks the current state of an alert
 type AlertState struct {
 	ID          string     `json:"id"`
-	Type        string     `json:"type"`        // offline, cpu, memory, disk, traffic
+	Type        string     `json:"type"`        // offline, cpu, memory, disk, traffic, custom
+	RuleID      string     `json:"rule_id,omitempty"`   // Custom rule that fired
+	RuleName    string     `json:"rule_name,omitempty"`
 	ServerID    string     `json:"server_id"`
 	ServerName  string     `json:"server_name"`
 	Severity    string     `json:"severity"`    // warning, critical
@@ -118,6 +175,19 @@ type AlertState struct {
 	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
 	NotifiedAt  *time.Time `json:"notified_at,omitempty"`
 	Muted       bool       `json:"muted"`
+	SilencedBy  []string   `json:"silenced_by,omitempty"` // Active silences holding back notifications
+	EscalationLevel int    `json:"escalation_level,omitempty"` // Escalation steps of its route already notified
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AckComment     string     `json:"ack_comment,omitempty"`
+	PendingChannels []string  `json:"pending_channels,omitempty"` // Channels waiting for the alert's group to be sent
+	PendingSince   *time.Time `json:"pending_since,omitempty"`
+}
+
+// acknowledged reports whether someone has taken responsibility for the
+// alert, which stops escalation and reminders
+func (a *AlertState) acknowledged() bool {
+	return a.Muted || a.AcknowledgedAt != nil
 }
 
 // AlertHistory records historical alert data
@@ -135,21 +205,29 @@ type AlertHistory struct {
 	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
 	Duration    int64      `json:"duration"` // Seconds
 	Notified    bool       `json:"notified"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AckComment     string     `json:"ack_comment,omitempty"`
 }
 
-// NotificationEvent records a notification that was sent
+// NotificationEvent records a notification and its delivery attempts
 type NotificationEvent struct {
-	ID         int64     `json:"id"`
-	AlertID    string    `json:"alert_id"`
-	ChannelID  string    `json:"channel_id"`
-	Type       string    `json:"type"`        // alert_type
-	ServerID   string    `json:"server_id"`
-	Title      string    `json:"title"`
-	Message    string    `json:"message"`
-	Status     string    `json:"status"`      // sent, failed, pending
-	Error      string    `json:"error,omitempty"`
-	SentAt     time.Time `json:"sent_at"`
-	RetryCount int       `json:"retry_count"`
+	ID            int64       `json:"id"`
+	AlertID       string      `json:"alert_id"`
+	ChannelID     string      `json:"channel_id"`
+	ChannelName   string      `json:"channel_name"`
+	Type          string      `json:"type"` // alert_type
+	ServerID      string      `json:"server_id"`
+	Title         string      `json:"title"`
+	Message       string      `json:"message"`
+	Resolved      bool        `json:"resolved"`          // Recovery notification
+	Payload       *AlertEvent `json:"payload,omitempty"` // Structured event handed to the notifier
+	Status        string      `json:"status"`            // pending, sent, failed (gave up after retries)
+	Error         string      `json:"error,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	SentAt        time.Time   `json:"sent_at"` // Time of the last attempt
+	NextAttemptAt *time.Time  `json:"next_attempt_at,omitempty"`
+	RetryCount    int         `json:"retry_count"` // Failed attempts so far
 }
 
 // ============================================================================
@@ -164,15 +242,24 @@ type UpdateAlertConfigRequest struct {
 	Templates      *map[string]AlertTemplate `json:"templates,omitempty"`
 	GlobalCooldown *int                      `json:"global_cooldown,omitempty"`
 	RecoveryNotify *bool                     `json:"recovery_notify,omitempty"`
+	Routes         *[]AlertRoute             `json:"routes,omitempty"`
+	PublicURL      *string                   `json:"public_url,omitempty"`
+	Grouping       *AlertGrouping            `json:"grouping,omitempty"`
+}
+
+// AcknowledgeAlertRequest acknowledges an active alert
+type AcknowledgeAlertRequest struct {
+	Comment string `json:"comment"`
 }
 
 // AddChannelRequest adds a new notification channel
 type AddChannelRequest struct {
-	Type     string            `json:"type"`
-	Name     string            `json:"name"`
-	Enabled  bool              `json:"enabled"`
-	Config   map[string]string `json:"config"`
-	Priority int               `json:"priority,omitempty"`
+	Type      string                   `json:"type"`
+	Name      string                   `json:"name"`
+	Enabled   bool                     `json:"enabled"`
+	Config    map[string]string        `json:"config"`
+	Priority  int                      `json:"priority,omitempty"`
+	Templates map[string]AlertTemplate `json:"templates,omitempty"`
 }
 
 // TestChannelRequest tests a notification channel
@@ -240,11 +327,31 @@ func GetDefaultAlertConfig() AlertConfig {
 				Body:   "服务器 {{ .ServerName }} 将于 {{ .ExpiryDate }} 到期，剩余 {{ .DaysLeft }} 天。\n服务商: {{ .Provider }}\n价格: {{ .Price }}",
 				Format: "text",
 			},
+			"custom": {
+				Title:  "[{{ .Severity }}] {{ .ServerName }} {{ .RuleName }}",
+				Body:   "{{ .Message }}\n表达式: {{ .Expr }}\n当前值: {{ .Value }}，阈值: {{ .Threshold }}",
+				Format: "text",
+			},
+			"anomaly": {
+				Title:  "[{{ .Severity }}] {{ .ServerName }} 指标异常",
+				Body:   "{{ .Message }}",
+				Format: "text",
+			},
+			"forecast": {
+				Title:  "[{{ .Severity }}] {{ .ServerName }} 容量预警",
+				Body:   "{{ .Message }}",
+				Format: "text",
+			},
 			"recovery": {
 				Title:  "[恢复] {{ .ServerName }} {{ .AlertType }} 告警已恢复",
 				Body:   "服务器 {{ .ServerName }} 的 {{ .AlertType }} 告警已恢复正常。\n持续时间: {{ .Duration }}",
 				Format: "text",
 			},
+			"group": {
+				Title:  "{{ if .FiringCount }}[{{ .Severity }}] {{ .Summary }}: {{ .FiringCount }} 个告警{{ if .ResolvedCount }}，{{ .ResolvedCount }} 个已恢复{{ end }}{{ else }}[恢复] {{ .Summary }}: {{ .ResolvedCount }} 个告警已恢复{{ end }}",
+				Body:   "{{ range .Firing }}🔴 {{ .Message }}\n{{ end }}{{ range .Resolved }}✅ {{ .ServerName }} {{ .AlertType }} 告警已恢复，持续 {{ .Duration }}\n{{ end }}",
+				Format: "text",
+			},
 		},
 		Rules: AlertRules{
 			Offline: OfflineAlertRule{
@@ -290,6 +397,29 @@ func GetDefaultAlertConfig() AlertConfig {
 				Exclude:     []string{},
 				ExcludeAuto: true, // By default, don't notify for auto-renew servers
 			},
+			Anomaly: AnomalyAlertRule{
+				Enabled:  false,
+				Metrics:  []string{"cpu", "memory"},
+				Sigma:    3,
+				MinDelta: 10,
+				Weeks:    4,
+				Window:   30,
+				Channels: []string{},
+				Servers:  []string{},
+				Exclude:  []string{},
+				Cooldown: 3600,
+			},
+			Forecast: ForecastAlertRule{
+				Enabled:   false,
+				Disk:      true,
+				DiskHours: 72,
+				Window:    24,
+				Traffic:   true,
+				Channels:  []string{},
+				Servers:   []string{},
+				Exclude:   []string{},
+				Cooldown:  86400,
+			},
 		},
 	}
 }
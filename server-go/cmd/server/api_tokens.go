@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// API Token Types
+// ============================================================================
+
+// APITokenPrefix marks bearer tokens that are API tokens rather than JWTs
+const APITokenPrefix = "vst_"
+
+// ContextKeyAPITokenID is set by AuthMiddleware when a request uses an API token
+const ContextKeyAPITokenID = "api_token_id"
+
+// Available API token scopes. Write scopes imply the matching read scope.
+var APITokenScopes = []string{
+	"servers:read", "servers:write",
+	"alerts:read", "alerts:write",
+	"traffic:read", "traffic:write",
+	"settings:read", "settings:write",
+	"audit:read",
+}
+
+var (
+	ErrAPITokenNotFound = errors.New("api token not found")
+	ErrAPITokenRevoked  = errors.New("api token revoked")
+	ErrAPITokenExpired  = errors.New("api token expired")
+)
+
+// APIToken represents a named, scoped token used for automation
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"` // First characters of the token, for identification
+	TokenHash  string   `json:"-"`
+	Scopes     []string `json:"scopes"`
+	UserID     string   `json:"user_id,omitempty"`
+	Username   string   `json:"username"`
+	Role       UserRole `json:"role"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	LastUsedIP string   `json:"last_used_ip,omitempty"`
+	RevokedAt  string   `json:"revoked_at,omitempty"`
+}
+
+// IsValidAPITokenScope reports whether scope is a known scope
+func IsValidAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token grants scope (write implies read)
+func (t *APIToken) HasScope(scope string) bool {
+	resource, action, _ := strings.Cut(scope, ":")
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+		if action == "read" && s == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// hashAPIToken returns the hex SHA-256 of a raw token. Tokens are random
+// and high-entropy, so a fast hash is sufficient for storage at rest.
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIToken returns a new raw token value
+func generateAPIToken() string {
+	return APITokenPrefix + GenerateRandomString(40)
+}
+
+// apiTokenScopeForRoute maps a route to the scope required to call it with an
+// API token. Returns "" for routes that API tokens may never call.
+func apiTokenScopeForRoute(method, route string) string {
+	var resource string
+	switch {
+	case route == "/metrics",
+		strings.HasPrefix(route, "/api/servers"),
+		strings.HasPrefix(route, "/api/agent"),
+		strings.HasPrefix(route, "/api/groups"),
+		strings.HasPrefix(route, "/api/dimensions"),
+		strings.HasPrefix(route, "/api/geoip"),
+		strings.HasPrefix(route, "/api/assets"),
+		route == "/api/install-command":
+		resource = "servers"
+	case strings.HasPrefix(route, "/api/alerts"),
+		route == "/api/settings/alerts":
+		resource = "alerts"
+	case strings.HasPrefix(route, "/api/traffic"):
+		resource = "traffic"
+	case strings.HasPrefix(route, "/api/audit-logs"):
+		resource = "audit"
+	case strings.HasPrefix(route, "/api/tokens"),
+		strings.HasPrefix(route, "/api/auth"),
+		strings.HasPrefix(route, "/api/users"),
+		strings.HasPrefix(route, "/api/sso"),
+		strings.HasPrefix(route, "/api/settings/oauth"):
+		// Tokens cannot manage credentials, users or login providers
+		return ""
+	case strings.HasPrefix(route, "/api/settings"),
+		strings.HasPrefix(route, "/api/themes"),
+		strings.HasPrefix(route, "/api/server/"):
+		resource = "settings"
+	default:
+		return ""
+	}
+
+	if method == "GET" || method == "HEAD" {
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+// ============================================================================
+// API Token Storage
+// ============================================================================
+
+const apiTokenColumns = `id, name, prefix, token_hash, scopes, COALESCE(user_id, ''), username, role, created_at,
+	COALESCE(expires_at, ''), COALESCE(last_used_at, ''), COALESCE(last_used_ip, ''), COALESCE(revoked_at, '')`
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes, role string
+	if err := row.Scan(&t.ID, &t.Name, &t.Prefix, &t.TokenHash, &scopes, &t.UserID, &t.Username, &role,
+		&t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.LastUsedIP, &t.RevokedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+	t.Role = UserRole(role)
+	t.Scopes = []string{}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	return &t, nil
+}
+
+// listAPITokens returns all tokens, newest first
+func listAPITokens(db *sql.DB) ([]APIToken, error) {
+	rows, err := db.Query("SELECT " + apiTokenColumns + " FROM api_tokens ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, nil
+}
+
+// getAPITokenByID looks up a token by ID
+func getAPITokenByID(db *sql.DB, id string) (*APIToken, error) {
+	return scanAPIToken(db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?", id))
+}
+
+// insertAPIToken stores a new token
+func insertAPIToken(db *sql.DB, t *APIToken) error {
+	var expiresAt interface{}
+	if t.ExpiresAt != "" {
+		expiresAt = t.ExpiresAt
+	}
+	var userID interface{}
+	if t.UserID != "" {
+		userID = t.UserID
+	}
+	_, err := db.Exec(`
+		INSERT INTO api_tokens (id, name, prefix, token_hash, scopes, user_id, username, role, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.Prefix, t.TokenHash, strings.Join(t.Scopes, ","), userID, t.Username, string(t.Role), t.CreatedAt, expiresAt,
+	)
+	return err
+}
+
+// revokeAPIToken marks a token as revoked
+func revokeAPIToken(db *sql.DB, id string) error {
+	result, err := db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// authenticateAPIToken validates a raw API token and returns the acting identity
+func authenticateAPIToken(raw string) (*APIToken, AuthIdentity, error) {
+	if dbWriter == nil {
+		return nil, AuthIdentity{}, ErrAPITokenNotFound
+	}
+	db := dbWriter.GetDB()
+
+	t, err := scanAPIToken(db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = ?", hashAPIToken(raw)))
+	if err != nil {
+		return nil, AuthIdentity{}, err
+	}
+	if t.RevokedAt != "" {
+		return t, AuthIdentity{}, ErrAPITokenRevoked
+	}
+	if t.ExpiresAt != "" {
+		if expiresAt, err := time.Parse(time.RFC3339, t.ExpiresAt); err == nil && time.Now().After(expiresAt) {
+			return t, AuthIdentity{}, ErrAPITokenExpired
+		}
+	}
+
+	identity := AuthIdentity{UserID: t.UserID, Username: t.Username, Role: t.Role}
+	if t.UserID != "" {
+		// The token can never exceed the current permissions of its owner
+		u, err := getUserByID(db, t.UserID)
+		if err != nil || u.Disabled {
+			return t, AuthIdentity{}, ErrUserNotFound
+		}
+		identity.Username = u.Username
+		if roleRank(u.Role) < roleRank(identity.Role) {
+			identity.Role = u.Role
+		}
+	}
+	return t, identity, nil
+}
+
+// touchAPIToken records the last use of a token (fire-and-forget)
+func touchAPIToken(id, ip string) {
+	if dbWriter == nil {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?", now, ip, id)
+		return err
+	})
+}
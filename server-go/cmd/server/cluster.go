@@ -0,0 +1,697 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================================================
+// Cluster Coordination (Redis)
+// ============================================================================
+
+// ClusterConfig lets several server replicas run behind a load balancer.
+// Replicas share live state through Redis and must also share a PostgreSQL
+// database (see DatabaseConfig).
+type ClusterConfig struct {
+	RedisURL  string `json:"redis_url,omitempty"`  // redis://[:password@]host:port/db
+	NodeID    string `json:"node_id,omitempty"`    // Defaults to <hostname>-<random>
+	KeyPrefix string `json:"key_prefix,omitempty"` // Defaults to "vstats:"
+}
+
+// cluster is nil when running as a single node
+var cluster *Cluster
+
+// Cluster timings (variables so tests can shorten them)
+var (
+	clusterFlushInterval = 1 * time.Second
+	clusterLeaderTTL     = 15 * time.Second
+	clusterRenewInterval = 5 * time.Second
+	clusterCallTimeout   = 5 * time.Second
+	clusterOwnerTTL      = 60 * time.Second
+)
+
+var (
+	ErrNoLeader        = errors.New("no cluster leader elected")
+	ErrNodeUnavailable = errors.New("cluster node did not respond")
+)
+
+// ClusterHandler serves a request sent by another node
+type ClusterHandler func(payload json.RawMessage) (interface{}, error)
+
+// Cluster shares agent metrics, agent ownership and alert state between
+// replicas, routes requests to the node that can serve them and elects the
+// leader that runs the singleton background loops.
+type Cluster struct {
+	rdb    *redis.Client
+	nodeID string
+	prefix string
+	state  *AppState
+
+	leader atomic.Bool
+
+	// Metrics received by this node since the last flush
+	pending   map[string]*clusterMetrics
+	pendingMu sync.Mutex
+
+	handlers   map[string]ClusterHandler
+	handlersMu sync.RWMutex
+
+	calls   map[string]chan clusterReply
+	callsMu sync.Mutex
+
+	pubsub *redis.PubSub
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// clusterMetrics is the latest metrics of one agent as stored in Redis
+type clusterMetrics struct {
+	ServerID    string        `json:"server_id"`
+	Metrics     SystemMetrics `json:"metrics"`
+	LastUpdated time.Time     `json:"last_updated"`
+}
+
+// clusterEvent is broadcast to every node
+type clusterEvent struct {
+	Type    string           `json:"type"` // "metrics" or "config"
+	Node    string           `json:"node"`
+	Metrics []clusterMetrics `json:"metrics,omitempty"`
+	Config  json.RawMessage  `json:"config,omitempty"`
+}
+
+type clusterRequest struct {
+	ID      string          `json:"id"`
+	From    string          `json:"from"`
+	Method  string          `json:"method"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type clusterReply struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Compare-and-delete / compare-and-expire on keys owned by this node
+var (
+	releaseIfOwner = redis.NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("DEL", KEYS[1])
+		end
+		return 0`)
+	renewIfOwner = redis.NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+		end
+		return 0`)
+)
+
+// loadClusterConfig returns the cluster section of the config.
+// VSTATS_REDIS_URL and VSTATS_NODE_ID override the file.
+func loadClusterConfig(config *AppConfig) ClusterConfig {
+	var cfg ClusterConfig
+	if config != nil && config.Cluster != nil {
+		cfg = *config.Cluster
+	}
+	if url := os.Getenv("VSTATS_REDIS_URL"); url != "" {
+		cfg.RedisURL = url
+	}
+	if id := os.Getenv("VSTATS_NODE_ID"); id != "" {
+		cfg.NodeID = id
+	}
+	return cfg
+}
+
+// isLeader reports whether this node runs the singleton background work.
+// A single node is always the leader.
+func isLeader() bool {
+	return cluster == nil || cluster.IsLeader()
+}
+
+// NewCluster connects to Redis. Call Start once handlers are registered.
+func NewCluster(cfg ClusterConfig, state *AppState) (*Cluster, error) {
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	rdb := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	nodeID := cfg.NodeID
+	if nodeID == "" {
+		hostname, _ := os.Hostname()
+		nodeID = hostname + "-" + uuid.New().String()[:8]
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = "vstats:"
+	}
+
+	c := &Cluster{
+		rdb:      rdb,
+		nodeID:   nodeID,
+		prefix:   prefix,
+		state:    state,
+		pending:  make(map[string]*clusterMetrics),
+		handlers: make(map[string]ClusterHandler),
+		calls:    make(map[string]chan clusterReply),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// NodeID returns the ID of this node
+func (c *Cluster) NodeID() string { return c.nodeID }
+
+// IsLeader reports whether this node currently holds the leader lease
+func (c *Cluster) IsLeader() bool { return c.leader.Load() }
+
+func (c *Cluster) key(parts ...string) string {
+	return c.prefix + strings.Join(parts, ":")
+}
+
+// Handle registers a request handler for method
+func (c *Cluster) Handle(method string, h ClusterHandler) {
+	c.handlersMu.Lock()
+	c.handlers[method] = h
+	c.handlersMu.Unlock()
+}
+
+// Start subscribes to cluster channels, loads the metrics other nodes have
+// published and starts the flush and election loops
+func (c *Cluster) Start() error {
+	c.pubsub = c.rdb.Subscribe(c.ctx, c.key("events"), c.key("rpc", c.nodeID), c.key("reply", c.nodeID))
+	// Wait for the subscription so that nothing published from here on is missed
+	if _, err := c.pubsub.Receive(c.ctx); err != nil {
+		c.pubsub.Close()
+		return err
+	}
+
+	c.loadMetrics()
+	c.elect()
+
+	c.wg.Add(3)
+	go c.receiveLoop()
+	go c.flushLoop()
+	go c.electionLoop()
+	return nil
+}
+
+// Close releases the leader lease and agent ownership held by this node
+func (c *Cluster) Close() {
+	c.cancel()
+	if c.pubsub != nil {
+		c.pubsub.Close()
+	}
+	c.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c.flush(ctx)
+	if c.leader.Load() {
+		releaseIfOwner.Run(ctx, c.rdb, []string{c.key("leader")}, c.nodeID)
+		c.leader.Store(false)
+	}
+	c.rdb.Close()
+}
+
+// ============================================================================
+// Shared Metrics
+// ============================================================================
+
+// PublishMetrics queues the latest metrics of an agent connected to this
+// node. Queued metrics are written and broadcast once per flush interval.
+func (c *Cluster) PublishMetrics(data *AgentMetricsData) {
+	c.pendingMu.Lock()
+	c.pending[data.ServerID] = &clusterMetrics{
+		ServerID:    data.ServerID,
+		Metrics:     data.Metrics,
+		LastUpdated: data.LastUpdated,
+	}
+	c.pendingMu.Unlock()
+}
+
+// ClaimAgent records that serverID's agent is connected to this node
+func (c *Cluster) ClaimAgent(serverID string) {
+	c.rdb.Set(c.ctx, c.key("agent", serverID), c.nodeID, clusterOwnerTTL)
+}
+
+// ReleaseAgent clears the ownership record unless another node took over
+func (c *Cluster) ReleaseAgent(serverID string) {
+	c.pendingMu.Lock()
+	delete(c.pending, serverID)
+	c.pendingMu.Unlock()
+	releaseIfOwner.Run(c.ctx, c.rdb, []string{c.key("agent", serverID)}, c.nodeID)
+}
+
+// AgentOwner returns the node holding serverID's agent connection, or ""
+func (c *Cluster) AgentOwner(serverID string) string {
+	node, err := c.rdb.Get(c.ctx, c.key("agent", serverID)).Result()
+	if err != nil {
+		return ""
+	}
+	return node
+}
+
+func (c *Cluster) flushLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(clusterFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.flush(c.ctx)
+		}
+	}
+}
+
+// flush stores queued metrics, refreshes agent ownership and broadcasts the
+// batch to the other nodes
+func (c *Cluster) flush(ctx context.Context) {
+	c.pendingMu.Lock()
+	if len(c.pending) == 0 {
+		c.pendingMu.Unlock()
+		return
+	}
+	batch := make([]clusterMetrics, 0, len(c.pending))
+	for _, m := range c.pending {
+		batch = append(batch, *m)
+	}
+	c.pending = make(map[string]*clusterMetrics)
+	c.pendingMu.Unlock()
+
+	fields := make([]interface{}, 0, len(batch)*2)
+	for _, m := range batch {
+		data, err := json.Marshal(m)
+		if err != nil {
+			continue
+		}
+		fields = append(fields, m.ServerID, data)
+	}
+	event, _ := json.Marshal(clusterEvent{Type: "metrics", Node: c.nodeID, Metrics: batch})
+
+	_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, c.key("metrics"), fields...)
+		for _, m := range batch {
+			pipe.Set(ctx, c.key("agent", m.ServerID), c.nodeID, clusterOwnerTTL)
+		}
+		pipe.Publish(ctx, c.key("events"), event)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("⚠️ Failed to publish metrics to cluster: %v\n", err)
+	}
+}
+
+// loadMetrics seeds AgentMetrics from Redis when the node starts
+func (c *Cluster) loadMetrics() {
+	values, err := c.rdb.HGetAll(c.ctx, c.key("metrics")).Result()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load cluster metrics: %v\n", err)
+		return
+	}
+	batch := make([]clusterMetrics, 0, len(values))
+	for _, v := range values {
+		var m clusterMetrics
+		if json.Unmarshal([]byte(v), &m) == nil {
+			batch = append(batch, m)
+		}
+	}
+	c.mergeMetrics(batch)
+}
+
+// mergeMetrics applies metrics from other nodes, keeping whichever sample
+// is newer so an agent that reconnected elsewhere is not overwritten
+func (c *Cluster) mergeMetrics(batch []clusterMetrics) {
+	c.state.AgentMetricsMu.Lock()
+	defer c.state.AgentMetricsMu.Unlock()
+	for _, m := range batch {
+		existing := c.state.AgentMetrics[m.ServerID]
+		if existing != nil && !existing.LastUpdated.Before(m.LastUpdated) {
+			continue
+		}
+		c.state.AgentMetrics[m.ServerID] = &AgentMetricsData{
+			ServerID:    m.ServerID,
+			Metrics:     m.Metrics,
+			LastUpdated: m.LastUpdated,
+		}
+	}
+}
+
+// ============================================================================
+// Config Sync
+// ============================================================================
+
+// PublishConfig sends a saved config to the other nodes
+func (c *Cluster) PublishConfig(data []byte) {
+	event, _ := json.Marshal(clusterEvent{Type: "config", Node: c.nodeID, Config: data})
+	if err := c.rdb.Publish(c.ctx, c.key("events"), event).Err(); err != nil {
+		fmt.Printf("⚠️ Failed to publish config to cluster: %v\n", err)
+	}
+}
+
+// applyRemoteConfig applies the shared sections of a config saved on another
+// node. The keys of the local config file (credentials, listen address, TLS,
+// storage and cluster settings) belong to each node and keep their values.
+func (c *Cluster) applyRemoteConfig(data []byte) {
+	var remote AppConfig
+	if err := json.Unmarshal(data, &remote); err != nil {
+		fmt.Printf("⚠️ Ignoring invalid config from cluster: %v\n", err)
+		return
+	}
+	_, sections, err := splitConfig(&remote)
+	if err != nil {
+		fmt.Printf("⚠️ Ignoring invalid config from cluster: %v\n", err)
+		return
+	}
+
+	c.state.ConfigMu.RLock()
+	file, _, err := splitConfig(c.state.Config)
+	c.state.ConfigMu.RUnlock()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to read current config: %v\n", err)
+		return
+	}
+	newConfig, err := mergeConfig(file, sections)
+	if err != nil {
+		fmt.Printf("⚠️ Ignoring config from cluster: %v\n", err)
+		return
+	}
+	if err := applyConfig(c.state, newConfig); err != nil {
+		fmt.Printf("⚠️ Ignoring config from cluster: %v\n", err)
+		return
+	}
+	c.state.pushConfigToLocalAgents()
+
+	// Stored sections were already saved by the sending node
+	if err := writeConfigFile(newConfig); err != nil {
+		fmt.Printf("Failed to write config: %v\n", err)
+	}
+}
+
+// ============================================================================
+// Requests Between Nodes
+// ============================================================================
+
+// Call sends a request to node and decodes the reply into result (may be nil)
+func (c *Cluster) Call(node, method string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req := clusterRequest{
+		ID:      uuid.New().String(),
+		From:    c.nodeID,
+		Method:  method,
+		Payload: body,
+	}
+	data, _ := json.Marshal(req)
+
+	replyCh := make(chan clusterReply, 1)
+	c.callsMu.Lock()
+	c.calls[req.ID] = replyCh
+	c.callsMu.Unlock()
+	defer func() {
+		c.callsMu.Lock()
+		delete(c.calls, req.ID)
+		c.callsMu.Unlock()
+	}()
+
+	receivers, err := c.rdb.Publish(c.ctx, c.key("rpc", node), data).Result()
+	if err != nil {
+		return err
+	}
+	if receivers == 0 {
+		return ErrNodeUnavailable
+	}
+
+	select {
+	case reply := <-replyCh:
+		if reply.Error != "" {
+			return remoteError(reply.Error)
+		}
+		if result != nil && len(reply.Result) > 0 {
+			return json.Unmarshal(reply.Result, result)
+		}
+		return nil
+	case <-time.After(clusterCallTimeout):
+		return ErrNodeUnavailable
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// CallLeader sends a request to the current leader
+func (c *Cluster) CallLeader(method string, payload, result interface{}) error {
+	leader, err := c.rdb.Get(c.ctx, c.key("leader")).Result()
+	if err == redis.Nil {
+		return ErrNoLeader
+	} else if err != nil {
+		return err
+	}
+	return c.Call(leader, method, payload, result)
+}
+
+func (c *Cluster) receiveLoop() {
+	defer c.wg.Done()
+	ch := c.pubsub.Channel(redis.WithChannelSize(1000))
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch msg.Channel {
+			case c.key("events"):
+				c.handleEvent([]byte(msg.Payload))
+			case c.key("rpc", c.nodeID):
+				var req clusterRequest
+				if json.Unmarshal([]byte(msg.Payload), &req) == nil {
+					go c.serve(req)
+				}
+			case c.key("reply", c.nodeID):
+				var reply clusterReply
+				if json.Unmarshal([]byte(msg.Payload), &reply) == nil {
+					c.callsMu.Lock()
+					replyCh := c.calls[reply.ID]
+					c.callsMu.Unlock()
+					if replyCh != nil {
+						replyCh <- reply
+					}
+				}
+			}
+		}
+	}
+}
+
+// remoteError maps an error message from another node back to the
+// matching sentinel error so callers can compare against it
+func remoteError(msg string) error {
+	for _, err := range []error{ErrAgentNotConnected, ErrAgentBusy, ErrNoLeader} {
+		if err.Error() == msg {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+func (c *Cluster) handleEvent(data []byte) {
+	var event clusterEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.Node == c.nodeID {
+		return
+	}
+	switch event.Type {
+	case "metrics":
+		c.mergeMetrics(event.Metrics)
+	case "config":
+		c.applyRemoteConfig(event.Config)
+	}
+}
+
+func (c *Cluster) serve(req clusterRequest) {
+	c.handlersMu.RLock()
+	handler := c.handlers[req.Method]
+	c.handlersMu.RUnlock()
+
+	reply := clusterReply{ID: req.ID}
+	if handler == nil {
+		reply.Error = "unknown cluster method " + req.Method
+	} else if result, err := handler(req.Payload); err != nil {
+		reply.Error = err.Error()
+	} else if result != nil {
+		reply.Result, _ = json.Marshal(result)
+	}
+
+	data, _ := json.Marshal(reply)
+	c.rdb.Publish(c.ctx, c.key("reply", req.From), data)
+}
+
+// ============================================================================
+// Leader Election
+// ============================================================================
+
+func (c *Cluster) electionLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(clusterRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.elect()
+		}
+	}
+}
+
+// elect renews the leader lease, or takes it if nobody holds it
+func (c *Cluster) elect() {
+	key := c.key("leader")
+	var leader bool
+	if c.leader.Load() {
+		n, err := renewIfOwner.Run(c.ctx, c.rdb, []string{key}, c.nodeID, clusterLeaderTTL.Milliseconds()).Int64()
+		leader = err == nil && n == 1
+	} else {
+		ok, err := c.rdb.SetNX(c.ctx, key, c.nodeID, clusterLeaderTTL).Result()
+		leader = err == nil && ok
+	}
+
+	if c.leader.Swap(leader) != leader {
+		if leader {
+			fmt.Printf("👑 Node %s is now the cluster leader\n", c.nodeID)
+		} else {
+			fmt.Printf("👑 Node %s lost cluster leadership\n", c.nodeID)
+		}
+	}
+}
+
+// ============================================================================
+// Shared Alert State
+// ============================================================================
+
+// SaveAlertState replaces the shared copy of the leader's alert state
+func (c *Cluster) SaveAlertState(alerts map[string]*AlertState, cooldowns map[string]time.Time) error {
+	_, err := c.rdb.TxPipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(c.ctx, c.key("alerts"), c.key("cooldowns"))
+		for key, alert := range alerts {
+			data, _ := json.Marshal(alert)
+			pipe.HSet(c.ctx, c.key("alerts"), key, data)
+		}
+		for key, t := range cooldowns {
+			pipe.HSet(c.ctx, c.key("cooldowns"), key, t.Unix())
+		}
+		return nil
+	})
+	return err
+}
+
+// LoadAlertState returns the alert state last saved by the leader
+func (c *Cluster) LoadAlertState() (map[string]*AlertState, map[string]time.Time, error) {
+	alertValues, err := c.rdb.HGetAll(c.ctx, c.key("alerts")).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	cooldownValues, err := c.rdb.HGetAll(c.ctx, c.key("cooldowns")).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	alerts := make(map[string]*AlertState, len(alertValues))
+	for key, v := range alertValues {
+		var alert AlertState
+		if json.Unmarshal([]byte(v), &alert) == nil {
+			alerts[key] = &alert
+		}
+	}
+	cooldowns := make(map[string]time.Time, len(cooldownValues))
+	for key, v := range cooldownValues {
+		var ts int64
+		if _, err := fmt.Sscan(v, &ts); err == nil {
+			cooldowns[key] = time.Unix(ts, 0)
+		}
+	}
+	return alerts, cooldowns, nil
+}
+
+// ============================================================================
+// Request Handlers
+// ============================================================================
+
+// registerClusterHandlers serves the requests other nodes route to this one
+func registerClusterHandlers(c *Cluster, state *AppState) {
+	c.Handle("agent.send", func(payload json.RawMessage) (interface{}, error) {
+		var req agentSendRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return nil, state.sendToLocalAgent(req.ServerID, req.Data)
+	})
+
+	c.Handle("alerts.mute", func(payload json.RawMessage) (interface{}, error) {
+		var alertID string
+		if err := json.Unmarshal(payload, &alertID); err != nil {
+			return nil, err
+		}
+		if alertEngine == nil {
+			return false, nil
+		}
+		return alertEngine.MuteAlert(alertID), nil
+	})
+
+	c.Handle("alerts.ack", func(payload json.RawMessage) (interface{}, error) {
+		var call alertAckCall
+		if err := json.Unmarshal(payload, &call); err != nil {
+			return nil, err
+		}
+		if alertEngine == nil {
+			return nil, nil
+		}
+		return alertEngine.setAcknowledged(call), nil
+	})
+
+	c.Handle("traffic.update_limit", func(payload json.RawMessage) (interface{}, error) {
+		var req trafficLimitCall
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		if trafficManager == nil {
+			return nil, errors.New("traffic manager not initialized")
+		}
+		return nil, trafficManager.UpdateLimit(req.ServerID, req.MonthlyLimitGB, req.ThresholdType, req.ResetDay)
+	})
+
+	c.Handle("traffic.reset", func(payload json.RawMessage) (interface{}, error) {
+		var req trafficResetCall
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		if trafficManager == nil {
+			return nil, errors.New("traffic manager not initialized")
+		}
+		return nil, trafficManager.ResetTraffic(req.ServerID, req.ToZero)
+	})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"vstats/internal/common"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+)
+
+// newTestClusterNode starts a cluster node with its own state against mr
+func newTestClusterNode(t *testing.T, mr *miniredis.Miniredis, nodeID string) (*Cluster, *AppState) {
+	t.Helper()
+
+	state := &AppState{
+		Config:           &AppConfig{AdminPasswordHash: "$2a$10$" + nodeID, JWTSecret: "secret", Port: "3001"},
+		AgentMetrics:     make(map[string]*AgentMetricsData),
+		AgentConns:       make(map[string]*AgentConnection),
+		DashboardClients: make(map[*websocket.Conn]*DashboardClient),
+	}
+	c, err := NewCluster(ClusterConfig{RedisURL: "redis://" + mr.Addr(), NodeID: nodeID}, state)
+	if err != nil {
+		t.Fatalf("NewCluster failed: %v", err)
+	}
+	registerClusterHandlers(c, state)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	return c, state
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+// TestCluster tests state sharing and routing between two replicas
+func TestCluster(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("VSTATS_CONFIG_PATH", t.TempDir()+"/vstats-config.json")
+
+	oldFlush, oldRenew, oldCluster := clusterFlushInterval, clusterRenewInterval, cluster
+	clusterFlushInterval = 20 * time.Millisecond
+	clusterRenewInterval = 20 * time.Millisecond
+	defer func() {
+		clusterFlushInterval, clusterRenewInterval, cluster = oldFlush, oldRenew, oldCluster
+	}()
+
+	nodeA, stateA := newTestClusterNode(t, mr, "node-a")
+	nodeB, stateB := newTestClusterNode(t, mr, "node-b")
+	defer nodeB.Close()
+
+	t.Run("Single leader", func(t *testing.T) {
+		if !nodeA.IsLeader() || nodeB.IsLeader() {
+			t.Errorf("Expected node-a to lead, got a=%v b=%v", nodeA.IsLeader(), nodeB.IsLeader())
+		}
+	})
+
+	t.Run("Metrics reach other nodes", func(t *testing.T) {
+		cluster = nodeA
+		stateA.setAgentMetrics("srv-1", &SystemMetrics{Hostname: "web-1"})
+
+		waitFor(t, "metrics on node-b", func() bool {
+			stateB.AgentMetricsMu.RLock()
+			defer stateB.AgentMetricsMu.RUnlock()
+			m := stateB.AgentMetrics["srv-1"]
+			return m != nil && m.Metrics.Hostname == "web-1"
+		})
+		if owner := nodeB.AgentOwner("srv-1"); owner != "node-a" {
+			t.Errorf("Expected node-a to own srv-1, got %q", owner)
+		}
+	})
+
+	t.Run("Commands are routed to the owning node", func(t *testing.T) {
+		sendChan := make(chan []byte, 1)
+		stateA.AgentConnsMu.Lock()
+		stateA.AgentConns["srv-1"] = &AgentConnection{SendChan: sendChan}
+		stateA.AgentConnsMu.Unlock()
+
+		cluster = nodeB
+		if err := stateB.SendToAgent("srv-1", []byte(`{"type":"command"}`)); err != nil {
+			t.Fatalf("SendToAgent failed: %v", err)
+		}
+		select {
+		case msg := <-sendChan:
+			if string(msg) != `{"type":"command"}` {
+				t.Errorf("Unexpected message %s", msg)
+			}
+		default:
+			t.Error("Expected command on node-a's agent connection")
+		}
+
+		if err := stateB.SendToAgent("srv-unknown", []byte("x")); err != ErrAgentNotConnected {
+			t.Errorf("Expected ErrAgentNotConnected, got %v", err)
+		}
+
+		// The agent queue is full now that nobody drains it
+		sendChan <- []byte("fill")
+		if err := stateB.SendToAgent("srv-1", []byte("x")); err != ErrAgentBusy {
+			t.Errorf("Expected ErrAgentBusy from the remote node, got %v", err)
+		}
+	})
+
+	t.Run("Alert state is shared", func(t *testing.T) {
+		alerts := map[string]*AlertState{
+			"cpu:srv-1": {ID: "a1", Type: "cpu", ServerID: "srv-1", Severity: "critical", Status: "firing"},
+		}
+		cooldowns := map[string]time.Time{"cpu:srv-1": time.Unix(1700000000, 0)}
+		if err := nodeA.SaveAlertState(alerts, cooldowns); err != nil {
+			t.Fatalf("SaveAlertState failed: %v", err)
+		}
+
+		gotAlerts, gotCooldowns, err := nodeB.LoadAlertState()
+		if err != nil {
+			t.Fatalf("LoadAlertState failed: %v", err)
+		}
+		if a := gotAlerts["cpu:srv-1"]; a == nil || a.ID != "a1" || a.Severity != "critical" {
+			t.Errorf("Unexpected alerts %+v", gotAlerts)
+		}
+		if !gotCooldowns["cpu:srv-1"].Equal(cooldowns["cpu:srv-1"]) {
+			t.Errorf("Unexpected cooldowns %+v", gotCooldowns)
+		}
+	})
+
+	t.Run("Config changes reach other nodes", func(t *testing.T) {
+		newConfig := &AppConfig{
+			AdminPasswordHash: "$2a$10$remote",
+			JWTSecret:         "other",
+			Port:              "4001",
+			TLS:               &TLSConfig{Enabled: true, Cert: "/etc/node-a.pem"},
+			SiteSettings:      SiteSettings{SiteName: "Fleet"},
+			Cluster:           &ClusterConfig{NodeID: "node-a"},
+		}
+		data, _ := json.Marshal(newConfig)
+		stateB.ConfigMu.RLock()
+		configB := stateB.Config
+		stateB.ConfigMu.RUnlock()
+		nodeA.PublishConfig(data)
+
+		waitFor(t, "config on node-b", func() bool {
+			stateB.ConfigMu.RLock()
+			defer stateB.ConfigMu.RUnlock()
+			return stateB.Config.SiteSettings.SiteName == "Fleet"
+		})
+		stateB.ConfigMu.RLock()
+		if stateB.Config.Cluster != nil || stateB.Config.Port != "3001" || stateB.Config.TLS != nil ||
+			stateB.Config.AdminPasswordHash != "$2a$10$node-b" || stateB.Config.JWTSecret != "secret" {
+			t.Errorf("Node-specific settings must not be copied, got %+v", stateB.Config)
+		}
+		if stateB.Config != configB {
+			t.Error("Expected the config to be updated in place")
+		}
+		stateB.ConfigMu.RUnlock()
+	})
+
+	t.Run("Ping targets reach agents on other nodes", func(t *testing.T) {
+		sendChan := make(chan []byte, 10)
+		stateA.AgentConnsMu.Lock()
+		stateA.AgentConns["srv-1"] = &AgentConnection{SendChan: sendChan}
+		stateA.AgentConnsMu.Unlock()
+		received := func() []common.PingTargetConfig {
+			select {
+			case data := <-sendChan:
+				var msg common.ServerResponse
+				json.Unmarshal(data, &msg)
+				return msg.PingTargets
+			default:
+				return nil
+			}
+		}
+
+		stateB.ConfigMu.Lock()
+		stateB.Config.Servers = []RemoteServer{{ID: "srv-1"}}
+		stateB.Config.ProbeSettings.PingTargets = []common.PingTargetConfig{{Name: "dns", Host: "1.1.1.1"}}
+		stateB.ConfigMu.Unlock()
+		cluster = nodeB
+		stateB.BroadcastPingTargets()
+		if targets := received(); len(targets) != 1 {
+			t.Errorf("Expected the ping targets on node-a's agent, got %+v", targets)
+		}
+
+		// Configs from other nodes are pushed to the local agents
+		data, _ := json.Marshal(&AppConfig{
+			Servers:       []RemoteServer{{ID: "srv-1"}},
+			ProbeSettings: ProbeSettings{PingTargets: []common.PingTargetConfig{{Name: "dns", Host: "1.1.1.1"}, {Name: "web", Host: "8.8.8.8"}}},
+		})
+		nodeB.PublishConfig(data)
+		waitFor(t, "ping targets from the cluster config", func() bool {
+			return len(received()) == 2
+		})
+	})
+
+	t.Run("Leadership fails over", func(t *testing.T) {
+		nodeA.Close()
+		waitFor(t, "node-b to lead", nodeB.IsLeader)
+
+		cluster = nodeB
+		if err := nodeB.Call("node-a", "agent.send", agentSendRequest{ServerID: "srv-1"}, nil); err != ErrNodeUnavailable {
+			t.Errorf("Expected ErrNodeUnavailable for a stopped node, got %v", err)
+		}
+	})
+}
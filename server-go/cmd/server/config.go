@@ -7,9 +7,11 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"vstats/internal/common"
 )
@@ -76,6 +78,7 @@ type OIDCProvider struct {
 	AllowedUsers  []string `json:"allowed_users,omitempty"`  // Email addresses or subject IDs
 	AllowedGroups []string `json:"allowed_groups,omitempty"` // Group names from OIDC claims
 	UsernameClaim string   `json:"username_claim,omitempty"` // Claim to use as username (default: email)
+	GroupRoles    map[string]string `json:"group_roles,omitempty"` // OIDC group -> role (admin, operator, viewer)
 }
 
 // CloudflareAccessConfig represents Cloudflare Access (Zero Trust) configuration
@@ -92,6 +95,7 @@ type SSOBinding struct {
 	ProviderID string `json:"provider_id"` // Provider's unique identifier for OIDC
 	Identifier string `json:"identifier"`  // Username/email from the provider
 	BoundAt    string `json:"bound_at"`    // ISO timestamp when bound
+	Username   string `json:"username,omitempty"` // Dashboard user this identity logs in as (default: admin)
 }
 
 type OAuthConfig struct {
@@ -112,8 +116,11 @@ type OAuthConfig struct {
 	// Cloudflare Access (Zero Trust) configuration
 	CloudflareAccess *CloudflareAccessConfig `json:"cloudflare_access,omitempty"`
 
-	// SSO Bindings - linked SSO identities to admin account
+	// SSO Bindings - linked SSO identities to dashboard users
 	Bindings []SSOBinding `json:"bindings,omitempty"`
+
+	// Role for allowed SSO users without a binding, user account or group mapping (default: admin)
+	DefaultRole string `json:"default_role,omitempty"`
 }
 
 // GroupDimension represents a grouping dimension (e.g., Region, Purpose)
@@ -192,6 +199,11 @@ type AffProvider struct {
 	Enabled  bool   `json:"enabled"`
 }
 
+// PrometheusConfig represents the Prometheus /metrics exporter configuration
+type PrometheusConfig struct {
+	Token string `json:"token,omitempty"` // Static bearer token for scrapers (optional, admin JWTs and API tokens are always accepted)
+}
+
 type AppConfig struct {
 	AdminPasswordHash string            `json:"admin_password_hash"`
 	JWTSecret         string            `json:"jwt_secret"`
@@ -210,6 +222,12 @@ type AppConfig struct {
 	GeoIPConfig       *GeoIPConfig      `json:"geoip_config,omitempty"`
 	InstalledThemes   []InstalledTheme  `json:"installed_themes,omitempty"` // External themes installed from GitHub
 	AffProviders      []AffProvider     `json:"aff_providers,omitempty"`    // Affiliate provider configurations
+	Prometheus        *PrometheusConfig `json:"prometheus,omitempty"`       // Prometheus exporter settings
+	SessionSettings   *SessionSettings  `json:"session_settings,omitempty"` // Access/refresh token lifetimes
+	LoginProtection   *LoginProtectionConfig `json:"login_protection,omitempty"` // Brute-force protection for authentication
+	Database          *DatabaseConfig   `json:"database,omitempty"`         // Storage backend (read at startup, before the rest of the config)
+	Cluster           *ClusterConfig    `json:"cluster,omitempty"`          // Redis coordination for multiple replicas
+	AgentProfiles     []AgentProfile    `json:"agent_profiles,omitempty"`   // Agent settings pushed to matching servers
 }
 
 func getExeDir() string {
@@ -336,7 +354,8 @@ func LoadConfig() (*AppConfig, *string) {
 		if err != nil {
 			fmt.Printf("⚠️  Failed to read config: %v, using defaults\n", err)
 			config, password := NewAppConfigWithRandomPassword()
-			saveConfigNow(config) // Immediate save for initialization
+			overlayStoredConfig(config)
+			saveConfigNow(config, systemAuthor) // Immediate save for initialization
 			InitJWTSecret(config.JWTSecret)
 			return config, &password
 		}
@@ -345,10 +364,12 @@ func LoadConfig() (*AppConfig, *string) {
 		if err := json.Unmarshal(data, &config); err != nil {
 			fmt.Printf("⚠️  Failed to parse config: %v, using defaults\n", err)
 			newConfig, password := NewAppConfigWithRandomPassword()
-			saveConfigNow(newConfig) // Immediate save for initialization
+			overlayStoredConfig(newConfig)
+			saveConfigNow(newConfig, systemAuthor) // Immediate save for initialization
 			InitJWTSecret(newConfig.JWTSecret)
 			return newConfig, &password
 		}
+		overlayStoredConfig(&config)
 
 		// Verify password hash looks valid
 		if len(config.AdminPasswordHash) < 4 || config.AdminPasswordHash[:3] != "$2a" && config.AdminPasswordHash[:3] != "$2b" {
@@ -356,7 +377,7 @@ func LoadConfig() (*AppConfig, *string) {
 			password := GenerateRandomString(16)
 			hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 			config.AdminPasswordHash = string(hash)
-			saveConfigNow(&config) // Immediate save for password
+			saveConfigNow(&config, systemAuthor) // Immediate save for password
 			fmt.Printf("🔑 New password: %s\n", password)
 		} else {
 			fmt.Printf("✅ Password hash loaded (%d chars)\n", len(config.AdminPasswordHash))
@@ -365,13 +386,13 @@ func LoadConfig() (*AppConfig, *string) {
 		// Ensure jwt_secret exists
 		if config.JWTSecret == "" {
 			config.JWTSecret = GenerateRandomString(64)
-			saveConfigNow(&config) // Immediate save for JWT secret
+			saveConfigNow(&config, systemAuthor) // Immediate save for JWT secret
 		}
 
 		// Initialize default group dimensions if not present
 		if len(config.GroupDimensions) == 0 {
 			config.GroupDimensions = GetDefaultGroupDimensions()
-			saveConfigNow(&config) // Immediate save for defaults
+			saveConfigNow(&config, systemAuthor) // Immediate save for defaults
 			fmt.Println("✅ Initialized default group dimensions")
 		}
 
@@ -381,14 +402,27 @@ func LoadConfig() (*AppConfig, *string) {
 
 	// First run - generate random password
 	config, password := NewAppConfigWithRandomPassword()
-	saveConfigNow(config) // Immediate save for initialization
+	overlayStoredConfig(config)
+	saveConfigNow(config, systemAuthor) // Immediate save for initialization
 	InitJWTSecret(config.JWTSecret)
 	return config, &password
 }
 
+// overlayStoredConfig replaces the shared sections of config with the ones
+// stored in the database, importing them on first use
+func overlayStoredConfig(config *AppConfig) {
+	if configStore == nil {
+		return
+	}
+	if err := configStore.Load(config); err != nil {
+		fmt.Printf("⚠️  Failed to load config from database: %v\n", err)
+	}
+}
+
 func ResetAdminPassword() string {
 	path := GetConfigPath()
 	var config *AppConfig
+	var raw map[string]json.RawMessage
 
 	if _, err := os.Stat(path); err == nil {
 		data, err := os.ReadFile(path)
@@ -396,6 +430,7 @@ func ResetAdminPassword() string {
 			var c AppConfig
 			if json.Unmarshal(data, &c) == nil {
 				config = &c
+				json.Unmarshal(data, &raw)
 			}
 		}
 	}
@@ -411,7 +446,18 @@ func ResetAdminPassword() string {
 		config.JWTSecret = GenerateRandomString(64)
 	}
 
-	saveConfigNow(config) // Immediate save for password reset
+	if raw != nil {
+		// Only touch the credentials so that a file holding just the keys
+		// not stored in the database keeps that layout
+		raw["admin_password_hash"], _ = json.Marshal(config.AdminPasswordHash)
+		raw["jwt_secret"], _ = json.Marshal(config.JWTSecret)
+		data, _ := json.MarshalIndent(raw, "", "  ")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			fmt.Printf("Failed to write config: %v\n", err)
+		}
+	} else {
+		saveConfigNow(config, systemAuthor) // Immediate save for password reset
+	}
 
 	// Re-initialize JWT secret in case server is running
 	InitJWTSecret(config.JWTSecret)
@@ -419,21 +465,114 @@ func ResetAdminPassword() string {
 	return password
 }
 
+// Last config file modification seen by reloadConfigIfChanged
+var (
+	lastConfigModTime   time.Time
+	lastConfigModTimeMu sync.Mutex
+)
+
+// reloadConfigIfChanged reloads the config file only if it was modified
+// since the last check. Returns nil when nothing changed.
+func reloadConfigIfChanged() *AppConfig {
+	info, err := os.Stat(GetConfigPath())
+	if err != nil {
+		return nil
+	}
+
+	lastConfigModTimeMu.Lock()
+	changed := !info.ModTime().Equal(lastConfigModTime)
+	lastConfigModTime = info.ModTime()
+	lastConfigModTimeMu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	config, _ := LoadConfig()
+	return config
+}
+
+// applyConfig hot-applies a config read from disk or restored from a
+// revision. Storage and cluster settings keep their running values.
+func applyConfig(state *AppState, newConfig *AppConfig) error {
+	if len(newConfig.AdminPasswordHash) < 4 ||
+		(newConfig.AdminPasswordHash[:3] != "$2a" && newConfig.AdminPasswordHash[:3] != "$2b") {
+		return fmt.Errorf("invalid password hash format in config")
+	}
+
+	state.ConfigMu.Lock()
+	newConfig.Database = state.Config.Database
+	newConfig.Cluster = state.Config.Cluster
+	if newConfig.JWTSecret == "" {
+		newConfig.JWTSecret = state.Config.JWTSecret
+	}
+	passwordChanged := state.Config.AdminPasswordHash != newConfig.AdminPasswordHash
+	secretChanged := state.Config.JWTSecret != newConfig.JWTSecret
+	// Copy in place so that pending debounced saves see the new values
+	*state.Config = *newConfig
+	state.ConfigMu.Unlock()
+
+	if secretChanged {
+		InitJWTSecret(newConfig.JWTSecret)
+	}
+	// A new admin password invalidates every existing admin session
+	if passwordChanged {
+		revokeBuiltinAdminSessions()
+	}
+	return nil
+}
+
+// pushConfigToAgents sends the agents their ping targets and remote config
+// after a config was applied as a whole. Must be called without holding
+// ConfigMu.
+func (s *AppState) pushConfigToAgents() {
+	s.BroadcastPingTargets()
+	s.PushAgentConfigs()
+}
+
+// pushConfigToLocalAgents is pushConfigToAgents for the agents connected to
+// this node. Used for configs from other nodes: the sending node already
+// reached the agents of every node through SendToAgent.
+func (s *AppState) pushConfigToLocalAgents() {
+	s.sendPingTargets(s.sendToLocalAgent)
+	s.sendAgentConfigs(s.sendToLocalAgent)
+}
+
 // Config save debouncing - prevents excessive disk I/O
 var (
 	configDirty     bool
 	configDirtyMu   sync.Mutex
 	configSaveTimer *time.Timer
 	pendingConfig   *AppConfig
+	pendingAuthor   ConfigAuthor
 )
 
 const configSaveDelay = 5 * time.Second // Batch saves within 5 seconds
 
-// SaveConfig marks config as dirty and schedules a debounced save
+// SaveConfig schedules a debounced save of a change made by the server itself
 func SaveConfig(config *AppConfig) {
+	SaveConfigAs(config, systemAuthor)
+}
+
+// SaveConfigFrom schedules a debounced save of a change made through the API
+// and records the acting user in the config revision
+func SaveConfigFrom(c *gin.Context, config *AppConfig) {
+	SaveConfigAs(config, ConfigAuthor{
+		Username: CurrentUsername(c),
+		IP:       c.ClientIP(),
+		Source:   ConfigSourceAPI,
+	})
+}
+
+// SaveConfigAs marks config as dirty and schedules a debounced save
+func SaveConfigAs(config *AppConfig, author ConfigAuthor) {
 	configDirtyMu.Lock()
 	defer configDirtyMu.Unlock()
 
+	if configDirty {
+		pendingAuthor = mergeConfigAuthors(pendingAuthor, author)
+	} else {
+		pendingAuthor = author
+	}
 	pendingConfig = config
 	configDirty = true
 
@@ -444,18 +583,47 @@ func SaveConfig(config *AppConfig) {
 
 	// Schedule save after delay
 	configSaveTimer = time.AfterFunc(configSaveDelay, func() {
-		configDirtyMu.Lock()
-		if !configDirty || pendingConfig == nil {
-			configDirtyMu.Unlock()
-			return
+		FlushConfig()
+	})
+}
+
+// mergeConfigAuthors combines the authors of changes batched into one save
+func mergeConfigAuthors(a, b ConfigAuthor) ConfigAuthor {
+	if a.Source == ConfigSourceSystem {
+		return b
+	}
+	if b.Source == ConfigSourceSystem || a.Username == b.Username {
+		return a
+	}
+	for _, name := range strings.Split(a.Username, ",") {
+		if name == b.Username {
+			return a
 		}
-		cfg := pendingConfig
-		configDirty = false
+	}
+	a.Username += "," + b.Username
+	if a.IP != b.IP {
+		a.IP = ""
+	}
+	return a
+}
+
+// FlushConfig saves a pending debounced config change right away
+func FlushConfig() {
+	configDirtyMu.Lock()
+	if configSaveTimer != nil {
+		configSaveTimer.Stop()
 		configSaveTimer = nil
+	}
+	if !configDirty || pendingConfig == nil {
 		configDirtyMu.Unlock()
+		return
+	}
+	cfg, author := pendingConfig, pendingAuthor
+	configDirty = false
+	pendingConfig = nil
+	configDirtyMu.Unlock()
 
-		saveConfigNow(cfg)
-	})
+	saveConfigNow(cfg, author)
 }
 
 // SaveConfigImmediate saves config immediately (for critical operations like password reset)
@@ -469,18 +637,48 @@ func SaveConfigImmediate(config *AppConfig) {
 	pendingConfig = nil
 	configDirtyMu.Unlock()
 
-	saveConfigNow(config)
+	saveConfigNow(config, systemAuthor)
 }
 
-// saveConfigNow performs the actual file write
-func saveConfigNow(config *AppConfig) {
-	path := GetConfigPath()
+// saveConfigNow stores the shared sections as a new revision, writes the
+// config file and, in cluster mode, hands the new config to the other nodes
+func saveConfigNow(config *AppConfig, author ConfigAuthor) *ConfigRevision {
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		fmt.Printf("Failed to serialize config: %v\n", err)
-		return
+		return nil
 	}
-	if err := os.WriteFile(path, data, 0600); err != nil {
+
+	var rev *ConfigRevision
+	if configStore != nil {
+		if rev, err = configStore.Save(config, author); err != nil {
+			fmt.Printf("Failed to store config: %v\n", err)
+		}
+	}
+	if err := writeConfigFile(config); err != nil {
 		fmt.Printf("Failed to write config: %v\n", err)
 	}
+	if cluster != nil {
+		cluster.PublishConfig(data)
+	}
+	return rev
+}
+
+// writeConfigFile writes config to the config file. With the config store
+// active only the keys that are not stored in the database are written.
+func writeConfigFile(config *AppConfig) error {
+	var data []byte
+	var err error
+	if configStore != nil {
+		var file map[string]json.RawMessage
+		if file, _, err = splitConfig(config); err == nil {
+			data, err = json.MarshalIndent(file, "", "  ")
+		}
+	} else {
+		data, err = json.MarshalIndent(config, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(GetConfigPath(), data, 0600)
 }
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Config Store
+// ============================================================================
+
+// configStore keeps the shared config sections in the database. When nil
+// (offline commands, tests) the whole config lives in the config file.
+var configStore *ConfigStore
+
+// fileConfigKeys stay in the config file: credentials that the offline
+// --reset-password command rewrites, and settings that belong to each node
+var fileConfigKeys = map[string]bool{
+	"admin_password_hash": true,
+	"jwt_secret":          true,
+	"port":                true,
+	"host":                true,
+	"dual_stack":          true,
+	"tls":                 true,
+	"database":            true,
+	"cluster":             true,
+}
+
+// Config revision sources
+const (
+	ConfigSourceAPI     = "api"
+	ConfigSourceSystem  = "system"
+	ConfigSourceImport  = "import"
+	ConfigSourceRestore = "restore"
+)
+
+var ErrConfigRevisionNotFound = errors.New("config revision not found")
+
+// ConfigAuthor describes who made a config change
+type ConfigAuthor struct {
+	Username     string
+	IP           string
+	Source       string
+	RestoredFrom int64
+}
+
+// systemAuthor is used for changes the server makes on its own
+var systemAuthor = ConfigAuthor{Username: "system", Source: ConfigSourceSystem}
+
+// ConfigChange is one difference between two config versions
+type ConfigChange struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"` // added, removed, changed, reordered
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// ConfigRevision is a stored version of the shared config
+type ConfigRevision struct {
+	ID           int64          `json:"id"`
+	CreatedAt    string         `json:"created_at"`
+	Username     string         `json:"username"`
+	UserIP       string         `json:"user_ip,omitempty"`
+	Source       string         `json:"source"`
+	RestoredFrom *int64         `json:"restored_from,omitempty"`
+	Sections     []string       `json:"sections"`
+	Changes      []ConfigChange `json:"changes,omitempty"`
+	ChangeCount  int            `json:"change_count"`
+}
+
+// ConfigStore reads and writes versioned config sections
+type ConfigStore struct {
+	db *sql.DB
+}
+
+// NewConfigStore creates a config store on an open database
+func NewConfigStore(db *sql.DB) *ConfigStore {
+	return &ConfigStore{db: db}
+}
+
+func (s *ConfigStore) write(fn func(*sql.DB) error) error {
+	if dbWriter != nil {
+		return dbWriter.WriteSync(fn)
+	}
+	return fn(s.db)
+}
+
+// splitConfig separates the file-only keys from the stored sections
+func splitConfig(config *AppConfig) (file, sections map[string]json.RawMessage, err error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, nil, err
+	}
+
+	file = make(map[string]json.RawMessage)
+	sections = make(map[string]json.RawMessage)
+	for key, value := range all {
+		if fileConfigKeys[key] {
+			file[key] = value
+		} else {
+			sections[key] = value
+		}
+	}
+	return file, sections, nil
+}
+
+// mergeConfig builds a config from file-only keys and stored sections
+func mergeConfig(file, sections map[string]json.RawMessage) (*AppConfig, error) {
+	all := make(map[string]json.RawMessage, len(file)+len(sections))
+	for key, value := range sections {
+		if !fileConfigKeys[key] {
+			all[key] = value
+		}
+	}
+	for key, value := range file {
+		all[key] = value
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return nil, err
+	}
+	var config AppConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Sections returns the stored config sections
+func (s *ConfigStore) Sections() (map[string]json.RawMessage, error) {
+	rows, err := s.db.Query("SELECT name, data FROM config_sections")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, err
+		}
+		sections[name] = json.RawMessage(data)
+	}
+	return sections, rows.Err()
+}
+
+// Load replaces the shared sections of config with the stored ones. A
+// database without stored config imports it from config instead.
+func (s *ConfigStore) Load(config *AppConfig) error {
+	sections, err := s.Sections()
+	if err != nil {
+		return err
+	}
+	if len(sections) == 0 {
+		return s.importConfig(config)
+	}
+
+	file, _, err := splitConfig(config)
+	if err != nil {
+		return err
+	}
+	merged, err := mergeConfig(file, sections)
+	if err != nil {
+		return err
+	}
+	*config = *merged
+	return nil
+}
+
+// importConfig stores a config that so far only lived in the config file
+// and keeps a copy of the original file next to it
+func (s *ConfigStore) importConfig(config *AppConfig) error {
+	rev, err := s.Save(config, ConfigAuthor{Username: "system", Source: ConfigSourceImport})
+	if err != nil {
+		return err
+	}
+	if rev == nil {
+		return nil
+	}
+
+	path := GetConfigPath()
+	if data, err := os.ReadFile(path); err == nil {
+		if err := os.WriteFile(path+".bak", data, 0600); err != nil {
+			fmt.Printf("⚠️  Failed to back up config file: %v\n", err)
+		}
+	}
+	fmt.Printf("📦 Config imported into the database (revision %d), original file kept as %s.bak\n", rev.ID, path)
+	return writeConfigFile(config)
+}
+
+// Save stores the shared sections of config as a new revision. It returns
+// nil without storing anything when no section changed.
+func (s *ConfigStore) Save(config *AppConfig, author ConfigAuthor) (*ConfigRevision, error) {
+	_, sections, err := splitConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var rev *ConfigRevision
+	err = s.write(func(db *sql.DB) error {
+		rev = nil
+		previous, err := s.Sections()
+		if err != nil {
+			return err
+		}
+		changes := diffConfigSections(previous, sections)
+		if len(changes) == 0 {
+			return nil
+		}
+
+		changed := changedSections(previous, sections)
+		snapshot, _ := json.Marshal(sections)
+		changesJSON, _ := json.Marshal(changes)
+		now := time.Now().UTC().Format(time.RFC3339)
+		var restoredFrom interface{}
+		if author.RestoredFrom > 0 {
+			restoredFrom = author.RestoredFrom
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var id int64
+		err = tx.QueryRow(`
+			INSERT INTO config_revisions (created_at, username, user_ip, source, restored_from, sections, changes, snapshot)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+			now, author.Username, author.IP, author.Source, restoredFrom,
+			strings.Join(changed, ","), string(changesJSON), string(snapshot),
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range changed {
+			data, ok := sections[name]
+			if !ok {
+				if _, err := tx.Exec("DELETE FROM config_sections WHERE name = ?", name); err != nil {
+					return err
+				}
+				continue
+			}
+			_, err = tx.Exec(`
+				INSERT INTO config_sections (name, data, revision_id, updated_at) VALUES (?, ?, ?, ?)
+				ON CONFLICT(name) DO UPDATE SET
+					data = excluded.data,
+					revision_id = excluded.revision_id,
+					updated_at = excluded.updated_at`,
+				name, string(data), id, now)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		rev = &ConfigRevision{
+			ID:          id,
+			CreatedAt:   now,
+			Username:    author.Username,
+			UserIP:      author.IP,
+			Source:      author.Source,
+			Sections:    changed,
+			Changes:     changes,
+			ChangeCount: len(changes),
+		}
+		if author.RestoredFrom > 0 {
+			rev.RestoredFrom = &author.RestoredFrom
+		}
+		return nil
+	})
+	return rev, err
+}
+
+const configRevisionColumns = "id, created_at, username, user_ip, source, restored_from, sections, changes"
+
+func scanConfigRevision(row interface{ Scan(...interface{}) error }) (*ConfigRevision, error) {
+	var rev ConfigRevision
+	var restoredFrom sql.NullInt64
+	var sections, changes string
+	if err := row.Scan(&rev.ID, &rev.CreatedAt, &rev.Username, &rev.UserIP, &rev.Source, &restoredFrom, &sections, &changes); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConfigRevisionNotFound
+		}
+		return nil, err
+	}
+	if restoredFrom.Valid {
+		rev.RestoredFrom = &restoredFrom.Int64
+	}
+	rev.Sections = []string{}
+	if sections != "" {
+		rev.Sections = strings.Split(sections, ",")
+	}
+	json.Unmarshal([]byte(changes), &rev.Changes)
+	rev.ChangeCount = len(rev.Changes)
+	return &rev, nil
+}
+
+// Revisions lists revisions newest first, without their changes
+func (s *ConfigStore) Revisions(limit, offset int) ([]ConfigRevision, int, error) {
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM config_revisions").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT "+configRevisionColumns+" FROM config_revisions ORDER BY id DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	revisions := []ConfigRevision{}
+	for rows.Next() {
+		rev, err := scanConfigRevision(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		rev.Changes = nil
+		revisions = append(revisions, *rev)
+	}
+	return revisions, total, rows.Err()
+}
+
+// Revision returns one revision with its changes
+func (s *ConfigStore) Revision(id int64) (*ConfigRevision, error) {
+	return scanConfigRevision(s.db.QueryRow("SELECT "+configRevisionColumns+" FROM config_revisions WHERE id = ?", id))
+}
+
+// Snapshot returns the sections stored by a revision
+func (s *ConfigStore) Snapshot(id int64) (map[string]json.RawMessage, error) {
+	var data string
+	if err := s.db.QueryRow("SELECT snapshot FROM config_revisions WHERE id = ?", id).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConfigRevisionNotFound
+		}
+		return nil, err
+	}
+	sections := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(data), &sections); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// PreviousRevisionID returns the revision before id, or 0 for the first
+func (s *ConfigStore) PreviousRevisionID(id int64) (int64, error) {
+	var prev sql.NullInt64
+	err := s.db.QueryRow("SELECT MAX(id) FROM config_revisions WHERE id < ?", id).Scan(&prev)
+	return prev.Int64, err
+}
+
+// ============================================================================
+// Config Diff
+// ============================================================================
+
+// changedSections returns the names of sections that differ, sorted
+func changedSections(old, new map[string]json.RawMessage) []string {
+	var names []string
+	for name := range unionKeys(old, new) {
+		if !jsonEqual(old[name], new[name]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffConfigSections lists the changes between two sets of sections with
+// sensitive values redacted
+func diffConfigSections(old, new map[string]json.RawMessage) []ConfigChange {
+	changes := []ConfigChange{}
+	for _, name := range changedSections(old, new) {
+		changes = append(changes, diffJSON(name, decodeJSON(old[name]), decodeJSON(new[name]))...)
+	}
+	return changes
+}
+
+func unionKeys(a, b map[string]json.RawMessage) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+func decodeJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	var v interface{}
+	json.Unmarshal(data, &v)
+	return v
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	return reflect.DeepEqual(decodeJSON(a), decodeJSON(b))
+}
+
+// diffJSON compares two decoded JSON values. Arrays of objects with unique
+// "id" fields are matched by id so that inserts do not shift every element.
+func diffJSON(path string, old, new interface{}) []ConfigChange {
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	if old == nil {
+		return []ConfigChange{{Path: path, Op: "added", New: redactConfigValue(path, new)}}
+	}
+	if new == nil {
+		return []ConfigChange{{Path: path, Op: "removed", Old: redactConfigValue(path, old)}}
+	}
+
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var changes []ConfigChange
+		for _, k := range keys {
+			changes = append(changes, diffJSON(path+"."+k, o[k], n[k])...)
+		}
+		return changes
+
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		oldIDs, oldByID := indexByID(o)
+		newIDs, newByID := indexByID(n)
+		if oldByID == nil || newByID == nil {
+			var changes []ConfigChange
+			for i := 0; i < len(o) || i < len(n); i++ {
+				var ov, nv interface{}
+				if i < len(o) {
+					ov = o[i]
+				}
+				if i < len(n) {
+					nv = n[i]
+				}
+				changes = append(changes, diffJSON(path+"["+strconv.Itoa(i)+"]", ov, nv)...)
+			}
+			return changes
+		}
+
+		var changes []ConfigChange
+		for _, id := range oldIDs {
+			changes = append(changes, diffJSON(path+"[id="+id+"]", oldByID[id], newByID[id])...)
+		}
+		var common []string
+		for _, id := range newIDs {
+			if _, ok := oldByID[id]; !ok {
+				changes = append(changes, diffJSON(path+"[id="+id+"]", nil, newByID[id])...)
+			} else {
+				common = append(common, id)
+			}
+		}
+		var oldOrder []string
+		for _, id := range oldIDs {
+			if _, ok := newByID[id]; ok {
+				oldOrder = append(oldOrder, id)
+			}
+		}
+		if !reflect.DeepEqual(oldOrder, common) {
+			changes = append(changes, ConfigChange{Path: path, Op: "reordered", Old: oldOrder, New: common})
+		}
+		return changes
+	}
+
+	return []ConfigChange{{Path: path, Op: "changed", Old: redactConfigValue(path, old), New: redactConfigValue(path, new)}}
+}
+
+// indexByID maps array elements by their "id" field. It returns nil when
+// any element is not an object with a unique string id.
+func indexByID(items []interface{}) ([]string, map[string]interface{}) {
+	ids := make([]string, 0, len(items))
+	byID := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		id, ok := obj["id"].(string)
+		if !ok || id == "" {
+			return nil, nil
+		}
+		if _, dup := byID[id]; dup {
+			return nil, nil
+		}
+		ids = append(ids, id)
+		byID[id] = item
+	}
+	return ids, byID
+}
+
+// redactedValue replaces secrets in revision diffs
+const redactedValue = "[redacted]"
+
+// isSensitiveConfigKey reports whether a config key holds a credential
+func isSensitiveConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"secret", "password", "token", "webhook"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	// private_key, api_key, routing_key, device_key, send_key, ...
+	return strings.HasSuffix(key, "_key")
+}
+
+// notifierCredentialKeys are generic names that hold the credential inside
+// a notification channel config: the WeCom robot key and webhook URLs
+var notifierCredentialKeys = map[string]bool{"key": true, "url": true}
+
+// isSensitiveConfigPath reports whether the value at a diff path holds a
+// credential
+func isSensitiveConfigPath(path string) bool {
+	key := lastPathKey(path)
+	if isSensitiveConfigKey(key) {
+		return true
+	}
+	return notifierCredentialKeys[strings.ToLower(key)] &&
+		strings.Contains(path, "channels[") && strings.HasSuffix(path, ".config."+key)
+}
+
+// lastPathKey returns the final object key of a diff path
+func lastPathKey(path string) string {
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.IndexByte(path, '['); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+// redactConfigValue hides credential values at path and inside v
+func redactConfigValue(path string, v interface{}) interface{} {
+	if isSensitiveConfigPath(path) {
+		if v == nil || v == "" {
+			return v
+		}
+		return redactedValue
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = redactConfigValue(path+"."+k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = redactConfigValue(path+"["+strconv.Itoa(i)+"]", item)
+		}
+		return out
+	}
+	return v
+}
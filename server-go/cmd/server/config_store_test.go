@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vstats/internal/common"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestConfigStore tests storing config sections with revision history
+func TestConfigStore(t *testing.T) {
+	forEachBackend(t, testConfigStore)
+}
+
+func testConfigStore(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter, oldStore := dbWriter, configStore
+	dbWriter = NewDBWriter(helper.db, 10)
+	configStore = NewConfigStore(helper.db)
+	defer func() {
+		dbWriter.Close()
+		dbWriter, configStore = oldWriter, oldStore
+	}()
+
+	path := filepath.Join(t.TempDir(), ConfigFilename)
+	t.Setenv("VSTATS_CONFIG_PATH", path)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	legacy := &AppConfig{
+		AdminPasswordHash: string(hash),
+		JWTSecret:         "secret",
+		Port:              "3001",
+		Servers: []RemoteServer{
+			{ID: "s1", Name: "Tokyo", Token: "token-1"},
+			{ID: "s2", Name: "Paris", Token: "token-2"},
+		},
+		GroupDimensions: GetDefaultGroupDimensions(),
+	}
+	data, _ := json.MarshalIndent(legacy, "", "  ")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	t.Run("ImportFromFile", func(t *testing.T) {
+		config, password := LoadConfig()
+		if password != nil {
+			t.Fatal("Existing config must not be regenerated")
+		}
+		if len(config.Servers) != 2 || config.Port != "3001" {
+			t.Fatalf("Unexpected loaded config: %+v", config)
+		}
+
+		var file map[string]json.RawMessage
+		data, _ := os.ReadFile(path)
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatalf("Failed to parse rewritten config file: %v", err)
+		}
+		if _, ok := file["servers"]; ok {
+			t.Error("Stored sections must be removed from the config file")
+		}
+		if _, ok := file["admin_password_hash"]; !ok {
+			t.Error("Credentials must stay in the config file")
+		}
+		if _, err := os.Stat(path + ".bak"); err != nil {
+			t.Errorf("Expected a backup of the original file: %v", err)
+		}
+
+		revisions, total, err := configStore.Revisions(10, 0)
+		if err != nil || total != 1 || revisions[0].Source != ConfigSourceImport {
+			t.Fatalf("Expected one import revision, got %+v (%d) / %v", revisions, total, err)
+		}
+
+		// Loading again reads the sections back from the database
+		config, _ = LoadConfig()
+		if len(config.Servers) != 2 || config.Servers[1].Name != "Paris" {
+			t.Errorf("Expected servers from the database, got %+v", config.Servers)
+		}
+		if _, total, _ := configStore.Revisions(10, 0); total != 1 {
+			t.Errorf("Loading must not create revisions, got %d", total)
+		}
+	})
+
+	t.Run("SaveRecordsChanges", func(t *testing.T) {
+		config, _ := LoadConfig()
+		config.Servers[0].Name = "Osaka"
+		config.Servers[1].Token = "token-rotated"
+		config.Servers = append(config.Servers, RemoteServer{ID: "s3", Name: "Berlin"})
+
+		author := ConfigAuthor{Username: "alice", IP: "10.0.0.1", Source: ConfigSourceAPI}
+		rev, err := configStore.Save(config, author)
+		if err != nil || rev == nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if rev.Username != "alice" || len(rev.Sections) != 1 || rev.Sections[0] != "servers" {
+			t.Errorf("Unexpected revision: %+v", rev)
+		}
+
+		changes := make(map[string]ConfigChange)
+		for _, change := range rev.Changes {
+			changes[change.Path] = change
+		}
+		if c := changes["servers[id=s1].name"]; c.Op != "changed" || c.Old != "Tokyo" || c.New != "Osaka" {
+			t.Errorf("Unexpected name change: %+v", c)
+		}
+		if c := changes["servers[id=s2].token"]; c.Old != redactedValue || c.New != redactedValue {
+			t.Errorf("Expected token change to be redacted: %+v", c)
+		}
+		if c := changes["servers[id=s3]"]; c.Op != "added" {
+			t.Errorf("Expected added server, got %+v", c)
+		}
+
+		if rev, err := configStore.Save(config, author); err != nil || rev != nil {
+			t.Errorf("Saving an unchanged config must not create a revision, got %+v / %v", rev, err)
+		}
+
+		// Credentials are not part of the revision history
+		config.AdminPasswordHash = "$2a$changed"
+		if rev, err := configStore.Save(config, author); err != nil || rev != nil {
+			t.Errorf("File-only changes must not create a revision, got %+v / %v", rev, err)
+		}
+	})
+
+	t.Run("RestoreRevision", func(t *testing.T) {
+		config, _ := LoadConfig()
+		state := &AppState{Config: config, AgentConns: map[string]*AgentConnection{
+			"s1": {SendChan: make(chan []byte, 10)},
+		}}
+
+		router := gin.New()
+		router.GET("/api/config/revisions/:id/diff", state.GetConfigRevisionDiff)
+		router.POST("/api/config/revisions/:id/restore", state.RestoreConfigRevision)
+		request := func(method, path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			return w
+		}
+
+		var preview struct {
+			Changes []ConfigChange `json:"changes"`
+		}
+		w := request("GET", "/api/config/revisions/1/diff?against=current")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &preview)
+		if len(preview.Changes) != 3 {
+			t.Errorf("Expected 3 changes to restore revision 1, got %+v", preview.Changes)
+		}
+
+		w = request("POST", "/api/config/revisions/1/restore")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if len(state.Config.Servers) != 2 || state.Config.Servers[0].Name != "Tokyo" {
+			t.Errorf("Expected restored servers to be applied, got %+v", state.Config.Servers)
+		}
+		if state.Config.Port != "3001" {
+			t.Errorf("Restore must keep file-only settings, got port %q", state.Config.Port)
+		}
+		var pushed []string
+		for len(state.AgentConns["s1"].SendChan) > 0 {
+			var msg common.ServerResponse
+			json.Unmarshal(<-state.AgentConns["s1"].SendChan, &msg)
+			if msg.PingTargets != nil {
+				pushed = append(pushed, "ping_targets")
+			}
+			if msg.AgentConfig != nil {
+				pushed = append(pushed, "agent_config")
+			}
+		}
+		if len(pushed) != 2 {
+			t.Errorf("Expected the restored ping targets and agent config to be pushed, got %v", pushed)
+		}
+
+		rev, err := configStore.Revision(3)
+		if err != nil {
+			t.Fatalf("Expected restore revision: %v", err)
+		}
+		if rev.Source != ConfigSourceRestore || rev.RestoredFrom == nil || *rev.RestoredFrom != 1 {
+			t.Errorf("Unexpected restore revision: %+v", rev)
+		}
+
+		w = request("GET", "/api/config/revisions/1/diff?against=current")
+		json.Unmarshal(w.Body.Bytes(), &preview)
+		if len(preview.Changes) != 0 {
+			t.Errorf("Expected no changes after restore, got %+v", preview.Changes)
+		}
+
+		if w := request("POST", "/api/config/revisions/99/restore"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for unknown revision, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+// TestDiffJSON tests structural config diffs
+func TestDiffJSON(t *testing.T) {
+	decode := func(s string) interface{} {
+		return decodeJSON(json.RawMessage(s))
+	}
+
+	changes := diffJSON("servers",
+		decode(`[{"id":"a","name":"A"},{"id":"b","name":"B"}]`),
+		decode(`[{"id":"b","name":"B"},{"id":"a","name":"A"}]`))
+	if len(changes) != 1 || changes[0].Op != "reordered" {
+		t.Errorf("Expected a reorder, got %+v", changes)
+	}
+
+	changes = diffJSON("oauth", decode(`{"github":{"client_secret":"x","enabled":false}}`),
+		decode(`{"github":{"client_secret":"y","enabled":true}}`))
+	if len(changes) != 2 || changes[0].Path != "oauth.github.client_secret" || changes[0].New != redactedValue {
+		t.Errorf("Unexpected oauth diff: %+v", changes)
+	}
+
+	changes = diffJSON("channels", decode(`[]`), decode(`[{"type":"webhook","config":{"webhook_url":"https://x"}}]`))
+	if len(changes) != 1 || changes[0].Op != "added" {
+		t.Fatalf("Unexpected channel diff: %+v", changes)
+	}
+	added := changes[0].New.(map[string]interface{})["config"].(map[string]interface{})
+	if added["webhook_url"] != redactedValue {
+		t.Errorf("Expected nested secrets to be redacted, got %+v", added)
+	}
+}
+
+// TestRedactNotifierConfigs tests that revision diffs hide the credentials
+// of every notifier type
+func TestRedactNotifierConfigs(t *testing.T) {
+	tests := []struct {
+		kind    string
+		secrets []string
+		plain   []string
+	}{
+		{"email", []string{"password"}, []string{"smtp_host", "username"}},
+		{"telegram", []string{"bot_token"}, []string{"chat_id", "api_url"}},
+		{"discord", []string{"webhook_url"}, []string{"username", "avatar_url"}},
+		{"webhook", []string{"url", "secret"}, []string{"method"}},
+		{"bark", []string{"device_key"}, []string{"server_url", "sound"}},
+		{"serverchan", []string{"send_key"}, []string{"channel"}},
+		{"slack", []string{"webhook_url"}, []string{"channel"}},
+		{"teams", []string{"webhook_url"}, nil},
+		{"matrix", []string{"access_token"}, []string{"homeserver", "room_id"}},
+		{"ntfy", []string{"token", "password"}, []string{"server_url", "username"}},
+		{"gotify", []string{"app_token"}, []string{"server_url", "priority"}},
+		{"pagerduty", []string{"routing_key"}, []string{"severity", "api_url"}},
+		{"dingtalk", []string{"webhook_url", "secret"}, []string{"at_mobiles"}},
+		{"feishu", []string{"webhook_url", "secret"}, nil},
+		{"wecom", []string{"key"}, nil},
+	}
+	for _, tt := range tests {
+		config := make(map[string]interface{})
+		for _, key := range append(append([]string{}, tt.secrets...), tt.plain...) {
+			config[key] = "value-of-" + key
+		}
+		channel := map[string]interface{}{"id": "c1", "type": tt.kind, "config": config}
+		changed := map[string]interface{}{"id": "c1", "type": tt.kind, "config": map[string]interface{}{}}
+		for key := range config {
+			changed["config"].(map[string]interface{})[key] = "new-" + key
+		}
+
+		// Added channels are redacted as a whole, changed values one by one
+		added := diffJSON("alert_config.channels", []interface{}{}, []interface{}{channel})
+		if len(added) != 1 {
+			t.Fatalf("%s: unexpected diff %+v", tt.kind, added)
+		}
+		values := added[0].New.(map[string]interface{})["config"].(map[string]interface{})
+		modified := make(map[string]interface{})
+		for _, change := range diffJSON("alert_config.channels", []interface{}{channel}, []interface{}{changed}) {
+			modified[lastPathKey(change.Path)] = change.New
+		}
+
+		for _, key := range tt.secrets {
+			if values[key] != redactedValue || modified[key] != redactedValue {
+				t.Errorf("%s: expected %s to be redacted, got %v and %v", tt.kind, key, values[key], modified[key])
+			}
+		}
+		for _, key := range tt.plain {
+			if values[key] != "value-of-"+key || modified[key] != "new-"+key {
+				t.Errorf("%s: expected %s to be shown, got %v and %v", tt.kind, key, values[key], modified[key])
+			}
+		}
+	}
+
+	// Generic names are only credentials inside channel configs
+	changes := diffJSON("group_dimensions", decodeJSON(json.RawMessage(`[{"id":"d1","key":"region"}]`)),
+		decodeJSON(json.RawMessage(`[{"id":"d1","key":"zone"}]`)))
+	if len(changes) != 1 || changes[0].New != "zone" {
+		t.Errorf("Expected dimension keys to be shown, got %+v", changes)
+	}
+}
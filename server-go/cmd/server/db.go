@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,10 +13,12 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// DBWriter serializes all database write operations through a channel
+// DBWriter serializes all database write operations through a channel.
+// Backends with concurrent writers also get a pool for bulk metrics writes.
 type DBWriter struct {
 	db       *sql.DB
 	writeCh  chan writeJob
+	bulkCh   chan writeJob // nil when bulk writes share writeCh
 	done     chan struct{}
 	wg       sync.WaitGroup
 }
@@ -150,7 +153,7 @@ func (mb *MetricsBuffer) flushItems(items []MetricsBufferItem) {
 		return
 	}
 	
-	dbWriter.WriteAsync(func(db *sql.DB) error {
+	dbWriter.WriteBulk(func(db *sql.DB) error {
 		return batchStoreMetrics(db, items)
 	})
 }
@@ -314,6 +317,9 @@ func batchStoreMetrics(db *sql.DB, items []MetricsBufferItem) error {
 	if len(items) == 0 {
 		return nil
 	}
+
+	// Batches may run concurrently; touching rows in the same order avoids deadlocks
+	sort.SliceStable(items, func(i, j int) bool { return items[i].ServerID < items[j].ServerID })
 	
 	tx, err := db.Begin()
 	if err != nil {
@@ -333,17 +339,7 @@ func batchStoreMetrics(db *sql.DB, items []MetricsBufferItem) error {
 	stmt5sec, err := tx.Prepare(`
 		INSERT INTO metrics_5sec (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(server_id, bucket) DO UPDATE SET
-			cpu_sum = cpu_sum + excluded.cpu_sum,
-			cpu_max = MAX(cpu_max, excluded.cpu_max),
-			memory_sum = memory_sum + excluded.memory_sum,
-			memory_max = MAX(memory_max, excluded.memory_max),
-			disk_sum = disk_sum + excluded.disk_sum,
-			net_rx = MAX(net_rx, excluded.net_rx),
-			net_tx = MAX(net_tx, excluded.net_tx),
-			ping_sum = ping_sum + excluded.ping_sum,
-			ping_count = ping_count + excluded.ping_count,
-			sample_count = sample_count + 1`)
+		ON CONFLICT(server_id, bucket) DO UPDATE SET`+metricsAccumulateSet("metrics_5sec", "1"))
 	if err != nil {
 		return err
 	}
@@ -352,17 +348,7 @@ func batchStoreMetrics(db *sql.DB, items []MetricsBufferItem) error {
 	stmt2min, err := tx.Prepare(`
 		INSERT INTO metrics_2min (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(server_id, bucket) DO UPDATE SET
-			cpu_sum = cpu_sum + excluded.cpu_sum,
-			cpu_max = MAX(cpu_max, excluded.cpu_max),
-			memory_sum = memory_sum + excluded.memory_sum,
-			memory_max = MAX(memory_max, excluded.memory_max),
-			disk_sum = disk_sum + excluded.disk_sum,
-			net_rx = MAX(net_rx, excluded.net_rx),
-			net_tx = MAX(net_tx, excluded.net_tx),
-			ping_sum = ping_sum + excluded.ping_sum,
-			ping_count = ping_count + excluded.ping_count,
-			sample_count = sample_count + 1`)
+		ON CONFLICT(server_id, bucket) DO UPDATE SET`+metricsAccumulateSet("metrics_2min", "1"))
 	if err != nil {
 		return err
 	}
@@ -691,7 +677,7 @@ func (ab *AggBuffer) Flush() {
 
 	// Write to database
 	if dbWriter != nil {
-		dbWriter.WriteAsync(func(db *sql.DB) error {
+		dbWriter.WriteBulk(func(db *sql.DB) error {
 			err := flushAggBufferToDB(db, metrics, ping)
 			if err != nil {
 				fmt.Printf("⚠️ Aggregation buffer flush error: %v\n", err)
@@ -739,12 +725,17 @@ func flushAggBufferToDB(db *sql.DB, metrics map[AggBufferKey]*common.BucketData,
 		}{key.ServerID, data})
 	}
 
-	// Batch insert metrics for each granularity
-	for granularity, items := range metricsByGranularity {
+	// Batch insert metrics for each granularity. Tables and rows are written
+	// in a fixed order so that concurrent flushes cannot deadlock.
+	for _, granularity := range aggGranularities {
+		items := metricsByGranularity[granularity]
 		table := getMetricsTable(granularity)
-		if table == "" {
-			continue
-		}
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].serverID != items[j].serverID {
+				return items[i].serverID < items[j].serverID
+			}
+			return items[i].data.Bucket < items[j].data.Bucket
+		})
 
 		// Build batch insert with UPSERT
 		if len(items) > 0 {
@@ -769,11 +760,19 @@ func flushAggBufferToDB(db *sql.DB, metrics map[AggBufferKey]*common.BucketData,
 	}
 
 	// Batch insert ping for each granularity
-	for granularity, items := range pingByGranularity {
+	for _, granularity := range aggGranularities {
+		items := pingByGranularity[granularity]
 		table := getPingTable(granularity)
-		if table == "" {
-			continue
-		}
+		sort.Slice(items, func(i, j int) bool {
+			a, b := items[i], items[j]
+			if a.serverID != b.serverID {
+				return a.serverID < b.serverID
+			}
+			if a.data.TargetName != b.data.TargetName {
+				return a.data.TargetName < b.data.TargetName
+			}
+			return a.data.Bucket < b.data.Bucket
+		})
 
 		if len(items) > 0 {
 			err := batchUpsertPing(tx, table, items)
@@ -786,6 +785,9 @@ func flushAggBufferToDB(db *sql.DB, metrics map[AggBufferKey]*common.BucketData,
 	return tx.Commit()
 }
 
+// aggGranularities lists the agent aggregation granularities, finest first
+var aggGranularities = []string{"5sec", "2min", "15min", "hourly", "daily"}
+
 // getMetricsTable returns the table name for a granularity
 func getMetricsTable(granularity string) string {
 	switch granularity {
@@ -822,6 +824,61 @@ func getPingTable(granularity string) string {
 	}
 }
 
+// metricsAccumulateSet is the ON CONFLICT update that adds samples to an
+// existing metrics bucket. Columns of the existing row are qualified with the
+// table name, which PostgreSQL requires.
+func metricsAccumulateSet(table, sampleCount string) string {
+	return fmt.Sprintf(`
+			cpu_sum = %[1]s.cpu_sum + excluded.cpu_sum,
+			cpu_max = %[2]s,
+			memory_sum = %[1]s.memory_sum + excluded.memory_sum,
+			memory_max = %[3]s,
+			disk_sum = %[1]s.disk_sum + excluded.disk_sum,
+			net_rx = %[4]s,
+			net_tx = %[5]s,
+			ping_sum = %[1]s.ping_sum + excluded.ping_sum,
+			ping_count = %[1]s.ping_count + excluded.ping_count,
+			sample_count = %[1]s.sample_count + %[6]s`,
+		table,
+		sqlDialect.Greatest(table+".cpu_max", "excluded.cpu_max"),
+		sqlDialect.Greatest(table+".memory_max", "excluded.memory_max"),
+		sqlDialect.Greatest(table+".net_rx", "excluded.net_rx"),
+		sqlDialect.Greatest(table+".net_tx", "excluded.net_tx"),
+		sampleCount)
+}
+
+// metricsReplaceSet is the ON CONFLICT update for agent-aggregated metrics
+// buckets, which already carry running totals
+func metricsReplaceSet(table string) string {
+	return fmt.Sprintf(`
+			cpu_sum = excluded.cpu_sum,
+			cpu_max = %s,
+			memory_sum = excluded.memory_sum,
+			memory_max = %s,
+			disk_sum = excluded.disk_sum,
+			net_rx = %s,
+			net_tx = %s,
+			ping_sum = excluded.ping_sum,
+			ping_count = excluded.ping_count,
+			sample_count = excluded.sample_count`,
+		sqlDialect.Greatest(table+".cpu_max", "excluded.cpu_max"),
+		sqlDialect.Greatest(table+".memory_max", "excluded.memory_max"),
+		sqlDialect.Greatest(table+".net_rx", "excluded.net_rx"),
+		sqlDialect.Greatest(table+".net_tx", "excluded.net_tx"))
+}
+
+// pingMaxSet is the ON CONFLICT update for agent-aggregated ping buckets
+func pingMaxSet(table string) string {
+	return fmt.Sprintf(`
+			target_host = excluded.target_host,
+			latency_sum = excluded.latency_sum,
+			latency_max = %s,
+			latency_count = excluded.latency_count,
+			ok_count = excluded.ok_count,
+			fail_count = excluded.fail_count`,
+		sqlDialect.Greatest(table+".latency_max", "excluded.latency_max"))
+}
+
 // batchUpsertMetrics performs batch upsert for metrics
 func batchUpsertMetrics(tx *sql.Tx, table string, items []struct {
 	serverID string
@@ -859,18 +916,8 @@ func batchUpsertMetrics(tx *sql.Tx, table string, items []struct {
 		query := fmt.Sprintf(`
 			INSERT INTO %s (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 			VALUES %s
-			ON CONFLICT(server_id, bucket) DO UPDATE SET
-				cpu_sum = excluded.cpu_sum,
-				cpu_max = MAX(%s.cpu_max, excluded.cpu_max),
-				memory_sum = excluded.memory_sum,
-				memory_max = MAX(%s.memory_max, excluded.memory_max),
-				disk_sum = excluded.disk_sum,
-				net_rx = MAX(%s.net_rx, excluded.net_rx),
-				net_tx = MAX(%s.net_tx, excluded.net_tx),
-				ping_sum = excluded.ping_sum,
-				ping_count = excluded.ping_count,
-				sample_count = excluded.sample_count`,
-			table, strings.Join(valueStrings, ","), table, table, table, table)
+			ON CONFLICT(server_id, bucket) DO UPDATE SET%s`,
+			table, strings.Join(valueStrings, ","), metricsReplaceSet(table))
 
 		_, err := tx.Exec(query, valueArgs...)
 		if err != nil {
@@ -913,14 +960,8 @@ func batchUpsertPing(tx *sql.Tx, table string, items []struct {
 		query := fmt.Sprintf(`
 			INSERT INTO %s (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
 			VALUES %s
-			ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET
-				target_host = excluded.target_host,
-				latency_sum = excluded.latency_sum,
-				latency_max = MAX(%s.latency_max, excluded.latency_max),
-				latency_count = excluded.latency_count,
-				ok_count = excluded.ok_count,
-				fail_count = excluded.fail_count`,
-			table, strings.Join(valueStrings, ","), table)
+			ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET%s`,
+			table, strings.Join(valueStrings, ","), pingMaxSet(table))
 
 		_, err := tx.Exec(query, valueArgs...)
 		if err != nil {
@@ -939,16 +980,24 @@ func NewDBWriter(db *sql.DB, bufferSize int) *DBWriter {
 		done:    make(chan struct{}),
 	}
 	w.wg.Add(1)
-	go w.processWrites()
+	go w.processWrites(w.writeCh)
+
+	if n := sqlDialect.BulkWriters(); n > 0 {
+		w.bulkCh = make(chan writeJob, bufferSize)
+		for i := 0; i < n; i++ {
+			w.wg.Add(1)
+			go w.processWrites(w.bulkCh)
+		}
+	}
 	return w
 }
 
-// processWrites handles all write operations sequentially
-func (w *DBWriter) processWrites() {
+// processWrites handles the write operations of a channel sequentially
+func (w *DBWriter) processWrites(ch chan writeJob) {
 	defer w.wg.Done()
 	for {
 		select {
-		case job := <-w.writeCh:
+		case job := <-ch:
 			err := job.fn(w.db)
 			if job.result != nil {
 				job.result <- err
@@ -959,7 +1008,7 @@ func (w *DBWriter) processWrites() {
 			// Drain remaining jobs before exiting
 			for {
 				select {
-				case job := <-w.writeCh:
+				case job := <-ch:
 					err := job.fn(w.db)
 					if job.result != nil {
 						job.result <- err
@@ -981,6 +1030,20 @@ func (w *DBWriter) WriteAsync(fn func(*sql.DB) error) {
 	}
 }
 
+// WriteBulk queues a metrics batch (fire-and-forget). Batches must not
+// depend on the order of other writes; they may run concurrently.
+func (w *DBWriter) WriteBulk(fn func(*sql.DB) error) {
+	if w.bulkCh == nil {
+		w.WriteAsync(fn)
+		return
+	}
+	select {
+	case w.bulkCh <- writeJob{fn: fn, result: nil}:
+	default:
+		fmt.Println("Warning: bulk write queue full, dropping write")
+	}
+}
+
 // WriteSync queues a write operation and waits for result
 func (w *DBWriter) WriteSync(fn func(*sql.DB) error) error {
 	result := make(chan error, 1)
@@ -999,464 +1062,18 @@ func (w *DBWriter) GetDB() *sql.DB {
 	return w.db
 }
 
+// InitDatabase opens the configured database and brings its schema up to date
 func InitDatabase() (*sql.DB, error) {
-	// Open database with busy_timeout as fallback
-	db, err := sql.Open("sqlite", GetDBPath()+"?_busy_timeout=5000")
+	db, err := openConfiguredDatabase()
 	if err != nil {
 		return nil, err
 	}
 
-	// Enable WAL mode for better concurrent read access
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		fmt.Printf("Warning: Failed to enable WAL mode: %v\n", err)
-	}
-
-	// Set synchronous to NORMAL for better performance while still being safe
-	if _, err := db.Exec("PRAGMA synchronous=NORMAL"); err != nil {
-		fmt.Printf("Warning: Failed to set synchronous mode: %v\n", err)
-	}
-
-	// Create tables
-	_, err = db.Exec(`
-		-- Raw metrics (keep for 24 hours)
-		-- Note: bucket_5min column added via migration for existing databases
-		CREATE TABLE IF NOT EXISTS metrics_raw (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			timestamp TEXT NOT NULL,
-			cpu_usage REAL NOT NULL,
-			memory_usage REAL NOT NULL,
-			disk_usage REAL NOT NULL,
-			net_rx INTEGER NOT NULL,
-			net_tx INTEGER NOT NULL,
-			load_1 REAL NOT NULL,
-			load_5 REAL NOT NULL,
-			load_15 REAL NOT NULL,
-			ping_ms REAL,
-			created_at TEXT DEFAULT CURRENT_TIMESTAMP
-		);
-		
-		-- 15-minute aggregated metrics (keep for 7 days, for 7d range with 720 points)
-		CREATE TABLE IF NOT EXISTS metrics_15min (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			bucket_start TEXT NOT NULL,
-			cpu_avg REAL NOT NULL,
-			cpu_max REAL NOT NULL,
-			memory_avg REAL NOT NULL,
-			memory_max REAL NOT NULL,
-			disk_avg REAL NOT NULL,
-			net_rx_total INTEGER NOT NULL,
-			net_tx_total INTEGER NOT NULL,
-			ping_avg REAL,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, bucket_start)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_metrics_15min_server_time ON metrics_15min(server_id, bucket_start);
-		
-		-- Hourly aggregated metrics (keep for 30 days)
-		CREATE TABLE IF NOT EXISTS metrics_hourly (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			hour_start TEXT NOT NULL,
-			cpu_avg REAL NOT NULL,
-			cpu_max REAL NOT NULL,
-			memory_avg REAL NOT NULL,
-			memory_max REAL NOT NULL,
-			disk_avg REAL NOT NULL,
-			net_rx_total INTEGER NOT NULL,
-			net_tx_total INTEGER NOT NULL,
-			ping_avg REAL,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, hour_start)
-		);
-		
-		-- Daily aggregated metrics (keep forever)
-		CREATE TABLE IF NOT EXISTS metrics_daily (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			date TEXT NOT NULL,
-			cpu_avg REAL NOT NULL,
-			cpu_max REAL NOT NULL,
-			memory_avg REAL NOT NULL,
-			memory_max REAL NOT NULL,
-			disk_avg REAL NOT NULL,
-			net_rx_total INTEGER NOT NULL,
-			net_tx_total INTEGER NOT NULL,
-			uptime_percent REAL NOT NULL,
-			ping_avg REAL,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, date)
-		);
-		
-		-- Create indexes (bucket_5min index created after migration)
-		CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_time ON metrics_raw(server_id, timestamp);
-		CREATE INDEX IF NOT EXISTS idx_metrics_hourly_server_time ON metrics_hourly(server_id, hour_start);
-		CREATE INDEX IF NOT EXISTS idx_metrics_daily_server_time ON metrics_daily(server_id, date);
-		
-		-- Ping metrics per target (keep for 24 hours)
-		-- Note: bucket_5min column added via migration for existing databases
-		CREATE TABLE IF NOT EXISTS ping_raw (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			timestamp TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_ms REAL,
-			packet_loss REAL NOT NULL DEFAULT 0,
-			status TEXT NOT NULL DEFAULT 'ok'
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_raw_server_time ON ping_raw(server_id, timestamp);
-		CREATE INDEX IF NOT EXISTS idx_ping_raw_target ON ping_raw(server_id, target_name, timestamp);
-		
-		-- 15-minute aggregated ping metrics (keep for 7 days)
-		CREATE TABLE IF NOT EXISTS ping_15min (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			bucket_start TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_avg REAL,
-			latency_max REAL,
-			packet_loss_avg REAL NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, target_name, bucket_start)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_15min_server_time ON ping_15min(server_id, bucket_start);
-		CREATE INDEX IF NOT EXISTS idx_ping_15min_target ON ping_15min(server_id, target_name, bucket_start);
-		
-		-- Hourly aggregated ping metrics (keep for 30 days)
-		CREATE TABLE IF NOT EXISTS ping_hourly (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			hour_start TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_avg REAL,
-			latency_max REAL,
-			packet_loss_avg REAL NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, target_name, hour_start)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_hourly_server_time ON ping_hourly(server_id, hour_start);
-		CREATE INDEX IF NOT EXISTS idx_ping_hourly_target ON ping_hourly(server_id, target_name, hour_start);
-		
-		-- Daily aggregated ping metrics (keep forever)
-		CREATE TABLE IF NOT EXISTS ping_daily (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			date TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_avg REAL,
-			latency_max REAL,
-			packet_loss_avg REAL NOT NULL DEFAULT 0,
-			uptime_percent REAL NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, target_name, date)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_daily_server_time ON ping_daily(server_id, date);
-		CREATE INDEX IF NOT EXISTS idx_ping_daily_target ON ping_daily(server_id, target_name, date);
-	`)
-	if err != nil {
+	if _, err := runMigrations(db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	// Migration: Add ping_ms column if it doesn't exist
-	db.Exec("ALTER TABLE metrics_raw ADD COLUMN ping_ms REAL")
-	db.Exec("ALTER TABLE metrics_hourly ADD COLUMN ping_avg REAL")
-	db.Exec("ALTER TABLE metrics_daily ADD COLUMN ping_avg REAL")
-
-	// Migration: Add bucket_5min column for efficient 24h sampling (actually stores 2-min buckets for 720 points)
-	db.Exec("ALTER TABLE metrics_raw ADD COLUMN bucket_5min INTEGER")
-	db.Exec("ALTER TABLE ping_raw ADD COLUMN bucket_5min INTEGER")
-
-	// Create indexes for bucket_5min (ignore error if already exists)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket ON metrics_raw(server_id, bucket_5min)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket ON ping_raw(server_id, bucket_5min)")
-
-	// Backfill bucket for existing data - only if there are NULL values (check first for fast startup)
-	var needsBackfill5min int
-	db.QueryRow("SELECT 1 FROM metrics_raw WHERE bucket_5min IS NULL OR bucket_5min > 100000000 LIMIT 1").Scan(&needsBackfill5min)
-	if needsBackfill5min == 1 {
-		fmt.Println("⏳ Backfilling bucket_5min for metrics_raw (one-time migration)...")
-		db.Exec("UPDATE metrics_raw SET bucket_5min = CAST(strftime('%s', timestamp) AS INTEGER) / 120 WHERE bucket_5min IS NULL OR bucket_5min > 100000000")
-	}
-	db.QueryRow("SELECT 1 FROM ping_raw WHERE bucket_5min IS NULL OR bucket_5min > 100000000 LIMIT 1").Scan(&needsBackfill5min)
-	if needsBackfill5min == 1 {
-		fmt.Println("⏳ Backfilling bucket_5min for ping_raw (one-time migration)...")
-		db.Exec("UPDATE ping_raw SET bucket_5min = CAST(strftime('%s', timestamp) AS INTEGER) / 120 WHERE bucket_5min IS NULL OR bucket_5min > 100000000")
-	}
-
-	// Migration: Add bucket_5sec column for efficient 1h sampling (5-sec buckets for 720 points over 1h)
-	db.Exec("ALTER TABLE metrics_raw ADD COLUMN bucket_5sec INTEGER")
-	db.Exec("ALTER TABLE ping_raw ADD COLUMN bucket_5sec INTEGER")
-
-	// Create indexes for bucket_5sec (ignore error if already exists)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket_5sec ON metrics_raw(server_id, bucket_5sec)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket_5sec ON ping_raw(server_id, bucket_5sec)")
-
-	// Backfill bucket_5sec for existing data - only if there are NULL values (check first for fast startup)
-	var needsBackfill5sec int
-	db.QueryRow("SELECT 1 FROM metrics_raw WHERE bucket_5sec IS NULL LIMIT 1").Scan(&needsBackfill5sec)
-	if needsBackfill5sec == 1 {
-		fmt.Println("⏳ Backfilling bucket_5sec for metrics_raw (one-time migration)...")
-		db.Exec("UPDATE metrics_raw SET bucket_5sec = CAST(strftime('%s', timestamp) AS INTEGER) / 5 WHERE bucket_5sec IS NULL")
-	}
-	db.QueryRow("SELECT 1 FROM ping_raw WHERE bucket_5sec IS NULL LIMIT 1").Scan(&needsBackfill5sec)
-	if needsBackfill5sec == 1 {
-		fmt.Println("⏳ Backfilling bucket_5sec for ping_raw (one-time migration)...")
-		db.Exec("UPDATE ping_raw SET bucket_5sec = CAST(strftime('%s', timestamp) AS INTEGER) / 5 WHERE bucket_5sec IS NULL")
-	}
-
-	// Create real-time aggregation tables for fast queries
-	db.Exec(`
-		-- 5-second aggregated metrics (for 1h queries, ~720 points per server)
-		CREATE TABLE IF NOT EXISTS metrics_5sec (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- 2-minute aggregated metrics (for 24h queries, ~720 points per server)
-		CREATE TABLE IF NOT EXISTS metrics_2min (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	// New aggregation tables for agent-side aggregation (15min, hourly, daily)
-	db.Exec(`
-		-- 15-minute aggregated metrics (for 7d queries, from agent)
-		CREATE TABLE IF NOT EXISTS metrics_15min_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Hourly aggregated metrics (for 30d queries, from agent)
-		CREATE TABLE IF NOT EXISTS metrics_hourly_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Daily aggregated metrics (for 1y queries, from agent)
-		CREATE TABLE IF NOT EXISTS metrics_daily_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- 5-second aggregated ping metrics (for 1h queries)
-		CREATE TABLE IF NOT EXISTS ping_5sec (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- 2-minute aggregated ping metrics (for 24h queries)
-		CREATE TABLE IF NOT EXISTS ping_2min (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	// New ping aggregation tables for agent-side aggregation
-	db.Exec(`
-		-- 15-minute aggregated ping metrics (for 7d queries, from agent)
-		CREATE TABLE IF NOT EXISTS ping_15min_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Hourly aggregated ping metrics (for 30d queries, from agent)
-		CREATE TABLE IF NOT EXISTS ping_hourly_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Daily aggregated ping metrics (for 1y queries, from agent)
-		CREATE TABLE IF NOT EXISTS ping_daily_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	// Create alert history table
-	db.Exec(`
-		CREATE TABLE IF NOT EXISTS alert_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			alert_id TEXT NOT NULL,
-			type TEXT NOT NULL,
-			server_id TEXT NOT NULL,
-			server_name TEXT NOT NULL,
-			severity TEXT NOT NULL,
-			value REAL,
-			threshold REAL,
-			message TEXT NOT NULL,
-			started_at TEXT NOT NULL,
-			resolved_at TEXT,
-			duration INTEGER,
-			notified INTEGER NOT NULL DEFAULT 0,
-			created_at TEXT DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_alert_history_server ON alert_history(server_id, started_at)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_alert_history_type ON alert_history(type, started_at)")
-
-	// Create notification events table
-	db.Exec(`
-		CREATE TABLE IF NOT EXISTS notification_events (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			alert_id TEXT NOT NULL,
-			channel_id TEXT NOT NULL,
-			type TEXT NOT NULL,
-			server_id TEXT NOT NULL,
-			title TEXT NOT NULL,
-			message TEXT NOT NULL,
-			status TEXT NOT NULL,
-			error TEXT,
-			sent_at TEXT NOT NULL,
-			retry_count INTEGER NOT NULL DEFAULT 0
-		)
-	`)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_notification_events_alert ON notification_events(alert_id)")
-
-	// Create audit log table
-	db.Exec(`
-		CREATE TABLE IF NOT EXISTS audit_logs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			timestamp TEXT NOT NULL,
-			action TEXT NOT NULL,
-			category TEXT NOT NULL,
-			user_ip TEXT NOT NULL,
-			user_agent TEXT,
-			target_type TEXT,
-			target_id TEXT,
-			target_name TEXT,
-			details TEXT,
-			status TEXT NOT NULL DEFAULT 'success',
-			error_message TEXT
-		)
-	`)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_audit_logs_timestamp ON audit_logs(timestamp)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_audit_logs_category ON audit_logs(category)")
-
 	// Run ANALYZE in background to avoid slow startup
 	go func() {
 		time.Sleep(10 * time.Second) // Wait for server to fully start
@@ -1589,17 +1206,7 @@ func storeMultiGranularityMetricsInternal(db *sql.DB, serverID string, granulari
 			db.Exec(`
 				INSERT INTO `+metricsTable+` (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-				ON CONFLICT(server_id, bucket) DO UPDATE SET
-					cpu_sum = excluded.cpu_sum,
-					cpu_max = MAX(cpu_max, excluded.cpu_max),
-					memory_sum = excluded.memory_sum,
-					memory_max = MAX(memory_max, excluded.memory_max),
-					disk_sum = excluded.disk_sum,
-					net_rx = MAX(net_rx, excluded.net_rx),
-					net_tx = MAX(net_tx, excluded.net_tx),
-					ping_sum = excluded.ping_sum,
-					ping_count = excluded.ping_count,
-					sample_count = excluded.sample_count`,
+				ON CONFLICT(server_id, bucket) DO UPDATE SET`+metricsReplaceSet(metricsTable),
 				serverID, m.Bucket,
 				m.CPUSum, m.CPUMax,
 				m.MemorySum, m.MemoryMax,
@@ -1615,13 +1222,7 @@ func storeMultiGranularityMetricsInternal(db *sql.DB, serverID string, granulari
 			db.Exec(`
 				INSERT INTO `+pingTable+` (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
 				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-				ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET
-					target_host = excluded.target_host,
-					latency_sum = excluded.latency_sum,
-					latency_max = MAX(latency_max, excluded.latency_max),
-					latency_count = excluded.latency_count,
-					ok_count = excluded.ok_count,
-					fail_count = excluded.fail_count`,
+				ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET`+pingMaxSet(pingTable),
 				serverID, p.Bucket, p.TargetName, p.TargetHost,
 				p.LatencySum, p.LatencyMax, p.LatencyCount, p.OkCount, p.FailCount,
 			)
@@ -1702,17 +1303,7 @@ func storeAggregatedMetricsInternal(db *sql.DB, serverID string, agg *common.Agg
 	_, err = db.Exec(`
 		INSERT INTO metrics_2min (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(server_id, bucket) DO UPDATE SET
-			cpu_sum = cpu_sum + excluded.cpu_sum,
-			cpu_max = MAX(cpu_max, excluded.cpu_max),
-			memory_sum = memory_sum + excluded.memory_sum,
-			memory_max = MAX(memory_max, excluded.memory_max),
-			disk_sum = disk_sum + excluded.disk_sum,
-			net_rx = MAX(net_rx, excluded.net_rx),
-			net_tx = MAX(net_tx, excluded.net_tx),
-			ping_sum = ping_sum + excluded.ping_sum,
-			ping_count = ping_count + excluded.ping_count,
-			sample_count = sample_count + excluded.sample_count`,
+		ON CONFLICT(server_id, bucket) DO UPDATE SET`+metricsAccumulateSet("metrics_2min", "excluded.sample_count"),
 		serverID, bucket2min,
 		float64(agg.CPUAvg)*float64(agg.SampleCount), float64(agg.CPUMax),
 		float64(agg.MemoryAvg)*float64(agg.SampleCount), float64(agg.MemoryMax),
@@ -1807,17 +1398,7 @@ func storeMetricsInternal(db *sql.DB, serverID string, metrics *SystemMetrics) e
 	db.Exec(`
 		INSERT INTO metrics_5sec (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(server_id, bucket) DO UPDATE SET
-			cpu_sum = cpu_sum + excluded.cpu_sum,
-			cpu_max = MAX(cpu_max, excluded.cpu_max),
-			memory_sum = memory_sum + excluded.memory_sum,
-			memory_max = MAX(memory_max, excluded.memory_max),
-			disk_sum = disk_sum + excluded.disk_sum,
-			net_rx = MAX(net_rx, excluded.net_rx),
-			net_tx = MAX(net_tx, excluded.net_tx),
-			ping_sum = ping_sum + excluded.ping_sum,
-			ping_count = ping_count + excluded.ping_count,
-			sample_count = sample_count + 1`,
+		ON CONFLICT(server_id, bucket) DO UPDATE SET`+metricsAccumulateSet("metrics_5sec", "1"),
 		serverID, bucket5sec,
 		float64(metrics.CPU.Usage), float64(metrics.CPU.Usage),
 		float64(metrics.Memory.UsagePercent), float64(metrics.Memory.UsagePercent),
@@ -1830,17 +1411,7 @@ func storeMetricsInternal(db *sql.DB, serverID string, metrics *SystemMetrics) e
 	db.Exec(`
 		INSERT INTO metrics_2min (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(server_id, bucket) DO UPDATE SET
-			cpu_sum = cpu_sum + excluded.cpu_sum,
-			cpu_max = MAX(cpu_max, excluded.cpu_max),
-			memory_sum = memory_sum + excluded.memory_sum,
-			memory_max = MAX(memory_max, excluded.memory_max),
-			disk_sum = disk_sum + excluded.disk_sum,
-			net_rx = MAX(net_rx, excluded.net_rx),
-			net_tx = MAX(net_tx, excluded.net_tx),
-			ping_sum = ping_sum + excluded.ping_sum,
-			ping_count = ping_count + excluded.ping_count,
-			sample_count = sample_count + 1`,
+		ON CONFLICT(server_id, bucket) DO UPDATE SET`+metricsAccumulateSet("metrics_2min", "1"),
 		serverID, bucket5min,
 		float64(metrics.CPU.Usage), float64(metrics.CPU.Usage),
 		float64(metrics.Memory.UsagePercent), float64(metrics.Memory.UsagePercent),
@@ -1915,171 +1486,6 @@ func storeMetricsInternal(db *sql.DB, serverID string, metrics *SystemMetrics) e
 	return nil
 }
 
-func Aggregate15Min(db *sql.DB) error {
-	if dbWriter != nil {
-		return dbWriter.WriteSync(aggregate15MinInternal)
-	}
-	return aggregate15MinInternal(db)
-}
-
-func aggregate15MinInternal(db *sql.DB) error {
-	// Aggregate raw data from the last hour into 15-minute buckets
-	// This runs every 15 minutes, processing data from 15-30 minutes ago
-	now := time.Now().UTC()
-	// Round down to the previous 15-minute boundary
-	minuteOffset := now.Minute() % 15
-	bucketEnd := now.Add(-time.Duration(minuteOffset) * time.Minute).Truncate(time.Minute)
-	bucketStart := bucketEnd.Add(-15 * time.Minute)
-
-	_, err := db.Exec(`
-		INSERT OR REPLACE INTO metrics_15min (server_id, bucket_start, cpu_avg, cpu_max, memory_avg, memory_max, disk_avg, net_rx_total, net_tx_total, ping_avg, sample_count)
-		SELECT 
-			server_id,
-			? as bucket_start,
-			AVG(cpu_usage),
-			MAX(cpu_usage),
-			AVG(memory_usage),
-			MAX(memory_usage),
-			AVG(disk_usage),
-			MAX(net_rx) - MIN(net_rx),
-			MAX(net_tx) - MIN(net_tx),
-			AVG(ping_ms),
-			COUNT(*)
-		FROM metrics_raw
-		WHERE timestamp >= ? AND timestamp < ?
-		GROUP BY server_id`,
-		bucketStart.Format(time.RFC3339),
-		bucketStart.Format(time.RFC3339),
-		bucketEnd.Format(time.RFC3339))
-	if err != nil {
-		return err
-	}
-
-	// Aggregate ping data into 15-minute buckets
-	_, err = db.Exec(`
-		INSERT OR REPLACE INTO ping_15min (server_id, bucket_start, target_name, target_host, latency_avg, latency_max, packet_loss_avg, ok_count, fail_count, sample_count)
-		SELECT 
-			server_id,
-			? as bucket_start,
-			target_name,
-			target_host,
-			AVG(latency_ms),
-			MAX(latency_ms),
-			AVG(packet_loss),
-			SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status != 'ok' THEN 1 ELSE 0 END),
-			COUNT(*)
-		FROM ping_raw
-		WHERE timestamp >= ? AND timestamp < ?
-		GROUP BY server_id, target_name, target_host`,
-		bucketStart.Format(time.RFC3339),
-		bucketStart.Format(time.RFC3339),
-		bucketEnd.Format(time.RFC3339))
-	return err
-}
-
-func AggregateHourly(db *sql.DB) error {
-	if dbWriter != nil {
-		return dbWriter.WriteSync(aggregateHourlyInternal)
-	}
-	return aggregateHourlyInternal(db)
-}
-
-func aggregateHourlyInternal(db *sql.DB) error {
-	hourAgo := time.Now().UTC().Add(-time.Hour)
-	hourStart := hourAgo.Format("2006-01-02T15:00:00Z")
-
-	_, err := db.Exec(`
-		INSERT OR REPLACE INTO metrics_hourly (server_id, hour_start, cpu_avg, cpu_max, memory_avg, memory_max, disk_avg, net_rx_total, net_tx_total, ping_avg, sample_count)
-		SELECT 
-			server_id,
-			strftime('%Y-%m-%dT%H:00:00Z', bucket_start) as hour,
-			AVG(cpu_avg),
-			MAX(cpu_max),
-			AVG(memory_avg),
-			MAX(memory_max),
-			AVG(disk_avg),
-			SUM(net_rx_total),
-			SUM(net_tx_total),
-			AVG(ping_avg),
-			SUM(sample_count)
-		FROM metrics_15min
-		WHERE bucket_start >= ? AND bucket_start < datetime(?, '+1 hour')
-		GROUP BY server_id, hour`, hourStart, hourStart)
-	if err != nil {
-		return err
-	}
-
-	// Aggregate ping data into hourly buckets
-	_, err = db.Exec(`
-		INSERT OR REPLACE INTO ping_hourly (server_id, hour_start, target_name, target_host, latency_avg, latency_max, packet_loss_avg, ok_count, fail_count, sample_count)
-		SELECT 
-			server_id,
-			strftime('%Y-%m-%dT%H:00:00Z', bucket_start) as hour,
-			target_name,
-			target_host,
-			AVG(latency_avg),
-			MAX(latency_max),
-			AVG(packet_loss_avg),
-			SUM(ok_count),
-			SUM(fail_count),
-			SUM(sample_count)
-		FROM ping_15min
-		WHERE bucket_start >= ? AND bucket_start < datetime(?, '+1 hour')
-		GROUP BY server_id, target_name, target_host, hour`, hourStart, hourStart)
-	return err
-}
-
-func AggregateDaily(db *sql.DB) error {
-	if dbWriter != nil {
-		return dbWriter.WriteSync(aggregateDailyInternal)
-	}
-	return aggregateDailyInternal(db)
-}
-
-func aggregateDailyInternal(db *sql.DB) error {
-	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
-
-	_, err := db.Exec(`
-		INSERT OR REPLACE INTO metrics_daily (server_id, date, cpu_avg, cpu_max, memory_avg, memory_max, disk_avg, net_rx_total, net_tx_total, uptime_percent, sample_count)
-		SELECT 
-			server_id,
-			date(hour_start) as day,
-			AVG(cpu_avg),
-			MAX(cpu_max),
-			AVG(memory_avg),
-			MAX(memory_max),
-			AVG(disk_avg),
-			SUM(net_rx_total),
-			SUM(net_tx_total),
-			(COUNT(*) * 100.0 / 24.0),
-			SUM(sample_count)
-		FROM metrics_hourly
-		WHERE date(hour_start) = ?
-		GROUP BY server_id, day`, yesterday)
-	if err != nil {
-		return err
-	}
-
-	// Aggregate ping data into daily buckets
-	_, err = db.Exec(`
-		INSERT OR REPLACE INTO ping_daily (server_id, date, target_name, target_host, latency_avg, latency_max, packet_loss_avg, uptime_percent, sample_count)
-		SELECT 
-			server_id,
-			date(hour_start) as day,
-			target_name,
-			target_host,
-			AVG(latency_avg),
-			MAX(latency_max),
-			AVG(packet_loss_avg),
-			(SUM(ok_count) * 100.0 / (SUM(ok_count) + SUM(fail_count))),
-			SUM(sample_count)
-		FROM ping_hourly
-		WHERE date(hour_start) = ?
-		GROUP BY server_id, target_name, target_host, day`, yesterday)
-	return err
-}
-
 func CleanupOldData(db *sql.DB) error {
 	if dbWriter != nil {
 		return dbWriter.WriteSync(cleanupOldDataInternal)
@@ -2124,15 +1530,13 @@ func cleanupOldDataInternal(db *sql.DB) error {
 	db.Exec("DELETE FROM metrics_daily_agg WHERE bucket < ?", cutoffDailyAgg)
 	db.Exec("DELETE FROM ping_daily_agg WHERE bucket < ?", cutoffDailyAgg)
 
-	// Delete old pre-aggregated 15-min data older than 7 days (legacy)
-	cutoff15min := time.Now().UTC().Add(-7 * 24 * time.Hour).Format(time.RFC3339)
-	db.Exec("DELETE FROM metrics_15min WHERE bucket_start < ?", cutoff15min)
-	db.Exec("DELETE FROM ping_15min WHERE bucket_start < ?", cutoff15min)
+	// Delete delivered and abandoned notifications older than 30 days
+	cutoffNotifications := time.Now().UTC().Add(-notificationRetention).Format(time.RFC3339)
+	db.Exec("DELETE FROM notification_events WHERE status != ? AND created_at < ?", NotificationPending, cutoffNotifications)
 
-	// Delete old pre-aggregated hourly data older than 30 days (legacy)
-	cutoffHourly := time.Now().UTC().AddDate(0, 0, -30).Format(time.RFC3339)
-	db.Exec("DELETE FROM metrics_hourly WHERE hour_start < ?", cutoffHourly)
-	db.Exec("DELETE FROM ping_hourly WHERE hour_start < ?", cutoffHourly)
+	// Delete silences that ended more than 30 days ago
+	cutoffSilences := time.Now().UTC().Add(-silenceRetention).Format(time.RFC3339)
+	db.Exec("DELETE FROM silences WHERE expired_at < ? OR ends_at < ?", cutoffSilences, cutoffSilences)
 
 	// Update query planner statistics after cleanup
 	db.Exec("ANALYZE")
@@ -2159,7 +1563,7 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 		}
 		rows, err = db.Query(`
 			SELECT 
-				strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 5, 'unixepoch') as timestamp,
+				`+sqlDialect.UnixToTimestamp("bucket * 5")+` as timestamp,
 				CASE WHEN sample_count > 0 THEN cpu_sum / sample_count ELSE 0 END as cpu_usage,
 				CASE WHEN sample_count > 0 THEN memory_sum / sample_count ELSE 0 END as memory_usage,
 				CASE WHEN sample_count > 0 THEN disk_sum / sample_count ELSE 0 END as disk_usage,
@@ -2180,7 +1584,7 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 		}
 		rows, err = db.Query(`
 			SELECT 
-				strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 120, 'unixepoch') as timestamp,
+				`+sqlDialect.UnixToTimestamp("bucket * 120")+` as timestamp,
 				CASE WHEN sample_count > 0 THEN cpu_sum / sample_count ELSE 0 END as cpu_usage,
 				CASE WHEN sample_count > 0 THEN memory_sum / sample_count ELSE 0 END as memory_usage,
 				CASE WHEN sample_count > 0 THEN disk_sum / sample_count ELSE 0 END as disk_usage,
@@ -2204,7 +1608,7 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 			// Use agent-aggregated 15-min data
 			rows, err = db.Query(`
 				SELECT 
-					strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 900, 'unixepoch') as timestamp,
+					`+sqlDialect.UnixToTimestamp("bucket * 900")+` as timestamp,
 					CASE WHEN sample_count > 0 THEN cpu_sum / sample_count ELSE 0 END as cpu_usage,
 					CASE WHEN sample_count > 0 THEN memory_sum / sample_count ELSE 0 END as memory_usage,
 					CASE WHEN sample_count > 0 THEN disk_sum / sample_count ELSE 0 END as disk_usage,
@@ -2216,35 +1620,22 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 				ORDER BY bucket ASC
 				LIMIT 720`, serverID, cutoffBucket)
 		} else {
-			// Fall back to old pre-aggregated 15-min data (for backward compatibility)
+			// Fall back to real-time aggregation from raw data (15-min buckets = 900 seconds)
 			cutoff := time.Now().UTC().Add(-7 * 24 * time.Hour).Format(time.RFC3339)
-			db.QueryRow(`SELECT COUNT(*) FROM metrics_15min WHERE server_id = ? AND bucket_start >= ?`,
-				serverID, cutoff).Scan(&count)
-			
-			if count > 0 {
-				rows, err = db.Query(`
-					SELECT bucket_start, cpu_avg, memory_avg, disk_avg, net_rx_total, net_tx_total, ping_avg
-					FROM metrics_15min 
-					WHERE server_id = ? AND bucket_start >= ?
-					ORDER BY bucket_start ASC
-					LIMIT 720`, serverID, cutoff)
-			} else {
-				// Fall back to real-time aggregation from raw data (15-min buckets = 900 seconds)
-				rows, err = db.Query(`
-					SELECT 
-						strftime('%Y-%m-%dT%H:%M:%SZ', (strftime('%s', timestamp) / 900) * 900, 'unixepoch') as bucket_start,
-						AVG(cpu_usage) as cpu_avg,
-						AVG(memory_usage) as memory_avg,
-						AVG(disk_usage) as disk_avg,
-						MAX(net_rx) - MIN(net_rx) as net_rx_total,
-						MAX(net_tx) - MIN(net_tx) as net_tx_total,
-						AVG(ping_ms) as ping_avg
-					FROM metrics_raw 
-					WHERE server_id = ? AND timestamp >= ?
-					GROUP BY strftime('%s', timestamp) / 900
-					ORDER BY bucket_start ASC
-					LIMIT 720`, serverID, cutoff)
-			}
+			rows, err = db.Query(`
+				SELECT 
+					`+sqlDialect.UnixToTimestamp("("+sqlDialect.TimestampToUnix("timestamp")+" / 900) * 900")+` as bucket_start,
+					AVG(cpu_usage) as cpu_avg,
+					AVG(memory_usage) as memory_avg,
+					AVG(disk_usage) as disk_avg,
+					MAX(net_rx) - MIN(net_rx) as net_rx_total,
+					MAX(net_tx) - MIN(net_tx) as net_tx_total,
+					AVG(ping_ms) as ping_avg
+				FROM metrics_raw 
+				WHERE server_id = ? AND timestamp >= ?
+				GROUP BY `+sqlDialect.TimestampToUnix("timestamp")+` / 900
+				ORDER BY bucket_start ASC
+				LIMIT 720`, serverID, cutoff)
 		}
 
 	case "30d":
@@ -2258,7 +1649,7 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 			// Use agent-aggregated hourly data
 			rows, err = db.Query(`
 				SELECT 
-					strftime('%Y-%m-%dT%H:00:00Z', bucket * 3600, 'unixepoch') as timestamp,
+					`+sqlDialect.UnixToTimestamp("bucket * 3600")+` as timestamp,
 					CASE WHEN sample_count > 0 THEN cpu_sum / sample_count ELSE 0 END as cpu_usage,
 					CASE WHEN sample_count > 0 THEN memory_sum / sample_count ELSE 0 END as memory_usage,
 					CASE WHEN sample_count > 0 THEN disk_sum / sample_count ELSE 0 END as disk_usage,
@@ -2270,56 +1661,22 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 				ORDER BY bucket ASC
 				LIMIT 720`, serverID, cutoffBucket)
 		} else {
-			// Fall back to old pre-aggregated hourly data (for backward compatibility)
+			// Fall back to raw data with hourly aggregation
 			cutoff := time.Now().UTC().AddDate(0, 0, -30).Format(time.RFC3339)
-			db.QueryRow(`SELECT COUNT(*) FROM metrics_hourly WHERE server_id = ? AND hour_start >= ?`,
-				serverID, cutoff).Scan(&count)
-
-			if count > 0 {
-				rows, err = db.Query(`
-					SELECT hour_start, cpu_avg, memory_avg, disk_avg, net_rx_total, net_tx_total, ping_avg
-					FROM metrics_hourly WHERE server_id = ? AND hour_start >= ?
-					ORDER BY hour_start ASC
-					LIMIT 720`, serverID, cutoff)
-			} else {
-				// Try 15-min table
-				var count15 int
-				db.QueryRow(`SELECT COUNT(*) FROM metrics_15min WHERE server_id = ? AND bucket_start >= ?`,
-					serverID, cutoff).Scan(&count15)
-
-				if count15 > 0 {
-					rows, err = db.Query(`
-						SELECT 
-							strftime('%Y-%m-%dT%H:00:00Z', bucket_start) as hour_start,
-							AVG(cpu_avg) as cpu_avg,
-							AVG(memory_avg) as memory_avg,
-							AVG(disk_avg) as disk_avg,
-							SUM(net_rx_total) as net_rx_total,
-							SUM(net_tx_total) as net_tx_total,
-							AVG(ping_avg) as ping_avg
-						FROM metrics_15min 
-						WHERE server_id = ? AND bucket_start >= ?
-						GROUP BY strftime('%Y-%m-%dT%H:00:00Z', bucket_start)
-						ORDER BY hour_start ASC
-						LIMIT 720`, serverID, cutoff)
-				} else {
-					// Fall back to raw data with hourly aggregation
-					rows, err = db.Query(`
-						SELECT 
-							strftime('%Y-%m-%dT%H:00:00Z', timestamp) as hour_start,
-							AVG(cpu_usage) as cpu_avg,
-							AVG(memory_usage) as memory_avg,
-							AVG(disk_usage) as disk_avg,
-							MAX(net_rx) - MIN(net_rx) as net_rx_total,
-							MAX(net_tx) - MIN(net_tx) as net_tx_total,
-							AVG(ping_ms) as ping_avg
-						FROM metrics_raw 
-						WHERE server_id = ? AND timestamp >= ?
-						GROUP BY strftime('%Y-%m-%dT%H:00:00Z', timestamp)
-						ORDER BY hour_start ASC
-						LIMIT 720`, serverID, cutoff)
-				}
-			}
+			rows, err = db.Query(`
+				SELECT 
+					substr(timestamp, 1, 13) || ':00:00Z' as hour_start,
+					AVG(cpu_usage) as cpu_avg,
+					AVG(memory_usage) as memory_avg,
+					AVG(disk_usage) as disk_avg,
+					MAX(net_rx) - MIN(net_rx) as net_rx_total,
+					MAX(net_tx) - MIN(net_tx) as net_tx_total,
+					AVG(ping_ms) as ping_avg
+				FROM metrics_raw 
+				WHERE server_id = ? AND timestamp >= ?
+				GROUP BY substr(timestamp, 1, 13) || ':00:00Z'
+				ORDER BY hour_start ASC
+				LIMIT 720`, serverID, cutoff)
 		}
 
 	case "1y":
@@ -2333,7 +1690,7 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 			// Use agent-aggregated daily data
 			rows, err = db.Query(`
 				SELECT 
-					strftime('%Y-%m-%dT00:00:00Z', bucket * 86400, 'unixepoch') as timestamp,
+					`+sqlDialect.UnixToTimestamp("bucket * 86400")+` as timestamp,
 					CASE WHEN sample_count > 0 THEN cpu_sum / sample_count ELSE 0 END as cpu_usage,
 					CASE WHEN sample_count > 0 THEN memory_sum / sample_count ELSE 0 END as memory_usage,
 					CASE WHEN sample_count > 0 THEN disk_sum / sample_count ELSE 0 END as disk_usage,
@@ -2345,44 +1702,22 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 				ORDER BY bucket ASC
 				LIMIT 365`, serverID, cutoffBucket)
 		} else {
-			// Fall back to old pre-aggregated hourly data (for backward compatibility)
+			// Fall back to raw data with 12-hour aggregation
 			cutoff := time.Now().UTC().AddDate(0, 0, -365).Format(time.RFC3339)
-			db.QueryRow(`SELECT COUNT(*) FROM metrics_hourly WHERE server_id = ? AND hour_start >= ?`,
-				serverID, cutoff).Scan(&count)
-
-			if count > 0 {
-				// Use hourly data with 12-hour grouping
-				rows, err = db.Query(`
-					SELECT 
-						MIN(hour_start) as timestamp,
-						AVG(cpu_avg) as cpu_avg,
-						AVG(memory_avg) as memory_avg,
-						AVG(disk_avg) as disk_avg,
-						SUM(net_rx_total) as net_rx_total,
-						SUM(net_tx_total) as net_tx_total,
-						AVG(ping_avg) as ping_avg
-					FROM metrics_hourly 
-					WHERE server_id = ? AND hour_start >= ?
-					GROUP BY date(hour_start), (CAST(strftime('%H', hour_start) AS INTEGER) / 12)
-					ORDER BY MIN(hour_start) ASC
-					LIMIT 730`, serverID, cutoff)
-			} else {
-				// Fall back to raw data with 12-hour aggregation
-				rows, err = db.Query(`
-					SELECT 
-						MIN(timestamp) as timestamp,
-						AVG(cpu_usage) as cpu_avg,
-						AVG(memory_usage) as memory_avg,
-						AVG(disk_usage) as disk_avg,
-						MAX(net_rx) - MIN(net_rx) as net_rx_total,
-						MAX(net_tx) - MIN(net_tx) as net_tx_total,
-						AVG(ping_ms) as ping_avg
-					FROM metrics_raw 
-					WHERE server_id = ? AND timestamp >= ?
-					GROUP BY date(timestamp), (CAST(strftime('%H', timestamp) AS INTEGER) / 12)
-					ORDER BY MIN(timestamp) ASC
-					LIMIT 730`, serverID, cutoff)
-			}
+			rows, err = db.Query(`
+				SELECT 
+					MIN(timestamp) as timestamp,
+					AVG(cpu_usage) as cpu_avg,
+					AVG(memory_usage) as memory_avg,
+					AVG(disk_usage) as disk_avg,
+					MAX(net_rx) - MIN(net_rx) as net_rx_total,
+					MAX(net_tx) - MIN(net_tx) as net_tx_total,
+					AVG(ping_ms) as ping_avg
+				FROM metrics_raw 
+				WHERE server_id = ? AND timestamp >= ?
+				GROUP BY substr(timestamp, 1, 10), (CAST(substr(timestamp, 12, 2) AS INTEGER) / 12)
+				ORDER BY MIN(timestamp) ASC
+				LIMIT 730`, serverID, cutoff)
 		}
 
 	default:
@@ -2393,7 +1728,7 @@ func GetHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int64) (
 		}
 		rows, err = db.Query(`
 			SELECT 
-				strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 120, 'unixepoch') as timestamp,
+				`+sqlDialect.UnixToTimestamp("bucket * 120")+` as timestamp,
 				CASE WHEN sample_count > 0 THEN cpu_sum / sample_count ELSE 0 END as cpu_usage,
 				CASE WHEN sample_count > 0 THEN memory_sum / sample_count ELSE 0 END as memory_usage,
 				CASE WHEN sample_count > 0 THEN disk_sum / sample_count ELSE 0 END as disk_usage,
@@ -2453,7 +1788,7 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 			SELECT 
 				target_name,
 				target_host,
-				strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 5, 'unixepoch') as timestamp,
+				`+sqlDialect.UnixToTimestamp("bucket * 5")+` as timestamp,
 				CASE WHEN latency_count > 0 THEN latency_sum / latency_count ELSE NULL END as latency_ms,
 				CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
 			FROM ping_5sec 
@@ -2470,7 +1805,7 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 			SELECT 
 				target_name,
 				target_host,
-				strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 120, 'unixepoch') as timestamp,
+				`+sqlDialect.UnixToTimestamp("bucket * 120")+` as timestamp,
 				CASE WHEN latency_count > 0 THEN latency_sum / latency_count ELSE NULL END as latency_ms,
 				CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
 			FROM ping_2min 
@@ -2490,43 +1825,26 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 				SELECT 
 					target_name,
 					target_host,
-					strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 900, 'unixepoch') as timestamp,
+					`+sqlDialect.UnixToTimestamp("bucket * 900")+` as timestamp,
 					CASE WHEN latency_count > 0 THEN latency_sum / latency_count ELSE NULL END as latency_ms,
 					CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
 				FROM ping_15min_agg 
 				WHERE server_id = ? AND bucket >= ?
 				ORDER BY target_name, bucket ASC`, serverID, cutoffBucket)
 		} else {
-			// Fall back to old pre-aggregated 15-min data
+			// Fall back to real-time aggregation from raw data
 			cutoff := time.Now().UTC().Add(-7 * 24 * time.Hour).Format(time.RFC3339)
-			db.QueryRow(`SELECT COUNT(*) FROM ping_15min WHERE server_id = ? AND bucket_start >= ?`,
-				serverID, cutoff).Scan(&count)
-
-			if count > 0 {
-				rows, err = db.Query(`
-					SELECT 
-						target_name,
-						target_host,
-						bucket_start,
-						latency_avg as latency_ms,
-						CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
-					FROM ping_15min 
-					WHERE server_id = ? AND bucket_start >= ?
-					ORDER BY target_name, bucket_start ASC`, serverID, cutoff)
-			} else {
-				// Fall back to real-time aggregation from raw data
-				rows, err = db.Query(`
-					SELECT 
-						target_name,
-						target_host,
-						strftime('%Y-%m-%dT%H:%M:%SZ', (strftime('%s', timestamp) / 900) * 900, 'unixepoch') as bucket_start,
-						AVG(latency_ms) as latency_ms,
-						MIN(status) as status
-					FROM ping_raw 
-					WHERE server_id = ? AND timestamp >= ?
-					GROUP BY target_name, target_host, strftime('%s', timestamp) / 900
-					ORDER BY target_name, bucket_start ASC`, serverID, cutoff)
-			}
+			rows, err = db.Query(`
+				SELECT 
+					target_name,
+					target_host,
+					`+sqlDialect.UnixToTimestamp("("+sqlDialect.TimestampToUnix("timestamp")+" / 900) * 900")+` as bucket_start,
+					AVG(latency_ms) as latency_ms,
+					MIN(status) as status
+				FROM ping_raw 
+				WHERE server_id = ? AND timestamp >= ?
+				GROUP BY target_name, target_host, `+sqlDialect.TimestampToUnix("timestamp")+` / 900
+				ORDER BY target_name, bucket_start ASC`, serverID, cutoff)
 		}
 
 	case "30d":
@@ -2542,62 +1860,26 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 				SELECT 
 					target_name,
 					target_host,
-					strftime('%Y-%m-%dT%H:00:00Z', bucket * 3600, 'unixepoch') as timestamp,
+					`+sqlDialect.UnixToTimestamp("bucket * 3600")+` as timestamp,
 					CASE WHEN latency_count > 0 THEN latency_sum / latency_count ELSE NULL END as latency_ms,
 					CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
 				FROM ping_hourly_agg 
 				WHERE server_id = ? AND bucket >= ?
 				ORDER BY target_name, bucket ASC`, serverID, cutoffBucket)
 		} else {
-			// Fall back to old pre-aggregated hourly data
+			// Fall back to raw data with hourly aggregation
 			cutoff := time.Now().UTC().AddDate(0, 0, -30).Format(time.RFC3339)
-			db.QueryRow(`SELECT COUNT(*) FROM ping_hourly WHERE server_id = ? AND hour_start >= ?`,
-				serverID, cutoff).Scan(&count)
-
-			if count > 0 {
-				rows, err = db.Query(`
-					SELECT 
-						target_name,
-						target_host,
-						hour_start,
-						latency_avg as latency_ms,
-						CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
-					FROM ping_hourly 
-					WHERE server_id = ? AND hour_start >= ?
-					ORDER BY target_name, hour_start ASC`, serverID, cutoff)
-			} else {
-				// Try 15-min table first
-				var count15 int
-				db.QueryRow(`SELECT COUNT(*) FROM ping_15min WHERE server_id = ? AND bucket_start >= ?`,
-					serverID, cutoff).Scan(&count15)
-
-				if count15 > 0 {
-					rows, err = db.Query(`
-						SELECT 
-							target_name,
-							target_host,
-							strftime('%Y-%m-%dT%H:00:00Z', bucket_start) as hour_start,
-							AVG(latency_avg) as latency_ms,
-							CASE WHEN SUM(fail_count) > 0 THEN 'error' ELSE 'ok' END as status
-						FROM ping_15min 
-						WHERE server_id = ? AND bucket_start >= ?
-						GROUP BY target_name, target_host, strftime('%Y-%m-%dT%H:00:00Z', bucket_start)
-						ORDER BY target_name, hour_start ASC`, serverID, cutoff)
-				} else {
-					// Fall back to raw data with hourly aggregation
-					rows, err = db.Query(`
-						SELECT 
-							target_name,
-							target_host,
-							strftime('%Y-%m-%dT%H:00:00Z', timestamp) as hour_start,
-							AVG(latency_ms) as latency_ms,
-							MIN(status) as status
-						FROM ping_raw 
-						WHERE server_id = ? AND timestamp >= ?
-						GROUP BY target_name, target_host, strftime('%Y-%m-%dT%H:00:00Z', timestamp)
-						ORDER BY target_name, hour_start ASC`, serverID, cutoff)
-				}
-			}
+			rows, err = db.Query(`
+				SELECT 
+					target_name,
+					target_host,
+					substr(timestamp, 1, 13) || ':00:00Z' as hour_start,
+					AVG(latency_ms) as latency_ms,
+					MIN(status) as status
+				FROM ping_raw 
+				WHERE server_id = ? AND timestamp >= ?
+				GROUP BY target_name, target_host, substr(timestamp, 1, 13) || ':00:00Z'
+				ORDER BY target_name, hour_start ASC`, serverID, cutoff)
 		}
 
 	case "1y":
@@ -2613,45 +1895,26 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 				SELECT 
 					target_name,
 					target_host,
-					strftime('%Y-%m-%dT00:00:00Z', bucket * 86400, 'unixepoch') as timestamp,
+					`+sqlDialect.UnixToTimestamp("bucket * 86400")+` as timestamp,
 					CASE WHEN latency_count > 0 THEN latency_sum / latency_count ELSE NULL END as latency_ms,
 					CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
 				FROM ping_daily_agg 
 				WHERE server_id = ? AND bucket >= ?
 				ORDER BY target_name, bucket ASC`, serverID, cutoffBucket)
 		} else {
-			// Fall back to old pre-aggregated hourly data
+			// Fall back to raw data with 12-hour aggregation
 			cutoff := time.Now().UTC().AddDate(0, 0, -365).Format(time.RFC3339)
-			db.QueryRow(`SELECT COUNT(*) FROM ping_hourly WHERE server_id = ? AND hour_start >= ?`,
-				serverID, cutoff).Scan(&count)
-
-			if count > 0 {
-				// Use hourly data with 12-hour grouping
-				rows, err = db.Query(`
-					SELECT 
-						target_name,
-						target_host,
-						MIN(hour_start) as timestamp,
-						AVG(latency_avg) as latency_ms,
-						CASE WHEN SUM(fail_count) > 0 THEN 'error' ELSE 'ok' END as status
-					FROM ping_hourly 
-					WHERE server_id = ? AND hour_start >= ?
-					GROUP BY target_name, target_host, date(hour_start), (CAST(strftime('%H', hour_start) AS INTEGER) / 12)
-					ORDER BY target_name, MIN(hour_start) ASC`, serverID, cutoff)
-			} else {
-				// Fall back to raw data with 12-hour aggregation
-				rows, err = db.Query(`
-					SELECT 
-						target_name,
-						target_host,
-						MIN(timestamp) as timestamp,
-						AVG(latency_ms) as latency_ms,
-						MIN(status) as status
+			rows, err = db.Query(`
+				SELECT 
+					target_name,
+					target_host,
+					MIN(timestamp) as timestamp,
+					AVG(latency_ms) as latency_ms,
+					MIN(status) as status
 				FROM ping_raw 
 				WHERE server_id = ? AND timestamp >= ?
-				GROUP BY target_name, target_host, date(timestamp), (CAST(strftime('%H', timestamp) AS INTEGER) / 12)
+				GROUP BY target_name, target_host, substr(timestamp, 1, 10), (CAST(substr(timestamp, 12, 2) AS INTEGER) / 12)
 				ORDER BY target_name, MIN(timestamp) ASC`, serverID, cutoff)
-			}
 		}
 
 	default:
@@ -2664,7 +1927,7 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 			SELECT 
 				target_name,
 				target_host,
-				strftime('%Y-%m-%dT%H:%M:%SZ', bucket * 120, 'unixepoch') as timestamp,
+				`+sqlDialect.UnixToTimestamp("bucket * 120")+` as timestamp,
 				CASE WHEN latency_count > 0 THEN latency_sum / latency_count ELSE NULL END as latency_ms,
 				CASE WHEN fail_count > 0 THEN 'error' ELSE 'ok' END as status
 			FROM ping_2min 
@@ -2,10 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	_ "modernc.org/sqlite"
 )
 
@@ -13,6 +15,7 @@ import (
 type TestHelper struct {
 	db     *sql.DB
 	dbPath string
+	schema string // PostgreSQL schema owned by the helper
 }
 
 // NewTestHelper creates a test helper with an in-memory database
@@ -42,8 +45,49 @@ func NewTestHelper(t *testing.T) *TestHelper {
 	}
 }
 
+// NewPostgresTestHelper creates a test helper in a fresh schema of the
+// PostgreSQL instance named by VSTATS_TEST_POSTGRES_DSN, skipping the test
+// when it is unset. The postgres dialect stays active until Close.
+func NewPostgresTestHelper(t *testing.T) *TestHelper {
+	t.Helper()
+
+	dsn := os.Getenv("VSTATS_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("VSTATS_TEST_POSTGRES_DSN not set")
+	}
+
+	admin, err := openPostgres(dsn, 1)
+	if err != nil {
+		t.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("vstats_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("Failed to parse dsn: %v", err)
+	}
+	config.RuntimeParams["search_path"] = schema
+	sqlDialect = postgresDialect{}
+
+	return &TestHelper{
+		db:     newPostgresDB(config),
+		schema: schema,
+	}
+}
+
 // Close cleans up the test helper
 func (h *TestHelper) Close() {
+	if h.schema != "" {
+		h.db.Exec("DROP SCHEMA " + h.schema + " CASCADE")
+		h.db.Close()
+		sqlDialect = sqliteDialect{}
+		return
+	}
 	if h.db != nil {
 		h.db.Close()
 	}
@@ -52,11 +96,33 @@ func (h *TestHelper) Close() {
 	os.Remove(h.dbPath + "-shm")
 }
 
+// forEachBackend runs fn against SQLite and, when configured, PostgreSQL
+func forEachBackend(t *testing.T, fn func(t *testing.T, helper *TestHelper)) {
+	t.Run("sqlite", func(t *testing.T) {
+		helper := NewTestHelper(t)
+		defer helper.Close()
+		fn(t, helper)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		helper := NewPostgresTestHelper(t)
+		defer helper.Close()
+		fn(t, helper)
+	})
+}
+
+// Migrate applies the embedded schema migrations
+func (h *TestHelper) Migrate(t *testing.T) {
+	t.Helper()
+	if _, err := runMigrations(h.db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+}
+
 // InitTestTables creates minimal tables for testing
 func (h *TestHelper) InitTestTables(t *testing.T) {
 	t.Helper()
 
-	_, err := h.db.Exec(`
+	_, err := h.db.Exec(sqlDialect.DDL(`
 		CREATE TABLE IF NOT EXISTS metrics_raw (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			server_id TEXT NOT NULL,
@@ -110,7 +176,7 @@ func (h *TestHelper) InitTestTables(t *testing.T) {
 		CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_time ON metrics_raw(server_id, timestamp);
 		CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket ON metrics_raw(server_id, bucket_5min);
 		CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket_5sec ON metrics_raw(server_id, bucket_5sec);
-	`)
+	`))
 	if err != nil {
 		t.Fatalf("Failed to create test tables: %v", err)
 	}
@@ -244,8 +310,11 @@ func TestGetPingTable(t *testing.T) {
 
 // TestDBWriter tests the DBWriter functionality
 func TestDBWriter(t *testing.T) {
-	helper := NewTestHelper(t)
-	defer helper.Close()
+	forEachBackend(t, testDBWriter)
+}
+
+func testDBWriter(t *testing.T, helper *TestHelper) {
+	helper.InitTestTables(t)
 
 	t.Run("NewDBWriter", func(t *testing.T) {
 		writer := NewDBWriter(helper.db, 100)
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 
+	"vstats/internal/common"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -34,7 +38,7 @@ func (s *AppState) RegisterAgent(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	s.Config.Servers = append(s.Config.Servers, server)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, AgentRegisterResponse{
@@ -167,32 +171,33 @@ func (s *AppState) UpdateAgent(c *gin.Context) {
 	var req UpdateAgentRequest
 	c.ShouldBindJSON(&req)
 
-	s.AgentConnsMu.RLock()
-	conn := s.AgentConns[serverID]
-	s.AgentConnsMu.RUnlock()
-
-	if conn == nil {
-		c.JSON(http.StatusOK, UpdateAgentResponse{
-			Success: false,
-			Message: "Agent is not connected",
-		})
-		return
-	}
-
 	cmd := AgentCommand{
 		Type:        "command",
 		Command:     "update",
 		DownloadURL: req.DownloadURL,
+		ManifestURL: req.ManifestURL,
+		Version:     req.Version,
 		Force:       req.Force,
 	}
 
 	data, _ := json.Marshal(cmd)
-	select {
-	case conn.SendChan <- data:
+	switch err := s.SendToAgent(serverID, data); err {
+	case nil:
+		version := req.Version
+		if version == "" {
+			version = "latest"
+		}
+		LogAuditFromContext(c, AuditActionAgentUpdate, AuditCategoryServer, "server", serverID, s.serverName(serverID),
+			fmt.Sprintf("Requested agent update to %s (force=%v)", version, req.Force))
 		c.JSON(http.StatusOK, UpdateAgentResponse{
 			Success: true,
 			Message: "Update command sent to agent",
 		})
+	case ErrAgentNotConnected:
+		c.JSON(http.StatusOK, UpdateAgentResponse{
+			Success: false,
+			Message: "Agent is not connected",
+		})
 	default:
 		c.JSON(http.StatusOK, UpdateAgentResponse{
 			Success: false,
@@ -200,3 +205,294 @@ func (s *AppState) UpdateAgent(c *gin.Context) {
 		})
 	}
 }
+
+// serverName returns the name of a server, or its ID when unknown
+func (s *AppState) serverName(serverID string) string {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	for _, server := range s.Config.Servers {
+		if server.ID == serverID {
+			return server.Name
+		}
+	}
+	return serverID
+}
+
+// recordAgentUpdate keeps the latest self-update report of an agent and
+// logs the outcome
+func (s *AppState) recordAgentUpdate(serverID string, update *AgentUpdateStatus) {
+	name := s.serverName(serverID)
+	if dbWriter != nil {
+		status := *update
+		dbWriter.WriteAsync(func(db *sql.DB) error {
+			return saveAgentUpdateStatus(db, serverID, &status)
+		})
+	}
+
+	if rolloutManager != nil {
+		rolloutManager.RecordUpdate(serverID, update)
+	}
+
+	log.Printf("Agent %s update %s: %s -> %s %s", serverID, update.Status, update.FromVersion, update.ToVersion, update.Error)
+
+	// Progress reports are not worth an audit entry, outcomes are
+	entry := AuditLogEntry{
+		Action:     AuditActionAgentUpdate,
+		Category:   AuditCategoryServer,
+		Username:   "agent",
+		TargetType: "server",
+		TargetID:   serverID,
+		TargetName: name,
+		Details:    fmt.Sprintf("Agent update %s: %s -> %s", update.Status, update.FromVersion, update.ToVersion),
+	}
+	switch update.Status {
+	case common.UpdateSucceeded, common.UpdateSkipped:
+		entry.Status = "success"
+	case common.UpdateFailed, common.UpdateRolledBack:
+		entry.Status = "error"
+		entry.ErrorMessage = update.Error
+	default:
+		return
+	}
+	LogAudit(entry)
+}
+
+// ============================================================================
+// Rollout Handlers
+// ============================================================================
+
+// CreateRolloutRequest starts a staged rollout
+type CreateRolloutRequest struct {
+	Version        string          `json:"version"`
+	ManifestURL    string          `json:"manifest_url,omitempty"`
+	Force          bool            `json:"force,omitempty"`
+	Selector       RolloutSelector `json:"selector"`
+	BatchSize      int             `json:"batch_size"`
+	PauseOnFailure *bool           `json:"pause_on_failure,omitempty"` // Default true
+}
+
+// GetRollouts lists rollouts with their progress
+func (s *AppState) GetRollouts(c *gin.Context) {
+	if rolloutManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rollouts are not available"})
+		return
+	}
+	rollouts, err := rolloutManager.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rollouts)
+}
+
+// GetRollout returns a rollout with the state of every agent
+func (s *AppState) GetRollout(c *gin.Context) {
+	if rolloutManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rollouts are not available"})
+		return
+	}
+	rollout, err := rolloutManager.Get(c.Param("id"))
+	if err != nil {
+		s.rolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rollout)
+}
+
+// CreateRollout starts updating the selected agents in waves
+func (s *AppState) CreateRollout(c *gin.Context) {
+	if rolloutManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rollouts are not available"})
+		return
+	}
+	var req CreateRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rollout, err := rolloutManager.Create(Rollout{
+		Version:        req.Version,
+		ManifestURL:    req.ManifestURL,
+		Force:          req.Force,
+		Selector:       req.Selector,
+		BatchSize:      req.BatchSize,
+		PauseOnFailure: req.PauseOnFailure == nil || *req.PauseOnFailure,
+		CreatedBy:      CurrentUsername(c),
+	})
+	if err != nil {
+		if err == ErrRolloutActive {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionRolloutCreate, AuditCategoryServer, "rollout", rollout.ID, rollout.Version,
+		fmt.Sprintf("Rollout of %s to %d agents in %d waves", rollout.Version, len(rollout.Targets), rollout.Waves))
+
+	c.JSON(http.StatusOK, rollout)
+}
+
+// ResumeRollout continues a rollout paused after failures
+func (s *AppState) ResumeRollout(c *gin.Context) {
+	if rolloutManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rollouts are not available"})
+		return
+	}
+	rollout, err := rolloutManager.Resume(c.Param("id"))
+	if err != nil {
+		s.rolloutError(c, err)
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionRolloutResume, AuditCategoryServer, "rollout", rollout.ID, rollout.Version,
+		fmt.Sprintf("Rollout resumed at wave %d of %d", rollout.Wave+1, rollout.Waves))
+
+	c.JSON(http.StatusOK, rollout)
+}
+
+// AbortRollout stops a rollout; agents already updating finish their update
+func (s *AppState) AbortRollout(c *gin.Context) {
+	if rolloutManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rollouts are not available"})
+		return
+	}
+	username := CurrentUsername(c)
+	rollout, err := rolloutManager.Abort(c.Param("id"), "aborted by "+username)
+	if err != nil {
+		s.rolloutError(c, err)
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionRolloutAbort, AuditCategoryServer, "rollout", rollout.ID, rollout.Version,
+		fmt.Sprintf("Rollout aborted at wave %d of %d", rollout.Wave+1, rollout.Waves))
+
+	c.JSON(http.StatusOK, rollout)
+}
+
+func (s *AppState) rolloutError(c *gin.Context, err error) {
+	switch err {
+	case ErrRolloutNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rollout not found"})
+	case ErrRolloutState:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ============================================================================
+// Agent Config Profile Handlers
+// ============================================================================
+
+// AgentConfigStatus is the effective remote config of a server and whether
+// its agent applied it
+type AgentConfigStatus struct {
+	ServerID       string                    `json:"server_id"`
+	Config         *common.RemoteAgentConfig `json:"config"`
+	Profiles       []string                  `json:"profiles"` // Matching profile IDs in merge order
+	AppliedVersion string                    `json:"applied_version,omitempty"`
+	Error          string                    `json:"error,omitempty"`
+	InSync         bool                      `json:"in_sync"`
+}
+
+// GetAgentProfiles returns the agent config profiles
+func (s *AppState) GetAgentProfiles(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	profiles := s.Config.AgentProfiles
+	if profiles == nil {
+		profiles = []AgentProfile{}
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+// UpdateAgentProfiles replaces the agent config profiles and pushes the
+// resulting configs to connected agents
+func (s *AppState) UpdateAgentProfiles(c *gin.Context) {
+	var profiles []AgentProfile
+	if err := c.ShouldBindJSON(&profiles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAgentProfiles(profiles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	s.Config.AgentProfiles = profiles
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	LogAuditFromContext(c, AuditActionAgentProfilesUpdate, AuditCategorySettings, "agent_profiles", "agent_profiles", "Agent Profiles",
+		fmt.Sprintf("Agent profiles updated (%d profiles)", len(profiles)))
+
+	s.PushAgentConfigs()
+
+	if profiles == nil {
+		profiles = []AgentProfile{}
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+// GetAgentUpdateStatus returns the latest self-update report of a server's agent
+func (s *AppState) GetAgentUpdateStatus(c *gin.Context) {
+	id := c.Param("id")
+	s.ConfigMu.RLock()
+	found := false
+	for _, server := range s.Config.Servers {
+		if server.ID == id {
+			found = true
+			break
+		}
+	}
+	s.ConfigMu.RUnlock()
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		return
+	}
+
+	update, err := getAgentUpdateStatus(dbWriter.GetDB(), id)
+	if err == ErrNoAgentUpdate {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No update reported"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load update status"})
+		return
+	}
+	c.JSON(http.StatusOK, update)
+}
+
+// GetServerAgentConfig returns the effective agent config of a server
+func (s *AppState) GetServerAgentConfig(c *gin.Context) {
+	id := c.Param("id")
+	ack := loadAgentConfigAcks()[id]
+
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	for _, server := range s.Config.Servers {
+		if server.ID != id {
+			continue
+		}
+		status := AgentConfigStatus{
+			ServerID:       id,
+			Config:         agentConfigFor(s.Config, server),
+			Profiles:       []string{},
+			AppliedVersion: ack.Version,
+			Error:          ack.Error,
+		}
+		for _, p := range matchingProfiles(s.Config, server) {
+			status.Profiles = append(status.Profiles, p.ID)
+		}
+		status.InSync = status.Config.Version == ack.Version
+		c.JSON(http.StatusOK, status)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vstats/internal/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAgentUpdateStatus tests recording the self-update reports of agents
+func TestAgentUpdateStatus(t *testing.T) {
+	forEachBackend(t, testAgentUpdateStatus)
+}
+
+func testAgentUpdateStatus(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	state := &AppState{Config: &AppConfig{Servers: []RemoteServer{{ID: "s1", Name: "Tokyo", Version: "1.0.0"}}}}
+
+	state.recordAgentUpdate("s1", &AgentUpdateStatus{Status: common.UpdateDownloading, FromVersion: "1.0.0", ToVersion: "1.1.0"})
+	state.recordAgentUpdate("s1", &AgentUpdateStatus{Status: common.UpdateRolledBack, FromVersion: "1.0.0", ToVersion: "1.1.0", Error: "did not authenticate"})
+	state.recordAgentUpdate("unknown", &AgentUpdateStatus{Status: common.UpdateFailed, FromVersion: "1.0.0"})
+
+	dbWriter.WriteSync(func(db *sql.DB) error { return nil }) // Wait for queued writes
+
+	router := gin.New()
+	router.GET("/api/servers/:id/update", state.GetAgentUpdateStatus)
+	get := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/servers/"+id+"/update", nil))
+		return w
+	}
+
+	w := get("s1")
+	var update AgentUpdateStatus
+	json.Unmarshal(w.Body.Bytes(), &update)
+	if w.Code != http.StatusOK || update.Status != common.UpdateRolledBack || update.Error != "did not authenticate" || update.Time == "" {
+		t.Errorf("Expected the latest report of s1, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := get("unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown server, got %d", http.StatusNotFound, w.Code)
+	}
+	state.Config.Servers = append(state.Config.Servers, RemoteServer{ID: "s2"})
+	if w := get("s2"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a server without reports, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Only outcomes are audited
+	rows, err := helper.db.Query("SELECT target_id, target_name, status, error_message FROM audit_logs WHERE action = ? ORDER BY id", string(AuditActionAgentUpdate))
+	if err != nil {
+		t.Fatalf("Failed to query audit logs: %v", err)
+	}
+	defer rows.Close()
+	var entries [][4]string
+	for rows.Next() {
+		var entry [4]string
+		rows.Scan(&entry[0], &entry[1], &entry[2], &entry[3])
+		entries = append(entries, entry)
+	}
+	expected := [][4]string{
+		{"s1", "Tokyo", "error", "did not authenticate"},
+		{"unknown", "unknown", "error", ""},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d audit entries, got %v", len(expected), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Audit entry %d: expected %v, got %v", i, expected[i], entries[i])
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"html"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -46,6 +49,41 @@ func (s *AppState) UpdateAlertConfig(c *gin.Context) {
 
 	config := s.Config.AlertConfig
 
+	if req.Routes != nil {
+		channels := config.Channels
+		if req.Channels != nil {
+			channels = *req.Channels
+		}
+		if err := validateRoutes(*req.Routes, channels); err != nil {
+			s.ConfigMu.Unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Grouping != nil {
+		if err := req.Grouping.Validate(); err != nil {
+			s.ConfigMu.Unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Templates != nil {
+		if err := validateTemplates(*req.Templates); err != nil {
+			s.ConfigMu.Unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Channels != nil {
+		for _, channel := range *req.Channels {
+			if err := validateTemplates(channel.Templates); err != nil {
+				s.ConfigMu.Unlock()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "channel " + channel.Name + ": " + err.Error()})
+				return
+			}
+		}
+	}
+
 	if req.Enabled != nil {
 		config.Enabled = *req.Enabled
 	}
@@ -53,6 +91,10 @@ func (s *AppState) UpdateAlertConfig(c *gin.Context) {
 		config.Channels = *req.Channels
 	}
 	if req.Rules != nil {
+		// Custom rules have their own endpoints; keep them unless sent
+		if req.Rules.Custom == nil {
+			req.Rules.Custom = config.Rules.Custom
+		}
 		config.Rules = *req.Rules
 	}
 	if req.Templates != nil {
@@ -64,8 +106,17 @@ func (s *AppState) UpdateAlertConfig(c *gin.Context) {
 	if req.RecoveryNotify != nil {
 		config.RecoveryNotify = *req.RecoveryNotify
 	}
+	if req.Routes != nil {
+		config.Routes = *req.Routes
+	}
+	if req.Grouping != nil {
+		config.Grouping = *req.Grouping
+	}
+	if req.PublicURL != nil {
+		config.PublicURL = strings.TrimRight(strings.TrimSpace(*req.PublicURL), "/")
+	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionAlertConfigUpdate, AuditCategoryAlert, "settings", "alert_config", "Alert Config", "Alert configuration updated")
@@ -102,12 +153,13 @@ func (s *AppState) AddChannel(c *gin.Context) {
 	}
 
 	channel := NotificationChannel{
-		ID:       GenerateRandomString(12),
-		Type:     req.Type,
-		Name:     req.Name,
-		Enabled:  req.Enabled,
-		Config:   req.Config,
-		Priority: req.Priority,
+		ID:        GenerateRandomString(12),
+		Type:      req.Type,
+		Name:      req.Name,
+		Enabled:   req.Enabled,
+		Config:    req.Config,
+		Priority:  req.Priority,
+		Templates: req.Templates,
 	}
 
 	// Validate channel configuration
@@ -120,6 +172,10 @@ func (s *AppState) AddChannel(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Configuration validation failed: " + err.Error()})
 		return
 	}
+	if err := validateTemplates(channel.Templates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	s.ConfigMu.Lock()
 	if s.Config.AlertConfig == nil {
@@ -127,7 +183,7 @@ func (s *AppState) AddChannel(c *gin.Context) {
 		s.Config.AlertConfig = &defaultConfig
 	}
 	s.Config.AlertConfig.Channels = append(s.Config.AlertConfig.Channels, channel)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionChannelCreate, AuditCategoryAlert, "channel", channel.ID, channel.Name, "Notification channel created: "+string(channel.Type))
@@ -144,6 +200,10 @@ func (s *AppState) UpdateChannel(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateTemplates(req.Templates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
@@ -161,6 +221,7 @@ func (s *AppState) UpdateChannel(c *gin.Context) {
 			s.Config.AlertConfig.Channels[i].Enabled = req.Enabled
 			s.Config.AlertConfig.Channels[i].Config = req.Config
 			s.Config.AlertConfig.Channels[i].Priority = req.Priority
+			s.Config.AlertConfig.Channels[i].Templates = req.Templates
 			found = true
 			break
 		}
@@ -171,7 +232,7 @@ func (s *AppState) UpdateChannel(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, AuditActionChannelUpdate, AuditCategoryAlert, "channel", channelID, req.Name, "Notification channel updated")
 
@@ -206,7 +267,7 @@ func (s *AppState) DeleteChannel(c *gin.Context) {
 	}
 
 	s.Config.AlertConfig.Channels = channels
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, AuditActionChannelDelete, AuditCategoryAlert, "channel", channelID, "", "Notification channel deleted")
 
@@ -262,7 +323,7 @@ func (s *AppState) TestChannel(c *gin.Context) {
 	title := "vStats 测试通知"
 	message := "这是一条测试通知消息。\n发送时间: " + time.Now().Format("2006-01-02 15:04:05")
 
-	if err := notifier.Send(title, message); err != nil {
+	if err := notifier.Send(messageEvent("test", title, message)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send test notification: " + err.Error()})
 		return
 	}
@@ -338,7 +399,8 @@ func (s *AppState) GetAlertHistory(c *gin.Context) {
 
 	// Get paginated results
 	query := `
-		SELECT id, alert_id, type, server_id, server_name, severity, value, threshold, message, started_at, resolved_at, duration, notified
+		SELECT id, alert_id, type, server_id, server_name, severity, value, threshold, message, started_at, resolved_at, duration, notified,
+		       COALESCE(acknowledged_by, ''), acknowledged_at, ack_comment
 		FROM alert_history ` + whereClause + ` ORDER BY started_at DESC LIMIT ? OFFSET ?`
 	args = append(args, limit, offset)
 
@@ -353,12 +415,13 @@ func (s *AppState) GetAlertHistory(c *gin.Context) {
 	for rows.Next() {
 		var h AlertHistory
 		var startedAt string
-		var resolvedAtPtr *string
+		var resolvedAtPtr, acknowledgedAtPtr *string
 
 		err := rows.Scan(
 			&h.ID, &h.AlertID, &h.Type, &h.ServerID, &h.ServerName,
 			&h.Severity, &h.Value, &h.Threshold, &h.Message,
 			&startedAt, &resolvedAtPtr, &h.Duration, &h.Notified,
+			&h.AcknowledgedBy, &acknowledgedAtPtr, &h.AckComment,
 		)
 		if err != nil {
 			continue
@@ -369,6 +432,10 @@ func (s *AppState) GetAlertHistory(c *gin.Context) {
 			t, _ := time.Parse(time.RFC3339, *resolvedAtPtr)
 			h.ResolvedAt = &t
 		}
+		if acknowledgedAtPtr != nil {
+			t, _ := time.Parse(time.RFC3339, *acknowledgedAtPtr)
+			h.AcknowledgedAt = &t
+		}
 
 		history = append(history, h)
 	}
@@ -399,6 +466,257 @@ func (s *AppState) MuteAlert(c *gin.Context) {
 	}
 }
 
+// AcknowledgeAlert records that the current user is handling an alert
+func (s *AppState) AcknowledgeAlert(c *gin.Context) {
+	alertID := c.Param("id")
+
+	var req AcknowledgeAlertRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if alertEngine == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert engine not running"})
+		return
+	}
+
+	alert := alertEngine.AcknowledgeAlert(alertID, CurrentUsername(c), req.Comment)
+	if alert == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	LogAuditFromContext(c, AuditActionAlertAck, AuditCategoryAlert, "alert", alert.ID, alert.ServerName, "Alert acknowledged: "+alert.Type)
+	c.JSON(http.StatusOK, alert)
+}
+
+// UnacknowledgeAlert clears an alert's acknowledgement
+func (s *AppState) UnacknowledgeAlert(c *gin.Context) {
+	alertID := c.Param("id")
+
+	if alertEngine == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert engine not running"})
+		return
+	}
+
+	alert := alertEngine.UnacknowledgeAlert(alertID)
+	if alert == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	LogAuditFromContext(c, AuditActionAlertUnack, AuditCategoryAlert, "alert", alert.ID, alert.ServerName, "Alert acknowledgement cleared: "+alert.Type)
+	c.JSON(http.StatusOK, alert)
+}
+
+// AcknowledgeAlertLink handles the signed acknowledge links sent in
+// notifications. GET shows a confirmation page, so that link previews and
+// mail scanners do not acknowledge anything; POST acknowledges.
+func (s *AppState) AcknowledgeAlertLink(c *gin.Context) {
+	alertID := c.Param("id")
+	if !validAlertAckToken(alertID, c.Query("token"), time.Now()) {
+		ackLinkResponse(c, http.StatusForbidden, "链接无效", nil)
+		return
+	}
+	if alertEngine == nil {
+		ackLinkResponse(c, http.StatusNotFound, "告警已恢复或不存在", nil)
+		return
+	}
+
+	if c.Request.Method == http.MethodGet {
+		for _, alert := range alertEngine.GetActiveAlerts() {
+			if alert.ID == alertID {
+				ackLinkResponse(c, http.StatusOK, "", &alert)
+				return
+			}
+		}
+		ackLinkResponse(c, http.StatusNotFound, "告警已恢复或不存在", nil)
+		return
+	}
+
+	alert := alertEngine.AcknowledgeAlert(alertID, "link", c.PostForm("comment"))
+	if alert == nil {
+		ackLinkResponse(c, http.StatusNotFound, "告警已恢复或不存在", nil)
+		return
+	}
+	LogAuditFromContext(c, AuditActionAlertAck, AuditCategoryAlert, "alert", alert.ID, alert.ServerName, "Alert acknowledged via link: "+alert.Type)
+	ackLinkResponse(c, http.StatusOK, "告警已确认", alert)
+}
+
+// ackLinkResponse answers an acknowledge link with JSON for scripts and a
+// small page for browsers. A page without a message asks for confirmation.
+func ackLinkResponse(c *gin.Context, status int, message string, alert *AlertState) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEJSON {
+		if status != http.StatusOK {
+			c.JSON(status, gin.H{"error": message})
+		} else {
+			c.JSON(status, alert)
+		}
+		return
+	}
+
+	body := "<p>" + html.EscapeString(message) + "</p>"
+	if alert != nil {
+		body = fmt.Sprintf("<h3>%s</h3><p>%s</p>", html.EscapeString(alert.ServerName), html.EscapeString(alert.Message))
+		switch {
+		case message != "":
+			body += "<p>" + html.EscapeString(message) + "</p>"
+		case alert.acknowledged() && !alert.Muted:
+			body += "<p>" + html.EscapeString(alert.AcknowledgedBy) + " 已于 " + alert.AcknowledgedAt.Local().Format("2006-01-02 15:04:05") + " 确认</p>"
+		default:
+			body += `<form method="post"><input name="comment" placeholder="备注（可选）"> <button type="submit">确认告警</button></form>`
+		}
+	}
+	c.Data(status, "text/html; charset=utf-8", []byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>vStats</title></head><body>`+body+`</body></html>`))
+}
+
+// GetNotifications returns the notification delivery log with pagination
+func (s *AppState) GetNotifications(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	filter := NotificationFilter{
+		Status:    c.Query("status"),
+		ChannelID: c.Query("channel_id"),
+		AlertID:   c.Query("alert_id"),
+		ServerID:  c.Query("server_id"),
+		Type:      c.Query("type"),
+		Since:     c.Query("since"),
+	}
+	if filter.Since != "" {
+		since, err := time.Parse(time.RFC3339, filter.Since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since parameter"})
+			return
+		}
+		filter.Since = since.UTC().Format(time.RFC3339)
+	}
+
+	notifications, total, err := ListNotifications(dbWriter.GetDB(), filter, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+	})
+}
+
+// ResendNotification queues a notification for delivery again
+func (s *AppState) ResendNotification(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification id"})
+		return
+	}
+	if alertEngine == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert engine not running"})
+		return
+	}
+
+	event, err := alertEngine.queue.Resend(id)
+	switch err {
+	case nil:
+	case ErrNotificationNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	case ErrNotificationQueued:
+		c.JSON(http.StatusConflict, gin.H{"error": "Notification is already queued"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionNotificationResend, AuditCategoryAlert, "notification", c.Param("id"), event.Title, "Notification queued for resend")
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ============================================================================
+// Silence Handlers
+// ============================================================================
+
+// GetSilences lists silences, optionally filtered by status
+func (s *AppState) GetSilences(c *gin.Context) {
+	if silenceStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Silences are not available"})
+		return
+	}
+	all, err := silenceStore.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := c.Query("status")
+	silences := []Silence{}
+	for _, silence := range all {
+		if status == "" || silence.Status == status {
+			silences = append(silences, silence)
+		}
+	}
+
+	c.JSON(http.StatusOK, silences)
+}
+
+// CreateSilence creates a silence or recurring maintenance window
+func (s *AppState) CreateSilence(c *gin.Context) {
+	if silenceStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Silences are not available"})
+		return
+	}
+	var req Silence
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.CreatedBy = CurrentUsername(c)
+
+	silence, err := silenceStore.Create(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionSilenceCreate, AuditCategoryAlert, "silence", silence.ID, silence.Comment, "Silence created")
+
+	c.JSON(http.StatusOK, silence)
+}
+
+// ExpireSilence ends a silence immediately
+func (s *AppState) ExpireSilence(c *gin.Context) {
+	if silenceStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Silences are not available"})
+		return
+	}
+	id := c.Param("id")
+	if err := silenceStore.Expire(id); err != nil {
+		if err == ErrSilenceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Silence not found or already expired"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionSilenceExpire, AuditCategoryAlert, "silence", id, "", "Silence expired")
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 // ============================================================================
 // Alert Rules Handlers
 // ============================================================================
@@ -417,7 +735,7 @@ func (s *AppState) UpdateOfflineRule(c *gin.Context) {
 		s.Config.AlertConfig = &defaultConfig
 	}
 	s.Config.AlertConfig.Rules.Offline = rule
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
@@ -437,7 +755,7 @@ func (s *AppState) UpdateLoadRule(c *gin.Context) {
 		s.Config.AlertConfig = &defaultConfig
 	}
 	s.Config.AlertConfig.Rules.Load = rule
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
@@ -457,12 +775,258 @@ func (s *AppState) UpdateTrafficRule(c *gin.Context) {
 		s.Config.AlertConfig = &defaultConfig
 	}
 	s.Config.AlertConfig.Rules.Traffic = rule
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// UpdateAnomalyRule updates baseline anomaly alert rules
+func (s *AppState) UpdateAnomalyRule(c *gin.Context) {
+	var rule AnomalyAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, metric := range rule.Metrics {
+		if _, ok := anomalyMetrics[metric]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported anomaly metric: " + metric})
+			return
+		}
+	}
+
+	s.ConfigMu.Lock()
+	if s.Config.AlertConfig == nil {
+		defaultConfig := GetDefaultAlertConfig()
+		s.Config.AlertConfig = &defaultConfig
+	}
+	s.Config.AlertConfig.Rules.Anomaly = rule
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// UpdateForecastRule updates capacity forecast alert rules
+func (s *AppState) UpdateForecastRule(c *gin.Context) {
+	var rule ForecastAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	if s.Config.AlertConfig == nil {
+		defaultConfig := GetDefaultAlertConfig()
+		s.Config.AlertConfig = &defaultConfig
+	}
+	s.Config.AlertConfig.Rules.Forecast = rule
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetCustomRules returns the custom expression rules
+func (s *AppState) GetCustomRules(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	rules := []CustomAlertRule{}
+	if s.Config.AlertConfig != nil && s.Config.AlertConfig.Rules.Custom != nil {
+		rules = s.Config.AlertConfig.Rules.Custom
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// AddCustomRule adds a custom expression rule
+func (s *AppState) AddCustomRule(c *gin.Context) {
+	var rule CustomAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCustomRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = GenerateRandomString(12)
+
+	s.ConfigMu.Lock()
+	if s.Config.AlertConfig == nil {
+		defaultConfig := GetDefaultAlertConfig()
+		s.Config.AlertConfig = &defaultConfig
+	}
+	s.Config.AlertConfig.Rules.Custom = append(s.Config.AlertConfig.Rules.Custom, rule)
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	LogAuditFromContext(c, AuditActionRuleUpdate, AuditCategoryAlert, "rule", rule.ID, rule.Name, "Custom alert rule created: "+rule.Expr)
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateCustomRule replaces a custom expression rule
+func (s *AppState) UpdateCustomRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	var rule CustomAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCustomRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = ruleID
+
+	s.ConfigMu.Lock()
+	defer s.ConfigMu.Unlock()
+
+	if s.Config.AlertConfig == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	existing := findCustomRule(s.Config.AlertConfig, ruleID)
+	if existing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	*existing = rule
+	SaveConfigFrom(c, s.Config)
+
+	LogAuditFromContext(c, AuditActionRuleUpdate, AuditCategoryAlert, "rule", rule.ID, rule.Name, "Custom alert rule updated: "+rule.Expr)
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteCustomRule deletes a custom expression rule
+func (s *AppState) DeleteCustomRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	s.ConfigMu.Lock()
+	defer s.ConfigMu.Unlock()
+
+	if s.Config.AlertConfig == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	var deleted *CustomAlertRule
+	rules := make([]CustomAlertRule, 0)
+	for _, rule := range s.Config.AlertConfig.Rules.Custom {
+		if rule.ID == ruleID {
+			r := rule
+			deleted = &r
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if deleted == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	s.Config.AlertConfig.Rules.Custom = rules
+	SaveConfigFrom(c, s.Config)
+
+	LogAuditFromContext(c, AuditActionRuleUpdate, AuditCategoryAlert, "rule", ruleID, deleted.Name, "Custom alert rule deleted")
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// PreviewCustomRule evaluates a rule against the current metrics without
+// saving it
+func (s *AppState) PreviewCustomRule(c *gin.Context) {
+	var rule CustomAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expr, err := compileAlertExpr(rule.Expr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expression: " + err.Error()})
+		return
+	}
+
+	s.ConfigMu.RLock()
+	servers := append([]RemoteServer(nil), s.Config.Servers...)
+	dimensions := s.Config.GroupDimensions
+	s.ConfigMu.RUnlock()
+
+	type previewResult struct {
+		ServerID   string  `json:"server_id"`
+		ServerName string  `json:"server_name"`
+		Matched    bool    `json:"matched"`
+		Value      float64 `json:"value,omitempty"`
+		Threshold  float64 `json:"threshold,omitempty"`
+		Error      string  `json:"error,omitempty"`
+	}
+	results := []previewResult{}
+
+	s.AgentMetricsMu.RLock()
+	defer s.AgentMetricsMu.RUnlock()
+	for _, server := range servers {
+		if !ruleSelectsServer(rule, server, dimensions) {
+			continue
+		}
+		result := previewResult{ServerID: server.ID, ServerName: server.Name}
+		metrics, ok := s.AgentMetrics[server.ID]
+		if !ok {
+			result.Error = "no metrics"
+		} else if res, err := expr.Eval(metricsEnv(&metrics.Metrics)); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Matched, result.Value, result.Threshold = res.Matched, res.Value, res.Threshold
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// GetAlertRoutes returns the alert routing tree
+func (s *AppState) GetAlertRoutes(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	routes := []AlertRoute{}
+	if s.Config.AlertConfig != nil && s.Config.AlertConfig.Routes != nil {
+		routes = s.Config.AlertConfig.Routes
+	}
+
+	c.JSON(http.StatusOK, routes)
+}
+
+// UpdateAlertRoutes replaces the alert routing tree
+func (s *AppState) UpdateAlertRoutes(c *gin.Context) {
+	var routes []AlertRoute
+	if err := c.ShouldBindJSON(&routes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	if s.Config.AlertConfig == nil {
+		defaultConfig := GetDefaultAlertConfig()
+		s.Config.AlertConfig = &defaultConfig
+	}
+	if err := validateRoutes(routes, s.Config.AlertConfig.Channels); err != nil {
+		s.ConfigMu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.Config.AlertConfig.Routes = routes
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	LogAuditFromContext(c, AuditActionRuleUpdate, AuditCategoryAlert, "routes", "alert_routes", "Alert Routes", "Alert routing updated")
+
+	c.JSON(http.StatusOK, routes)
+}
+
 // ============================================================================
 // Alert Templates Handlers
 // ============================================================================
@@ -493,6 +1057,10 @@ func (s *AppState) UpdateAlertTemplate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateTemplates(map[string]AlertTemplate{templateKey: template}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	s.ConfigMu.Lock()
 	if s.Config.AlertConfig == nil {
@@ -504,7 +1072,7 @@ func (s *AppState) UpdateAlertTemplate(c *gin.Context) {
 		s.Config.AlertConfig.Templates = defaultConfig.Templates
 	}
 	s.Config.AlertConfig.Templates[templateKey] = template
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
@@ -280,7 +280,7 @@ func (s *AppState) ImportServers(c *gin.Context) {
 	}
 	
 	if result.Success > 0 {
-		SaveConfig(s.Config)
+		SaveConfigFrom(c, s.Config)
 		LogAuditFromContext(c, AuditActionServerCreate, AuditCategoryServer, "import", "", 
 			fmt.Sprintf("%d servers", result.Success), 
 			fmt.Sprintf("Bulk imported %d servers", result.Success))
@@ -465,7 +465,7 @@ func (s *AppState) ImportServersCSV(c *gin.Context) {
 	}
 	
 	if result.Success > 0 {
-		SaveConfig(s.Config)
+		SaveConfigFrom(c, s.Config)
 		LogAuditFromContext(c, AuditActionServerCreate, AuditCategoryServer, "import_csv", "",
 			fmt.Sprintf("%d servers", result.Success),
 			fmt.Sprintf("Bulk imported %d servers from CSV", result.Success))
@@ -594,7 +594,7 @@ func (s *AppState) UpdateExpiryRule(c *gin.Context) {
 		rule.ExcludeAuto = *req.ExcludeAuto
 	}
 	
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	
 	LogAuditFromContext(c, AuditActionRuleUpdate, AuditCategoryAlert, "expiry_rule", "", "",
 		"Updated expiry alert rule configuration")
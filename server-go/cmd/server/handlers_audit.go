@@ -28,11 +28,12 @@ func LogAudit(entry AuditLogEntry) {
 
 	dbWriter.WriteAsync(func(db *sql.DB) error {
 		_, err := db.Exec(`
-			INSERT INTO audit_logs (timestamp, action, category, user_ip, user_agent, target_type, target_id, target_name, details, status, error_message)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			INSERT INTO audit_logs (timestamp, action, category, username, user_ip, user_agent, target_type, target_id, target_name, details, status, error_message)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			timestamp,
 			string(entry.Action),
 			string(entry.Category),
+			entry.Username,
 			entry.UserIP,
 			entry.UserAgent,
 			entry.TargetType,
@@ -51,6 +52,7 @@ func LogAuditFromContext(c *gin.Context, action AuditLogAction, category AuditLo
 	LogAudit(AuditLogEntry{
 		Action:     action,
 		Category:   category,
+		Username:   CurrentUsername(c),
 		UserIP:     c.ClientIP(),
 		UserAgent:  c.GetHeader("User-Agent"),
 		TargetType: targetType,
@@ -66,6 +68,7 @@ func LogAuditError(c *gin.Context, action AuditLogAction, category AuditLogCateg
 	LogAudit(AuditLogEntry{
 		Action:       action,
 		Category:     category,
+		Username:     CurrentUsername(c),
 		UserIP:       c.ClientIP(),
 		UserAgent:    c.GetHeader("User-Agent"),
 		TargetType:   targetType,
@@ -116,6 +119,11 @@ func (s *AppState) GetAuditLogs(c *gin.Context) {
 		args = append(args, string(query.Action))
 	}
 
+	if query.Username != "" {
+		whereConditions = append(whereConditions, "username = ?")
+		args = append(args, query.Username)
+	}
+
 	if query.StartDate != "" {
 		whereConditions = append(whereConditions, "timestamp >= ?")
 		args = append(args, query.StartDate)
@@ -128,8 +136,9 @@ func (s *AppState) GetAuditLogs(c *gin.Context) {
 
 	if query.Search != "" {
 		searchPattern := "%" + query.Search + "%"
-		whereConditions = append(whereConditions, "(target_name LIKE ? OR details LIKE ? OR user_ip LIKE ?)")
-		args = append(args, searchPattern, searchPattern, searchPattern)
+		like := sqlDialect.ILike()
+		whereConditions = append(whereConditions, "(target_name "+like+" ? OR details "+like+" ? OR user_ip "+like+" ? OR username "+like+" ?)")
+		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern)
 	}
 
 	whereClause := ""
@@ -148,7 +157,7 @@ func (s *AppState) GetAuditLogs(c *gin.Context) {
 	// Get paginated results
 	offset := (query.Page - 1) * query.Limit
 	dataQuery := fmt.Sprintf(`
-		SELECT id, timestamp, action, category, user_ip, COALESCE(user_agent, ''), 
+		SELECT id, timestamp, action, category, COALESCE(username, ''), user_ip, COALESCE(user_agent, ''), 
 		       COALESCE(target_type, ''), COALESCE(target_id, ''), COALESCE(target_name, ''),
 		       COALESCE(details, ''), status, COALESCE(error_message, '')
 		FROM audit_logs %s
@@ -167,7 +176,7 @@ func (s *AppState) GetAuditLogs(c *gin.Context) {
 	for rows.Next() {
 		var log AuditLog
 		if err := rows.Scan(
-			&log.ID, &log.Timestamp, &log.Action, &log.Category,
+			&log.ID, &log.Timestamp, &log.Action, &log.Category, &log.Username,
 			&log.UserIP, &log.UserAgent, &log.TargetType, &log.TargetID,
 			&log.TargetName, &log.Details, &log.Status, &log.ErrorMessage,
 		); err != nil {
@@ -214,6 +223,11 @@ func (s *AppState) ExportAuditLogs(c *gin.Context) {
 		args = append(args, string(query.Action))
 	}
 
+	if query.Username != "" {
+		whereConditions = append(whereConditions, "username = ?")
+		args = append(args, query.Username)
+	}
+
 	if query.StartDate != "" {
 		whereConditions = append(whereConditions, "timestamp >= ?")
 		args = append(args, query.StartDate)
@@ -231,7 +245,7 @@ func (s *AppState) ExportAuditLogs(c *gin.Context) {
 
 	// Get all matching results (limit to 10000 for safety)
 	dataQuery := fmt.Sprintf(`
-		SELECT id, timestamp, action, category, user_ip, COALESCE(user_agent, ''), 
+		SELECT id, timestamp, action, category, COALESCE(username, ''), user_ip, COALESCE(user_agent, ''), 
 		       COALESCE(target_type, ''), COALESCE(target_id, ''), COALESCE(target_name, ''),
 		       COALESCE(details, ''), status, COALESCE(error_message, '')
 		FROM audit_logs %s
@@ -249,7 +263,7 @@ func (s *AppState) ExportAuditLogs(c *gin.Context) {
 	for rows.Next() {
 		var log AuditLog
 		if err := rows.Scan(
-			&log.ID, &log.Timestamp, &log.Action, &log.Category,
+			&log.ID, &log.Timestamp, &log.Action, &log.Category, &log.Username,
 			&log.UserIP, &log.UserAgent, &log.TargetType, &log.TargetID,
 			&log.TargetName, &log.Details, &log.Status, &log.ErrorMessage,
 		); err != nil {
@@ -269,14 +283,15 @@ func (s *AppState) ExportAuditLogs(c *gin.Context) {
 		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
 		
 		// Write CSV header
-		c.Writer.WriteString("ID,Timestamp,Action,Category,UserIP,UserAgent,TargetType,TargetID,TargetName,Details,Status,ErrorMessage\n")
+		c.Writer.WriteString("ID,Timestamp,Action,Category,Username,UserIP,UserAgent,TargetType,TargetID,TargetName,Details,Status,ErrorMessage\n")
 		
 		for _, log := range logs {
-			line := fmt.Sprintf("%d,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s\n",
+			line := fmt.Sprintf("%d,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s\n",
 				log.ID,
 				escapeCSV(log.Timestamp),
 				escapeCSV(string(log.Action)),
 				escapeCSV(string(log.Category)),
+				escapeCSV(log.Username),
 				escapeCSV(log.UserIP),
 				escapeCSV(log.UserAgent),
 				escapeCSV(log.TargetType),
@@ -397,7 +412,7 @@ func (s *AppState) UpdateAuditLogSettings(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	s.Config.AuditLogSettings = &settings
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionSettingsUpdate, AuditCategorySettings,
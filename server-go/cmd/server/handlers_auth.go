@@ -1,11 +1,12 @@
 package main
 
 import (
+	"database/sql"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -20,6 +21,13 @@ func (s *AppState) Login(c *gin.Context) {
 		return
 	}
 
+	username := strings.TrimSpace(req.Username)
+	if username != "" && !strings.EqualFold(username, BuiltinAdminUsername) {
+		s.loginUser(c, username, req.Password)
+		return
+	}
+	c.Set(ContextKeyUsername, BuiltinAdminUsername)
+
 	s.ConfigMu.RLock()
 	passwordHash := s.Config.AdminPasswordHash
 	s.ConfigMu.RUnlock()
@@ -27,7 +35,8 @@ func (s *AppState) Login(c *gin.Context) {
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
 		// If password verification fails, try reloading config from disk
 		// This handles the case where password was reset while server is running
-		if newConfig, _ := LoadConfig(); newConfig != nil {
+		// Only reload when the file actually changed, not on every failed attempt
+		if newConfig := reloadConfigIfChanged(); newConfig != nil {
 			s.ConfigMu.Lock()
 			oldHash := s.Config.AdminPasswordHash
 			s.Config.AdminPasswordHash = newConfig.AdminPasswordHash
@@ -40,39 +49,96 @@ func (s *AppState) Login(c *gin.Context) {
 				s.Config.AdminPasswordHash = oldHash
 				s.ConfigMu.Unlock()
 				LogAuditError(c, AuditActionLoginFailed, AuditCategoryAuth, "user", "admin", "admin", "Password login attempt", "Invalid password")
+				markAuthFailure(c)
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
 				return
 			}
 			// Success after reload, continue with login
 		} else {
 			LogAuditError(c, AuditActionLoginFailed, AuditCategoryAuth, "user", "admin", "admin", "Password login attempt", "Invalid password")
+			markAuthFailure(c)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
 			return
 		}
 	}
 
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": "admin",
-		"exp": expiresAt.Unix(),
-	})
+	s.completePasswordLogin(c, builtinAdminIdentity())
+}
 
-	tokenString, err := token.SignedString([]byte(GetJWTSecret()))
+// completePasswordLogin finishes a login whose password was verified. If the
+// account has two-factor authentication enabled, a challenge is returned
+// instead of a token and the login continues at LoginTwoFactor.
+func (s *AppState) completePasswordLogin(c *gin.Context, identity AuthIdentity) {
+	if twoFactorEnabled(identity) {
+		challenge, err := issueTwoFactorChallenge(identity)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, LoginResponse{
+			Username:          identity.Username,
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		})
+		return
+	}
+
+	pair, err := s.issueSession(identity, "", c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	LogAuditFromContext(c, AuditActionLogin, AuditCategoryAuth, "user", "admin", "admin", "Password login successful")
+	markAuthSuccess(c)
+	touchUserLogin(identity.UserID)
+	c.Set(ContextKeyUsername, identity.Username)
+	LogAuditFromContext(c, AuditActionLogin, AuditCategoryAuth, "user", auditTargetID(identity), identity.Username, "Password login successful")
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token:     tokenString,
-		ExpiresAt: expiresAt,
-	})
+	c.JSON(http.StatusOK, newLoginResponse(pair, identity))
+}
+
+// newLoginResponse builds the login response for an issued token pair
+func newLoginResponse(pair *TokenPair, identity AuthIdentity) LoginResponse {
+	resp := LoginResponse{
+		Token:     pair.AccessToken,
+		ExpiresAt: pair.AccessExpiresAt,
+		Username:  identity.Username,
+		Role:      identity.Role,
+	}
+	if pair.RefreshToken != "" {
+		resp.RefreshToken = pair.RefreshToken
+		resp.RefreshExpiresAt = &pair.RefreshExpiresAt
+	}
+	return resp
+}
+
+// loginUser authenticates a database user by username and password
+func (s *AppState) loginUser(c *gin.Context, username, password string) {
+	c.Set(ContextKeyUsername, username)
+
+	u := lookupUser(username)
+	if u == nil || bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		LogAuditError(c, AuditActionLoginFailed, AuditCategoryAuth, "user", username, username, "Password login attempt", "Invalid username or password")
+		markAuthFailure(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+	if u.Disabled {
+		LogAuditError(c, AuditActionLoginFailed, AuditCategoryAuth, "user", u.ID, u.Username, "Password login attempt", "User is disabled")
+		markAuthFailure(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	s.completePasswordLogin(c, AuthIdentity{UserID: u.ID, Username: u.Username, Role: u.Role})
 }
 
 func (s *AppState) VerifyToken(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "valid"})
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "valid",
+		"username": CurrentUsername(c),
+		"role":     CurrentRole(c),
+	})
 }
 
 func (s *AppState) ChangePassword(c *gin.Context) {
@@ -82,6 +148,17 @@ func (s *AppState) ChangePassword(c *gin.Context) {
 		return
 	}
 
+	// Database users change their own password; everyone else is the
+	// built-in admin, except unbound SSO identities that have no password
+	if userID := c.GetString(ContextKeyUserID); userID != "" {
+		s.changeUserPassword(c, userID, req)
+		return
+	}
+	if isSSOUsername(CurrentUsername(c)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only password accounts can change their password"})
+		return
+	}
+
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
 
@@ -98,9 +175,47 @@ func (s *AppState) ChangePassword(c *gin.Context) {
 	}
 
 	s.Config.AdminPasswordHash = string(hash)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
+
+	// Sign out every other session of the admin
+	revokeOtherSessions(c, "", BuiltinAdminUsername)
 	
 	LogAuditFromContext(c, AuditActionPasswordChange, AuditCategoryAuth, "user", "admin", "admin", "Password changed successfully")
 	
 	c.Status(http.StatusOK)
 }
+
+// changeUserPassword updates the password of a database user
+func (s *AppState) changeUserPassword(c *gin.Context, userID string, req ChangePasswordRequest) {
+	db := dbWriter.GetDB()
+	u, err := getUserByID(db, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		LogAuditError(c, AuditActionPasswordChange, AuditCategoryAuth, "user", u.ID, u.Username, "Password change attempt", "Invalid current password")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid current password"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	u.PasswordHash = string(hash)
+	u.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return updateUser(db, u) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	revokeOtherSessions(c, u.ID, u.Username)
+
+	LogAuditFromContext(c, AuditActionPasswordChange, AuditCategoryAuth, "user", u.ID, u.Username, "Password changed successfully")
+
+	c.Status(http.StatusOK)
+}
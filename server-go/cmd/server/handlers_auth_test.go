@@ -7,8 +7,10 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -217,6 +219,57 @@ func TestChangePassword(t *testing.T) {
 	})
 }
 
+// TestRoleMiddleware tests role claims and per-route role enforcement
+func TestRoleMiddleware(t *testing.T) {
+	router := gin.New()
+	protected := router.Group("/")
+	protected.Use(AuthMiddleware())
+	protected.GET("/api/alerts", func(c *gin.Context) { c.Status(http.StatusOK) })
+	protected.PUT("/api/settings/site", RequireRole(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Viewer can read but not mutate", func(t *testing.T) {
+		token, _, err := generateJWTToken(AuthIdentity{Username: "alice", Role: RoleViewer}, "", "", time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		if code := request("GET", "/api/alerts", token); code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+		if code := request("PUT", "/api/settings/site", token); code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("Legacy token without role is admin", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "admin",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		tokenString, _ := token.SignedString([]byte(GetJWTSecret()))
+		if code := request("PUT", "/api/settings/site", tokenString); code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+	})
+
+	t.Run("2FA challenge is not an access token", func(t *testing.T) {
+		challenge, err := issueTwoFactorChallenge(builtinAdminIdentity())
+		if err != nil {
+			t.Fatalf("Failed to issue challenge: %v", err)
+		}
+		if code := request("GET", "/api/alerts", challenge); code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+}
+
 // BenchmarkLogin benchmarks the login handler
 func BenchmarkLogin(b *testing.B) {
 	gin.SetMode(gin.ReleaseMode)
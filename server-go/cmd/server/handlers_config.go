@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Config Revision Handlers
+// ============================================================================
+
+// requireConfigStore answers with 503 when config is not stored in the database
+func requireConfigStore(c *gin.Context) bool {
+	if configStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Config revisions are not available"})
+		return false
+	}
+	return true
+}
+
+// configRevisionParam parses the :id path parameter
+func configRevisionParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetConfigRevisions lists stored config revisions, newest first
+func (s *AppState) GetConfigRevisions(c *gin.Context) {
+	if !requireConfigStore(c) {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	revisions, total, err := configStore.Revisions(limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query config revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revisions": revisions,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// GetConfigRevisionDiff compares a revision with an earlier one (the
+// previous revision by default) or, with against=current, shows what
+// restoring it would change
+func (s *AppState) GetConfigRevisionDiff(c *gin.Context) {
+	if !requireConfigStore(c) {
+		return
+	}
+	id, ok := configRevisionParam(c)
+	if !ok {
+		return
+	}
+
+	rev, err := configStore.Revision(id)
+	if err == ErrConfigRevisionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load revision"})
+		return
+	}
+
+	against := c.Query("against")
+	if against == "" {
+		// Changes recorded when the revision was saved
+		c.JSON(http.StatusOK, gin.H{"revision": rev, "against": "previous", "changes": rev.Changes})
+		return
+	}
+
+	target, err := configStore.Snapshot(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load revision"})
+		return
+	}
+
+	var base map[string]json.RawMessage
+	if against == "current" {
+		s.ConfigMu.RLock()
+		_, base, err = splitConfig(s.Config)
+		s.ConfigMu.RUnlock()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read current config"})
+			return
+		}
+		// Restoring turns the current config into the revision
+		rev.Changes = diffConfigSections(base, target)
+	} else {
+		otherID, err := strconv.ParseInt(against, 10, 64)
+		if err != nil || otherID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid against parameter"})
+			return
+		}
+		base, err = configStore.Snapshot(otherID)
+		if err == ErrConfigRevisionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load revision"})
+			return
+		}
+		rev.Changes = diffConfigSections(base, target)
+	}
+	rev.ChangeCount = len(rev.Changes)
+
+	c.JSON(http.StatusOK, gin.H{"revision": rev, "against": against, "changes": rev.Changes})
+}
+
+// RestoreConfigRevision makes a stored revision the current config. The
+// restore is saved as a new revision, so it can be undone the same way.
+func (s *AppState) RestoreConfigRevision(c *gin.Context) {
+	if !requireConfigStore(c) {
+		return
+	}
+	id, ok := configRevisionParam(c)
+	if !ok {
+		return
+	}
+
+	snapshot, err := configStore.Snapshot(id)
+	if err == ErrConfigRevisionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load revision"})
+		return
+	}
+
+	// Store edits still waiting for the debounce so they are not lost
+	FlushConfig()
+
+	s.ConfigMu.RLock()
+	file, _, err := splitConfig(s.Config)
+	oldSiteSettings := s.Config.SiteSettings
+	s.ConfigMu.RUnlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read current config"})
+		return
+	}
+
+	restored, err := mergeConfig(file, snapshot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore revision"})
+		return
+	}
+	if err := applyConfig(s, restored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.pushConfigToAgents()
+
+	rev := saveConfigNow(restored, ConfigAuthor{
+		Username:     CurrentUsername(c),
+		IP:           c.ClientIP(),
+		Source:       ConfigSourceRestore,
+		RestoredFrom: id,
+	})
+
+	siteSettings := restored.SiteSettings
+	if !jsonValuesEqual(oldSiteSettings, siteSettings) {
+		s.BroadcastSiteSettings(&siteSettings)
+	}
+
+	LogAuditFromContext(c, AuditActionConfigRestore, AuditCategorySettings, "config", strconv.FormatInt(id, 10), "Config Revision",
+		fmt.Sprintf("Restored config revision %d", id))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "revision": rev})
+}
+
+// jsonValuesEqual compares two values by their JSON encoding
+func jsonValuesEqual(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && jsonEqual(ja, jb)
+}
@@ -86,7 +86,7 @@ func (s *AppState) UpdateGeoIPConfig(c *gin.Context) {
 	// Save to app config
 	s.ConfigMu.Lock()
 	s.Config.GeoIPConfig = newConfig
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionSettingsUpdate, AuditCategorySettings, "settings", "geoip", "GeoIP Config", "GeoIP configuration updated")
@@ -187,7 +187,7 @@ func (s *AppState) RefreshServerGeoIP(c *gin.Context) {
 		s.Config.GeoIPConfig.LastUpdate = time.Now().Format(time.RFC3339)
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, AuditActionSettingsUpdate, AuditCategorySettings, "settings", "geoip", "GeoIP Refresh", fmt.Sprintf("Updated %d servers", updated))
 
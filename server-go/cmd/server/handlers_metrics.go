@@ -26,11 +26,13 @@ func (s *AppState) GetMetrics(c *gin.Context) {
 func (s *AppState) GetAllMetrics(c *gin.Context) {
 	s.ConfigMu.RLock()
 	servers := s.Config.Servers
+	dimensions := s.Config.GroupDimensions
 	s.ConfigMu.RUnlock()
 
 	s.AgentMetricsMu.RLock()
 	defer s.AgentMetricsMu.RUnlock()
 
+	now := time.Now()
 	var updates []ServerMetricsUpdate
 	for _, server := range servers {
 		metricsData := s.AgentMetrics[server.ID]
@@ -72,6 +74,7 @@ func (s *AppState) GetAllMetrics(c *gin.Context) {
 			GeoIP:         server.GeoIP,
 			SaleStatus:    server.SaleStatus,
 			SaleContactURL: server.SaleContactURL,
+			Maintenance:   serverInMaintenance(server, dimensions, now),
 		})
 	}
 
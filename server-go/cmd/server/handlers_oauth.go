@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -74,6 +75,7 @@ func (s *AppState) GetOAuthSettings(c *gin.Context) {
 	if s.Config.OAuth != nil {
 		response["use_centralized"] = s.Config.OAuth.UseCentralized
 		response["allowed_users"] = s.Config.OAuth.AllowedUsers
+		response["default_role"] = s.Config.OAuth.DefaultRole
 
 		if s.Config.OAuth.GitHub != nil {
 			response["github"] = gin.H{
@@ -107,6 +109,7 @@ func (s *AppState) GetOAuthSettings(c *gin.Context) {
 					"allowed_users":  oidc.AllowedUsers,
 					"allowed_groups": oidc.AllowedGroups,
 					"username_claim": oidc.UsernameClaim,
+					"group_roles":    oidc.GroupRoles,
 				})
 			}
 			response["oidc"] = oidcProviders
@@ -136,6 +139,7 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 	var req struct {
 		UseCentralized *bool    `json:"use_centralized,omitempty"`
 		AllowedUsers   []string `json:"allowed_users,omitempty"`
+		DefaultRole    *string  `json:"default_role,omitempty"`
 		GitHub         *struct {
 			Enabled      bool     `json:"enabled"`
 			ClientID     string   `json:"client_id"`
@@ -150,16 +154,17 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 		} `json:"google,omitempty"`
 		// OIDC providers
 		OIDC []struct {
-			ID            string   `json:"id,omitempty"`
-			Enabled       bool     `json:"enabled"`
-			Name          string   `json:"name"`
-			Issuer        string   `json:"issuer"`
-			ClientID      string   `json:"client_id"`
-			ClientSecret  string   `json:"client_secret,omitempty"`
-			Scopes        []string `json:"scopes,omitempty"`
-			AllowedUsers  []string `json:"allowed_users,omitempty"`
-			AllowedGroups []string `json:"allowed_groups,omitempty"`
-			UsernameClaim string   `json:"username_claim,omitempty"`
+			ID            string            `json:"id,omitempty"`
+			Enabled       bool              `json:"enabled"`
+			Name          string            `json:"name"`
+			Issuer        string            `json:"issuer"`
+			ClientID      string            `json:"client_id"`
+			ClientSecret  string            `json:"client_secret,omitempty"`
+			Scopes        []string          `json:"scopes,omitempty"`
+			AllowedUsers  []string          `json:"allowed_users,omitempty"`
+			AllowedGroups []string          `json:"allowed_groups,omitempty"`
+			UsernameClaim string            `json:"username_claim,omitempty"`
+			GroupRoles    map[string]string `json:"group_roles,omitempty"`
 		} `json:"oidc,omitempty"`
 		// Cloudflare Access
 		CloudflareAccess *struct {
@@ -175,6 +180,19 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 		return
 	}
 
+	if req.DefaultRole != nil && *req.DefaultRole != "" && !IsValidRole(UserRole(*req.DefaultRole)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid default role"})
+		return
+	}
+	for _, oidcReq := range req.OIDC {
+		for group, role := range oidcReq.GroupRoles {
+			if !IsValidRole(UserRole(role)) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role for group " + group})
+				return
+			}
+		}
+	}
+
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
 
@@ -189,6 +207,9 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 	if req.AllowedUsers != nil {
 		s.Config.OAuth.AllowedUsers = req.AllowedUsers
 	}
+	if req.DefaultRole != nil {
+		s.Config.OAuth.DefaultRole = *req.DefaultRole
+	}
 
 	// Update self-hosted OAuth settings
 	if req.GitHub != nil {
@@ -229,6 +250,7 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 				AllowedUsers:  oidcReq.AllowedUsers,
 				AllowedGroups: oidcReq.AllowedGroups,
 				UsernameClaim: oidcReq.UsernameClaim,
+				GroupRoles:    oidcReq.GroupRoles,
 			}
 			// Preserve existing secret if not provided
 			if oidcReq.ClientSecret != "" {
@@ -256,7 +278,7 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 		s.Config.OAuth.CloudflareAccess.AllowedUsers = req.CloudflareAccess.AllowedUsers
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, AuditActionOAuthSettingsUpdate, AuditCategorySettings, "settings", "oauth", "OAuth Settings", "OAuth settings updated")
 
@@ -366,15 +388,8 @@ func (s *AppState) GitHubOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(user.Login, "github")
-	if err != nil {
-		redirectWithError(c, "Failed to generate token")
-		return
-	}
-
-	// Redirect to frontend with token
-	redirectWithToken(c, token, expiresAt, "github", user.Login)
+	// Map identity to a dashboard user, issue token and redirect
+	s.completeSSOLogin(c, "github", user.Login, nil, nil)
 }
 
 // Google OAuth handlers
@@ -479,15 +494,8 @@ func (s *AppState) GoogleOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(user.Email, "google")
-	if err != nil {
-		redirectWithError(c, "Failed to generate token")
-		return
-	}
-
-	// Redirect to frontend with token
-	redirectWithToken(c, token, expiresAt, "google", user.Email)
+	// Map identity to a dashboard user, issue token and redirect
+	s.completeSSOLogin(c, "google", user.Email, nil, nil)
 }
 
 // ProxyOAuthCallback handles OAuth callback from centralized OAuth proxy (vstats.zsoft.cc)
@@ -544,15 +552,8 @@ func (s *AppState) ProxyOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(user, provider)
-	if err != nil {
-		redirectWithError(c, "Failed to generate token")
-		return
-	}
-
-	// Redirect to frontend with token
-	redirectWithToken(c, token, expiresAt, provider, user)
+	// Map identity to a dashboard user, issue token and redirect
+	s.completeSSOLogin(c, provider, user, nil, nil)
 }
 
 // ============================================================================
@@ -690,13 +691,25 @@ func isUserAllowed(allowedUsers []string, identifier string) bool {
 	return false
 }
 
-func generateJWTToken(sub, provider string) (string, time.Time, error) {
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":      sub,
-		"provider": provider,
-		"exp":      expiresAt.Unix(),
-	})
+// generateJWTToken issues a dashboard access token carrying the user's role
+// claims. sessionID becomes the jti and binds the token to a server-side session.
+func generateJWTToken(identity AuthIdentity, provider, sessionID string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	claims := jwt.MapClaims{
+		"sub":  identity.Username,
+		"role": string(identity.Role),
+		"exp":  expiresAt.Unix(),
+	}
+	if identity.UserID != "" {
+		claims["uid"] = identity.UserID
+	}
+	if provider != "" {
+		claims["provider"] = provider
+	}
+	if sessionID != "" {
+		claims["jti"] = sessionID
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(GetJWTSecret()))
 	if err != nil {
@@ -706,18 +719,47 @@ func generateJWTToken(sub, provider string) (string, time.Time, error) {
 	return tokenString, expiresAt, nil
 }
 
-func redirectWithToken(c *gin.Context, token string, expiresAt time.Time, provider, username string) {
-	// Redirect to frontend OAuth callback page
-	redirectURL := fmt.Sprintf("/oauth-callback?token=%s&expires=%d&provider=%s&user=%s",
-		url.QueryEscape(token),
-		expiresAt.Unix(),
-		provider,
-		url.QueryEscape(username),
-	)
-	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
+// completeSSOLogin resolves the dashboard user for an allowed SSO identity,
+// records the login in the audit log and redirects with a token
+func (s *AppState) completeSSOLogin(c *gin.Context, provider, identifier string, groups []string, oidc *OIDCProvider) {
+	identity, err := s.resolveSSOIdentity(provider, identifier, groups, oidc)
+	if err != nil {
+		LogAuditError(c, AuditActionOAuthLoginFailed, AuditCategoryAuth, "user", provider, identifier, "SSO login attempt", err.Error())
+		redirectWithError(c, "User not authorized: "+identifier)
+		return
+	}
+
+	pair, err := s.issueSession(identity, provider, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		redirectWithError(c, "Failed to generate token")
+		return
+	}
+
+	markAuthSuccess(c)
+	touchUserLogin(identity.UserID)
+	c.Set(ContextKeyUsername, identity.Username)
+	LogAuditFromContext(c, AuditActionOAuthLogin, AuditCategoryAuth, "user", provider, identifier, fmt.Sprintf("SSO login as %s (%s)", identity.Username, identity.Role))
+
+	redirectWithToken(c, pair, provider, identity.Username)
+}
+
+// redirectWithToken redirects to the frontend OAuth callback page. The tokens
+// go in the URL fragment, which browsers never send to servers or in Referer
+// headers, so they stay out of proxy and access logs.
+func redirectWithToken(c *gin.Context, pair *TokenPair, provider, username string) {
+	fragment := url.Values{}
+	fragment.Set("token", pair.AccessToken)
+	fragment.Set("expires", strconv.FormatInt(pair.AccessExpiresAt.Unix(), 10))
+	fragment.Set("provider", provider)
+	fragment.Set("user", username)
+	if pair.RefreshToken != "" {
+		fragment.Set("refresh", pair.RefreshToken)
+	}
+	c.Redirect(http.StatusTemporaryRedirect, "/oauth-callback#"+fragment.Encode())
 }
 
 func redirectWithError(c *gin.Context, message string) {
+	markAuthFailure(c)
 	redirectURL := fmt.Sprintf("/oauth-callback?error=%s", url.QueryEscape(message))
 	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
 }
@@ -985,15 +1027,8 @@ func (s *AppState) OIDCOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(username, providerID)
-	if err != nil {
-		redirectWithError(c, "Failed to generate token")
-		return
-	}
-
-	// Redirect to frontend with token
-	redirectWithToken(c, token, expiresAt, providerID, username)
+	// Map identity to a dashboard user, issue token and redirect
+	s.completeSSOLogin(c, providerID, username, userInfo.Groups, provider)
 }
 
 func exchangeOIDCCode(code string, provider *OIDCProvider, discovery *OIDCDiscovery, redirectURI string) (*OIDCTokenResponse, error) {
@@ -1150,15 +1185,8 @@ func (s *AppState) CloudflareAccessCallback(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(email, "cloudflare")
-	if err != nil {
-		redirectWithError(c, "Failed to generate token")
-		return
-	}
-
-	// Redirect to frontend with token
-	redirectWithToken(c, token, expiresAt, "cloudflare", email)
+	// Map identity to a dashboard user, issue token and redirect
+	s.completeSSOLogin(c, "cloudflare", email, nil, nil)
 }
 
 // verifyClouflareAccessJWT verifies Cloudflare Access JWT
@@ -1303,6 +1331,7 @@ func (s *AppState) AddSSOBinding(c *gin.Context) {
 		Provider   string `json:"provider" binding:"required"`
 		ProviderID string `json:"provider_id"`
 		Identifier string `json:"identifier" binding:"required"`
+		Username   string `json:"username"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1310,6 +1339,12 @@ func (s *AppState) AddSSOBinding(c *gin.Context) {
 		return
 	}
 
+	// Bindings may target any existing user; empty means the built-in admin
+	if req.Username != "" && !strings.EqualFold(req.Username, BuiltinAdminUsername) && lookupUser(req.Username) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+		return
+	}
+
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
 
@@ -1330,10 +1365,11 @@ func (s *AppState) AddSSOBinding(c *gin.Context) {
 		ProviderID: req.ProviderID,
 		Identifier: req.Identifier,
 		BoundAt:    time.Now().UTC().Format(time.RFC3339),
+		Username:   req.Username,
 	}
 
 	s.Config.OAuth.Bindings = append(s.Config.OAuth.Bindings, binding)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, "sso_binding_add", AuditCategoryAuth, "binding", req.Provider, req.Identifier, "SSO binding added")
 
@@ -1374,7 +1410,7 @@ func (s *AppState) DeleteSSOBinding(c *gin.Context) {
 	}
 
 	s.Config.OAuth.Bindings = newBindings
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, "sso_binding_delete", AuditCategoryAuth, "binding", provider, identifier, "SSO binding removed")
 
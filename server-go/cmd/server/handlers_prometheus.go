@@ -0,0 +1,416 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Prometheus Exporter
+// ============================================================================
+
+// promLabel is a single label pair, kept ordered for stable output
+type promLabel struct {
+	Name  string
+	Value string
+}
+
+// promFamily holds all samples of one metric name
+type promFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []string
+}
+
+// promWriter collects samples grouped by metric family in insertion order
+type promWriter struct {
+	families map[string]*promFamily
+	order    []string
+}
+
+func newPromWriter() *promWriter {
+	return &promWriter{families: make(map[string]*promFamily)}
+}
+
+func (w *promWriter) gauge(name, help string, labels []promLabel, value float64) {
+	w.add(name, help, "gauge", labels, value)
+}
+
+func (w *promWriter) counter(name, help string, labels []promLabel, value float64) {
+	w.add(name, help, "counter", labels, value)
+}
+
+func (w *promWriter) add(name, help, typ string, labels []promLabel, value float64) {
+	family, ok := w.families[name]
+	if !ok {
+		family = &promFamily{Name: name, Help: help, Type: typ}
+		w.families[name] = family
+		w.order = append(w.order, name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 0 {
+		sb.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(l.Name)
+			sb.WriteString(`="`)
+			sb.WriteString(escapePromLabelValue(l.Value))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	family.Samples = append(family.Samples, sb.String())
+}
+
+func (w *promWriter) String() string {
+	var sb strings.Builder
+	for _, name := range w.order {
+		family := w.families[name]
+		fmt.Fprintf(&sb, "# HELP %s %s\n", family.Name, family.Help)
+		fmt.Fprintf(&sb, "# TYPE %s %s\n", family.Name, family.Type)
+		for _, sample := range family.Samples {
+			sb.WriteString(sample)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// escapePromLabelValue escapes a label value per the text exposition format
+func escapePromLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+// sanitizePromLabelName converts an arbitrary key into a valid label name
+func sanitizePromLabelName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// withLabels returns a copy of base with extra labels appended
+func withLabels(base []promLabel, extra ...promLabel) []promLabel {
+	labels := make([]promLabel, 0, len(base)+len(extra))
+	labels = append(labels, base...)
+	return append(labels, extra...)
+}
+
+// serverPromLabels builds the identity labels for a server, including
+// one label per enabled group dimension (option name as value)
+func serverPromLabels(server RemoteServer, dimensions []GroupDimension) []promLabel {
+	labels := []promLabel{
+		{Name: "server_id", Value: server.ID},
+		{Name: "server_name", Value: server.Name},
+		{Name: "location", Value: server.Location},
+		{Name: "provider", Value: server.Provider},
+	}
+
+	reserved := map[string]bool{"server_id": true, "server_name": true, "location": true, "provider": true}
+	for _, dim := range dimensions {
+		if !dim.Enabled {
+			continue
+		}
+		key := dim.Key
+		if key == "" {
+			key = dim.ID
+		}
+		name := sanitizePromLabelName(key)
+		if name == "" || strings.HasPrefix(name, "__") || reserved[name] {
+			name = "dimension_" + name
+		}
+		reserved[name] = true
+
+		value := ""
+		if optionID, ok := server.GroupValues[dim.ID]; ok {
+			value = optionID
+			for _, opt := range dim.Options {
+				if opt.ID == optionID {
+					value = opt.Name
+					break
+				}
+			}
+		}
+		labels = append(labels, promLabel{Name: name, Value: value})
+	}
+	return labels
+}
+
+// buildPrometheusMetrics renders all server metrics in Prometheus text format
+func (s *AppState) buildPrometheusMetrics() string {
+	s.ConfigMu.RLock()
+	servers := make([]RemoteServer, len(s.Config.Servers))
+	copy(servers, s.Config.Servers)
+	dimensions := make([]GroupDimension, len(s.Config.GroupDimensions))
+	copy(dimensions, s.Config.GroupDimensions)
+	s.ConfigMu.RUnlock()
+
+	sort.Slice(dimensions, func(i, j int) bool { return dimensions[i].SortOrder < dimensions[j].SortOrder })
+
+	w := newPromWriter()
+	serverLabels := make(map[string][]promLabel, len(servers))
+
+	s.AgentMetricsMu.RLock()
+	for _, server := range servers {
+		base := serverPromLabels(server, dimensions)
+		serverLabels[server.ID] = base
+
+		data := s.AgentMetrics[server.ID]
+		online := data != nil && time.Since(data.LastUpdated).Seconds() < 30
+		w.gauge("vstats_server_up", "Whether the agent is online (1) or offline (0)", base, boolToFloat(online))
+		if data == nil {
+			continue
+		}
+
+		m := data.Metrics
+		version := server.Version
+		if m.Version != "" {
+			version = m.Version
+		}
+		w.gauge("vstats_server_info", "Static information about the server", withLabels(base,
+			promLabel{Name: "version", Value: version},
+			promLabel{Name: "hostname", Value: m.Hostname},
+			promLabel{Name: "os", Value: m.OS.Name},
+			promLabel{Name: "arch", Value: m.OS.Arch},
+		), 1)
+		w.gauge("vstats_last_seen_timestamp_seconds", "Unix time of the last metrics report", base, float64(data.LastUpdated.Unix()))
+		w.gauge("vstats_uptime_seconds", "System uptime in seconds", base, float64(m.Uptime))
+
+		// CPU
+		w.gauge("vstats_cpu_usage_percent", "Total CPU usage percentage", base, float64(m.CPU.Usage))
+		w.gauge("vstats_cpu_cores", "Number of CPU cores", base, float64(m.CPU.Cores))
+		for i, usage := range m.CPU.PerCore {
+			w.gauge("vstats_cpu_core_usage_percent", "Per-core CPU usage percentage",
+				withLabels(base, promLabel{Name: "core", Value: strconv.Itoa(i)}), float64(usage))
+		}
+
+		// Load
+		w.gauge("vstats_load1", "1-minute load average", base, m.LoadAverage.One)
+		w.gauge("vstats_load5", "5-minute load average", base, m.LoadAverage.Five)
+		w.gauge("vstats_load15", "15-minute load average", base, m.LoadAverage.Fifteen)
+
+		// Memory
+		w.gauge("vstats_memory_total_bytes", "Total memory in bytes", base, float64(m.Memory.Total))
+		w.gauge("vstats_memory_used_bytes", "Used memory in bytes", base, float64(m.Memory.Used))
+		w.gauge("vstats_memory_available_bytes", "Available memory in bytes", base, float64(m.Memory.Available))
+		w.gauge("vstats_memory_usage_percent", "Memory usage percentage", base, float64(m.Memory.UsagePercent))
+		w.gauge("vstats_swap_total_bytes", "Total swap in bytes", base, float64(m.Memory.SwapTotal))
+		w.gauge("vstats_swap_used_bytes", "Used swap in bytes", base, float64(m.Memory.SwapUsed))
+
+		// Disks
+		for _, disk := range m.Disks {
+			labels := withLabels(base,
+				promLabel{Name: "disk", Value: disk.Name},
+				promLabel{Name: "mountpoint", Value: strings.Join(disk.MountPoints, ",")},
+			)
+			w.gauge("vstats_disk_total_bytes", "Disk size in bytes", labels, float64(disk.Total))
+			w.gauge("vstats_disk_used_bytes", "Disk used bytes", labels, float64(disk.Used))
+			w.gauge("vstats_disk_usage_percent", "Disk usage percentage", labels, float64(disk.UsagePercent))
+			w.gauge("vstats_disk_read_bytes_per_second", "Disk read throughput in bytes per second", labels, float64(disk.ReadSpeed))
+			w.gauge("vstats_disk_write_bytes_per_second", "Disk write throughput in bytes per second", labels, float64(disk.WriteSpeed))
+		}
+
+		// Network
+		for _, iface := range m.Network.Interfaces {
+			labels := withLabels(base, promLabel{Name: "interface", Value: iface.Name})
+			w.counter("vstats_network_receive_bytes_total", "Received bytes per interface", labels, float64(iface.RxBytes))
+			w.counter("vstats_network_transmit_bytes_total", "Transmitted bytes per interface", labels, float64(iface.TxBytes))
+			w.counter("vstats_network_receive_packets_total", "Received packets per interface", labels, float64(iface.RxPackets))
+			w.counter("vstats_network_transmit_packets_total", "Transmitted packets per interface", labels, float64(iface.TxPackets))
+		}
+		w.gauge("vstats_network_receive_bytes_per_second", "Total receive throughput in bytes per second", base, float64(m.Network.RxSpeed))
+		w.gauge("vstats_network_transmit_bytes_per_second", "Total transmit throughput in bytes per second", base, float64(m.Network.TxSpeed))
+
+		// GPU
+		if m.GPU != nil {
+			for _, gpu := range m.GPU.GPUs {
+				labels := withLabels(base,
+					promLabel{Name: "gpu", Value: strconv.Itoa(gpu.Index)},
+					promLabel{Name: "gpu_name", Value: gpu.Name},
+					promLabel{Name: "vendor", Value: gpu.Vendor},
+				)
+				w.gauge("vstats_gpu_utilization_percent", "GPU core utilization percentage", labels, float64(gpu.Utilization))
+				w.gauge("vstats_gpu_memory_total_bytes", "GPU memory size in bytes", labels, float64(gpu.MemoryTotal))
+				w.gauge("vstats_gpu_memory_used_bytes", "GPU memory used in bytes", labels, float64(gpu.MemoryUsed))
+				w.gauge("vstats_gpu_temperature_celsius", "GPU temperature in Celsius", labels, float64(gpu.Temperature))
+				w.gauge("vstats_gpu_power_draw_watts", "GPU power draw in watts", labels, float64(gpu.PowerDraw))
+			}
+		}
+
+		// Ping
+		if m.Ping != nil {
+			for _, target := range m.Ping.Targets {
+				probeType := target.Type
+				if probeType == "" {
+					probeType = "icmp"
+				}
+				labels := withLabels(base,
+					promLabel{Name: "target", Value: target.Name},
+					promLabel{Name: "host", Value: target.Host},
+					promLabel{Name: "type", Value: probeType},
+				)
+				w.gauge("vstats_ping_up", "Whether the ping target is reachable", labels, boolToFloat(target.Status == "ok"))
+				w.gauge("vstats_ping_packet_loss_percent", "Ping packet loss percentage", labels, target.PacketLoss)
+				if target.LatencyMs != nil {
+					w.gauge("vstats_ping_latency_milliseconds", "Ping round-trip latency in milliseconds", labels, *target.LatencyMs)
+				}
+				if target.StatusCode != 0 {
+					w.gauge("vstats_probe_http_status_code", "HTTP status code returned to an HTTP probe", labels, float64(target.StatusCode))
+				}
+				if target.CertExpiryDays != nil {
+					w.gauge("vstats_probe_cert_expiry_days", "Days until the TLS certificate of a probe target expires", labels, *target.CertExpiryDays)
+				}
+			}
+		}
+	}
+	s.AgentMetricsMu.RUnlock()
+
+	// Traffic billing period usage
+	if trafficManager != nil {
+		stats := trafficManager.GetAllStats()
+		sort.Slice(stats, func(i, j int) bool { return stats[i].ServerID < stats[j].ServerID })
+		for _, stat := range stats {
+			base, ok := serverLabels[stat.ServerID]
+			if !ok {
+				continue
+			}
+			w.gauge("vstats_traffic_period_transmit_bytes", "Transmitted bytes in the current billing period", base, float64(stat.TxBytes))
+			w.gauge("vstats_traffic_period_receive_bytes", "Received bytes in the current billing period", base, float64(stat.RxBytes))
+			w.gauge("vstats_traffic_period_total_bytes", "Total bytes in the current billing period", base, float64(stat.TotalBytes))
+			w.gauge("vstats_traffic_limit_bytes", "Monthly traffic limit in bytes (0 = unlimited)", base, float64(GBToBytes(stat.MonthlyLimitGB)))
+			w.gauge("vstats_traffic_usage_percent", "Monthly traffic usage percentage", base, stat.UsagePercent)
+			w.gauge("vstats_traffic_period_end_timestamp_seconds", "Unix time when the billing period resets", base, float64(stat.PeriodEnd.Unix()))
+		}
+	}
+
+	return w.String()
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// PrometheusAuthMiddleware accepts either the configured scrape token or the
+// JWT or API token of an admin
+func (s *AppState) PrometheusAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.ConfigMu.RLock()
+		expected := ""
+		if s.Config.Prometheus != nil {
+			expected = s.Config.Prometheus.Token
+		}
+		s.ConfigMu.RUnlock()
+
+		if expected != "" {
+			provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if provided == "" {
+				provided = c.Query("token")
+			}
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1 {
+				c.Next()
+				return
+			}
+		}
+
+		if !authenticateRequest(c) {
+			return
+		}
+		if !RoleAtLeast(CurrentRole(c), RoleAdmin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// PrometheusMetrics serves all server metrics in Prometheus text exposition format
+func (s *AppState) PrometheusMetrics(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(s.buildPrometheusMetrics()))
+}
+
+// ============================================================================
+// Prometheus Settings Handlers
+// ============================================================================
+
+// GetPrometheusSettings returns the exporter settings with the token masked
+func (s *AppState) GetPrometheusSettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	token := ""
+	if s.Config.Prometheus != nil {
+		token = s.Config.Prometheus.Token
+	}
+	s.ConfigMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     maskToken(token),
+		"has_token": token != "",
+	})
+}
+
+// UpdatePrometheusSettings sets, regenerates or clears the scrape token
+func (s *AppState) UpdatePrometheusSettings(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token"`
+		Generate bool   `json:"generate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	if s.Config.Prometheus == nil {
+		s.Config.Prometheus = &PrometheusConfig{}
+	}
+	current := s.Config.Prometheus.Token
+	token := req.Token
+	if req.Generate {
+		token = GenerateRandomString(32)
+	} else if token != "" && token == maskToken(current) {
+		token = current
+	}
+	s.Config.Prometheus.Token = token
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	LogAuditFromContext(c, AuditActionSettingsUpdate, AuditCategorySettings, "settings", "prometheus", "Prometheus Exporter", "Prometheus exporter settings updated")
+
+	response := gin.H{"success": true, "has_token": token != ""}
+	if req.Generate {
+		// Only reveal the full token right after generation
+		response["token"] = token
+	} else {
+		response["token"] = maskToken(token)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestPrometheusMetrics tests the Prometheus exporter output and auth
+func TestPrometheusMetrics(t *testing.T) {
+	appState := createTestAppState(t, "testpassword123")
+	appState.Config.Prometheus = &PrometheusConfig{Token: "scrape-token"}
+	appState.Config.GroupDimensions = []GroupDimension{
+		{ID: "region", Key: "region", Enabled: true, Options: []GroupOption{{ID: "asia", Name: "Asia"}}},
+	}
+	appState.Config.Servers = []RemoteServer{
+		{ID: "s1", Name: "Tokyo \"1\"", Location: "JP", Provider: "Vultr", GroupValues: map[string]string{"region": "asia"}},
+		{ID: "s2", Name: "Offline"},
+	}
+	latency := 12.5
+	appState.AgentMetrics = map[string]*AgentMetricsData{
+		"s1": {
+			ServerID:    "s1",
+			LastUpdated: time.Now(),
+			Metrics: SystemMetrics{
+				CPU:   CpuMetrics{Usage: 42, Cores: 2, PerCore: []float32{40, 44}},
+				Disks: []DiskMetrics{{Name: "sda", MountPoints: []string{"/"}, UsagePercent: 50}},
+				Ping: &PingMetrics{Targets: []PingTarget{
+					{Name: "hk", Host: "1.1.1.1", LatencyMs: &latency, Status: "ok"},
+					{Name: "hk", Host: "1.1.1.1", Type: "tcp", Status: "timeout", PacketLoss: 100},
+				}},
+			},
+		},
+	}
+
+	router := gin.New()
+	router.GET("/metrics", appState.PrometheusAuthMiddleware(), appState.PrometheusMetrics)
+
+	t.Run("Rejects missing token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("Requires admin for JWTs", func(t *testing.T) {
+		for role, status := range map[UserRole]int{RoleViewer: http.StatusForbidden, RoleAdmin: http.StatusOK} {
+			token, _, err := generateJWTToken(AuthIdentity{Username: "alice", Role: role}, "", "", time.Hour)
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != status {
+				t.Errorf("%s: expected status %d, got %d", role, status, w.Code)
+			}
+		}
+	})
+
+	t.Run("Renders metrics with scrape token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer scrape-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		body := w.Body.String()
+		expected := []string{
+			`vstats_server_up{server_id="s1",server_name="Tokyo \"1\"",location="JP",provider="Vultr",region="Asia"} 1`,
+			`vstats_server_up{server_id="s2",server_name="Offline",location="",provider="",region=""} 0`,
+			`vstats_cpu_core_usage_percent{server_id="s1",server_name="Tokyo \"1\"",location="JP",provider="Vultr",region="Asia",core="1"} 44`,
+			`vstats_disk_usage_percent{server_id="s1",server_name="Tokyo \"1\"",location="JP",provider="Vultr",region="Asia",disk="sda",mountpoint="/"} 50`,
+			`vstats_ping_latency_milliseconds{server_id="s1",server_name="Tokyo \"1\"",location="JP",provider="Vultr",region="Asia",target="hk",host="1.1.1.1",type="icmp"} 12.5`,
+			`vstats_ping_up{server_id="s1",server_name="Tokyo \"1\"",location="JP",provider="Vultr",region="Asia",target="hk",host="1.1.1.1",type="tcp"} 0`,
+		}
+		for _, line := range expected {
+			if !strings.Contains(body, line) {
+				t.Errorf("Expected output to contain %q", line)
+			}
+		}
+
+		if strings.Count(body, "# TYPE vstats_server_up gauge") != 1 {
+			t.Error("Expected a single TYPE line per metric family")
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -48,7 +49,7 @@ func (s *AppState) AddServer(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	s.Config.Servers = append(s.Config.Servers, server)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionServerCreate, AuditCategoryServer, "server", server.ID, server.Name, "Server created")
@@ -70,13 +71,19 @@ func (s *AppState) DeleteServer(c *gin.Context) {
 		}
 	}
 	s.Config.Servers = servers
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	s.AgentMetricsMu.Lock()
 	delete(s.AgentMetrics, id)
 	s.AgentMetricsMu.Unlock()
 
+	if dbWriter != nil {
+		dbWriter.WriteAsync(func(db *sql.DB) error {
+			return deleteAgentStatus(db, id)
+		})
+	}
+
 	LogAuditFromContext(c, AuditActionServerDelete, AuditCategoryServer, "server", id, deletedName, "Server deleted")
 
 	c.Status(http.StatusOK)
@@ -155,7 +162,10 @@ func (s *AppState) UpdateServer(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
+	// Group values select agent profiles and ping targets
+	go s.PushAgentConfigs()
+	go s.BroadcastPingTargets()
 	
 	LogAuditFromContext(c, AuditActionServerUpdate, AuditCategoryServer, "server", id, updated.Name, "Server updated")
 
@@ -195,7 +205,7 @@ func (s *AppState) AddGroup(c *gin.Context) {
 		s.Config.Groups = []ServerGroup{}
 	}
 	s.Config.Groups = append(s.Config.Groups, group)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, group)
@@ -232,7 +242,7 @@ func (s *AppState) UpdateGroup(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -257,7 +267,7 @@ func (s *AppState) DeleteGroup(c *gin.Context) {
 		}
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.Status(http.StatusOK)
@@ -309,7 +319,7 @@ func (s *AppState) AddDimension(c *gin.Context) {
 		s.Config.GroupDimensions = []GroupDimension{}
 	}
 	s.Config.GroupDimensions = append(s.Config.GroupDimensions, dimension)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	c.JSON(http.StatusOK, dimension)
 }
@@ -348,7 +358,7 @@ func (s *AppState) UpdateDimension(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -374,7 +384,9 @@ func (s *AppState) DeleteDimension(c *gin.Context) {
 		}
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
+	go s.PushAgentConfigs()
+	go s.BroadcastPingTargets()
 	c.Status(http.StatusOK)
 }
 
@@ -414,7 +426,7 @@ func (s *AppState) AddOption(c *gin.Context) {
 	}
 
 	dimension.Options = append(dimension.Options, option)
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	c.JSON(http.StatusOK, option)
 }
@@ -456,7 +468,7 @@ func (s *AppState) UpdateOption(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -499,6 +511,8 @@ func (s *AppState) DeleteOption(c *gin.Context) {
 		}
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
+	go s.PushAgentConfigs()
+	go s.BroadcastPingTargets()
 	c.Status(http.StatusOK)
 }
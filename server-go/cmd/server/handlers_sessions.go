@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Session Handlers
+// ============================================================================
+
+// RefreshToken exchanges a refresh token for a new access token. The refresh
+// token is rotated on every use.
+func (s *AppState) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	sess, pair, err := s.refreshSession(req.RefreshToken, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	identity := AuthIdentity{UserID: sess.UserID, Username: sess.Username, Role: sess.Role}
+	if sess.UserID != "" {
+		if u, err := getUserByID(dbWriter.GetDB(), sess.UserID); err == nil {
+			identity.Username = u.Username
+			identity.Role = u.Role
+		}
+	}
+
+	c.JSON(http.StatusOK, newLoginResponse(pair, identity))
+}
+
+// Logout revokes the session of the current access token
+func (s *AppState) Logout(c *gin.Context) {
+	sessionID := c.GetString(ContextKeySessionID)
+	if sessionID != "" && sessionsEnabled() {
+		if err := dbWriter.WriteSync(func(db *sql.DB) error { return revokeSession(db, sessionID) }); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+	}
+
+	username := CurrentUsername(c)
+	LogAuditFromContext(c, AuditActionLogout, AuditCategoryAuth, "session", sessionID, username, "Logged out")
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
+}
+
+// GetSessions lists the active sessions of the current user.
+// Admins may pass ?all=true to list sessions of every user.
+func (s *AppState) GetSessions(c *gin.Context) {
+	if !sessionsEnabled() {
+		c.JSON(http.StatusOK, gin.H{"sessions": []Session{}})
+		return
+	}
+
+	var filter *AuthIdentity
+	if c.Query("all") != "true" || CurrentRole(c) != RoleAdmin {
+		filter = &AuthIdentity{UserID: c.GetString(ContextKeyUserID), Username: CurrentUsername(c)}
+	}
+
+	sessions, err := listActiveSessions(dbWriter.GetDB(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query sessions"})
+		return
+	}
+
+	current := c.GetString(ContextKeySessionID)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession revokes a session. Users may revoke their own sessions;
+// admins may revoke any session.
+func (s *AppState) RevokeSession(c *gin.Context) {
+	id := c.Param("id")
+
+	if !sessionsEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	sess, err := getSessionByID(dbWriter.GetDB(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	owned := sess.UserID == c.GetString(ContextKeyUserID) && sess.Username == CurrentUsername(c)
+	if !owned && CurrentRole(c) != RoleAdmin {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if sess.RevokedAt != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session already revoked"})
+		return
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return revokeSession(db, id) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionSessionRevoke, AuditCategoryAuth, "session", sess.ID, sess.Username,
+		fmt.Sprintf("Session revoked (ip %s, issued %s)", sess.IP, sess.IssuedAt))
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// revokeOtherSessions signs a user out everywhere except the current session
+func revokeOtherSessions(c *gin.Context, userID, username string) {
+	if !sessionsEnabled() {
+		return
+	}
+	current := c.GetString(ContextKeySessionID)
+	dbWriter.WriteSync(func(db *sql.DB) error {
+		_, err := revokeUserSessions(db, userID, username, current)
+		return err
+	})
+}
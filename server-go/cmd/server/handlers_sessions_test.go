@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSessions tests login sessions, refresh token rotation and revocation
+func TestSessions(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Close()
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	appState := createTestAppState(t, "password")
+	router := gin.New()
+	router.POST("/api/auth/login", appState.Login)
+	router.POST("/api/auth/refresh", appState.RefreshToken)
+	protected := router.Group("/")
+	protected.Use(AuthMiddleware())
+	protected.GET("/api/auth/me", appState.VerifyToken)
+	protected.POST("/api/auth/logout", appState.Logout)
+	protected.POST("/api/auth/password", appState.ChangePassword)
+	protected.GET("/api/auth/sessions", appState.GetSessions)
+
+	request := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	login := func(password string) LoginResponse {
+		t.Helper()
+		w := request("POST", "/api/auth/login", "", LoginRequest{Password: password})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp LoginResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if resp.RefreshToken == "" {
+			t.Fatal("Expected refresh token in response")
+		}
+		return resp
+	}
+
+	t.Run("Refresh rotates the refresh token", func(t *testing.T) {
+		first := login("password")
+
+		w := request("POST", "/api/auth/refresh", "", gin.H{"refresh_token": first.RefreshToken})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var refreshed LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &refreshed)
+		if refreshed.RefreshToken == first.RefreshToken {
+			t.Error("Expected a new refresh token")
+		}
+		if code := request("GET", "/api/auth/me", refreshed.Token, nil).Code; code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+
+		if code := request("POST", "/api/auth/refresh", "", gin.H{"refresh_token": first.RefreshToken}).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected reused refresh token to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("Logout revokes the session", func(t *testing.T) {
+		resp := login("password")
+
+		if code := request("POST", "/api/auth/logout", resp.Token, nil).Code; code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+		}
+		if code := request("GET", "/api/auth/me", resp.Token, nil).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+		if code := request("POST", "/api/auth/refresh", "", gin.H{"refresh_token": resp.RefreshToken}).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("Password change revokes other sessions", func(t *testing.T) {
+		current := login("password")
+		other := login("password")
+
+		w := request("POST", "/api/auth/password", current.Token, ChangePasswordRequest{CurrentPassword: "password", NewPassword: "newpassword"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		if code := request("GET", "/api/auth/me", other.Token, nil).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected other session to be revoked, got %d", code)
+		}
+		if code := request("GET", "/api/auth/me", current.Token, nil).Code; code != http.StatusOK {
+			t.Errorf("Expected current session to remain valid, got %d", code)
+		}
+
+		w = request("GET", "/api/auth/sessions", current.Token, nil)
+		var listed struct {
+			Sessions []Session `json:"sessions"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &listed)
+		if len(listed.Sessions) != 1 || !listed.Sessions[0].Current {
+			t.Errorf("Expected only the current session to be listed, got %+v", listed.Sessions)
+		}
+	})
+
+	t.Run("Token without session is rejected", func(t *testing.T) {
+		token, _, _ := generateJWTToken(builtinAdminIdentity(), "", "", time.Hour)
+		if code := request("GET", "/api/auth/me", token, nil).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+}
+
+// TestRedirectWithToken tests that SSO logins hand over the tokens in the URL
+// fragment, which is never sent to servers
+func TestRedirectWithToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/auth/oauth/github/callback", nil)
+
+	expires := time.Now().Add(time.Hour)
+	redirectWithToken(c, &TokenPair{AccessToken: "access", AccessExpiresAt: expires, RefreshToken: "refresh+token"}, "github", "jane doe")
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect: %v", err)
+	}
+	if location.Path != "/oauth-callback" || location.RawQuery != "" {
+		t.Errorf("Expected no query string, got %s", location)
+	}
+	fragment, _ := url.ParseQuery(location.EscapedFragment())
+	if fragment.Get("token") != "access" || fragment.Get("refresh") != "refresh+token" || fragment.Get("user") != "jane doe" || fragment.Get("provider") != "github" || fragment.Get("expires") != strconv.FormatInt(expires.Unix(), 10) {
+		t.Errorf("Unexpected fragment %q", location.EscapedFragment())
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"log"
 	"net/http"
 
-	"vstats/internal/common"
-
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,7 +27,7 @@ func (s *AppState) UpdateSiteSettings(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	s.Config.SiteSettings = settings
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	// Broadcast the updated settings to all connected dashboard clients
@@ -78,41 +76,54 @@ func (s *AppState) UpdateProbeSettings(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if err := validatePingTargets(settings.PingTargets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	s.ConfigMu.Lock()
 	s.Config.ProbeSettings = settings
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	// Broadcast new ping targets to all connected agents
-	s.BroadcastPingTargets(settings.PingTargets)
+	s.BroadcastPingTargets()
 
 	LogAuditFromContext(c, AuditActionProbeSettingsUpdate, AuditCategorySettings, "settings", "probe", "Probe Settings", "Probe settings updated")
 
 	c.Status(http.StatusOK)
 }
 
-// BroadcastPingTargets sends updated ping targets to all connected agents
-func (s *AppState) BroadcastPingTargets(targets []common.PingTargetConfig) {
-	msg := map[string]interface{}{
-		"type":         "config",
-		"ping_targets": targets,
-	}
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal ping targets: %v", err)
-		return
-	}
+// BroadcastPingTargets sends each agent the ping targets assigned to it,
+// through the node that holds its connection. Must be called without
+// holding ConfigMu.
+func (s *AppState) BroadcastPingTargets() {
+	s.sendPingTargets(s.SendToAgent)
+}
 
-	s.AgentConnsMu.RLock()
-	defer s.AgentConnsMu.RUnlock()
+// sendPingTargets builds the ping targets of every server and hands them to send
+func (s *AppState) sendPingTargets(send func(serverID string, data []byte) error) {
+	messages := make(map[string][]byte)
+	s.ConfigMu.RLock()
+	for _, server := range s.Config.Servers {
+		msg := map[string]interface{}{
+			"type":         "config",
+			"ping_targets": pingTargetsFor(s.Config, server),
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("Failed to marshal ping targets: %v", err)
+			continue
+		}
+		messages[server.ID] = data
+	}
+	s.ConfigMu.RUnlock()
 
-	for serverID, conn := range s.AgentConns {
-		select {
-		case conn.SendChan <- data:
+	for serverID, data := range messages {
+		if err := send(serverID, data); err == nil {
 			log.Printf("Sent ping targets update to agent %s", serverID)
-		default:
-			log.Printf("Failed to send ping targets to agent %s (channel full)", serverID)
+		} else if err != ErrAgentNotConnected {
+			log.Printf("Failed to send ping targets to agent %s: %v", serverID, err)
 		}
 	}
 }
@@ -141,7 +152,7 @@ func (s *AppState) UpdateAffProviders(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	s.Config.AffProviders = providers
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionSettingsUpdate, AuditCategorySettings, "settings", "aff_providers", "Aff Providers", "Affiliate providers updated")
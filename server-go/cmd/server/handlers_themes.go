@@ -230,7 +230,7 @@ func (s *AppState) InstallTheme(c *gin.Context) {
 		s.Config.InstalledThemes = append(s.Config.InstalledThemes, installedTheme)
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	LogAuditFromContext(c, AuditActionThemeInstall, AuditCategorySettings, "theme", manifest.ID, manifest.Name, fmt.Sprintf("Theme installed from %s", req.Source))
@@ -278,7 +278,7 @@ func (s *AppState) UninstallTheme(c *gin.Context) {
 		s.Config.SiteSettings.Theme.ThemeId = "midnight"
 	}
 
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 
 	LogAuditFromContext(c, AuditActionThemeUninstall, AuditCategorySettings, "theme", themeID, themeName, "Theme uninstalled")
 
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// API Token Handlers
+// ============================================================================
+
+// GetAPITokens lists all API tokens (never returns token values)
+func (s *AppState) GetAPITokens(c *gin.Context) {
+	tokens, err := listAPITokens(dbWriter.GetDB())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"scopes": APITokenScopes,
+	})
+}
+
+// CreateAPIToken creates a new API token owned by the current user.
+// The raw token is only returned once in the response.
+func (s *AppState) CreateAPIToken(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		Role          UserRole `json:"role,omitempty"`            // Defaults to the creator's role
+		ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 = never expires
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !IsValidAPITokenScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiry"})
+		return
+	}
+
+	creatorRole := CurrentRole(c)
+	role := req.Role
+	if role == "" {
+		role = creatorRole
+	}
+	if !IsValidRole(role) || !RoleAtLeast(creatorRole, role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role cannot exceed your own role"})
+		return
+	}
+
+	raw := generateAPIToken()
+	now := time.Now().UTC()
+	token := &APIToken{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    raw[:len(APITokenPrefix)+6],
+		TokenHash: hashAPIToken(raw),
+		Scopes:    req.Scopes,
+		UserID:    c.GetString(ContextKeyUserID),
+		Username:  CurrentUsername(c),
+		Role:      role,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if req.ExpiresInDays > 0 {
+		token.ExpiresAt = now.Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour).Format(time.RFC3339)
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return insertAPIToken(db, token) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionAPITokenCreate, AuditCategoryAuth, "api_token", token.ID, token.Name,
+		fmt.Sprintf("API token created with role %s and scopes %s", token.Role, strings.Join(token.Scopes, ",")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     raw,
+		"api_token": token,
+	})
+}
+
+// RevokeAPIToken revokes an API token
+func (s *AppState) RevokeAPIToken(c *gin.Context) {
+	id := c.Param("id")
+
+	token, err := getAPITokenByID(dbWriter.GetDB(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return revokeAPIToken(db, id) }); err != nil {
+		if err == ErrAPITokenNotFound {
+			c.JSON(http.StatusConflict, gin.H{"error": "Token already revoked"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionAPITokenRevoke, AuditCategoryAuth, "api_token", token.ID, token.Name, "API token revoked")
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
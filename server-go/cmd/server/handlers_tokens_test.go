@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAPITokens tests creating, using and revoking API tokens
+func TestAPITokens(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Close()
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	appState := createTestAppState(t, "password")
+	router := gin.New()
+	protected := router.Group("/")
+	protected.Use(AuthMiddleware())
+	protected.GET("/api/traffic/stats", func(c *gin.Context) { c.Status(http.StatusOK) })
+	protected.POST("/api/servers", RequireRole(RoleOperator), func(c *gin.Context) { c.Status(http.StatusOK) })
+	protected.POST("/api/tokens", RequireRole(RoleAdmin), appState.CreateAPIToken)
+	protected.DELETE("/api/tokens/:id", RequireRole(RoleAdmin), appState.RevokeAPIToken)
+	protected.POST("/api/users", RequireRole(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	protected.PUT("/api/settings/site", RequireRole(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	pair, err := appState.issueSession(builtinAdminIdentity(), "", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	adminJWT := pair.AccessToken
+
+	request := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/tokens", adminJWT, gin.H{"name": "onboarding", "scopes": []string{"traffic:write"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var created struct {
+		Token    string   `json:"token"`
+		APIToken APIToken `json:"api_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	t.Run("Token is hashed at rest", func(t *testing.T) {
+		var stored string
+		helper.db.QueryRow("SELECT token_hash FROM api_tokens WHERE id = ?", created.APIToken.ID).Scan(&stored)
+		if stored == created.Token || stored != hashAPIToken(created.Token) {
+			t.Error("Expected token to be stored as a hash")
+		}
+	})
+
+	t.Run("Write scope implies read", func(t *testing.T) {
+		if code := request("GET", "/api/traffic/stats", created.Token, nil).Code; code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+	})
+
+	t.Run("Out of scope request is rejected", func(t *testing.T) {
+		if code := request("POST", "/api/servers", created.Token, nil).Code; code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, code)
+		}
+		if code := request("POST", "/api/tokens", created.Token, gin.H{"name": "x", "scopes": []string{"alerts:read"}}).Code; code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("Settings scope does not reach users", func(t *testing.T) {
+		w := request("POST", "/api/tokens", adminJWT, gin.H{"name": "settings", "scopes": []string{"settings:write"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var settings struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &settings)
+
+		if code := request("PUT", "/api/settings/site", settings.Token, nil).Code; code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+		if code := request("POST", "/api/users", settings.Token, gin.H{"username": "mallory", "password": "password123"}).Code; code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, code)
+		}
+		for _, route := range []string{"/api/users", "/api/sso/bindings", "/api/settings/oauth"} {
+			if scope := apiTokenScopeForRoute("PUT", route); scope != "" {
+				t.Errorf("Expected %s to be out of reach of tokens, got scope %s", route, scope)
+			}
+		}
+	})
+
+	t.Run("Revoked token is rejected", func(t *testing.T) {
+		if code := request("DELETE", "/api/tokens/"+created.APIToken.ID, adminJWT, nil).Code; code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+		}
+		if code := request("GET", "/api/traffic/stats", created.Token, nil).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ============================================================================
+// Two-Factor Authentication Handlers
+// ============================================================================
+
+// hasPasswordAccount reports whether an identity logs in with a password.
+// Two-factor authentication only applies to password logins.
+func hasPasswordAccount(identity AuthIdentity) bool {
+	if isSSOUsername(identity.Username) {
+		return false
+	}
+	return identity.UserID != "" || identity.Username == BuiltinAdminUsername
+}
+
+// verifyAccountPassword checks the password of the built-in admin or a database user
+func (s *AppState) verifyAccountPassword(identity AuthIdentity, password string) bool {
+	var hash string
+	if identity.UserID == "" {
+		s.ConfigMu.RLock()
+		hash = s.Config.AdminPasswordHash
+		s.ConfigMu.RUnlock()
+	} else {
+		u, err := getUserByID(dbWriter.GetDB(), identity.UserID)
+		if err != nil {
+			return false
+		}
+		hash = u.PasswordHash
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// auditTargetID returns the audit target ID of an account
+func auditTargetID(identity AuthIdentity) string {
+	if identity.UserID != "" {
+		return identity.UserID
+	}
+	return identity.Username
+}
+
+// GetTwoFactorStatus returns the two-factor status of the current user
+func (s *AppState) GetTwoFactorStatus(c *gin.Context) {
+	identity := CurrentIdentity(c)
+
+	tf, err := getTwoFactor(dbWriter.GetDB(), identity.UserID, identity.Username)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"available": hasPasswordAccount(identity),
+			"enabled":   false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"available":                hasPasswordAccount(identity),
+		"enabled":                  tf.Enabled,
+		"enabled_at":               tf.EnabledAt,
+		"recovery_codes_remaining": len(tf.RecoveryCodes),
+	})
+}
+
+// EnrollTwoFactor starts enrollment by generating a new secret. The secret
+// only becomes active once a code is confirmed via ConfirmTwoFactor.
+func (s *AppState) EnrollTwoFactor(c *gin.Context) {
+	identity := CurrentIdentity(c)
+	if !hasPasswordAccount(identity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is only available for password accounts"})
+		return
+	}
+
+	if existing, err := getTwoFactor(dbWriter.GetDB(), identity.UserID, identity.Username); err == nil && existing.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	tf := &TwoFactor{
+		UserID:    identity.UserID,
+		Username:  identity.Username,
+		Secret:    generateTOTPSecret(),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return saveTwoFactor(db, tf) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      tf.Secret,
+		"otpauth_uri": totpURI(identity.Username, tf.Secret),
+	})
+}
+
+// ConfirmTwoFactor verifies the first code from the authenticator app,
+// enables two-factor authentication and returns the recovery codes
+func (s *AppState) ConfirmTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	identity := CurrentIdentity(c)
+	targetID := auditTargetID(identity)
+
+	tf, err := getTwoFactor(dbWriter.GetDB(), identity.UserID, identity.Username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enrollment has not been started"})
+		return
+	}
+	if tf.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := validateTOTP(tf.Secret, req.Code, time.Now(), 0)
+	if !ok {
+		LogAuditError(c, AuditAction2FAFail, AuditCategoryAuth, "user", targetID, identity.Username, "Two-factor enrollment", "Invalid code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes := generateRecoveryCodes()
+	tf.Enabled = true
+	tf.LastStep = step
+	tf.EnabledAt = time.Now().UTC().Format(time.RFC3339)
+	tf.RecoveryCodes = make([]string, len(codes))
+	for i, code := range codes {
+		tf.RecoveryCodes[i] = hashAPIToken(normalizeRecoveryCode(code))
+	}
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return saveTwoFactor(db, tf) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditAction2FAEnroll, AuditCategoryAuth, "user", targetID, identity.Username, "Two-factor authentication enabled")
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns off two-factor authentication for the current user.
+// Requires the account password and a current code.
+func (s *AppState) DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	identity := CurrentIdentity(c)
+	targetID := auditTargetID(identity)
+
+	if !s.verifyAccountPassword(identity, req.Password) {
+		LogAuditError(c, AuditAction2FADisable, AuditCategoryAuth, "user", targetID, identity.Username, "Two-factor disable attempt", "Invalid password")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if _, err := verifySecondFactor(identity, req.Code); err != nil {
+		LogAuditError(c, AuditAction2FAFail, AuditCategoryAuth, "user", targetID, identity.Username, "Two-factor disable attempt", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		_, err := deleteTwoFactor(db, identity.UserID, identity.Username)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditAction2FADisable, AuditCategoryAuth, "user", targetID, identity.Username, "Two-factor authentication disabled")
+
+	c.JSON(http.StatusOK, gin.H{"status": "disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the current user
+func (s *AppState) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	identity := CurrentIdentity(c)
+	targetID := auditTargetID(identity)
+
+	if _, err := verifySecondFactor(identity, req.Code); err != nil {
+		LogAuditError(c, AuditAction2FAFail, AuditCategoryAuth, "user", targetID, identity.Username, "Recovery code regeneration", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes := generateRecoveryCodes()
+	err := dbWriter.WriteSync(func(db *sql.DB) error {
+		tf, err := getTwoFactor(db, identity.UserID, identity.Username)
+		if err != nil {
+			return err
+		}
+		tf.RecoveryCodes = make([]string, len(codes))
+		for i, code := range codes {
+			tf.RecoveryCodes[i] = hashAPIToken(normalizeRecoveryCode(code))
+		}
+		return saveTwoFactor(db, tf)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditAction2FAEnroll, AuditCategoryAuth, "user", targetID, identity.Username, "Recovery codes regenerated")
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginTwoFactor completes a password login with a TOTP or recovery code
+func (s *AppState) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	identity, challengeID, err := parseTwoFactorChallenge(req.Challenge)
+	if err != nil {
+		markAuthFailure(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge expired, please sign in again"})
+		return
+	}
+	c.Set(ContextKeyUsername, identity.Username)
+	targetID := auditTargetID(identity)
+
+	// Re-check database users in case they were disabled in the meantime
+	if identity.UserID != "" {
+		u, err := getUserByID(dbWriter.GetDB(), identity.UserID)
+		if err != nil || u.Disabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+		identity.Username = u.Username
+		identity.Role = u.Role
+	}
+
+	usedRecovery, err := verifySecondFactor(identity, req.Code)
+	if err != nil {
+		LogAuditError(c, AuditAction2FAFail, AuditCategoryAuth, "user", targetID, identity.Username, "Two-factor login attempt", err.Error())
+		markAuthFailure(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	finishTwoFactorChallenge(challengeID)
+
+	details := "Two-factor code verified"
+	if usedRecovery {
+		details = "Recovery code used"
+		if tf, err := getTwoFactor(dbWriter.GetDB(), identity.UserID, identity.Username); err == nil {
+			details = fmt.Sprintf("Recovery code used, %d remaining", len(tf.RecoveryCodes))
+		}
+	}
+	LogAuditFromContext(c, AuditAction2FAVerify, AuditCategoryAuth, "user", targetID, identity.Username, details)
+
+	pair, err := s.issueSession(identity, "", c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	markAuthSuccess(c)
+	touchUserLogin(identity.UserID)
+	LogAuditFromContext(c, AuditActionLogin, AuditCategoryAuth, "user", targetID, identity.Username,
+		"Password login successful ("+strings.ToLower(details)+")")
+
+	c.JSON(http.StatusOK, newLoginResponse(pair, identity))
+}
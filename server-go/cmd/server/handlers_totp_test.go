@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestTOTPCode tests code generation against the RFC 6238 test vectors
+func TestTOTPCode(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("At %d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+
+	t.Run("Replay is rejected", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		step, ok := validateTOTP(secret, "005924", now, 0)
+		if !ok {
+			t.Fatal("Expected code to be valid")
+		}
+		if _, ok := validateTOTP(secret, "005924", now, step); ok {
+			t.Error("Expected reused code to be rejected")
+		}
+	})
+}
+
+// TestTwoFactorLogin tests enrollment and the two-step login flow
+func TestTwoFactorLogin(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Close()
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	appState := createTestAppState(t, "password")
+	router := gin.New()
+	router.POST("/api/auth/login", appState.Login)
+	router.POST("/api/auth/login/2fa", appState.LoginTwoFactor)
+	protected := router.Group("/")
+	protected.Use(AuthMiddleware())
+	protected.POST("/api/auth/2fa/enroll", appState.EnrollTwoFactor)
+	protected.POST("/api/auth/2fa/verify", appState.ConfirmTwoFactor)
+
+	request := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest("POST", path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	login := func() LoginResponse {
+		t.Helper()
+		w := request("/api/auth/login", "", LoginRequest{Password: "password"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	session := login()
+	if session.Token == "" || session.TwoFactorRequired {
+		t.Fatal("Expected a token before two-factor is enabled")
+	}
+
+	w := request("/api/auth/2fa/enroll", session.Token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+
+	// Confirm with the previous period's code so the current one stays usable
+	confirmCode, _ := totpCode(enrollment.Secret, time.Now().Unix()/totpPeriod-1)
+	w = request("/api/auth/2fa/verify", session.Token, gin.H{"code": confirmCode})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &confirmed)
+	if len(confirmed.RecoveryCodes) != totpRecoveryCodes {
+		t.Fatalf("Expected %d recovery codes, got %d", totpRecoveryCodes, len(confirmed.RecoveryCodes))
+	}
+
+	t.Run("Login requires a second factor", func(t *testing.T) {
+		resp := login()
+		if resp.Token != "" || !resp.TwoFactorRequired || resp.Challenge == "" {
+			t.Fatalf("Expected a two-factor challenge, got %+v", resp)
+		}
+
+		if code := request("/api/auth/login/2fa", "", TwoFactorLoginRequest{Challenge: resp.Challenge, Code: "000000"}).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+
+		current, _ := totpCode(enrollment.Secret, time.Now().Unix()/totpPeriod)
+		w := request("/api/auth/login/2fa", "", TwoFactorLoginRequest{Challenge: resp.Challenge, Code: current})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var done LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &done)
+		if done.Token == "" {
+			t.Error("Expected token after second factor")
+		}
+
+		if code := request("/api/auth/login/2fa", "", TwoFactorLoginRequest{Challenge: resp.Challenge, Code: current}).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected used challenge to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("Recovery codes are single use", func(t *testing.T) {
+		recovery := confirmed.RecoveryCodes[0]
+
+		resp := login()
+		if code := request("/api/auth/login/2fa", "", TwoFactorLoginRequest{Challenge: resp.Challenge, Code: recovery}).Code; code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+		}
+
+		resp = login()
+		if code := request("/api/auth/login/2fa", "", TwoFactorLoginRequest{Challenge: resp.Challenge, Code: recovery}).Code; code != http.StatusUnauthorized {
+			t.Errorf("Expected reused recovery code to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("Unbound SSO identities cannot enroll", func(t *testing.T) {
+		pair, err := appState.issueSession(AuthIdentity{Username: ssoUsername("github", "admin"), Role: RoleViewer}, "github", "", "")
+		if err != nil {
+			t.Fatalf("issueSession failed: %v", err)
+		}
+		if code := request("/api/auth/2fa/enroll", pair.AccessToken, nil).Code; code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+		if tf, err := getTwoFactor(helper.db, "", BuiltinAdminUsername); err != nil || tf.Secret != enrollment.Secret {
+			t.Errorf("Expected the admin enrollment to be unchanged, got %+v (%v)", tf, err)
+		}
+	})
+}
@@ -129,7 +129,7 @@ func (s *AppState) UpdateTrafficLimit(c *gin.Context) {
 				},
 			)
 		}
-		SaveConfig(s.Config)
+		SaveConfigFrom(c, s.Config)
 	}
 	s.ConfigMu.Unlock()
 
@@ -155,17 +155,12 @@ func (s *AppState) SendTrafficConfigToAgent(serverID string, monthlyLimitGB floa
 		return
 	}
 
-	s.AgentConnsMu.RLock()
-	conn := s.AgentConns[serverID]
-	s.AgentConnsMu.RUnlock()
-
-	if conn != nil {
-		select {
-		case conn.SendChan <- data:
-			log.Printf("Sent traffic config update to agent %s", serverID)
-		default:
-			log.Printf("Failed to send traffic config to agent %s (channel full)", serverID)
-		}
+	switch err := s.SendToAgent(serverID, data); err {
+	case nil:
+		log.Printf("Sent traffic config update to agent %s", serverID)
+	case ErrAgentNotConnected:
+	default:
+		log.Printf("Failed to send traffic config to agent %s: %v", serverID, err)
 	}
 }
 
@@ -366,7 +361,7 @@ func (s *AppState) BatchUpdateTrafficLimits(c *gin.Context) {
 		})
 	}
 	s.Config.AlertConfig.Rules.Traffic.Limits = newLimits
-	SaveConfig(s.Config)
+	SaveConfigFrom(c, s.Config)
 	s.ConfigMu.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "count": len(newLimits)})
@@ -395,7 +390,7 @@ func (s *AppState) DeleteTrafficLimit(c *gin.Context) {
 			}
 		}
 		s.Config.AlertConfig.Rules.Traffic.Limits = limits
-		SaveConfig(s.Config)
+		SaveConfigFrom(c, s.Config)
 	}
 	s.ConfigMu.Unlock()
 
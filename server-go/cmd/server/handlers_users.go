@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ============================================================================
+// User Management Handlers
+// ============================================================================
+
+// GetUsers returns all database users (the built-in admin is listed first)
+func (s *AppState) GetUsers(c *gin.Context) {
+	users, err := listUsers(dbWriter.GetDB())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"builtin_admin": BuiltinAdminUsername,
+		"users":         users,
+	})
+}
+
+// AddUser creates a new user
+func (s *AppState) AddUser(c *gin.Context) {
+	var req struct {
+		Username string   `json:"username" binding:"required"`
+		Password string   `json:"password" binding:"required"`
+		Role     UserRole `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" || strings.EqualFold(username, BuiltinAdminUsername) || isSSOUsername(username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or reserved username"})
+		return
+	}
+	if !IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Must be: admin, operator, or viewer"})
+		return
+	}
+	if lookupUser(username) != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	user := &User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         req.Role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return insertUser(db, user) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionUserCreate, AuditCategoryAuth, "user", user.ID, user.Username, fmt.Sprintf("User created with role %s", user.Role))
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser changes a user's role, status or password
+func (s *AppState) UpdateUser(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Role     *UserRole `json:"role,omitempty"`
+		Disabled *bool     `json:"disabled,omitempty"`
+		Password string    `json:"password,omitempty"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, err := getUserByID(dbWriter.GetDB(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	changes := []string{}
+	if req.Role != nil {
+		if !IsValidRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Must be: admin, operator, or viewer"})
+			return
+		}
+		if *req.Role != user.Role {
+			changes = append(changes, fmt.Sprintf("role %s -> %s", user.Role, *req.Role))
+			user.Role = *req.Role
+		}
+	}
+	if req.Disabled != nil && *req.Disabled != user.Disabled {
+		// Prevent locking yourself out
+		if *req.Disabled && c.GetString(ContextKeyUserID) == user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot disable your own account"})
+			return
+		}
+		user.Disabled = *req.Disabled
+		if user.Disabled {
+			changes = append(changes, "disabled")
+		} else {
+			changes = append(changes, "enabled")
+		}
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		user.PasswordHash = string(hash)
+		changes = append(changes, "password reset")
+	}
+
+	user.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := dbWriter.WriteSync(func(db *sql.DB) error { return updateUser(db, user) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if req.Password != "" || user.Disabled {
+		dbWriter.WriteAsync(func(db *sql.DB) error {
+			_, err := revokeUserSessions(db, user.ID, user.Username, "")
+			return err
+		})
+	}
+
+	LogAuditFromContext(c, AuditActionUserUpdate, AuditCategoryAuth, "user", user.ID, user.Username, "User updated: "+strings.Join(changes, ", "))
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser removes a user
+func (s *AppState) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+
+	if c.GetString(ContextKeyUserID) == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+
+	user, err := getUserByID(dbWriter.GetDB(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		if _, err := revokeUserSessions(db, id, user.Username, ""); err != nil {
+			return err
+		}
+		return deleteUser(db, id)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	LogAuditFromContext(c, AuditActionUserDelete, AuditCategoryAuth, "user", user.ID, user.Username, "User deleted")
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
@@ -39,6 +39,13 @@ func main() {
 			fmt.Printf("║  Config file: %-47s ║\n", GetConfigPath())
 			fmt.Println("╚════════════════════════════════════════════════════════════════╝")
 
+			// Sign out every existing admin session
+			if n, err := RevokeAdminSessionsOffline(); err != nil {
+				fmt.Printf("\n⚠️  Failed to revoke admin sessions: %v\n", err)
+			} else if n > 0 {
+				fmt.Printf("\n🔒 Revoked %d admin session(s)\n", n)
+			}
+
 			// Try to signal running server to reload config
 			if err := findAndSignalServer(); err != nil {
 				fmt.Printf("\n⚠️  %v\n", err)
@@ -74,6 +81,25 @@ func main() {
 				fmt.Println("\n✅ Server has been notified to reload the new password.")
 			}
 			return
+		case "--disable-2fa":
+			// Emergency recovery when the authenticator device is lost
+			username := BuiltinAdminUsername
+			if len(args) > 1 {
+				username = args[1]
+			}
+			n, err := DisableTwoFactorOffline(username)
+			if err != nil {
+				fmt.Printf("❌ Failed to disable two-factor authentication: %v\n", err)
+				os.Exit(1)
+			}
+			if n == 0 {
+				fmt.Printf("ℹ️  Two-factor authentication is not enabled for %s\n", username)
+				return
+			}
+			fmt.Printf("✅ Two-factor authentication disabled for %s\n", username)
+			return
+		case "migrate":
+			os.Exit(runMigrateCommand(args[1:]))
 		}
 	}
 
@@ -90,6 +116,10 @@ func main() {
 	dbWriter = NewDBWriter(db, 100)
 	defer dbWriter.Close()
 
+	// Shared settings are stored in the database with revision history
+	configStore = NewConfigStore(db)
+	silenceStore = NewSilenceStore(db)
+
 	// Initialize metrics buffer for batched real-time metrics writes
 	// Flush every 1 second or when buffer reaches 1000 items
 	metricsBuffer = NewMetricsBuffer(1*time.Second, 1000)
@@ -103,7 +133,7 @@ func main() {
 	// Initialize history cache with 10 second TTL
 	InitHistoryCache(10 * time.Second)
 
-	fmt.Printf("📦 Database initialized: %s\n", GetDBPath())
+	fmt.Printf("📦 Database initialized: %s\n", databaseLabel)
 	fmt.Printf("⚙️  Config file: %s\n", GetConfigPath())
 
 	// Load config
@@ -127,8 +157,9 @@ func main() {
 		AgentConns:       make(map[string]*AgentConnection),
 		LastSent: &LastSentState{
 			Servers: make(map[string]*struct {
-				Online  bool
-				Metrics *CompactMetrics
+				Online      bool
+				Maintenance bool
+				Metrics     *CompactMetrics
 			}),
 		},
 		DashboardClients: make(map[*websocket.Conn]*DashboardClient),
@@ -138,6 +169,26 @@ func main() {
 	// Setup signal handler for config reload (SIGHUP)
 	SetupSignalHandler(state)
 
+	// Join the cluster when Redis is configured
+	if clusterConfig := loadClusterConfig(config); clusterConfig.RedisURL != "" {
+		if sqlDialect.Name() != DatabaseDriverPostgres {
+			fmt.Println("⚠️  Cluster mode needs a shared PostgreSQL database; replicas will not see each other's history")
+		}
+		c, err := NewCluster(clusterConfig, state)
+		if err != nil {
+			fmt.Printf("Failed to connect to Redis: %v\n", err)
+			os.Exit(1)
+		}
+		cluster = c
+		registerClusterHandlers(cluster, state)
+		if err := cluster.Start(); err != nil {
+			fmt.Printf("Failed to join cluster: %v\n", err)
+			os.Exit(1)
+		}
+		defer cluster.Close()
+		fmt.Printf("🔗 Cluster mode enabled, node %s (leader: %s)\n", cluster.NodeID(), boolToStr(cluster.IsLeader()))
+	}
+
 	// Start pprof server for profiling (only in dev or when VSTATS_PPROF is set)
 	if os.Getenv("VSTATS_PPROF") != "" {
 		pprofAddr := os.Getenv("VSTATS_PPROF")
@@ -171,6 +222,11 @@ func main() {
 	alertEngine.Start()
 	defer alertEngine.Stop()
 
+	// Start driving staged agent rollouts
+	rolloutManager = NewRolloutManager(state, db)
+	rolloutManager.Start()
+	defer rolloutManager.Stop()
+
 	// Initialize GeoIP service
 	geoipService := GetGeoIPService()
 	if err := geoipService.Initialize(config.GeoIPConfig); err != nil {
@@ -232,24 +288,28 @@ func main() {
 	r.GET("/api/wallpaper/proxy", GetCustomWallpaper)
 	r.GET("/api/wallpaper/proxy/image", GetCustomWallpaperImage)
 	r.GET("/api/aff-providers", state.GetAffProvidersPublic) // Public: get enabled aff providers for dashboard
-	r.POST("/api/auth/login", state.Login)
+	r.GET("/api/alerts/:id/ack/link", state.AcknowledgeAlertLink) // Public: signed acknowledge links from notifications
+	r.POST("/api/alerts/:id/ack/link", state.AcknowledgeAlertLink)
+	r.POST("/api/auth/login", state.AuthRateLimit(AuthScopeLogin), state.Login)
+	r.POST("/api/auth/login/2fa", state.AuthRateLimit(AuthScopeLogin), state.LoginTwoFactor)
+	r.POST("/api/auth/refresh", state.RefreshToken)
 	r.GET("/api/auth/verify", AuthMiddleware(), state.VerifyToken)
 
 	// OAuth 2.0 routes (public)
 	r.GET("/api/auth/oauth/providers", state.GetOAuthProvidersExtended) // Extended version with OIDC/CF support
 	r.GET("/api/auth/oauth/github", state.GitHubOAuthStart)
-	r.GET("/api/auth/oauth/github/callback", state.GitHubOAuthCallback)
+	r.GET("/api/auth/oauth/github/callback", state.AuthRateLimit(AuthScopeOAuth), state.GitHubOAuthCallback)
 	r.GET("/api/auth/oauth/google", state.GoogleOAuthStart)
-	r.GET("/api/auth/oauth/google/callback", state.GoogleOAuthCallback)
-	r.GET("/api/auth/oauth/proxy/callback", state.ProxyOAuthCallback) // Centralized OAuth callback
+	r.GET("/api/auth/oauth/google/callback", state.AuthRateLimit(AuthScopeOAuth), state.GoogleOAuthCallback)
+	r.GET("/api/auth/oauth/proxy/callback", state.AuthRateLimit(AuthScopeOAuth), state.ProxyOAuthCallback) // Centralized OAuth callback
 	// OIDC routes
 	r.GET("/api/auth/oauth/oidc/providers", state.GetOIDCProviders)
 	r.GET("/api/auth/oauth/oidc/:provider_id", state.OIDCOAuthStart)
-	r.GET("/api/auth/oauth/oidc/:provider_id/callback", state.OIDCOAuthCallback)
+	r.GET("/api/auth/oauth/oidc/:provider_id/callback", state.AuthRateLimit(AuthScopeOAuth), state.OIDCOAuthCallback)
 	// Cloudflare Access routes
 	r.GET("/api/auth/oauth/cloudflare", state.CloudflareAccessStart)
-	r.GET("/api/auth/oauth/cloudflare/callback", state.CloudflareAccessCallback)
-	r.GET("/api/install-command", AuthMiddleware(), state.GetInstallCommand)
+	r.GET("/api/auth/oauth/cloudflare/callback", state.AuthRateLimit(AuthScopeOAuth), state.CloudflareAccessCallback)
+	r.GET("/api/install-command", AuthMiddleware(), RequireRole(RoleOperator), state.GetInstallCommand)
 	r.GET("/api/version", GetServerVersion)
 	r.GET("/version", GetServerVersion)
 	r.GET("/api/version/check", CheckLatestVersion)
@@ -259,95 +319,163 @@ func main() {
 	r.GET("/agent-uninstall.ps1", state.GetAgentUninstallPowerShellScript)
 	r.GET("/ws", state.HandleDashboardWS)
 	r.GET("/ws/agent", state.HandleAgentWS)
+	r.GET("/metrics", state.PrometheusAuthMiddleware(), state.PrometheusMetrics) // Prometheus exporter (scrape token or JWT)
 
-	// Protected routes
+	// Protected routes (any authenticated user, read-only)
 	protected := r.Group("/")
 	protected.Use(AuthMiddleware())
 	{
-		protected.POST("/api/servers", state.AddServer)
-		protected.DELETE("/api/servers/:id", state.DeleteServer)
-		protected.PUT("/api/servers/:id", state.UpdateServer)
-		protected.POST("/api/servers/:id/update", state.UpdateAgent)
+		protected.GET("/api/auth/me", state.VerifyToken)
 		protected.POST("/api/auth/password", state.ChangePassword)
-		protected.POST("/api/agent/register", state.RegisterAgent)
-		protected.PUT("/api/settings/site", state.UpdateSiteSettings)
+		protected.POST("/api/auth/logout", state.Logout)
+		protected.GET("/api/auth/sessions", state.GetSessions)
+		protected.DELETE("/api/auth/sessions/:id", state.RevokeSession)
+		protected.GET("/api/auth/2fa", state.GetTwoFactorStatus)
+		protected.POST("/api/auth/2fa/enroll", state.EnrollTwoFactor)
+		protected.POST("/api/auth/2fa/verify", state.ConfirmTwoFactor)
+		protected.POST("/api/auth/2fa/disable", state.DisableTwoFactor)
+		protected.POST("/api/auth/2fa/recovery-codes", state.RegenerateRecoveryCodes)
 		protected.GET("/api/settings/probe", state.GetProbeSettings)
-		protected.PUT("/api/settings/probe", state.UpdateProbeSettings)
-		protected.POST("/api/server/upgrade", UpgradeServer)
-		// OAuth settings (admin only)
-		protected.GET("/api/settings/oauth", state.GetOAuthSettings)
-		protected.PUT("/api/settings/oauth", state.UpdateOAuthSettings)
-		// SSO binding management (admin only)
-		protected.GET("/api/sso/bindings", state.GetSSOBindings)
-		protected.POST("/api/sso/bindings", state.AddSSOBinding)
-		protected.DELETE("/api/sso/bindings/:provider", state.DeleteSSOBinding)
-		// Group management (GET is public, mutations are protected)
-		protected.POST("/api/groups", state.AddGroup)
-		protected.PUT("/api/groups/:id", state.UpdateGroup)
-		protected.DELETE("/api/groups/:id", state.DeleteGroup)
-		// Dimension management (GET is public, mutations are protected)
-		protected.POST("/api/dimensions", state.AddDimension)
-		protected.PUT("/api/dimensions/:id", state.UpdateDimension)
-		protected.DELETE("/api/dimensions/:id", state.DeleteDimension)
-		// Dimension options management
-		protected.POST("/api/dimensions/:id/options", state.AddOption)
-		protected.PUT("/api/dimensions/:id/options/:option_id", state.UpdateOption)
-		protected.DELETE("/api/dimensions/:id/options/:option_id", state.DeleteOption)
-		// Alert settings and management (admin only)
-		protected.GET("/api/settings/alerts", state.GetAlertConfig)
-		protected.PUT("/api/settings/alerts", state.UpdateAlertConfig)
-		protected.GET("/api/alerts/channels", state.GetChannels)
-		protected.POST("/api/alerts/channels", state.AddChannel)
-		protected.PUT("/api/alerts/channels/:id", state.UpdateChannel)
-		protected.DELETE("/api/alerts/channels/:id", state.DeleteChannel)
-		protected.POST("/api/alerts/channels/test", state.TestChannel)
 		protected.GET("/api/alerts", state.GetAlerts)
 		protected.GET("/api/alerts/history", state.GetAlertHistory)
-		protected.POST("/api/alerts/:id/mute", state.MuteAlert)
-		protected.PUT("/api/alerts/rules/offline", state.UpdateOfflineRule)
-		protected.PUT("/api/alerts/rules/load", state.UpdateLoadRule)
-		protected.PUT("/api/alerts/rules/traffic", state.UpdateTrafficRule)
+		protected.GET("/api/alerts/notifications", state.GetNotifications)
 		protected.GET("/api/alerts/templates", state.GetAlertTemplates)
-		protected.PUT("/api/alerts/templates/:key", state.UpdateAlertTemplate)
-		// Audit log management
-		protected.GET("/api/audit-logs", state.GetAuditLogs)
-		protected.GET("/api/audit-logs/export", state.ExportAuditLogs)
-		protected.GET("/api/audit-logs/stats", state.GetAuditLogStats)
-		protected.GET("/api/settings/audit-log", state.GetAuditLogSettings)
-		protected.PUT("/api/settings/audit-log", state.UpdateAuditLogSettings)
-		// GeoIP management
-		protected.GET("/api/settings/geoip", state.GetGeoIPConfig)
-		protected.PUT("/api/settings/geoip", state.UpdateGeoIPConfig)
+		protected.GET("/api/alerts/rules/custom", state.GetCustomRules)
+		protected.GET("/api/alerts/silences", state.GetSilences)
+		protected.GET("/api/alerts/routes", state.GetAlertRoutes)
+		protected.GET("/api/rollouts", state.GetRollouts)
+		protected.GET("/api/rollouts/:id", state.GetRollout)
+		protected.GET("/api/agent-profiles", state.GetAgentProfiles)
+		protected.GET("/api/servers/:id/agent-config", state.GetServerAgentConfig)
+		protected.GET("/api/servers/:id/update", state.GetAgentUpdateStatus)
 		protected.GET("/api/geoip/lookup", state.LookupGeoIP)
-		protected.POST("/api/geoip/lookup/batch", state.LookupGeoIPBatch)
-		protected.POST("/api/geoip/refresh", state.RefreshServerGeoIP)
-		// Theme management (GET /api/themes is public, see above)
-		protected.POST("/api/themes/install", state.InstallTheme)
-		protected.DELETE("/api/themes/:id", state.UninstallTheme)
-		protected.GET("/api/themes/:id/check-update", state.CheckThemeUpdate)
-		// Affiliate provider management
-		protected.GET("/api/settings/aff-providers", state.GetAffProviders)
-		protected.PUT("/api/settings/aff-providers", state.UpdateAffProviders)
-		protected.POST("/api/geoip/cache/clear", state.ClearGeoIPCache)
 		protected.GET("/api/servers/:id/geoip", state.GetServerGeoIP)
-		// Asset management
+		protected.GET("/api/themes/:id/check-update", state.CheckThemeUpdate)
+		// Asset overview
 		protected.GET("/api/assets/cost-statistics", state.GetCostStatistics)
 		protected.GET("/api/assets/expiring", state.GetExpiringServers)
-		protected.POST("/api/servers/import", state.ImportServers)
-		protected.POST("/api/servers/import/csv", state.ImportServersCSV)
-		protected.GET("/api/servers/export", state.ExportServers)
-		protected.PUT("/api/alerts/rules/expiry", state.UpdateExpiryRule)
-		// Traffic management
+		// Traffic overview
 		protected.GET("/api/traffic/summary", state.GetTrafficSummary)
 		protected.GET("/api/traffic/stats", state.GetTrafficStats)
 		protected.GET("/api/traffic/stats/:server_id", state.GetServerTrafficStats)
-		protected.PUT("/api/traffic/limit", state.UpdateTrafficLimit)
-		protected.POST("/api/traffic/reset", state.ResetServerTraffic)
 		protected.GET("/api/traffic/history/:server_id", state.GetTrafficHistory)
 		protected.GET("/api/traffic/daily/:server_id", state.GetTrafficDaily)
 		protected.GET("/api/traffic/limits", state.GetAllTrafficLimits)
-		protected.PUT("/api/traffic/limits/batch", state.BatchUpdateTrafficLimits)
-		protected.DELETE("/api/traffic/limits/:server_id", state.DeleteTrafficLimit)
+	}
+
+	// Operator routes (manage servers, groups, alerts and traffic)
+	operator := protected.Group("/")
+	operator.Use(RequireRole(RoleOperator))
+	{
+		operator.POST("/api/servers", state.AddServer)
+		operator.DELETE("/api/servers/:id", state.DeleteServer)
+		operator.PUT("/api/servers/:id", state.UpdateServer)
+		operator.POST("/api/servers/:id/update", state.UpdateAgent)
+		operator.POST("/api/rollouts", state.CreateRollout)
+		operator.POST("/api/rollouts/:id/resume", state.ResumeRollout)
+		operator.POST("/api/rollouts/:id/abort", state.AbortRollout)
+		operator.PUT("/api/agent-profiles", state.UpdateAgentProfiles)
+		operator.POST("/api/agent/register", state.RegisterAgent)
+		operator.POST("/api/servers/import", state.ImportServers)
+		operator.POST("/api/servers/import/csv", state.ImportServersCSV)
+		operator.GET("/api/servers/export", state.ExportServers)
+		// Group management (GET is public, mutations are protected)
+		operator.POST("/api/groups", state.AddGroup)
+		operator.PUT("/api/groups/:id", state.UpdateGroup)
+		operator.DELETE("/api/groups/:id", state.DeleteGroup)
+		// Dimension management (GET is public, mutations are protected)
+		operator.POST("/api/dimensions", state.AddDimension)
+		operator.PUT("/api/dimensions/:id", state.UpdateDimension)
+		operator.DELETE("/api/dimensions/:id", state.DeleteDimension)
+		// Dimension options management
+		operator.POST("/api/dimensions/:id/options", state.AddOption)
+		operator.PUT("/api/dimensions/:id/options/:option_id", state.UpdateOption)
+		operator.DELETE("/api/dimensions/:id/options/:option_id", state.DeleteOption)
+		// Alert operations
+		operator.POST("/api/alerts/:id/mute", state.MuteAlert)
+		operator.POST("/api/alerts/:id/ack", state.AcknowledgeAlert)
+		operator.DELETE("/api/alerts/:id/ack", state.UnacknowledgeAlert)
+		operator.POST("/api/alerts/notifications/:id/resend", state.ResendNotification)
+		operator.POST("/api/alerts/silences", state.CreateSilence)
+		operator.DELETE("/api/alerts/silences/:id", state.ExpireSilence)
+		operator.PUT("/api/alerts/rules/offline", state.UpdateOfflineRule)
+		operator.PUT("/api/alerts/rules/load", state.UpdateLoadRule)
+		operator.PUT("/api/alerts/rules/traffic", state.UpdateTrafficRule)
+		operator.PUT("/api/alerts/rules/anomaly", state.UpdateAnomalyRule)
+		operator.PUT("/api/alerts/rules/forecast", state.UpdateForecastRule)
+		operator.PUT("/api/alerts/rules/expiry", state.UpdateExpiryRule)
+		operator.PUT("/api/alerts/routes", state.UpdateAlertRoutes)
+		operator.POST("/api/alerts/rules/custom", state.AddCustomRule)
+		operator.POST("/api/alerts/rules/custom/preview", state.PreviewCustomRule)
+		operator.PUT("/api/alerts/rules/custom/:id", state.UpdateCustomRule)
+		operator.DELETE("/api/alerts/rules/custom/:id", state.DeleteCustomRule)
+		// GeoIP operations
+		operator.POST("/api/geoip/lookup/batch", state.LookupGeoIPBatch)
+		operator.POST("/api/geoip/refresh", state.RefreshServerGeoIP)
+		operator.POST("/api/geoip/cache/clear", state.ClearGeoIPCache)
+		// Traffic management
+		operator.PUT("/api/traffic/limit", state.UpdateTrafficLimit)
+		operator.POST("/api/traffic/reset", state.ResetServerTraffic)
+		operator.PUT("/api/traffic/limits/batch", state.BatchUpdateTrafficLimits)
+		operator.DELETE("/api/traffic/limits/:server_id", state.DeleteTrafficLimit)
+	}
+
+	// Admin routes (settings, users and system)
+	admin := protected.Group("/")
+	admin.Use(RequireRole(RoleAdmin))
+	{
+		admin.PUT("/api/settings/site", state.UpdateSiteSettings)
+		admin.PUT("/api/settings/probe", state.UpdateProbeSettings)
+		// Config revisions
+		admin.GET("/api/config/revisions", state.GetConfigRevisions)
+		admin.GET("/api/config/revisions/:id/diff", state.GetConfigRevisionDiff)
+		admin.POST("/api/config/revisions/:id/restore", state.RestoreConfigRevision)
+		admin.POST("/api/server/upgrade", UpgradeServer)
+		// User management
+		admin.GET("/api/users", state.GetUsers)
+		admin.POST("/api/users", state.AddUser)
+		admin.PUT("/api/users/:id", state.UpdateUser)
+		admin.DELETE("/api/users/:id", state.DeleteUser)
+		// API token management
+		admin.GET("/api/tokens", state.GetAPITokens)
+		admin.POST("/api/tokens", state.CreateAPIToken)
+		admin.DELETE("/api/tokens/:id", state.RevokeAPIToken)
+		// OAuth settings
+		admin.GET("/api/settings/oauth", state.GetOAuthSettings)
+		admin.PUT("/api/settings/oauth", state.UpdateOAuthSettings)
+		// SSO binding management
+		admin.GET("/api/sso/bindings", state.GetSSOBindings)
+		admin.POST("/api/sso/bindings", state.AddSSOBinding)
+		admin.DELETE("/api/sso/bindings/:provider", state.DeleteSSOBinding)
+		// Alert settings and notification channels
+		admin.GET("/api/settings/alerts", state.GetAlertConfig)
+		admin.PUT("/api/settings/alerts", state.UpdateAlertConfig)
+		admin.GET("/api/alerts/channels", state.GetChannels)
+		admin.POST("/api/alerts/channels", state.AddChannel)
+		admin.PUT("/api/alerts/channels/:id", state.UpdateChannel)
+		admin.DELETE("/api/alerts/channels/:id", state.DeleteChannel)
+		admin.POST("/api/alerts/channels/test", state.TestChannel)
+		admin.PUT("/api/alerts/templates/:key", state.UpdateAlertTemplate)
+		// Audit log management
+		admin.GET("/api/audit-logs", state.GetAuditLogs)
+		admin.GET("/api/audit-logs/export", state.ExportAuditLogs)
+		admin.GET("/api/audit-logs/stats", state.GetAuditLogStats)
+		admin.GET("/api/settings/audit-log", state.GetAuditLogSettings)
+		admin.PUT("/api/settings/audit-log", state.UpdateAuditLogSettings)
+		// GeoIP settings
+		admin.GET("/api/settings/geoip", state.GetGeoIPConfig)
+		admin.PUT("/api/settings/geoip", state.UpdateGeoIPConfig)
+		// Theme management (GET /api/themes is public, see above)
+		admin.POST("/api/themes/install", state.InstallTheme)
+		admin.DELETE("/api/themes/:id", state.UninstallTheme)
+		// Affiliate provider management
+		admin.GET("/api/settings/aff-providers", state.GetAffProviders)
+		admin.PUT("/api/settings/aff-providers", state.UpdateAffProviders)
+		// Prometheus exporter settings
+		admin.GET("/api/settings/prometheus", state.GetPrometheusSettings)
+		admin.PUT("/api/settings/prometheus", state.UpdatePrometheusSettings)
+		admin.GET("/api/settings/login-protection", state.GetLoginProtectionSettings)
+		admin.PUT("/api/settings/login-protection", state.UpdateLoginProtectionSettings)
 	}
 
 	// Static file serving
@@ -605,12 +733,14 @@ func metricsBroadcastLoop(state *AppState) {
 		var deltaUpdates []CompactServerUpdate
 
 		// Check remote servers
+		now := time.Now()
 		for _, server := range config.Servers {
 			metricsData := agentMetrics[server.ID]
 			online := false
 			if metricsData != nil {
 				online = time.Since(metricsData.LastUpdated).Seconds() < 30
 			}
+			maintenance := serverInMaintenance(server, config.GroupDimensions, now)
 
 			currentMetrics := &CompactMetrics{}
 			if metricsData != nil {
@@ -622,18 +752,21 @@ func metricsBroadcastLoop(state *AppState) {
 			state.LastSentMu.Unlock()
 
 			prevOnline := false
+			prevMaintenance := false
 			var prevMetrics *CompactMetrics
 			if prev != nil {
 				prevOnline = prev.Online
+				prevMaintenance = prev.Maintenance
 				prevMetrics = prev.Metrics
 			} else {
 				prevMetrics = &CompactMetrics{}
 			}
 
 			onlineChanged := online != prevOnline
+			maintenanceChanged := maintenance != prevMaintenance
 			metricsChanged := online && currentMetrics.HasChanged(prevMetrics)
 
-			if onlineChanged || metricsChanged {
+			if onlineChanged || maintenanceChanged || metricsChanged {
 				update := CompactServerUpdate{
 					ID: server.ID,
 				}
@@ -642,21 +775,27 @@ func metricsBroadcastLoop(state *AppState) {
 					update.On = &online
 				}
 
+				if maintenanceChanged {
+					update.Mt = &maintenance
+				}
+
 				if metricsChanged && online {
 					update.M = currentMetrics.Diff(prevMetrics)
 				}
 
-				if update.On != nil || (update.M != nil && !update.M.IsEmpty()) {
+				if update.On != nil || update.Mt != nil || (update.M != nil && !update.M.IsEmpty()) {
 					deltaUpdates = append(deltaUpdates, update)
 				}
 
 				state.LastSentMu.Lock()
 				state.LastSent.Servers[server.ID] = &struct {
-					Online  bool
-					Metrics *CompactMetrics
+					Online      bool
+					Maintenance bool
+					Metrics     *CompactMetrics
 				}{
-					Online:  online,
-					Metrics: currentMetrics,
+					Online:      online,
+					Maintenance: maintenance,
+					Metrics:     currentMetrics,
 				}
 				state.LastSentMu.Unlock()
 			}
@@ -689,6 +828,10 @@ func cleanupLoop(db *sql.DB) {
 	defer ticker.Stop()
 
 	for range ticker.C {
+		// Only the cluster leader prunes shared tables
+		if !isLeader() {
+			continue
+		}
 		if err := CleanupOldData(db); err != nil {
 			fmt.Printf("Failed to cleanup old data: %v\n", err)
 		}
@@ -696,6 +839,7 @@ func cleanupLoop(db *sql.DB) {
 		if err := CleanupAuditLogs(db, 30); err != nil {
 			fmt.Printf("Failed to cleanup audit logs: %v\n", err)
 		}
+		CleanupSessions(db)
 	}
 }
 
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Schema Migrations
+// ============================================================================
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// Migration is one ordered schema change. The SQL comes from
+// migrations/NNNN_name.sql and is adapted by sqlDialect.DDL. Prepare, when
+// set, runs first in the same transaction for steps that need Go.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	Prepare func(tx *sql.Tx) error
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	AppliedAt string `json:"applied_at,omitempty"` // empty while pending
+}
+
+// MigrationError identifies the migration and statement that failed
+type MigrationError struct {
+	Version   int
+	Name      string
+	Statement string // empty when the failure is not in the SQL file
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	msg := fmt.Sprintf("migration %04d_%s failed: %v", e.Version, e.Name, e.Err)
+	if e.Statement != "" {
+		msg += "\n  in statement: " + summarizeStatement(e.Statement)
+	}
+	return msg
+}
+
+func (e *MigrationError) Unwrap() error { return e.Err }
+
+// migrationHooks holds the Prepare steps of migrations, keyed by version
+var migrationHooks = map[int]func(tx *sql.Tx) error{
+	1: prepareBaseline,
+	2: convertLegacyAggregates,
+}
+
+const migrationTableDDL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`
+
+// loadMigrations returns the embedded migrations in version order
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		file := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q (want NNNN_name.sql)", file)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+		}
+		seen[version] = file
+
+		data, err := migrationFS.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    name,
+			SQL:     string(data),
+			Prepare: migrationHooks[version],
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// runMigrations applies all pending embedded migrations and returns how
+// many were applied
+func runMigrations(db *sql.DB) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	return applyMigrations(db, migrations)
+}
+
+// applyMigrations applies the pending migrations in order, stopping at the
+// first failure. Each migration runs in its own transaction.
+func applyMigrations(db *sql.DB, migrations []Migration) (int, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		ran, err := applyMigration(db, m)
+		if err != nil {
+			return count, err
+		}
+		if ran {
+			count++
+			fmt.Printf("🗄️  Applied migration %04d_%s (%v)\n", m.Version, m.Name, time.Since(start).Round(time.Millisecond))
+		}
+	}
+
+	// A newer server may have migrated the database during a rolling upgrade
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	for version := range applied {
+		if version > latest {
+			fmt.Printf("⚠️  Database schema has migration %04d, newer than this server knows (%04d)\n", version, latest)
+			break
+		}
+	}
+	return count, nil
+}
+
+// applyMigration runs one migration and records it. It reports false when
+// another server applied the migration first.
+func applyMigration(db *sql.DB, m Migration) (bool, error) {
+	fail := func(stmt string, err error) (bool, error) {
+		return false, &MigrationError{Version: m.Version, Name: m.Name, Statement: stmt, Err: err}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fail("", err)
+	}
+	defer tx.Rollback()
+
+	if lock := sqlDialect.MigrationLock(); lock != "" {
+		if _, err := tx.Exec(lock); err != nil {
+			return fail("", err)
+		}
+	}
+	var done int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", m.Version).Scan(&done); err != nil {
+		return fail("", err)
+	}
+	if done > 0 {
+		return false, nil
+	}
+
+	if m.Prepare != nil {
+		if err := m.Prepare(tx); err != nil {
+			return fail("", err)
+		}
+	}
+	for _, stmt := range splitStatements(m.SQL) {
+		if _, err := tx.Exec(sqlDialect.DDL(stmt)); err != nil {
+			return fail(stmt, err)
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fail("", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail("", err)
+	}
+	return true, nil
+}
+
+// appliedMigrations creates the schema_migrations table if needed and
+// returns the applied versions with their timestamps
+func appliedMigrations(db *sql.DB) (map[int]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if lock := sqlDialect.MigrationLock(); lock != "" {
+		if _, err := tx.Exec(lock); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(sqlDialect.DDL(migrationTableDDL)); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatuses lists the embedded migrations and when each was applied
+func MigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		statuses = append(statuses, MigrationStatus{Version: m.Version, Name: m.Name, AppliedAt: applied[m.Version]})
+	}
+	return statuses, nil
+}
+
+// splitStatements splits a migration file on semicolons outside string
+// literals, quoted identifiers and comments, dropping empty statements
+func splitStatements(script string) []string {
+	var stmts []string
+	start := 0
+	flush := func(end int) {
+		if stmt := strings.TrimSpace(script[start:end]); summarizeStatement(stmt) != "" {
+			stmts = append(stmts, stmt)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch ch := script[i]; {
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(script[i+1:], ch)
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 1
+			}
+		case ch == '-' && i+1 < len(script) && script[i+1] == '-':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+		case ch == ';':
+			flush(i)
+		}
+	}
+	if start < len(script) {
+		flush(len(script))
+	}
+	return stmts
+}
+
+// summarizeStatement returns a statement on one line without comments
+func summarizeStatement(stmt string) string {
+	var parts []string
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			parts = append(parts, line)
+		}
+	}
+	summary := strings.Join(parts, " ")
+	if len(summary) > 200 {
+		summary = summary[:200] + "..."
+	}
+	return summary
+}
+
+// tableColumns returns the column names of a table, or an empty set when
+// the table does not exist
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(sqlDialect.ColumnsQuery(), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = true
+	}
+	return columns, rows.Err()
+}
+
+// addMissingColumn adds a column to an existing table that predates it
+func addMissingColumn(tx *sql.Tx, table, column, definition string) error {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 || columns[column] {
+		return nil
+	}
+	if _, err := tx.Exec(sqlDialect.DDL("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Migration Steps
+// ============================================================================
+
+// baselineColumns were added to existing tables before migrations were
+// versioned; databases from those releases may lack any of them
+var baselineColumns = []struct{ table, column, definition string }{
+	{"metrics_raw", "ping_ms", "REAL"},
+	{"metrics_raw", "bucket_5min", "INTEGER"},
+	{"metrics_raw", "bucket_5sec", "INTEGER"},
+	{"ping_raw", "bucket_5min", "INTEGER"},
+	{"ping_raw", "bucket_5sec", "INTEGER"},
+	{"audit_logs", "username", "TEXT"},
+}
+
+// prepareBaseline brings a pre-migration database up to the baseline so
+// the CREATE ... IF NOT EXISTS statements and their indexes apply cleanly
+func prepareBaseline(tx *sql.Tx) error {
+	for _, c := range baselineColumns {
+		if err := addMissingColumn(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Backfill sampling buckets of rows stored before the columns existed.
+	// bucket_5min values above 1e8 are unix/300 from an older release.
+	unix := sqlDialect.TimestampToUnix("timestamp")
+	for _, table := range []string{"metrics_raw", "ping_raw"} {
+		columns, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE " + table + " SET bucket_5min = " + unix + " / 120 WHERE bucket_5min IS NULL OR bucket_5min > 100000000"); err != nil {
+			return fmt.Errorf("failed to backfill %s.bucket_5min: %w", table, err)
+		}
+		if _, err := tx.Exec("UPDATE " + table + " SET bucket_5sec = " + unix + " / 5 WHERE bucket_5sec IS NULL"); err != nil {
+			return fmt.Errorf("failed to backfill %s.bucket_5sec: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// legacyAggregates maps the retired server-side aggregation tables onto the
+// *_agg tables that replaced them. Rows are also rolled up one granularity
+// so ranges that used to fall back to the finer table keep their data.
+// Existing *_agg rows win, so exact copies are listed before roll-ups.
+var legacyAggregates = []struct {
+	source, timeExpr, target string
+	seconds                  int
+}{
+	{"metrics_daily", "date || 'T00:00:00Z'", "metrics_daily_agg", 86400},
+	{"metrics_hourly", "hour_start", "metrics_hourly_agg", 3600},
+	{"metrics_hourly", "hour_start", "metrics_daily_agg", 86400},
+	{"metrics_15min", "bucket_start", "metrics_15min_agg", 900},
+	{"metrics_15min", "bucket_start", "metrics_hourly_agg", 3600},
+	{"ping_daily", "date || 'T00:00:00Z'", "ping_daily_agg", 86400},
+	{"ping_hourly", "hour_start", "ping_hourly_agg", 3600},
+	{"ping_hourly", "hour_start", "ping_daily_agg", 86400},
+	{"ping_15min", "bucket_start", "ping_15min_agg", 900},
+	{"ping_15min", "bucket_start", "ping_hourly_agg", 3600},
+}
+
+// convertLegacyAggregates copies the legacy aggregation tables into the
+// *_agg tables. Averages become sums weighted by sample_count.
+func convertLegacyAggregates(tx *sql.Tx) error {
+	for _, table := range []string{"metrics_15min", "metrics_hourly", "metrics_daily"} {
+		if err := addMissingColumn(tx, table, "ping_avg", "REAL"); err != nil {
+			return err
+		}
+	}
+
+	for _, l := range legacyAggregates {
+		columns, err := tableColumns(tx, l.source)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		bucket := sqlDialect.TimestampToUnix(l.timeExpr) + " / " + strconv.Itoa(l.seconds)
+		var query string
+		if strings.HasPrefix(l.source, "ping_") {
+			okCount, failCount := "ok_count", "fail_count"
+			if l.source == "ping_daily" {
+				// Daily ping rows only kept the uptime percentage
+				okCount = "CAST(ROUND(sample_count * uptime_percent / 100) AS INTEGER)"
+				failCount = "sample_count - " + okCount
+			}
+			query = `
+				INSERT INTO ` + l.target + ` (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
+				SELECT server_id, ` + bucket + `, target_name, MAX(target_host),
+					SUM(COALESCE(latency_avg, 0) * sample_count),
+					MAX(COALESCE(latency_max, 0)),
+					SUM(CASE WHEN latency_avg IS NULL THEN 0 ELSE sample_count END),
+					SUM(` + okCount + `),
+					SUM(` + failCount + `)
+				FROM ` + l.source + `
+				WHERE sample_count > 0
+				GROUP BY server_id, target_name, ` + bucket + `
+				ON CONFLICT(server_id, target_name, bucket) DO NOTHING`
+		} else {
+			query = `
+				INSERT INTO ` + l.target + ` (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
+				SELECT server_id, ` + bucket + `,
+					SUM(cpu_avg * sample_count),
+					MAX(cpu_max),
+					SUM(memory_avg * sample_count),
+					MAX(memory_max),
+					SUM(disk_avg * sample_count),
+					SUM(net_rx_total),
+					SUM(net_tx_total),
+					SUM(COALESCE(ping_avg, 0) * sample_count),
+					SUM(CASE WHEN ping_avg IS NULL THEN 0 ELSE sample_count END),
+					SUM(sample_count)
+				FROM ` + l.source + `
+				WHERE sample_count > 0
+				GROUP BY server_id, ` + bucket + `
+				ON CONFLICT(server_id, bucket) DO NOTHING`
+		}
+
+		result, err := tx.Exec(query)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s into %s: %w", l.source, l.target, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			fmt.Printf("   Copied %d rows from %s into %s\n", n, l.source, l.target)
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// Migrate Command
+// ============================================================================
+
+// runMigrateCommand implements "vstats-server migrate status|up" and
+// returns the process exit code
+func runMigrateCommand(args []string) int {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if action != "status" && action != "up" {
+		fmt.Println("Usage: vstats-server migrate [status|up]")
+		return 2
+	}
+
+	db, err := openConfiguredDatabase()
+	if err != nil {
+		fmt.Printf("❌ Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	fmt.Printf("📦 Database: %s\n", databaseLabel)
+
+	if action == "up" {
+		n, err := runMigrations(db)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		if n == 0 {
+			fmt.Println("✅ Schema is up to date")
+		} else {
+			fmt.Printf("✅ Applied %d migration(s)\n", n)
+		}
+		return 0
+	}
+
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		fmt.Printf("❌ Failed to read migration status: %v\n", err)
+		return 1
+	}
+	pending := 0
+	for _, s := range statuses {
+		state := "applied " + s.AppliedAt
+		if s.AppliedAt == "" {
+			state = "pending"
+			pending++
+		}
+		fmt.Printf("  %04d_%-32s %s\n", s.Version, s.Name, state)
+	}
+	if pending > 0 {
+		fmt.Printf("⏳ %d pending migration(s); run \"vstats-server migrate up\" or start the server to apply\n", pending)
+	}
+	return 0
+}
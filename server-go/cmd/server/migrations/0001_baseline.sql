@@ -0,0 +1,370 @@
+-- Baseline schema. Databases created before versioned migrations already
+-- have most of these tables; missing columns are added before this runs.
+-- Statements are written for SQLite and adapted by the active dialect.
+
+-- Raw metrics (keep for 24 hours)
+CREATE TABLE IF NOT EXISTS metrics_raw (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	cpu_usage REAL NOT NULL,
+	memory_usage REAL NOT NULL,
+	disk_usage REAL NOT NULL,
+	net_rx INTEGER NOT NULL,
+	net_tx INTEGER NOT NULL,
+	load_1 REAL NOT NULL,
+	load_5 REAL NOT NULL,
+	load_15 REAL NOT NULL,
+	ping_ms REAL,
+	bucket_5min INTEGER,
+	bucket_5sec INTEGER,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_time ON metrics_raw(server_id, timestamp);
+-- bucket_5min actually stores 2-minute buckets (720 points over 24h)
+CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket ON metrics_raw(server_id, bucket_5min);
+CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket_5sec ON metrics_raw(server_id, bucket_5sec);
+
+-- Ping metrics per target (keep for 24 hours)
+CREATE TABLE IF NOT EXISTS ping_raw (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_ms REAL,
+	packet_loss REAL NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'ok',
+	bucket_5min INTEGER,
+	bucket_5sec INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_ping_raw_server_time ON ping_raw(server_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_ping_raw_target ON ping_raw(server_id, target_name, timestamp);
+CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket ON ping_raw(server_id, bucket_5min);
+CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket_5sec ON ping_raw(server_id, bucket_5sec);
+
+-- 5-second aggregated metrics (for 1h queries, ~720 points per server)
+CREATE TABLE IF NOT EXISTS metrics_5sec (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- 2-minute aggregated metrics (for 24h queries, ~720 points per server)
+CREATE TABLE IF NOT EXISTS metrics_2min (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- 15-minute aggregated metrics (for 7d queries, from agent)
+CREATE TABLE IF NOT EXISTS metrics_15min_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- Hourly aggregated metrics (for 30d queries, from agent)
+CREATE TABLE IF NOT EXISTS metrics_hourly_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- Daily aggregated metrics (for 1y queries, from agent)
+CREATE TABLE IF NOT EXISTS metrics_daily_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- 5-second aggregated ping metrics (for 1h queries)
+CREATE TABLE IF NOT EXISTS ping_5sec (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- 2-minute aggregated ping metrics (for 24h queries)
+CREATE TABLE IF NOT EXISTS ping_2min (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- 15-minute aggregated ping metrics (for 7d queries, from agent)
+CREATE TABLE IF NOT EXISTS ping_15min_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- Hourly aggregated ping metrics (for 30d queries, from agent)
+CREATE TABLE IF NOT EXISTS ping_hourly_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- Daily aggregated ping metrics (for 1y queries, from agent)
+CREATE TABLE IF NOT EXISTS ping_daily_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- Alert history
+CREATE TABLE IF NOT EXISTS alert_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	alert_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	server_id TEXT NOT NULL,
+	server_name TEXT NOT NULL,
+	severity TEXT NOT NULL,
+	value REAL,
+	threshold REAL,
+	message TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	resolved_at TEXT,
+	duration INTEGER,
+	notified INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_history_server ON alert_history(server_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_alert_history_type ON alert_history(type, started_at);
+
+-- Notification events
+CREATE TABLE IF NOT EXISTS notification_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	alert_id TEXT NOT NULL,
+	channel_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	server_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	message TEXT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT,
+	sent_at TEXT NOT NULL,
+	retry_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_events_alert ON notification_events(alert_id);
+
+-- Audit log
+CREATE TABLE IF NOT EXISTS audit_logs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp TEXT NOT NULL,
+	action TEXT NOT NULL,
+	category TEXT NOT NULL,
+	username TEXT,
+	user_ip TEXT NOT NULL,
+	user_agent TEXT,
+	target_type TEXT,
+	target_id TEXT,
+	target_name TEXT,
+	details TEXT,
+	status TEXT NOT NULL DEFAULT 'success',
+	error_message TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_timestamp ON audit_logs(timestamp);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_category ON audit_logs(category);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_username ON audit_logs(username);
+
+-- Current period traffic stats
+CREATE TABLE IF NOT EXISTS traffic_stats (
+	server_id TEXT PRIMARY KEY,
+	period_start TEXT NOT NULL,
+	period_end TEXT NOT NULL,
+	reset_day INTEGER NOT NULL DEFAULT 1,
+	tx_bytes INTEGER NOT NULL DEFAULT 0,
+	rx_bytes INTEGER NOT NULL DEFAULT 0,
+	monthly_limit_gb REAL NOT NULL DEFAULT 0,
+	threshold_type TEXT NOT NULL DEFAULT 'sum',
+	baseline_tx INTEGER NOT NULL DEFAULT 0,
+	baseline_rx INTEGER NOT NULL DEFAULT 0,
+	baseline_time TEXT,
+	last_updated TEXT NOT NULL,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Historical traffic records (archived periods)
+CREATE TABLE IF NOT EXISTS traffic_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	period_start TEXT NOT NULL,
+	period_end TEXT NOT NULL,
+	tx_bytes INTEGER NOT NULL,
+	rx_bytes INTEGER NOT NULL,
+	monthly_limit_gb REAL NOT NULL DEFAULT 0,
+	usage_percent REAL NOT NULL DEFAULT 0,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(server_id, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_traffic_history_server ON traffic_history(server_id, period_start);
+
+-- Daily traffic for detailed charts
+CREATE TABLE IF NOT EXISTS traffic_daily (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	date TEXT NOT NULL,
+	tx_bytes INTEGER NOT NULL DEFAULT 0,
+	rx_bytes INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	UNIQUE(server_id, date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_traffic_daily_server ON traffic_daily(server_id, date);
+
+-- Users
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	password_hash TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL DEFAULT 'viewer',
+	disabled INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	last_login_at TEXT
+);
+
+-- COLLATE NOCASE is SQLite-only, so enforce case-insensitive uniqueness portably
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username));
+
+-- API tokens
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '',
+	user_id TEXT,
+	username TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	expires_at TEXT,
+	last_used_at TEXT,
+	last_used_ip TEXT,
+	revoked_at TEXT
+);
+
+-- Login sessions
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL DEFAULT '',
+	username TEXT NOT NULL,
+	role TEXT NOT NULL,
+	provider TEXT,
+	ip TEXT,
+	user_agent TEXT,
+	issued_at TEXT NOT NULL,
+	last_seen_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	refresh_hash TEXT NOT NULL UNIQUE,
+	revoked_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id, username);
+
+-- TOTP enrollments
+CREATE TABLE IF NOT EXISTS user_totp (
+	account_key TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL DEFAULT '',
+	username TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	enabled INTEGER NOT NULL DEFAULT 0,
+	recovery_codes TEXT NOT NULL DEFAULT '',
+	last_step INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	enabled_at TEXT
+);
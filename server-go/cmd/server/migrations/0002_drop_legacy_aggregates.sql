@@ -0,0 +1,9 @@
+-- The server-side 15min/hourly/daily tables were superseded by the
+-- agent-provided *_agg tables. Their rows are copied into the *_agg tables
+-- before this runs; see convertLegacyAggregates.
+DROP TABLE IF EXISTS metrics_15min;
+DROP TABLE IF EXISTS metrics_hourly;
+DROP TABLE IF EXISTS metrics_daily;
+DROP TABLE IF EXISTS ping_15min;
+DROP TABLE IF EXISTS ping_hourly;
+DROP TABLE IF EXISTS ping_daily;
@@ -0,0 +1,24 @@
+-- Shared settings move from the config file into the database. Each save
+-- that changes something is kept as a revision for history and rollback.
+
+-- Current value of each config section (top-level key of the config JSON)
+CREATE TABLE IF NOT EXISTS config_sections (
+	name TEXT PRIMARY KEY,
+	data TEXT NOT NULL,
+	revision_id INTEGER NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS config_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TEXT NOT NULL,
+	username TEXT NOT NULL DEFAULT '',
+	user_ip TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL,
+	restored_from INTEGER,
+	sections TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '[]',
+	snapshot TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_config_revisions_created ON config_revisions(created_at);
@@ -0,0 +1,10 @@
+-- Notifications are delivered from a persistent queue: rows start out
+-- pending, are retried with backoff and end up sent or failed.
+ALTER TABLE notification_events ADD COLUMN channel_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_events ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_events ADD COLUMN next_attempt_at TEXT;
+
+UPDATE notification_events SET created_at = sent_at WHERE created_at = '';
+
+CREATE INDEX IF NOT EXISTS idx_notification_events_status ON notification_events(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_notification_events_created ON notification_events(created_at);
@@ -0,0 +1,12 @@
+-- Alert engine state that must survive restarts: firing alerts (including
+-- whether they were muted) and the last notification time per cooldown key.
+CREATE TABLE IF NOT EXISTS alert_state (
+	alert_key TEXT PRIMARY KEY,
+	alert TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alert_cooldowns (
+	cooldown_key TEXT PRIMARY KEY,
+	last_notified TEXT NOT NULL
+);
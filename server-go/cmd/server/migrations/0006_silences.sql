@@ -0,0 +1,14 @@
+-- Silences suppress notifications for matching alerts, either for a fixed
+-- period or during recurring maintenance windows. Matchers and schedules
+-- are stored as JSON.
+CREATE TABLE IF NOT EXISTS silences (
+	id TEXT PRIMARY KEY,
+	comment TEXT NOT NULL DEFAULT '',
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	matchers TEXT NOT NULL,
+	schedule TEXT,
+	starts_at TEXT NOT NULL,
+	ends_at TEXT,
+	expired_at TEXT
+);
@@ -0,0 +1,4 @@
+-- Who acknowledged an alert, when, and why.
+ALTER TABLE alert_history ADD COLUMN acknowledged_by TEXT;
+ALTER TABLE alert_history ADD COLUMN acknowledged_at TEXT;
+ALTER TABLE alert_history ADD COLUMN ack_comment TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Whether a notification announces a recovery, for channels that track
+-- alerts on their side (PagerDuty).
+ALTER TABLE notification_events ADD COLUMN resolved INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- The structured event (AlertEvent JSON) a notification is rendered from,
+-- so that retries and resends deliver the same content to notifiers.
+ALTER TABLE notification_events ADD COLUMN payload TEXT NOT NULL DEFAULT '';
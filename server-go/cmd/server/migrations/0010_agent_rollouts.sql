@@ -0,0 +1,36 @@
+-- Staged agent rollouts: a target version is sent to the selected agents
+-- in waves, and each agent's progress is tracked from its update reports.
+-- The selector is stored as JSON.
+CREATE TABLE IF NOT EXISTS agent_rollouts (
+	id TEXT PRIMARY KEY,
+	version TEXT NOT NULL,
+	manifest_url TEXT NOT NULL DEFAULT '',
+	force_update INTEGER NOT NULL DEFAULT 0,
+	selector TEXT NOT NULL,
+	batch_size INTEGER NOT NULL,
+	pause_on_failure INTEGER NOT NULL DEFAULT 1,
+	status TEXT NOT NULL,
+	wave INTEGER NOT NULL DEFAULT 0,
+	waves INTEGER NOT NULL,
+	message TEXT NOT NULL DEFAULT '',
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	finished_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS agent_rollout_targets (
+	rollout_id TEXT NOT NULL,
+	server_id TEXT NOT NULL,
+	server_name TEXT NOT NULL DEFAULT '',
+	wave INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	from_version TEXT NOT NULL DEFAULT '',
+	to_version TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	sent_at TEXT,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (rollout_id, server_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_rollout_targets_server ON agent_rollout_targets(server_id, status);
@@ -0,0 +1,10 @@
+-- The latest self-update report of each agent. Kept out of the versioned
+-- config so that progress reports do not create config revisions.
+CREATE TABLE IF NOT EXISTS agent_update_status (
+	server_id TEXT PRIMARY KEY,
+	status TEXT NOT NULL,
+	from_version TEXT NOT NULL DEFAULT '',
+	to_version TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	reported_at TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+-- The remote config version each agent last applied. Kept out of the
+-- versioned config so that acknowledgements do not create config revisions.
+CREATE TABLE IF NOT EXISTS agent_config_acks (
+	server_id TEXT PRIMARY KEY,
+	version TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	acked_at TEXT NOT NULL
+);
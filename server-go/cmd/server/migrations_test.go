@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSplitStatements tests splitting migration files into statements
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements(`
+		-- leading comment; not a statement
+		CREATE TABLE a (x TEXT DEFAULT 'a;b');
+		INSERT INTO a VALUES ("c;d"); -- trailing
+		-- only a comment
+		DROP TABLE a`)
+	want := []string{
+		"-- leading comment; not a statement\n\t\tCREATE TABLE a (x TEXT DEFAULT 'a;b')",
+		`INSERT INTO a VALUES ("c;d")`,
+		"-- trailing\n\t\t-- only a comment\n\t\tDROP TABLE a",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d statements, got %d: %q", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestMigrations runs the embedded migrations against every backend
+func TestMigrations(t *testing.T) {
+	forEachBackend(t, testMigrations)
+}
+
+func testMigrations(t *testing.T, helper *TestHelper) {
+	db := helper.db
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected contiguous versions, got %04d_%s at position %d", m.Version, m.Name, i)
+		}
+	}
+
+	t.Run("LegacyDatabase", func(t *testing.T) {
+		// Schema as left behind by releases before versioned migrations
+		for _, stmt := range splitStatements(`
+			CREATE TABLE metrics_raw (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				server_id TEXT NOT NULL,
+				timestamp TEXT NOT NULL,
+				cpu_usage REAL NOT NULL,
+				memory_usage REAL NOT NULL,
+				disk_usage REAL NOT NULL,
+				net_rx INTEGER NOT NULL,
+				net_tx INTEGER NOT NULL,
+				load_1 REAL NOT NULL,
+				load_5 REAL NOT NULL,
+				load_15 REAL NOT NULL
+			);
+			CREATE TABLE audit_logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp TEXT NOT NULL,
+				action TEXT NOT NULL,
+				category TEXT NOT NULL,
+				user_ip TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'success'
+			);
+			CREATE TABLE metrics_hourly (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				server_id TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				cpu_avg REAL NOT NULL,
+				cpu_max REAL NOT NULL,
+				memory_avg REAL NOT NULL,
+				memory_max REAL NOT NULL,
+				disk_avg REAL NOT NULL,
+				net_rx_total INTEGER NOT NULL,
+				net_tx_total INTEGER NOT NULL,
+				sample_count INTEGER NOT NULL,
+				UNIQUE(server_id, hour_start)
+			);
+			CREATE TABLE ping_daily (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				server_id TEXT NOT NULL,
+				date TEXT NOT NULL,
+				target_name TEXT NOT NULL,
+				target_host TEXT NOT NULL,
+				latency_avg REAL,
+				latency_max REAL,
+				packet_loss_avg REAL NOT NULL DEFAULT 0,
+				uptime_percent REAL NOT NULL DEFAULT 0,
+				sample_count INTEGER NOT NULL,
+				UNIQUE(server_id, target_name, date)
+			);
+			INSERT INTO metrics_raw (server_id, timestamp, cpu_usage, memory_usage, disk_usage, net_rx, net_tx, load_1, load_5, load_15)
+				VALUES ('srv-1', '2024-03-01T10:00:10Z', 10, 20, 30, 0, 0, 0, 0, 0);
+			INSERT INTO audit_logs (timestamp, action, category, user_ip) VALUES ('2024-03-01T10:00:00Z', 'login', 'auth', '127.0.0.1');
+			INSERT INTO metrics_hourly (server_id, hour_start, cpu_avg, cpu_max, memory_avg, memory_max, disk_avg, net_rx_total, net_tx_total, sample_count)
+				VALUES ('srv-1', '2024-03-01T10:00:00Z', 10, 50, 40, 60, 30, 1000, 2000, 4);
+			INSERT INTO metrics_hourly (server_id, hour_start, cpu_avg, cpu_max, memory_avg, memory_max, disk_avg, net_rx_total, net_tx_total, sample_count)
+				VALUES ('srv-1', '2024-03-01T11:00:00Z', 30, 70, 40, 60, 30, 500, 500, 4);
+			INSERT INTO ping_daily (server_id, date, target_name, target_host, latency_avg, latency_max, uptime_percent, sample_count)
+				VALUES ('srv-1', '2024-03-01', 'gw', '10.0.0.1', 12.5, 40, 75, 8)`) {
+			if _, err := db.Exec(sqlDialect.DDL(stmt)); err != nil {
+				t.Fatalf("Failed to create legacy schema: %v\n%s", err, stmt)
+			}
+		}
+
+		n, err := runMigrations(db)
+		if err != nil {
+			t.Fatalf("runMigrations failed: %v", err)
+		}
+		if n != len(migrations) {
+			t.Errorf("Expected %d migrations applied, got %d", len(migrations), n)
+		}
+
+		var bucket5sec, bucket5min int64
+		if err := db.QueryRow("SELECT bucket_5sec, bucket_5min FROM metrics_raw").Scan(&bucket5sec, &bucket5min); err != nil {
+			t.Fatalf("Failed to read backfilled buckets: %v", err)
+		}
+		if bucket5sec != 1709287210/5 || bucket5min != 1709287210/120 {
+			t.Errorf("Unexpected backfilled buckets %d / %d", bucket5sec, bucket5min)
+		}
+		if _, err := db.Exec("UPDATE audit_logs SET username = 'admin'"); err != nil {
+			t.Errorf("Expected audit_logs.username to be added: %v", err)
+		}
+
+		// Hourly rows are copied and rolled up into the day
+		var cpuSum, cpuMax float64
+		var netRx, samples int64
+		err = db.QueryRow("SELECT cpu_sum, cpu_max, net_rx, sample_count FROM metrics_hourly_agg WHERE server_id = 'srv-1' AND bucket = ?",
+			int64(1709287200/3600)).Scan(&cpuSum, &cpuMax, &netRx, &samples)
+		if err != nil {
+			t.Fatalf("Failed to read converted hourly row: %v", err)
+		}
+		if cpuSum != 40 || cpuMax != 50 || netRx != 1000 || samples != 4 {
+			t.Errorf("Unexpected hourly row: cpu_sum=%v cpu_max=%v net_rx=%d samples=%d", cpuSum, cpuMax, netRx, samples)
+		}
+		err = db.QueryRow("SELECT cpu_sum, cpu_max, net_rx, sample_count FROM metrics_daily_agg WHERE server_id = 'srv-1' AND bucket = ?",
+			int64(1709251200/86400)).Scan(&cpuSum, &cpuMax, &netRx, &samples)
+		if err != nil {
+			t.Fatalf("Failed to read rolled up daily row: %v", err)
+		}
+		if cpuSum != 160 || cpuMax != 70 || netRx != 1500 || samples != 8 {
+			t.Errorf("Unexpected daily row: cpu_sum=%v cpu_max=%v net_rx=%d samples=%d", cpuSum, cpuMax, netRx, samples)
+		}
+
+		var latencySum float64
+		var latencyCount, okCount, failCount int64
+		err = db.QueryRow("SELECT latency_sum, latency_count, ok_count, fail_count FROM ping_daily_agg WHERE server_id = 'srv-1' AND target_name = 'gw'").
+			Scan(&latencySum, &latencyCount, &okCount, &failCount)
+		if err != nil {
+			t.Fatalf("Failed to read converted ping row: %v", err)
+		}
+		if latencySum != 100 || latencyCount != 8 || okCount != 6 || failCount != 2 {
+			t.Errorf("Unexpected ping row: sum=%v count=%d ok=%d fail=%d", latencySum, latencyCount, okCount, failCount)
+		}
+
+		for _, table := range []string{"metrics_hourly", "ping_daily"} {
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err == nil {
+				t.Errorf("Expected legacy table %s to be dropped", table)
+			}
+		}
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		n, err := runMigrations(db)
+		if err != nil || n != 0 {
+			t.Errorf("Expected no pending migrations, got %d / %v", n, err)
+		}
+
+		statuses, err := MigrationStatuses(db)
+		if err != nil {
+			t.Fatalf("MigrationStatuses failed: %v", err)
+		}
+		if len(statuses) != len(migrations) {
+			t.Fatalf("Expected %d statuses, got %d", len(migrations), len(statuses))
+		}
+		for _, s := range statuses {
+			if s.AppliedAt == "" {
+				t.Errorf("Expected %04d_%s to be applied", s.Version, s.Name)
+			}
+		}
+	})
+
+	t.Run("FailureIsReported", func(t *testing.T) {
+		broken := append(migrations, Migration{
+			Version: 9999,
+			Name:    "broken",
+			SQL:     "CREATE TABLE half_done (id INTEGER);\n-- the typo below\nCREATE TABL oops (id INTEGER);",
+		})
+		n, err := applyMigrations(db, broken)
+		var migErr *MigrationError
+		if !errors.As(err, &migErr) {
+			t.Fatalf("Expected MigrationError, got %v", err)
+		}
+		if n != 0 || migErr.Version != 9999 || !strings.Contains(err.Error(), "CREATE TABL oops") {
+			t.Errorf("Unexpected failure report (%d applied): %v", n, err)
+		}
+
+		// The failed migration is rolled back and stays pending
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = 9999").Scan(&count)
+		if count != 0 {
+			t.Error("Failed migration must not be recorded")
+		}
+		if err := db.QueryRow("SELECT COUNT(*) FROM half_done").Scan(&count); err == nil {
+			t.Error("Statements of a failed migration must be rolled back")
+		}
+	})
+}
+
+// TestMigrationsFreshDatabase tests that a new database ends up usable
+func TestMigrationsFreshDatabase(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Close()
+	helper.Migrate(t)
+
+	for _, table := range []string{"metrics_raw", "metrics_15min_agg", "traffic_stats", "users", "user_totp"} {
+		if err := helper.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(new(int)); err != nil {
+			t.Errorf("Expected table %s: %v", table, err)
+		}
+	}
+	if err := helper.db.QueryRow("SELECT COUNT(*) FROM metrics_hourly").Scan(new(int)); err == nil || err == sql.ErrNoRows {
+		t.Error("Legacy tables must not be created")
+	}
+}
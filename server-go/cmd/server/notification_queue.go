@@ -0,0 +1,424 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Notification Queue
+// ============================================================================
+
+// Notification delivery states
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed" // Gave up; stays in the log until resent
+)
+
+const (
+	notificationMaxAttempts  = 8
+	notificationRetryBase    = 30 * time.Second
+	notificationRetryMax     = 30 * time.Minute
+	notificationPollInterval = 5 * time.Second
+	notificationBatchSize    = 100
+	notificationRetention    = 30 * 24 * time.Hour
+)
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrNotificationQueued   = errors.New("notification is already queued")
+)
+
+// NotificationQueue delivers notifications stored in notification_events.
+// Every notification is written before it is sent, so pending deliveries
+// survive restarts; failed sends are retried with exponential backoff.
+type NotificationQueue struct {
+	state *AppState
+	db    *sql.DB
+
+	wakeCh chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewNotificationQueue creates a notification queue
+func NewNotificationQueue(state *AppState, db *sql.DB) *NotificationQueue {
+	return &NotificationQueue{
+		state:  state,
+		db:     db,
+		wakeCh: make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins delivering queued notifications
+func (q *NotificationQueue) Start() {
+	q.wg.Add(1)
+	go q.loop()
+}
+
+// Stop waits for the current delivery round and stops the queue
+func (q *NotificationQueue) Stop() {
+	close(q.stopCh)
+	q.wg.Wait()
+}
+
+// Wake triggers a delivery round without waiting for the next poll
+func (q *NotificationQueue) Wake() {
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (q *NotificationQueue) loop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(notificationPollInterval)
+	defer ticker.Stop()
+
+	// Deliver whatever was left pending by the previous run
+	q.Wake()
+
+	for {
+		select {
+		case <-q.stopCh:
+			return
+		case <-ticker.C:
+		case <-q.wakeCh:
+		}
+		// Only the cluster leader delivers, so replicas never send twice
+		if isLeader() {
+			q.processDue(time.Now())
+		}
+	}
+}
+
+func (q *NotificationQueue) write(fn func(*sql.DB) error) error {
+	if dbWriter != nil {
+		return dbWriter.WriteSync(fn)
+	}
+	return fn(q.db)
+}
+
+// Enqueue stores a notification for delivery
+func (q *NotificationQueue) Enqueue(event NotificationEvent) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var payload []byte
+	if event.Payload != nil {
+		payload, _ = json.Marshal(event.Payload)
+	}
+	err := q.write(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO notification_events (alert_id, channel_id, channel_name, type, server_id, title, message, resolved, payload, status, created_at, sent_at, next_attempt_at, retry_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)`,
+			event.AlertID, event.ChannelID, event.ChannelName, event.Type, event.ServerID,
+			event.Title, event.Message, boolToInt(event.Resolved), string(payload), NotificationPending, now, now, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	q.Wake()
+	return nil
+}
+
+// processDue delivers the pending notifications due at now. Channels are
+// delivered in parallel so that one slow endpoint does not hold up the
+// others; within a channel notifications keep their order. Notifications
+// about an alert wait for the earlier ones to the same channel to be sent
+// or given up, so that a recovery never arrives before its firing.
+func (q *NotificationQueue) processDue(now time.Time) int {
+	due := now.UTC().Format(time.RFC3339)
+	events, err := queryNotificationEvents(q.db, `
+		WHERE status = ? AND next_attempt_at <= ? AND NOT (alert_id <> '' AND EXISTS (
+			SELECT 1 FROM notification_events earlier
+			WHERE earlier.alert_id = notification_events.alert_id AND earlier.channel_id = notification_events.channel_id
+			  AND earlier.status = ? AND earlier.next_attempt_at > ? AND earlier.id < notification_events.id))
+		ORDER BY id LIMIT ?`,
+		NotificationPending, due, NotificationPending, due, notificationBatchSize)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load queued notifications: %v\n", err)
+		return 0
+	}
+
+	byChannel := make(map[string][]NotificationEvent)
+	for _, event := range events {
+		byChannel[event.ChannelID] = append(byChannel[event.ChannelID], event)
+	}
+
+	var wg sync.WaitGroup
+	for channelID, queued := range byChannel {
+		channel := q.channel(channelID)
+		wg.Add(1)
+		go func(queued []NotificationEvent) {
+			defer wg.Done()
+			held := make(map[string]bool)
+			for _, event := range queued {
+				if event.AlertID != "" && held[event.AlertID] {
+					continue
+				}
+				if !q.deliver(event, channel) {
+					held[event.AlertID] = true
+				}
+			}
+		}(queued)
+	}
+	wg.Wait()
+	return len(events)
+}
+
+// channel returns the current configuration of a channel, or nil when it
+// was deleted or disabled
+func (q *NotificationQueue) channel(id string) *NotificationChannel {
+	q.state.ConfigMu.RLock()
+	defer q.state.ConfigMu.RUnlock()
+
+	if q.state.Config.AlertConfig == nil {
+		return nil
+	}
+	for _, ch := range q.state.Config.AlertConfig.Channels {
+		if ch.ID == id && ch.Enabled {
+			channel := ch
+			return &channel
+		}
+	}
+	return nil
+}
+
+// deliver makes one delivery attempt and records its outcome. Returns false
+// when the notification stays queued for a retry.
+func (q *NotificationQueue) deliver(event NotificationEvent, channel *NotificationChannel) bool {
+	if channel == nil {
+		q.finish(event, NotificationFailed, "channel not found or disabled", nil)
+		return true
+	}
+
+	notifier, err := CreateNotifier(*channel)
+	if err == nil {
+		alertEvent := event.alertEvent()
+		alertEvent.AckURL = q.ackURL(event)
+		err = notifier.Send(alertEvent)
+	}
+	if err == nil {
+		q.finish(event, NotificationSent, "", nil)
+		fmt.Printf("📢 Notification sent via %s: %s\n", channel.Name, event.Title)
+		return true
+	}
+
+	event.RetryCount++
+	if event.RetryCount >= notificationMaxAttempts {
+		q.finish(event, NotificationFailed, err.Error(), nil)
+		fmt.Printf("⚠️ Giving up on notification via %s after %d attempts: %v\n", channel.Name, event.RetryCount, err)
+		return true
+	}
+	next := time.Now().Add(notificationBackoff(event.RetryCount))
+	q.finish(event, NotificationPending, err.Error(), &next)
+	fmt.Printf("⚠️ Failed to send notification via %s (attempt %d), retrying at %s: %v\n",
+		channel.Name, event.RetryCount, next.Format("15:04:05"), err)
+	return false
+}
+
+// ackURL returns the acknowledge link for a notification about an alert
+// that is still waiting for acknowledgement, or "" when there is none or no
+// public URL is configured
+func (q *NotificationQueue) ackURL(event NotificationEvent) string {
+	q.state.ConfigMu.RLock()
+	var publicURL string
+	if q.state.Config.AlertConfig != nil {
+		publicURL = q.state.Config.AlertConfig.PublicURL
+	}
+	q.state.ConfigMu.RUnlock()
+
+	if publicURL == "" || event.AlertID == "" || alertEngine == nil || !alertEngine.awaitingAck(event.AlertID) {
+		return ""
+	}
+	return alertAckURL(publicURL, event.AlertID)
+}
+
+// alertEvent returns the structured event of a notification. Notifications
+// queued before events were stored get one built from their text.
+func (event NotificationEvent) alertEvent() *AlertEvent {
+	if event.Payload != nil {
+		alertEvent := *event.Payload
+		return &alertEvent
+	}
+	alertEvent := messageEvent(event.Type, event.Title, event.Message)
+	alertEvent.Time = event.CreatedAt
+	if event.Resolved {
+		alertEvent.Status = "resolved"
+	}
+	if event.AlertID != "" {
+		alertEvent.Alerts = []EventAlert{{ID: event.AlertID, Status: alertEvent.Status, Type: event.Type, ServerID: event.ServerID}}
+	}
+	return alertEvent
+}
+
+// finish records the outcome of a delivery attempt
+func (q *NotificationQueue) finish(event NotificationEvent, status, errMsg string, next *time.Time) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var nextAttempt interface{}
+	if next != nil {
+		nextAttempt = next.UTC().Format(time.RFC3339)
+	}
+	err := q.write(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			UPDATE notification_events
+			SET status = ?, error = ?, sent_at = ?, next_attempt_at = ?, retry_count = ?
+			WHERE id = ?`,
+			status, errMsg, now, nextAttempt, event.RetryCount, event.ID)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Failed to record notification %d: %v\n", event.ID, err)
+	}
+}
+
+// notificationBackoff returns the wait before the next attempt after the
+// given number of failed attempts
+func notificationBackoff(failures int) time.Duration {
+	delay := notificationRetryBase
+	for i := 1; i < failures && delay < notificationRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > notificationRetryMax {
+		delay = notificationRetryMax
+	}
+	return delay
+}
+
+// Resend queues a notification again. A failed notification is retried in
+// place; one that was already delivered is copied into a new entry.
+func (q *NotificationQueue) Resend(id int64) (*NotificationEvent, error) {
+	events, err := queryNotificationEvents(q.db, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrNotificationNotFound
+	}
+	event := events[0]
+
+	switch event.Status {
+	case NotificationPending:
+		return nil, ErrNotificationQueued
+	case NotificationSent:
+		if err := q.Enqueue(event); err != nil {
+			return nil, err
+		}
+	default:
+		now := time.Now().UTC().Format(time.RFC3339)
+		err := q.write(func(db *sql.DB) error {
+			_, err := db.Exec(`
+				UPDATE notification_events SET status = ?, next_attempt_at = ?, retry_count = 0
+				WHERE id = ?`, NotificationPending, now, id)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		q.Wake()
+	}
+
+	event.Status = NotificationPending
+	return &event, nil
+}
+
+// ============================================================================
+// Notification Log Queries
+// ============================================================================
+
+// NotificationFilter selects entries of the notification log
+type NotificationFilter struct {
+	Status    string
+	ChannelID string
+	AlertID   string
+	ServerID  string
+	Type      string
+	Since     string // RFC3339, compared with created_at
+}
+
+func (f NotificationFilter) where() (string, []interface{}) {
+	where := "WHERE 1=1"
+	args := []interface{}{}
+	for _, cond := range []struct {
+		column, value string
+	}{
+		{"status", f.Status},
+		{"channel_id", f.ChannelID},
+		{"alert_id", f.AlertID},
+		{"server_id", f.ServerID},
+		{"type", f.Type},
+	} {
+		if cond.value != "" {
+			where += " AND " + cond.column + " = ?"
+			args = append(args, cond.value)
+		}
+	}
+	if f.Since != "" {
+		where += " AND created_at >= ?"
+		args = append(args, f.Since)
+	}
+	return where, args
+}
+
+// ListNotifications returns matching notifications, newest first
+func ListNotifications(db *sql.DB, filter NotificationFilter, limit, offset int) ([]NotificationEvent, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notification_events "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	events, err := queryNotificationEvents(db, where+" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	return events, total, err
+}
+
+// queryNotificationEvents loads notification events matching a WHERE clause
+func queryNotificationEvents(db *sql.DB, clause string, args ...interface{}) ([]NotificationEvent, error) {
+	rows, err := db.Query(`
+		SELECT id, alert_id, channel_id, channel_name, type, server_id, title, message, resolved, payload, status,
+		       COALESCE(error, ''), created_at, sent_at, next_attempt_at, retry_count
+		FROM notification_events `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []NotificationEvent{}
+	for rows.Next() {
+		var event NotificationEvent
+		var createdAt, sentAt string
+		var nextAttempt sql.NullString
+		var resolved int
+		var payload string
+		if err := rows.Scan(
+			&event.ID, &event.AlertID, &event.ChannelID, &event.ChannelName, &event.Type, &event.ServerID,
+			&event.Title, &event.Message, &resolved, &payload, &event.Status, &event.Error,
+			&createdAt, &sentAt, &nextAttempt, &event.RetryCount,
+		); err != nil {
+			return nil, err
+		}
+		event.Resolved = resolved != 0
+		if payload != "" {
+			var alertEvent AlertEvent
+			if json.Unmarshal([]byte(payload), &alertEvent) == nil {
+				event.Payload = &alertEvent
+			}
+		}
+		event.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		event.SentAt, _ = time.Parse(time.RFC3339, sentAt)
+		if nextAttempt.Valid && event.Status == NotificationPending {
+			t, _ := time.Parse(time.RFC3339, nextAttempt.String)
+			event.NextAttemptAt = &t
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestNotificationQueue tests persistent delivery with retries
+func TestNotificationQueue(t *testing.T) {
+	forEachBackend(t, testNotificationQueue)
+}
+
+func testNotificationQueue(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	var failing atomic.Bool
+	var received atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	defer endpoint.Close()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": endpoint.URL}},
+	}
+	state := &AppState{Config: &AppConfig{AlertConfig: &alertConfig}}
+	queue := NewNotificationQueue(state, helper.db)
+
+	enqueue := func(alertID string) {
+		t.Helper()
+		err := queue.Enqueue(NotificationEvent{AlertID: alertID, ChannelID: "hook", ChannelName: "Hook", Type: "cpu", ServerID: "srv-1", Title: "CPU high", Message: "95%"})
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+	list := func(filter NotificationFilter) []NotificationEvent {
+		t.Helper()
+		events, _, err := ListNotifications(helper.db, filter, 100, 0)
+		if err != nil {
+			t.Fatalf("ListNotifications failed: %v", err)
+		}
+		return events
+	}
+
+	t.Run("Delivered", func(t *testing.T) {
+		enqueue("a1")
+		if n := queue.processDue(time.Now()); n != 1 {
+			t.Fatalf("Expected 1 notification processed, got %d", n)
+		}
+		events := list(NotificationFilter{AlertID: "a1"})
+		if len(events) != 1 || events[0].Status != NotificationSent || received.Load() != 1 {
+			t.Errorf("Expected a delivered notification, got %+v (received %d)", events, received.Load())
+		}
+	})
+
+	t.Run("RetriedWithBackoff", func(t *testing.T) {
+		failing.Store(true)
+		enqueue("a2")
+		queue.processDue(time.Now())
+
+		event := list(NotificationFilter{AlertID: "a2"})[0]
+		if event.Status != NotificationPending || event.RetryCount != 1 || event.Error == "" || event.NextAttemptAt == nil {
+			t.Fatalf("Expected a pending retry, got %+v", event)
+		}
+		if wait := time.Until(*event.NextAttemptAt); wait < notificationRetryBase-2*time.Second {
+			t.Errorf("Expected retry after backoff, got %v", wait)
+		}
+
+		// Not due yet
+		if n := queue.processDue(time.Now()); n != 0 {
+			t.Errorf("Expected no due notifications, got %d", n)
+		}
+
+		// A restarted queue picks the notification up once it is due
+		failing.Store(false)
+		restarted := NewNotificationQueue(state, helper.db)
+		if n := restarted.processDue(time.Now().Add(time.Minute)); n != 1 {
+			t.Fatalf("Expected the retry to be processed, got %d", n)
+		}
+		event = list(NotificationFilter{AlertID: "a2"})[0]
+		if event.Status != NotificationSent || event.RetryCount != 1 {
+			t.Errorf("Expected the retry to be delivered, got %+v", event)
+		}
+	})
+
+	t.Run("OrderedPerAlert", func(t *testing.T) {
+		resolve := func(alertID string) {
+			t.Helper()
+			err := queue.Enqueue(NotificationEvent{AlertID: alertID, ChannelID: "hook", ChannelName: "Hook", Type: "cpu", ServerID: "srv-1", Title: "CPU recovered", Resolved: true})
+			if err != nil {
+				t.Fatalf("Enqueue failed: %v", err)
+			}
+		}
+		status := func(alertID string) (firing, resolved NotificationEvent) {
+			t.Helper()
+			events := list(NotificationFilter{AlertID: alertID})
+			if len(events) != 2 {
+				t.Fatalf("Expected 2 notifications for %s, got %+v", alertID, events)
+			}
+			return events[1], events[0]
+		}
+
+		// Both due: the recovery is held back in the round the firing fails
+		failing.Store(true)
+		enqueue("a5")
+		resolve("a5")
+		if n := queue.processDue(time.Now()); n != 2 {
+			t.Fatalf("Expected 2 notifications processed, got %d", n)
+		}
+		firing, resolved := status("a5")
+		if firing.RetryCount != 1 || resolved.Status != NotificationPending || resolved.RetryCount != 0 {
+			t.Fatalf("Expected only the firing to be attempted, got %+v / %+v", firing, resolved)
+		}
+
+		// The recovery waits for the retry of the firing
+		failing.Store(false)
+		before := received.Load()
+		if n := queue.processDue(time.Now()); n != 0 {
+			t.Errorf("Expected the recovery to wait for the firing, got %d processed", n)
+		}
+		if n := queue.processDue(time.Now().Add(time.Minute)); n != 2 {
+			t.Fatalf("Expected both notifications to be processed, got %d", n)
+		}
+		firing, resolved = status("a5")
+		if firing.Status != NotificationSent || resolved.Status != NotificationSent || received.Load() != before+2 {
+			t.Errorf("Expected both notifications delivered, got %+v / %+v", firing, resolved)
+		}
+		if resolved.SentAt.Before(firing.SentAt) {
+			t.Errorf("Expected the recovery after the firing, got %v before %v", resolved.SentAt, firing.SentAt)
+		}
+	})
+
+	t.Run("DeadLetterAndResend", func(t *testing.T) {
+		failing.Store(true)
+		enqueue("a3")
+		at := time.Now()
+		for i := 0; i < notificationMaxAttempts; i++ {
+			queue.processDue(at)
+			at = at.Add(notificationRetryMax + time.Minute)
+		}
+		failed := list(NotificationFilter{Status: NotificationFailed})
+		if len(failed) != 1 || failed[0].AlertID != "a3" || failed[0].RetryCount != notificationMaxAttempts {
+			t.Fatalf("Expected a3 to end up failed, got %+v", failed)
+		}
+
+		failing.Store(false)
+		router := gin.New()
+		router.GET("/api/alerts/notifications", state.GetNotifications)
+		router.POST("/api/alerts/:id/mute", state.MuteAlert)
+		router.POST("/api/alerts/notifications/:id/resend", state.ResendNotification)
+		oldEngine := alertEngine
+		alertEngine = &AlertEngine{queue: queue}
+		defer func() { alertEngine = oldEngine }()
+
+		request := func(method, path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			return w
+		}
+
+		path := "/api/alerts/notifications/" + strconv.FormatInt(failed[0].ID, 10) + "/resend"
+		if w := request("POST", path); w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if w := request("POST", path); w.Code != http.StatusConflict {
+			t.Errorf("Expected status %d for a queued notification, got %d", http.StatusConflict, w.Code)
+		}
+		queue.processDue(time.Now())
+
+		w := request("GET", "/api/alerts/notifications?alert_id=a3")
+		var resp struct {
+			Notifications []NotificationEvent `json:"notifications"`
+			Total         int                 `json:"total"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Total != 1 || resp.Notifications[0].Status != NotificationSent {
+			t.Errorf("Expected the resent notification to be delivered, got %+v", resp)
+		}
+
+		// Resending a delivered notification records a new entry
+		if w := request("POST", path); w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if events := list(NotificationFilter{AlertID: "a3"}); len(events) != 2 || events[0].Status != NotificationPending {
+			t.Errorf("Expected a new pending entry, got %+v", events)
+		}
+		if w := request("POST", "/api/alerts/notifications/9999/resend"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("DisabledChannel", func(t *testing.T) {
+		alertConfig.Channels[0].Enabled = false
+		enqueue("a4")
+		queue.processDue(time.Now())
+		if event := list(NotificationFilter{AlertID: "a4"})[0]; event.Status != NotificationFailed {
+			t.Errorf("Expected notification for a disabled channel to fail, got %+v", event)
+		}
+	})
+}
+
+// TestNotificationBackoff tests the retry schedule
+func TestNotificationBackoff(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		4: 4 * time.Minute,
+		7: 30 * time.Minute,
+		9: 30 * time.Minute,
+	} {
+		if got := notificationBackoff(failures); got != want {
+			t.Errorf("notificationBackoff(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
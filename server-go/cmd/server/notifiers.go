@@ -2,13 +2,23 @@ package main
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,9 +27,10 @@ import (
 // Notifier Interface
 // ============================================================================
 
-// Notifier interface for all notification channels
+// Notifier interface for all notification channels. Send formats the
+// event's title and message (see AlertEvent.Format) for the channel.
 type Notifier interface {
-	Send(title, message string) error
+	Send(event *AlertEvent) error
 	Type() string
 	Validate() error
 }
@@ -39,6 +50,24 @@ func CreateNotifier(channel NotificationChannel) (Notifier, error) {
 		return NewBarkNotifier(channel.Config)
 	case "serverchan":
 		return NewServerChanNotifier(channel.Config)
+	case "slack":
+		return NewSlackNotifier(channel.Config)
+	case "teams":
+		return NewTeamsNotifier(channel.Config)
+	case "matrix":
+		return NewMatrixNotifier(channel.Config)
+	case "ntfy":
+		return NewNtfyNotifier(channel.Config)
+	case "gotify":
+		return NewGotifyNotifier(channel.Config)
+	case "pagerduty":
+		return NewPagerDutyNotifier(channel.Config)
+	case "dingtalk":
+		return NewDingTalkNotifier(channel.Config)
+	case "feishu":
+		return NewFeishuNotifier(channel.Config)
+	case "wecom":
+		return NewWeComNotifier(channel.Config)
 	default:
 		return nil, fmt.Errorf("unknown notification channel type: %s", channel.Type)
 	}
@@ -96,26 +125,18 @@ func (e *EmailNotifier) Validate() error {
 	return nil
 }
 
-func (e *EmailNotifier) Send(title, message string) error {
+// Send sends the message as plain text and HTML, with an acknowledge link
+// below the message
+func (e *EmailNotifier) Send(event *AlertEvent) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
 	addr := e.SMTPHost + ":" + e.SMTPPort
-	
-	// Build email
-	header := make(map[string]string)
-	header["From"] = e.From
-	header["To"] = strings.Join(e.To, ",")
-	header["Subject"] = title
-	header["MIME-Version"] = "1.0"
-	header["Content-Type"] = "text/plain; charset=UTF-8"
-
-	body := ""
-	for k, v := range header {
-		body += fmt.Sprintf("%s: %s\r\n", k, v)
+	body, err := e.buildMessage(event)
+	if err != nil {
+		return err
 	}
-	body += "\r\n" + message
 
 	var auth smtp.Auth
 	if e.Username != "" && e.Password != "" {
@@ -160,7 +181,7 @@ func (e *EmailNotifier) Send(title, message string) error {
 		if err != nil {
 			return fmt.Errorf("DATA failed: %v", err)
 		}
-		if _, err := w.Write([]byte(body)); err != nil {
+		if _, err := w.Write(body); err != nil {
 			return fmt.Errorf("write failed: %v", err)
 		}
 		if err := w.Close(); err != nil {
@@ -170,27 +191,95 @@ func (e *EmailNotifier) Send(title, message string) error {
 	}
 
 	// Standard connection
-	return smtp.SendMail(addr, auth, e.From, e.To, []byte(body))
+	return smtp.SendMail(addr, auth, e.From, e.To, body)
+}
+
+// buildMessage builds the email as multipart/alternative with a plain text
+// and an HTML part
+func (e *EmailNotifier) buildMessage(event *AlertEvent) ([]byte, error) {
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	text := event.PlainMessage()
+	if event.AckURL != "" {
+		text += "\n\n确认告警: " + event.AckURL
+	}
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", emailHTML(event)},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.content))
+		qp.Close()
+	}
+	mw.Close()
+	
+	// Build email
+	header := make(map[string]string)
+	header["From"] = e.From
+	header["To"] = strings.Join(e.To, ",")
+	header["Subject"] = mime.QEncoding.Encode("UTF-8", event.Title)
+	header["MIME-Version"] = "1.0"
+	header["Content-Type"] = "multipart/alternative; boundary=" + mw.Boundary()
+
+	var body bytes.Buffer
+	for k, v := range header {
+		fmt.Fprintf(&body, "%s: %s\r\n", k, v)
+	}
+	body.WriteString("\r\n")
+	body.Write(parts.Bytes())
+	return body.Bytes(), nil
+}
+
+// emailHTML renders the HTML part of an alert email, with a header colored
+// by severity
+func emailHTML(event *AlertEvent) string {
+	var b strings.Builder
+	b.WriteString(`<div style="font-family:-apple-system,'Segoe UI',sans-serif;max-width:640px;margin:0 auto">`)
+	fmt.Fprintf(&b, `<div style="background:%s;color:#fff;padding:14px 18px;font-size:16px;font-weight:600">%s %s</div>`,
+		event.HexColor(), event.Emoji(), html.EscapeString(event.Title))
+	b.WriteString(`<div style="border:1px solid #e5e7eb;border-top:0;padding:18px;line-height:1.6;color:#1f2937">`)
+	b.WriteString(event.HTMLMessage())
+	if event.AckURL != "" {
+		fmt.Fprintf(&b, `<p style="margin-top:20px"><a href="%s" style="background:#2563eb;color:#fff;padding:8px 16px;border-radius:4px;text-decoration:none">确认告警</a></p>`,
+			html.EscapeString(event.AckURL))
+	}
+	b.WriteString(`</div></div>`)
+	return b.String()
 }
 
 // ============================================================================
 // Telegram Notifier
 // ============================================================================
 
+const telegramAPIURL = "https://api.telegram.org"
+
 type TelegramNotifier struct {
 	BotToken        string
 	ChatID          string
 	MessageThreadID string
 	Silent          bool
+	APIURL          string // Bot API server, for self-hosted servers
 }
 
 func NewTelegramNotifier(config map[string]string) (*TelegramNotifier, error) {
-	return &TelegramNotifier{
+	t := &TelegramNotifier{
 		BotToken:        config["bot_token"],
 		ChatID:          config["chat_id"],
 		MessageThreadID: config["message_thread_id"],
 		Silent:          config["silent"] == "true",
-	}, nil
+		APIURL:          strings.TrimSuffix(config["api_url"], "/"),
+	}
+	if t.APIURL == "" {
+		t.APIURL = telegramAPIURL
+	}
+	return t, nil
 }
 
 func (t *TelegramNotifier) Type() string { return "telegram" }
@@ -205,19 +294,31 @@ func (t *TelegramNotifier) Validate() error {
 	return nil
 }
 
-func (t *TelegramNotifier) Send(title, message string) error {
+// Send sends the message with an inline acknowledge button. HTML messages
+// use Telegram's HTML mode, others MarkdownV2.
+func (t *TelegramNotifier) Send(event *AlertEvent) error {
 	if err := t.Validate(); err != nil {
 		return err
 	}
 
-	text := fmt.Sprintf("*%s*\n\n%s", escapeMarkdownV2(title), escapeMarkdownV2(message))
+	parseMode := "MarkdownV2"
+	var text string
+	switch event.Format {
+	case FormatHTML:
+		parseMode = "HTML"
+		text = fmt.Sprintf("%s <b>%s</b>\n\n%s", event.Emoji(), html.EscapeString(event.Title), telegramHTML(event.Message))
+	case FormatMarkdown:
+		text = fmt.Sprintf("%s *%s*\n\n%s", event.Emoji(), escapeMarkdownV2(event.Title), markdownToTelegram(event.Message))
+	default:
+		text = fmt.Sprintf("%s *%s*\n\n%s", event.Emoji(), escapeMarkdownV2(event.Title), escapeMarkdownV2(event.Message))
+	}
 	
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", t.BotToken)
+	apiURL := fmt.Sprintf("%s/bot%s/sendMessage", t.APIURL, t.BotToken)
 	
 	payload := map[string]interface{}{
 		"chat_id":    t.ChatID,
 		"text":       text,
-		"parse_mode": "MarkdownV2",
+		"parse_mode": parseMode,
 	}
 	if t.MessageThreadID != "" {
 		payload["message_thread_id"] = t.MessageThreadID
@@ -225,13 +326,20 @@ func (t *TelegramNotifier) Send(title, message string) error {
 	if t.Silent {
 		payload["disable_notification"] = true
 	}
+	if event.AckURL != "" {
+		payload["reply_markup"] = map[string]interface{}{
+			"inline_keyboard": [][]map[string]string{
+				{{"text": "✅ 确认告警", "url": event.AckURL}},
+			},
+		}
+	}
 
 	return postJSON(apiURL, payload)
 }
 
 // escapeMarkdownV2 escapes special characters for Telegram MarkdownV2
 func escapeMarkdownV2(s string) string {
-	chars := []string{"_", "*", "[", "]", "(", ")", "~", "`", ">", "#", "+", "-", "=", "|", "{", "}", ".", "!"}
+	chars := []string{"\\", "_", "*", "[", "]", "(", ")", "~", "`", ">", "#", "+", "-", "=", "|", "{", "}", ".", "!"}
 	result := s
 	for _, c := range chars {
 		result = strings.ReplaceAll(result, c, "\\"+c)
@@ -239,6 +347,38 @@ func escapeMarkdownV2(s string) string {
 	return result
 }
 
+// markdownToTelegram converts inline Markdown to Telegram MarkdownV2,
+// escaping everything else
+func markdownToTelegram(s string) string {
+	return markdownInline(s, escapeMarkdownV2, func(kind, content, link string) string {
+		switch kind {
+		case "bold":
+			return "*" + escapeMarkdownV2(content) + "*"
+		case "italic":
+			return "_" + escapeMarkdownV2(content) + "_"
+		case "code":
+			return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(content) + "`"
+		default:
+			return "[" + escapeMarkdownV2(content) + "](" + strings.NewReplacer("\\", "\\\\", ")", "\\)").Replace(link) + ")"
+		}
+	})
+}
+
+// telegramTagPattern matches HTML tags, capturing the tag name
+var telegramTagPattern = regexp.MustCompile(`(?i)</?([a-z][a-z0-9-]*)\b[^>]*>`)
+
+// telegramHTML reduces HTML to the tags Telegram supports
+func telegramHTML(s string) string {
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(telegramTagPattern.ReplaceAllStringFunc(s, func(tag string) string {
+		switch strings.ToLower(telegramTagPattern.FindStringSubmatch(tag)[1]) {
+		case "b", "strong", "i", "em", "u", "ins", "s", "strike", "del", "a", "code", "pre", "blockquote", "tg-spoiler":
+			return tag
+		}
+		return ""
+	}))
+}
+
 // ============================================================================
 // Discord Notifier
 // ============================================================================
@@ -266,16 +406,39 @@ func (d *DiscordNotifier) Validate() error {
 	return nil
 }
 
-func (d *DiscordNotifier) Send(title, message string) error {
+// Send sends an embed colored by severity, with the alert's details as
+// fields and the acknowledge link as the embed's link
+func (d *DiscordNotifier) Send(event *AlertEvent) error {
 	if err := d.Validate(); err != nil {
 		return err
 	}
 
 	embed := map[string]interface{}{
-		"title":       title,
-		"description": message,
-		"color":       16711680, // Red
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"title":       truncateRunes(event.Emoji()+" "+event.Title, 256),
+		"description": truncateRunes(event.MarkdownMessage(), 4096),
+		"color":       event.Color(),
+		"timestamp":   event.Time.UTC().Format(time.RFC3339),
+	}
+	var fields []map[string]interface{}
+	if alert := event.Alert(); alert != nil && !event.Resolved() {
+		fields = append(fields,
+			map[string]interface{}{"name": "服务器", "value": alert.ServerName, "inline": true},
+			map[string]interface{}{"name": "级别", "value": alert.Severity, "inline": true},
+		)
+		if alert.Threshold != 0 {
+			fields = append(fields, map[string]interface{}{
+				"name":   "当前值 / 阈值",
+				"value":  fmt.Sprintf("%.1f / %.1f", alert.Value, alert.Threshold),
+				"inline": true,
+			})
+		}
+	}
+	if event.AckURL != "" {
+		embed["url"] = event.AckURL
+		fields = append(fields, map[string]interface{}{"name": "确认告警", "value": "[✅ 确认](" + event.AckURL + ")"})
+	}
+	if len(fields) > 0 {
+		embed["fields"] = fields
 	}
 
 	payload := map[string]interface{}{
@@ -300,6 +463,7 @@ type WebhookNotifier struct {
 	Method      string
 	Headers     map[string]string
 	BodyFormat  string // json, form
+	Secret      string // Signs the body when set
 }
 
 func NewWebhookNotifier(config map[string]string) (*WebhookNotifier, error) {
@@ -307,6 +471,7 @@ func NewWebhookNotifier(config map[string]string) (*WebhookNotifier, error) {
 		URL:        config["url"],
 		Method:     strings.ToUpper(config["method"]),
 		BodyFormat: config["body_format"],
+		Secret:     config["secret"],
 		Headers:    make(map[string]string),
 	}
 	if n.Method == "" {
@@ -336,33 +501,45 @@ func (w *WebhookNotifier) Validate() error {
 	return nil
 }
 
-func (w *WebhookNotifier) Send(title, message string) error {
+// Send sends the event as JSON (the AlertEvent schema) or as flat form
+// fields. POSTing to ack_url acknowledges the alert.
+func (w *WebhookNotifier) Send(event *AlertEvent) error {
 	if err := w.Validate(); err != nil {
 		return err
 	}
 
-	var body io.Reader
+	var body []byte
 	contentType := "application/json"
 
-	payload := map[string]string{
-		"title":   title,
-		"message": message,
-		"time":    time.Now().Format(time.RFC3339),
-	}
-
 	if w.BodyFormat == "form" {
 		form := url.Values{}
-		for k, v := range payload {
-			form.Add(k, v)
+		form.Set("version", strconv.Itoa(event.Version))
+		form.Set("status", event.Status)
+		form.Set("type", event.Type)
+		form.Set("severity", event.Severity)
+		form.Set("title", event.Title)
+		form.Set("message", event.Message)
+		form.Set("format", event.Format)
+		form.Set("time", event.Time.Format(time.RFC3339))
+		if event.AckURL != "" {
+			form.Set("ack_url", event.AckURL)
 		}
-		body = strings.NewReader(form.Encode())
+		if alert := event.Alert(); alert != nil {
+			form.Set("alert_id", alert.ID)
+			form.Set("server_id", alert.ServerID)
+			form.Set("server_name", alert.ServerName)
+		}
+		body = []byte(form.Encode())
 		contentType = "application/x-www-form-urlencoded"
 	} else {
-		jsonData, _ := json.Marshal(payload)
-		body = bytes.NewReader(jsonData)
+		jsonData, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		body = jsonData
 	}
 
-	req, err := http.NewRequest(w.Method, w.URL, body)
+	req, err := http.NewRequest(w.Method, w.URL, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -371,6 +548,11 @@ func (w *WebhookNotifier) Send(title, message string) error {
 	for k, v := range w.Headers {
 		req.Header.Set(k, v)
 	}
+	if w.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Vstats-Timestamp", timestamp)
+		req.Header.Set("X-Vstats-Signature", webhookSignature(w.Secret, timestamp, body))
+	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
@@ -387,6 +569,15 @@ func (w *WebhookNotifier) Send(title, message string) error {
 	return nil
 }
 
+// webhookSignature returns the X-Vstats-Signature header of a webhook body:
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // ============================================================================
 // Bark Notifier (iOS Push)
 // ============================================================================
@@ -422,14 +613,21 @@ func (b *BarkNotifier) Validate() error {
 	return nil
 }
 
-func (b *BarkNotifier) Send(title, message string) error {
+// Send pushes the message; tapping it opens the acknowledge link
+func (b *BarkNotifier) Send(event *AlertEvent) error {
 	if err := b.Validate(); err != nil {
 		return err
 	}
 
 	payload := map[string]interface{}{
-		"title": title,
-		"body":  message,
+		"title": event.Title,
+		"body":  event.PlainMessage(),
+	}
+	if event.AckURL != "" {
+		payload["url"] = event.AckURL
+	}
+	if event.Severity == "critical" && !event.Resolved() {
+		payload["level"] = "timeSensitive"
 	}
 	if b.Sound != "" {
 		payload["sound"] = b.Sound
@@ -470,7 +668,7 @@ func (s *ServerChanNotifier) Validate() error {
 	return nil
 }
 
-func (s *ServerChanNotifier) Send(title, message string) error {
+func (s *ServerChanNotifier) Send(event *AlertEvent) error {
 	if err := s.Validate(); err != nil {
 		return err
 	}
@@ -478,9 +676,13 @@ func (s *ServerChanNotifier) Send(title, message string) error {
 	// ServerChan Turbo API
 	apiURL := fmt.Sprintf("https://sctapi.ftqq.com/%s.send", s.SendKey)
 	
+	desp := markdownLines(event.MarkdownMessage())
+	if event.AckURL != "" {
+		desp += "\n\n[确认告警](" + event.AckURL + ")"
+	}
 	payload := map[string]interface{}{
-		"title": title,
-		"desp":  message,
+		"title": event.Title,
+		"desp":  desp,
 	}
 	if s.Channel != "" {
 		payload["channel"] = s.Channel
@@ -495,16 +697,25 @@ func (s *ServerChanNotifier) Send(title, message string) error {
 
 // postJSON sends a JSON POST request
 func postJSON(url string, payload interface{}) error {
+	return sendJSON("POST", url, nil, payload, nil)
+}
+
+// sendJSON sends a JSON request with extra headers and, when result is not
+// nil, decodes the JSON response into it
+func sendJSON(method, url string, headers map[string]string, payload, result interface{}) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
+	req, err := http.NewRequest(method, url, bytes.NewReader(jsonData))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
@@ -518,6 +729,23 @@ func postJSON(url string, payload interface{}) error {
 		return fmt.Errorf("request returned status %d: %s", resp.StatusCode, string(respBody))
 	}
 
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("invalid response: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateURL checks that a config value is an http(s) URL
+func validateURL(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http(s) URL", field)
+	}
 	return nil
 }
 
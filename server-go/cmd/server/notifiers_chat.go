@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// ============================================================================
+// Slack Notifier
+// ============================================================================
+
+type SlackNotifier struct {
+	WebhookURL string
+	Channel    string
+	Username   string
+	IconEmoji  string
+}
+
+func NewSlackNotifier(config map[string]string) (*SlackNotifier, error) {
+	return &SlackNotifier{
+		WebhookURL: config["webhook_url"],
+		Channel:    config["channel"],
+		Username:   config["username"],
+		IconEmoji:  config["icon_emoji"],
+	}, nil
+}
+
+func (s *SlackNotifier) Type() string { return "slack" }
+
+func (s *SlackNotifier) Validate() error {
+	return validateURL("webhook_url", s.WebhookURL)
+}
+
+// Send sends a Block Kit message, in an attachment colored by severity, with
+// an acknowledge button
+func (s *SlackNotifier) Send(event *AlertEvent) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	title := event.Emoji() + " " + event.Title
+	blocks := []map[string]interface{}{
+		{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": truncateRunes(title, 150), "emoji": true},
+		},
+		{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": truncateRunes(slackMrkdwn(event.MarkdownMessage()), 3000)},
+		},
+	}
+	if event.AckURL != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []map[string]interface{}{{
+				"type":  "button",
+				"text":  map[string]interface{}{"type": "plain_text", "text": "✅ 确认告警"},
+				"url":   event.AckURL,
+				"style": "primary",
+			}},
+		})
+	}
+
+	payload := map[string]interface{}{
+		"text": title, // Shown in notifications and by clients without blocks
+		"attachments": []map[string]interface{}{
+			{"color": event.HexColor(), "blocks": blocks},
+		},
+	}
+	if s.Channel != "" {
+		payload["channel"] = s.Channel
+	}
+	if s.Username != "" {
+		payload["username"] = s.Username
+	}
+	if s.IconEmoji != "" {
+		payload["icon_emoji"] = s.IconEmoji
+	}
+
+	return postJSON(s.WebhookURL, payload)
+}
+
+// escapeSlack escapes the characters Slack treats as control sequences
+func escapeSlack(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// slackMrkdwn converts inline Markdown to Slack mrkdwn, escaping everything
+// else
+func slackMrkdwn(s string) string {
+	return markdownInline(s, escapeSlack, func(kind, content, link string) string {
+		switch kind {
+		case "bold":
+			return "*" + escapeSlack(content) + "*"
+		case "italic":
+			return "_" + escapeSlack(content) + "_"
+		case "code":
+			return "`" + escapeSlack(content) + "`"
+		default:
+			return "<" + link + "|" + escapeSlack(content) + ">"
+		}
+	})
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// ============================================================================
+// Microsoft Teams Notifier
+// ============================================================================
+
+// TeamsNotifier posts an Adaptive Card to a Teams incoming webhook or a
+// Power Automate "post to a channel when a webhook request is received" flow
+type TeamsNotifier struct {
+	WebhookURL string
+}
+
+func NewTeamsNotifier(config map[string]string) (*TeamsNotifier, error) {
+	return &TeamsNotifier{
+		WebhookURL: config["webhook_url"],
+	}, nil
+}
+
+func (t *TeamsNotifier) Type() string { return "teams" }
+
+func (t *TeamsNotifier) Validate() error {
+	return validateURL("webhook_url", t.WebhookURL)
+}
+
+// Send sends an Adaptive Card with the alert's details and an acknowledge
+// action
+func (t *TeamsNotifier) Send(event *AlertEvent) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	color := "Accent"
+	switch {
+	case event.Resolved():
+		color = "Good"
+	case event.Severity == "critical":
+		color = "Attention"
+	case event.Severity == "warning":
+		color = "Warning"
+	}
+	body := []map[string]interface{}{
+		{"type": "TextBlock", "text": event.Emoji() + " " + event.Title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+		{"type": "TextBlock", "text": event.MarkdownMessage(), "wrap": true},
+	}
+	if alert := event.Alert(); alert != nil {
+		body = append(body, map[string]interface{}{
+			"type": "FactSet",
+			"facts": []map[string]string{
+				{"title": "服务器", "value": alert.ServerName},
+				{"title": "级别", "value": alert.Severity},
+				{"title": "开始时间", "value": alert.StartedAt.Format("2006-01-02 15:04:05")},
+			},
+		})
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if event.AckURL != "" {
+		card["actions"] = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "✅ 确认告警", "url": event.AckURL},
+		}
+	}
+
+	payload := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+	return postJSON(t.WebhookURL, payload)
+}
+
+// ============================================================================
+// Matrix Notifier
+// ============================================================================
+
+type MatrixNotifier struct {
+	Homeserver  string
+	AccessToken string
+	RoomID      string
+}
+
+func NewMatrixNotifier(config map[string]string) (*MatrixNotifier, error) {
+	return &MatrixNotifier{
+		Homeserver:  strings.TrimSuffix(config["homeserver"], "/"),
+		AccessToken: config["access_token"],
+		RoomID:      config["room_id"],
+	}, nil
+}
+
+func (m *MatrixNotifier) Type() string { return "matrix" }
+
+func (m *MatrixNotifier) Validate() error {
+	if err := validateURL("homeserver", m.Homeserver); err != nil {
+		return err
+	}
+	if m.AccessToken == "" {
+		return fmt.Errorf("access_token is required")
+	}
+	if !strings.HasPrefix(m.RoomID, "!") {
+		return fmt.Errorf("room_id must be an internal room ID (!...), not an alias")
+	}
+	return nil
+}
+
+// Send sends an HTML formatted message with an acknowledge link
+func (m *MatrixNotifier) Send(event *AlertEvent) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	title := event.Emoji() + " " + event.Title
+	text := title + "\n\n" + event.PlainMessage()
+	formatted := "<b>" + html.EscapeString(title) + "</b><br>" + event.HTMLMessage()
+	if event.AckURL != "" {
+		text += "\n\n确认告警: " + event.AckURL
+		formatted += `<br><br><a href="` + html.EscapeString(event.AckURL) + `">✅ 确认告警</a>`
+	}
+
+	payload := map[string]interface{}{
+		"msgtype":        "m.text",
+		"body":           text,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	}
+	apiURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.Homeserver, url.PathEscape(m.RoomID), GenerateRandomString(16))
+	return sendJSON("PUT", apiURL, map[string]string{"Authorization": "Bearer " + m.AccessToken}, payload, nil)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// DingTalk Notifier (钉钉群机器人)
+// ============================================================================
+
+type DingTalkNotifier struct {
+	WebhookURL string
+	Secret     string   // 加签密钥 (SEC...), optional
+	AtMobiles  []string // Phone numbers to @ in the group
+	AtAll      bool
+}
+
+func NewDingTalkNotifier(config map[string]string) (*DingTalkNotifier, error) {
+	return &DingTalkNotifier{
+		WebhookURL: config["webhook_url"],
+		Secret:     config["secret"],
+		AtMobiles:  splitList(config["at_mobiles"]),
+		AtAll:      config["at_all"] == "true",
+	}, nil
+}
+
+func (d *DingTalkNotifier) Type() string { return "dingtalk" }
+
+func (d *DingTalkNotifier) Validate() error {
+	if err := validateURL("webhook_url", d.WebhookURL); err != nil {
+		return err
+	}
+	if d.Secret != "" && !strings.HasPrefix(d.Secret, "SEC") {
+		return fmt.Errorf("secret must be the signing secret starting with SEC")
+	}
+	return nil
+}
+
+// Send sends a markdown message with an acknowledge link
+func (d *DingTalkNotifier) Send(event *AlertEvent) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	title := event.Emoji() + " " + event.Title
+	text := "### " + title + "\n\n" + markdownLines(event.MarkdownMessage())
+	if event.AckURL != "" {
+		text += "\n\n[✅ 确认告警](" + event.AckURL + ")"
+	}
+	for _, mobile := range d.AtMobiles {
+		text += " @" + mobile // Mentions only notify when the number is in the text
+	}
+
+	payload := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": title, "text": text},
+		"at":       map[string]interface{}{"atMobiles": d.AtMobiles, "isAtAll": d.AtAll},
+	}
+
+	apiURL := d.WebhookURL
+	if d.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sign := hmacSHA256Base64([]byte(d.Secret), timestamp+"\n"+d.Secret)
+		apiURL = addQuery(apiURL, url.Values{"timestamp": {timestamp}, "sign": {sign}})
+	}
+
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := sendJSON("POST", apiURL, nil, payload, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// ============================================================================
+// Feishu / Lark Notifier (飞书群机器人)
+// ============================================================================
+
+type FeishuNotifier struct {
+	WebhookURL string
+	Secret     string // 签名校验密钥, optional
+}
+
+func NewFeishuNotifier(config map[string]string) (*FeishuNotifier, error) {
+	return &FeishuNotifier{
+		WebhookURL: config["webhook_url"],
+		Secret:     config["secret"],
+	}, nil
+}
+
+func (f *FeishuNotifier) Type() string { return "feishu" }
+
+func (f *FeishuNotifier) Validate() error {
+	return validateURL("webhook_url", f.WebhookURL)
+}
+
+// Send sends an interactive card, with a header colored by severity and an
+// acknowledge button
+func (f *FeishuNotifier) Send(event *AlertEvent) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	elements := []map[string]interface{}{
+		{"tag": "div", "text": map[string]string{"tag": "lark_md", "content": event.MarkdownMessage()}},
+	}
+	if event.AckURL != "" {
+		elements = append(elements, map[string]interface{}{
+			"tag": "action",
+			"actions": []map[string]interface{}{{
+				"tag":  "button",
+				"text": map[string]string{"tag": "plain_text", "content": "✅ 确认告警"},
+				"type": "primary",
+				"url":  event.AckURL,
+			}},
+		})
+	}
+
+	template := "blue"
+	switch {
+	case event.Resolved():
+		template = "green"
+	case event.Severity == "critical":
+		template = "red"
+	case event.Severity == "warning":
+		template = "orange"
+	}
+	payload := map[string]interface{}{
+		"msg_type": "interactive",
+		"card": map[string]interface{}{
+			"header": map[string]interface{}{
+				"title":    map[string]string{"tag": "plain_text", "content": event.Title},
+				"template": template,
+			},
+			"elements": elements,
+		},
+	}
+	if f.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		// Feishu signs an empty message with the timestamp and secret as key
+		payload["timestamp"] = timestamp
+		payload["sign"] = hmacSHA256Base64([]byte(timestamp+"\n"+f.Secret), "")
+	}
+
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := sendJSON("POST", f.WebhookURL, nil, payload, &result); err != nil {
+		return err
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("feishu error %d: %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// ============================================================================
+// WeCom Notifier (企业微信群机器人)
+// ============================================================================
+
+type WeComNotifier struct {
+	WebhookURL string
+}
+
+func NewWeComNotifier(config map[string]string) (*WeComNotifier, error) {
+	webhookURL := config["webhook_url"]
+	// Accept the bare robot key as well as the full webhook address
+	if key := config["key"]; webhookURL == "" && key != "" {
+		webhookURL = "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=" + url.QueryEscape(key)
+	}
+	return &WeComNotifier{
+		WebhookURL: webhookURL,
+	}, nil
+}
+
+func (w *WeComNotifier) Type() string { return "wecom" }
+
+func (w *WeComNotifier) Validate() error {
+	return validateURL("webhook_url", w.WebhookURL)
+}
+
+// Send sends a markdown message with an acknowledge link
+func (w *WeComNotifier) Send(event *AlertEvent) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	// WeCom markdown only has the info (green), comment (grey) and warning
+	// (orange) colors
+	color := "warning"
+	if event.Resolved() {
+		color = "info"
+	}
+	content := `## <font color="` + color + `">` + event.Title + "</font>\n" + event.MarkdownMessage()
+	if event.AckURL != "" {
+		content += "\n[确认告警](" + event.AckURL + ")"
+	}
+	payload := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": truncateBytes(content, 4096)},
+	}
+
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := sendJSON("POST", w.WebhookURL, nil, payload, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("wecom error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// hmacSHA256Base64 returns the base64 HMAC-SHA256 of message
+func hmacSHA256Base64(key []byte, message string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// addQuery adds parameters to a URL that may already have a query
+func addQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// markdownLines keeps single line breaks in markdown that would otherwise
+// join the lines
+func markdownLines(s string) string {
+	return strings.ReplaceAll(s, "\n", "  \n")
+}
+
+// splitList splits a comma separated config value
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// truncateBytes shortens s to at most n bytes without splitting characters
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// ntfy Notifier
+// ============================================================================
+
+type NtfyNotifier struct {
+	ServerURL string
+	Topic     string
+	Token     string
+	Username  string
+	Password  string
+	Priority  int
+	Tags      []string
+}
+
+func NewNtfyNotifier(config map[string]string) (*NtfyNotifier, error) {
+	serverURL := config["server_url"]
+	if serverURL == "" {
+		serverURL = "https://ntfy.sh"
+	}
+	n := &NtfyNotifier{
+		ServerURL: strings.TrimSuffix(serverURL, "/"),
+		Topic:     config["topic"],
+		Token:     config["token"],
+		Username:  config["username"],
+		Password:  config["password"],
+		Tags:      splitList(config["tags"]),
+	}
+	if p := config["priority"]; p != "" {
+		priority, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("priority must be a number from 1 to 5")
+		}
+		n.Priority = priority
+	}
+	return n, nil
+}
+
+func (n *NtfyNotifier) Type() string { return "ntfy" }
+
+func (n *NtfyNotifier) Validate() error {
+	if err := validateURL("server_url", n.ServerURL); err != nil {
+		return err
+	}
+	if n.Topic == "" || strings.ContainsAny(n.Topic, "/?# ") {
+		return fmt.Errorf("topic is required and must not contain '/', '?', '#' or spaces")
+	}
+	if n.Priority < 0 || n.Priority > 5 {
+		return fmt.Errorf("priority must be a number from 1 to 5")
+	}
+	return nil
+}
+
+// Send publishes the message with an acknowledge action button. Without a
+// configured priority it follows the severity.
+func (n *NtfyNotifier) Send(event *AlertEvent) error {
+	if err := n.Validate(); err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"topic":    n.Topic,
+		"title":    event.Title,
+		"message":  event.MarkdownMessage(),
+		"priority": n.Priority,
+	}
+	if n.Priority == 0 {
+		payload["priority"] = severityPriority(event, 5, 4, 3)
+	}
+	if event.Format == FormatMarkdown {
+		payload["markdown"] = true
+	}
+	if len(n.Tags) > 0 {
+		payload["tags"] = n.Tags
+	}
+	if event.AckURL != "" {
+		payload["actions"] = []map[string]interface{}{
+			{"action": "view", "label": "确认告警", "url": event.AckURL},
+		}
+	}
+
+	headers := map[string]string{}
+	if n.Token != "" {
+		headers["Authorization"] = "Bearer " + n.Token
+	} else if n.Username != "" {
+		headers["Authorization"] = "Basic " + basicAuth(n.Username, n.Password)
+	}
+	// JSON messages are published to the server root
+	return sendJSON("POST", n.ServerURL, headers, payload, nil)
+}
+
+// severityPriority picks the priority of a push notification by severity;
+// recoveries use the lowest given priority
+func severityPriority(event *AlertEvent, critical, warning, other int) int {
+	switch {
+	case event.Resolved():
+		return other
+	case event.Severity == "critical":
+		return critical
+	case event.Severity == "warning":
+		return warning
+	default:
+		return other
+	}
+}
+
+// basicAuth returns the credentials of an HTTP Basic Authorization header
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// ============================================================================
+// Gotify Notifier
+// ============================================================================
+
+type GotifyNotifier struct {
+	ServerURL string
+	AppToken  string
+	Priority  int // 0 follows the severity
+}
+
+func NewGotifyNotifier(config map[string]string) (*GotifyNotifier, error) {
+	g := &GotifyNotifier{
+		ServerURL: strings.TrimSuffix(config["server_url"], "/"),
+		AppToken:  config["app_token"],
+	}
+	if p := config["priority"]; p != "" {
+		priority, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("priority must be a number")
+		}
+		g.Priority = priority
+	}
+	return g, nil
+}
+
+func (g *GotifyNotifier) Type() string { return "gotify" }
+
+func (g *GotifyNotifier) Validate() error {
+	if err := validateURL("server_url", g.ServerURL); err != nil {
+		return err
+	}
+	if g.AppToken == "" {
+		return fmt.Errorf("app_token is required")
+	}
+	return nil
+}
+
+// Send sends the message; clients open the acknowledge link when the
+// notification is clicked
+func (g *GotifyNotifier) Send(event *AlertEvent) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"title":    event.Title,
+		"message":  event.MarkdownMessage(),
+		"priority": g.Priority,
+	}
+	if g.Priority == 0 {
+		payload["priority"] = severityPriority(event, 8, 5, 4)
+	}
+	extras := map[string]interface{}{}
+	if event.Format == FormatMarkdown {
+		extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+	if event.AckURL != "" {
+		extras["client::notification"] = map[string]interface{}{
+			"click": map[string]string{"url": event.AckURL},
+		}
+	}
+	if len(extras) > 0 {
+		payload["extras"] = extras
+	}
+	headers := map[string]string{"X-Gotify-Key": g.AppToken}
+	return sendJSON("POST", g.ServerURL+"/message", headers, payload, nil)
+}
+
+// ============================================================================
+// PagerDuty Notifier
+// ============================================================================
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyNotifier sends Events API v2 events. Each alert is one PagerDuty
+// alert: firing notifications trigger it and the recovery resolves it,
+// matched by a dedup key derived from the alert ID.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	Severity   string // critical, error, warning, info; empty follows the alert
+	APIURL     string
+}
+
+func NewPagerDutyNotifier(config map[string]string) (*PagerDutyNotifier, error) {
+	p := &PagerDutyNotifier{
+		RoutingKey: config["routing_key"],
+		Severity:   config["severity"],
+		APIURL:     config["api_url"],
+	}
+	if p.APIURL == "" {
+		p.APIURL = pagerDutyEventsURL
+	}
+	return p, nil
+}
+
+func (p *PagerDutyNotifier) Type() string { return "pagerduty" }
+
+func (p *PagerDutyNotifier) Validate() error {
+	if len(p.RoutingKey) != 32 {
+		return fmt.Errorf("routing_key must be a 32 character integration key")
+	}
+	switch p.Severity {
+	case "", "critical", "error", "warning", "info":
+	default:
+		return fmt.Errorf("severity must be critical, error, warning or info")
+	}
+	return validateURL("api_url", p.APIURL)
+}
+
+// Send triggers or resolves the PagerDuty alert of a notification.
+// Notifications that are not about a single alert, such as tests and
+// groups, trigger an incident of their own.
+func (p *PagerDutyNotifier) Send(event *AlertEvent) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"routing_key": p.RoutingKey,
+		"client":      "vStats",
+	}
+	alertID := event.AlertID()
+	if alertID != "" {
+		payload["dedup_key"] = pagerDutyDedupKey(alertID)
+	}
+
+	if event.Resolved() {
+		// Without an alert there is nothing to resolve
+		if alertID == "" {
+			return nil
+		}
+		payload["event_action"] = "resolve"
+	} else {
+		source := event.ServerID()
+		if source == "" {
+			source = "vstats"
+		}
+		severity := p.Severity
+		if severity == "" {
+			severity = pagerDutySeverity(event.Severity)
+		}
+		details := map[string]interface{}{"message": event.PlainMessage()}
+		if alert := event.Alert(); alert != nil {
+			details["server_name"] = alert.ServerName
+			details["value"] = alert.Value
+			details["threshold"] = alert.Threshold
+		}
+		payload["event_action"] = "trigger"
+		payload["payload"] = map[string]interface{}{
+			"summary":        truncateRunes(event.Title, 1024),
+			"source":         source,
+			"severity":       severity,
+			"timestamp":      event.Time.UTC().Format(time.RFC3339),
+			"class":          event.Type,
+			"custom_details": details,
+		}
+	}
+
+	var result struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := sendJSON("POST", p.APIURL, nil, payload, &result); err != nil {
+		return err
+	}
+	if result.Status != "success" {
+		return fmt.Errorf("pagerduty rejected the event: %s", result.Message)
+	}
+	return nil
+}
+
+// pagerDutySeverity maps an alert severity to a PagerDuty severity
+func pagerDutySeverity(severity string) string {
+	switch severity {
+	case "critical", "warning", "info":
+		return severity
+	default:
+		return "error"
+	}
+}
+
+// pagerDutyDedupKey returns the dedup key of an alert
+func pagerDutyDedupKey(alertID string) string {
+	return "vstats-" + alertID
+}
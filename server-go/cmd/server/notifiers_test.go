@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capturedRequest is a request received by a notifier stand-in
+type capturedRequest struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// newNotifierStandIn starts a server that records requests and answers
+// with the given JSON body
+func newNotifierStandIn(t *testing.T, response string) (*httptest.Server, *[]capturedRequest) {
+	t.Helper()
+	var requests []capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		req := capturedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header}
+		if err := json.Unmarshal(data, &req.Body); err != nil {
+			t.Errorf("Expected a JSON body, got %q", data)
+		}
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// testEvent returns a message event with an acknowledge link
+func testEvent(title, message, ackURL string) *AlertEvent {
+	event := messageEvent("test", title, message)
+	event.AckURL = ackURL
+	return event
+}
+
+// field walks a decoded JSON body, e.g. field(body, "blocks", 0, "type")
+func field(value interface{}, path ...interface{}) interface{} {
+	for _, key := range path {
+		switch k := key.(type) {
+		case string:
+			m, _ := value.(map[string]interface{})
+			value = m[k]
+		case int:
+			list, _ := value.([]interface{})
+			if k >= len(list) {
+				return nil
+			}
+			value = list[k]
+		}
+	}
+	return value
+}
+
+// TestChatNotifiers tests the Slack, Teams and Matrix notifiers
+func TestChatNotifiers(t *testing.T) {
+	server, requests := newNotifierStandIn(t, `{}`)
+
+	slack, _ := CreateNotifier(NotificationChannel{Type: "slack", Config: map[string]string{"webhook_url": server.URL + "/slack", "channel": "#ops"}})
+	if err := slack.Send(testEvent("[critical] Tokyo CPU", "CPU <95%>", "https://status.example.com/ack")); err != nil {
+		t.Fatalf("Slack send failed: %v", err)
+	}
+	body := (*requests)[0].Body
+	blocks := field(body, "attachments", 0, "blocks")
+	if field(blocks, 0, "type") != "header" || field(blocks, 1, "text", "text") != "CPU &lt;95%&gt;" {
+		t.Errorf("Unexpected Slack blocks: %v", blocks)
+	}
+	if field(blocks, 2, "elements", 0, "url") != "https://status.example.com/ack" || body["channel"] != "#ops" {
+		t.Errorf("Expected an acknowledge button and the channel, got %v", body)
+	}
+
+	teams, _ := CreateNotifier(NotificationChannel{Type: "teams", Config: map[string]string{"webhook_url": server.URL + "/teams"}})
+	if err := teams.Send(messageEvent("test", "Tokyo offline", "No data for 5 minutes")); err != nil {
+		t.Fatalf("Teams send failed: %v", err)
+	}
+	body = (*requests)[1].Body
+	if field(body, "attachments", 0, "content", "type") != "AdaptiveCard" || field(body, "attachments", 0, "content", "body", 0, "text") != "ℹ️ Tokyo offline" {
+		t.Errorf("Unexpected Teams card: %v", body)
+	}
+
+	matrix, _ := CreateNotifier(NotificationChannel{Type: "matrix", Config: map[string]string{"homeserver": server.URL, "access_token": "secret", "room_id": "!room:example.com"}})
+	if err := matrix.Send(messageEvent("test", "Tokyo <offline>", "line 1\nline 2")); err != nil {
+		t.Fatalf("Matrix send failed: %v", err)
+	}
+	req := (*requests)[2]
+	if req.Method != "PUT" || !strings.HasPrefix(req.Path, "/_matrix/client/v3/rooms/!room:example.com/send/m.room.message/") {
+		t.Errorf("Unexpected Matrix request %s %s", req.Method, req.Path)
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" || req.Body["formatted_body"] != "<b>ℹ️ Tokyo &lt;offline&gt;</b><br>line 1<br>line 2" {
+		t.Errorf("Unexpected Matrix message: %v %v", req.Header, req.Body)
+	}
+
+	for _, channel := range []NotificationChannel{
+		{Type: "slack", Config: map[string]string{"webhook_url": "hooks.slack.com/x"}},
+		{Type: "teams", Config: map[string]string{}},
+		{Type: "matrix", Config: map[string]string{"homeserver": server.URL, "access_token": "secret", "room_id": "#ops:example.com"}},
+	} {
+		notifier, _ := CreateNotifier(channel)
+		if err := notifier.Validate(); err == nil {
+			t.Errorf("Expected %s config %v to be rejected", channel.Type, channel.Config)
+		}
+	}
+}
+
+// TestPushNotifiers tests the ntfy and Gotify notifiers
+func TestPushNotifiers(t *testing.T) {
+	server, requests := newNotifierStandIn(t, `{}`)
+
+	ntfy, _ := CreateNotifier(NotificationChannel{Type: "ntfy", Config: map[string]string{"server_url": server.URL, "topic": "alerts", "priority": "5", "tags": "warning, vstats", "token": "tk"}})
+	if err := ntfy.Send(testEvent("Tokyo CPU", "95%", "https://status.example.com/ack")); err != nil {
+		t.Fatalf("ntfy send failed: %v", err)
+	}
+	req := (*requests)[0]
+	if req.Body["topic"] != "alerts" || req.Body["priority"] != float64(5) || field(req.Body, "tags", 1) != "vstats" || req.Header.Get("Authorization") != "Bearer tk" {
+		t.Errorf("Unexpected ntfy message: %v %v", req.Header, req.Body)
+	}
+	if field(req.Body, "actions", 0, "url") != "https://status.example.com/ack" {
+		t.Errorf("Expected an acknowledge action, got %v", req.Body["actions"])
+	}
+
+	gotify, _ := CreateNotifier(NotificationChannel{Type: "gotify", Config: map[string]string{"server_url": server.URL + "/", "app_token": "app"}})
+	event := messageEvent("test", "Tokyo CPU", "**95%**")
+	event.Severity = "critical"
+	event.Format = FormatMarkdown
+	if err := gotify.Send(event); err != nil {
+		t.Fatalf("Gotify send failed: %v", err)
+	}
+	req = (*requests)[1]
+	if req.Path != "/message" || req.Header.Get("X-Gotify-Key") != "app" || req.Body["priority"] != float64(8) {
+		t.Errorf("Unexpected Gotify message: %s %v %v", req.Path, req.Header, req.Body)
+	}
+	if field(req.Body, "extras", "client::display", "contentType") != "text/markdown" {
+		t.Errorf("Expected Markdown to be rendered by Gotify clients, got %v", req.Body["extras"])
+	}
+
+	// Without a configured priority, lower severities are less intrusive
+	ntfy, _ = CreateNotifier(NotificationChannel{Type: "ntfy", Config: map[string]string{"server_url": server.URL, "topic": "alerts"}})
+	event.Severity = "warning"
+	if err := ntfy.Send(event); err != nil {
+		t.Fatalf("ntfy send failed: %v", err)
+	}
+	if req = (*requests)[2]; req.Body["priority"] != float64(4) || req.Body["markdown"] != true {
+		t.Errorf("Expected a warning priority and Markdown, got %v", req.Body)
+	}
+
+	if _, err := CreateNotifier(NotificationChannel{Type: "ntfy", Config: map[string]string{"topic": "a", "priority": "high"}}); err == nil {
+		t.Error("Expected a non-numeric ntfy priority to be rejected")
+	}
+	if notifier, _ := CreateNotifier(NotificationChannel{Type: "ntfy", Config: map[string]string{"topic": "a/b"}}); notifier.Validate() == nil {
+		t.Error("Expected an invalid ntfy topic to be rejected")
+	}
+}
+
+// TestPagerDutyNotifier tests triggering and resolving PagerDuty alerts
+// from the notification queue
+func TestPagerDutyNotifier(t *testing.T) {
+	forEachBackend(t, testPagerDutyNotifier)
+}
+
+func testPagerDutyNotifier(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	server, requests := newNotifierStandIn(t, `{"status":"success","message":"Event processed","dedup_key":"x"}`)
+
+	routingKey := strings.Repeat("a", 32)
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.RecoveryNotify = true
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "pd", Type: "pagerduty", Name: "PagerDuty", Enabled: true, Config: map[string]string{"routing_key": routingKey, "api_url": server.URL}},
+	}
+	state := &AppState{
+		Config:       &AppConfig{AlertConfig: &alertConfig, Servers: []RemoteServer{{ID: "s1", Name: "Tokyo"}}},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+	engine := NewAlertEngine(state, helper.db)
+
+	alert := &AlertState{ID: "a1", Type: "cpu", ServerID: "s1", ServerName: "Tokyo", Severity: "critical", Status: "firing", StartedAt: time.Now(), Message: "CPU 95%"}
+	engine.activeAlerts["cpu:s1"] = alert
+	engine.notify(alert, &alertConfig)
+	engine.queue.processDue(time.Now())
+	engine.resolveAlert("cpu:s1", &alertConfig)
+	engine.queue.processDue(time.Now())
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected a trigger and a resolve, got %+v", *requests)
+	}
+	trigger, resolve := (*requests)[0].Body, (*requests)[1].Body
+	if trigger["event_action"] != "trigger" || trigger["dedup_key"] != "vstats-a1" || trigger["routing_key"] != routingKey {
+		t.Errorf("Unexpected trigger: %v", trigger)
+	}
+	if field(trigger, "payload", "custom_details", "server_name") != "Tokyo" {
+		t.Errorf("Expected the alert details, got %v", field(trigger, "payload", "custom_details"))
+	}
+	if field(trigger, "payload", "source") != "s1" || field(trigger, "payload", "severity") != "critical" {
+		t.Errorf("Unexpected trigger payload: %v", trigger["payload"])
+	}
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != "vstats-a1" || resolve["payload"] != nil {
+		t.Errorf("Unexpected resolve: %v", resolve)
+	}
+	if events, _, _ := ListNotifications(helper.db, NotificationFilter{Status: NotificationSent}, 10, 0); len(events) != 2 || !events[0].Resolved || events[1].Resolved {
+		t.Errorf("Expected the recovery to be stored as resolved, got %+v", events)
+	}
+
+	// Rejected events are reported as failures
+	rejecting, _ := newNotifierStandIn(t, `{"status":"invalid event","message":"Event object is invalid"}`)
+	pd, _ := NewPagerDutyNotifier(map[string]string{"routing_key": routingKey, "api_url": rejecting.URL})
+	if err := pd.Send(messageEvent("test", "test", "test")); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("Expected the rejection to be reported, got %v", err)
+	}
+	if bad, _ := NewPagerDutyNotifier(map[string]string{"routing_key": "short"}); bad.Validate() == nil {
+		t.Error("Expected a malformed routing key to be rejected")
+	}
+}
+
+// TestChinaNotifiers tests the DingTalk, Feishu and WeCom notifiers and
+// their request signing
+func TestChinaNotifiers(t *testing.T) {
+	server, requests := newNotifierStandIn(t, `{"errcode":0,"errmsg":"ok","code":0,"msg":"success"}`)
+
+	dingtalk, _ := CreateNotifier(NotificationChannel{Type: "dingtalk", Config: map[string]string{
+		"webhook_url": server.URL + "/robot/send?access_token=tok", "secret": "SECabc", "at_mobiles": "13800000000",
+	}})
+	if err := dingtalk.Send(messageEvent("test", "Tokyo CPU", "CPU 95%\n持续 5 分钟")); err != nil {
+		t.Fatalf("DingTalk send failed: %v", err)
+	}
+	req := (*requests)[0]
+	timestamp := req.Query["timestamp"][0]
+	if req.Query["access_token"][0] != "tok" || req.Query["sign"][0] != hmacSHA256Base64([]byte("SECabc"), timestamp+"\nSECabc") {
+		t.Errorf("Unexpected DingTalk signature: %v", req.Query)
+	}
+	if ms, _ := strconv.ParseInt(timestamp, 10, 64); time.Since(time.UnixMilli(ms)) > time.Minute {
+		t.Errorf("Expected a millisecond timestamp, got %s", timestamp)
+	}
+	text, _ := field(req.Body, "markdown", "text").(string)
+	if req.Body["msgtype"] != "markdown" || !strings.Contains(text, "CPU 95%  \n持续") || !strings.Contains(text, "@13800000000") {
+		t.Errorf("Unexpected DingTalk message: %v", req.Body)
+	}
+
+	feishu, _ := CreateNotifier(NotificationChannel{Type: "feishu", Config: map[string]string{"webhook_url": server.URL + "/hook", "secret": "fs"}})
+	if err := feishu.Send(testEvent("Tokyo CPU", "CPU 95%", "https://status.example.com/ack")); err != nil {
+		t.Fatalf("Feishu send failed: %v", err)
+	}
+	body := (*requests)[1].Body
+	if body["sign"] != hmacSHA256Base64([]byte(body["timestamp"].(string)+"\nfs"), "") {
+		t.Errorf("Unexpected Feishu signature: %v", body)
+	}
+	if body["msg_type"] != "interactive" || field(body, "card", "elements", 1, "actions", 0, "url") != "https://status.example.com/ack" || field(body, "card", "header", "template") != "blue" {
+		t.Errorf("Unexpected Feishu card: %v", body["card"])
+	}
+
+	wecom, _ := CreateNotifier(NotificationChannel{Type: "wecom", Config: map[string]string{"webhook_url": server.URL + "/send?key=k"}})
+	if err := wecom.Send(messageEvent("test", "Tokyo CPU", "CPU 95%")); err != nil {
+		t.Fatalf("WeCom send failed: %v", err)
+	}
+	if content, _ := field((*requests)[2].Body, "markdown", "content").(string); !strings.Contains(content, "Tokyo CPU") {
+		t.Errorf("Unexpected WeCom message: %v", (*requests)[2].Body)
+	}
+
+	// Errors are reported in the response body with status 200
+	failing, _ := newNotifierStandIn(t, `{"errcode":310000,"errmsg":"sign not match","code":19021,"msg":"sign match fail"}`)
+	for _, channelType := range []string{"dingtalk", "feishu", "wecom"} {
+		notifier, _ := CreateNotifier(NotificationChannel{Type: channelType, Config: map[string]string{"webhook_url": failing.URL}})
+		if err := notifier.Send(messageEvent("test", "title", "message")); err == nil {
+			t.Errorf("Expected the %s error response to fail the send", channelType)
+		}
+	}
+
+	if notifier, _ := CreateNotifier(NotificationChannel{Type: "dingtalk", Config: map[string]string{"webhook_url": server.URL, "secret": "abc"}}); notifier.Validate() == nil {
+		t.Error("Expected a malformed DingTalk secret to be rejected")
+	}
+	if notifier, _ := CreateNotifier(NotificationChannel{Type: "wecom", Config: map[string]string{"key": "k"}}); notifier.Validate() != nil {
+		t.Error("Expected a bare WeCom robot key to be accepted")
+	}
+}
+
+// TestFormattedNotifiers tests that email, Telegram and Discord render the
+// event's format and severity natively
+func TestFormattedNotifiers(t *testing.T) {
+	event := testEvent("Tokyo CPU", "CPU <b>95%</b><br>Load 4.2<script>x</script>", "https://status.example.com/ack")
+	event.Severity = "critical"
+	event.Format = FormatHTML
+
+	email, _ := NewEmailNotifier(map[string]string{"smtp_host": "localhost", "from": "vstats@example.com", "to": "ops@example.com"})
+	data, err := email.buildMessage(event)
+	if err != nil {
+		t.Fatalf("Building the email failed: %v", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a valid email, got %v", err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Tokyo CPU" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %s", mediaType)
+	}
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := io.ReadAll(part) // Decodes quoted-printable
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = strings.ReplaceAll(string(content), "\r\n", "\n")
+	}
+	if text := parts["text/plain"]; !strings.Contains(text, "CPU 95%\nLoad 4.2") || strings.Contains(text, "<b>") || !strings.Contains(text, "确认告警: https://status.example.com/ack") {
+		t.Errorf("Unexpected text part %q", text)
+	}
+	if html := parts["text/html"]; !strings.Contains(html, "CPU <b>95%</b>") || !strings.Contains(html, "#e74c3c") || !strings.Contains(html, `href="https://status.example.com/ack"`) {
+		t.Errorf("Unexpected HTML part %q", html)
+	}
+
+	server, requests := newNotifierStandIn(t, `{"ok":true}`)
+	telegram, _ := CreateNotifier(NotificationChannel{Type: "telegram", Config: map[string]string{"bot_token": "123:abc", "chat_id": "42", "api_url": server.URL}})
+	if err := telegram.Send(event); err != nil {
+		t.Fatalf("Telegram send failed: %v", err)
+	}
+	req := (*requests)[0]
+	if req.Path != "/bot123:abc/sendMessage" || req.Body["parse_mode"] != "HTML" || req.Body["text"] != "🔴 <b>Tokyo CPU</b>\n\nCPU <b>95%</b>\nLoad 4.2x" {
+		t.Errorf("Unexpected Telegram HTML message: %s %v", req.Path, req.Body)
+	}
+	markdown := messageEvent("test", "Disk 1.5", "**Tokyo** at 95.5% see [panel](https://example.com/a_b)")
+	markdown.Format = FormatMarkdown
+	if err := telegram.Send(markdown); err != nil {
+		t.Fatalf("Telegram send failed: %v", err)
+	}
+	if text := (*requests)[1].Body["text"]; (*requests)[1].Body["parse_mode"] != "MarkdownV2" || text != "ℹ️ *Disk 1\\.5*\n\n*Tokyo* at 95\\.5% see [panel](https://example.com/a_b)" {
+		t.Errorf("Unexpected Telegram MarkdownV2 message: %q", text)
+	}
+
+	discord, _ := CreateNotifier(NotificationChannel{Type: "discord", Config: map[string]string{"webhook_url": server.URL + "/discord"}})
+	alert := &AlertState{ID: "a1", Type: "cpu", ServerID: "s1", ServerName: "Tokyo", Severity: "warning", Value: 85, Threshold: 80, StartedAt: time.Now()}
+	warning := newAlertEvent(alert)
+	warning.Title, warning.Message = "Tokyo CPU", "CPU 85%"
+	if err := discord.Send(warning); err != nil {
+		t.Fatalf("Discord send failed: %v", err)
+	}
+	embed := field((*requests)[2].Body, "embeds", 0)
+	if field(embed, "color") != float64(0xF39C12) || field(embed, "fields", 0, "value") != "Tokyo" || field(embed, "fields", 2, "value") != "85.0 / 80.0" {
+		t.Errorf("Unexpected Discord embed: %v", embed)
+	}
+	now := time.Now()
+	alert.ResolvedAt = &now
+	if err := discord.Send(newAlertEvent(alert)); err != nil {
+		t.Fatalf("Discord send failed: %v", err)
+	}
+	if embed := field((*requests)[3].Body, "embeds", 0); field(embed, "color") != float64(0x2ECC71) || field(embed, "fields") != nil {
+		t.Errorf("Expected a green recovery embed without fields, got %v", embed)
+	}
+}
+
+// TestWebhookNotifier tests the webhook's event schema, signature and form
+// body, and per-channel template overrides
+func TestWebhookNotifier(t *testing.T) {
+	forEachBackend(t, testWebhookNotifier)
+}
+
+func testWebhookNotifier(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	type delivery struct {
+		Header http.Header
+		Body   []byte
+	}
+	var received []delivery
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, delivery{r.Header, body})
+	}))
+	defer hook.Close()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "json", Type: "webhook", Name: "JSON", Enabled: true, Config: map[string]string{"url": hook.URL, "secret": "s3cret"}},
+		{ID: "form", Type: "webhook", Name: "Form", Enabled: true, Config: map[string]string{"url": hook.URL, "body_format": "form"},
+			Templates: map[string]AlertTemplate{
+				"cpu": {Title: "CPU on {{ .ServerName }}", Body: "<b>{{ .ServerName }}</b> at {{ .Value }}%", Format: FormatHTML},
+			}},
+	}
+	state := &AppState{
+		Config:       &AppConfig{AlertConfig: &alertConfig, Servers: []RemoteServer{{ID: "s1", Name: "<Tokyo>"}}},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+	engine := NewAlertEngine(state, helper.db)
+
+	alert := &AlertState{ID: "a1", Type: "cpu", ServerID: "s1", ServerName: "<Tokyo>", Severity: "critical", Status: "firing", Value: 95, Threshold: 90, StartedAt: time.Now()}
+	engine.activeAlerts["cpu:s1"] = alert
+	engine.notify(alert, &alertConfig)
+	engine.queue.processDue(time.Now())
+
+	if len(received) != 2 {
+		t.Fatalf("Expected both webhooks to be called, got %d", len(received))
+	}
+	signed, form := received[0], received[1]
+	if signed.Header.Get("Content-Type") != "application/json" {
+		signed, form = form, signed
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(signed.Header.Get("X-Vstats-Timestamp") + "."))
+	mac.Write(signed.Body)
+	if signed.Header.Get("X-Vstats-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Unexpected signature %q", signed.Header.Get("X-Vstats-Signature"))
+	}
+	var event AlertEvent
+	if err := json.Unmarshal(signed.Body, &event); err != nil {
+		t.Fatalf("Expected an event, got %s", signed.Body)
+	}
+	if event.Version != AlertEventVersion || event.Status != "firing" || event.Type != "cpu" || event.Severity != "critical" || event.Format != FormatText {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if len(event.Alerts) != 1 || event.Alerts[0].ID != "a1" || event.Alerts[0].ServerName != "<Tokyo>" || event.Alerts[0].Threshold != 90 {
+		t.Errorf("Unexpected event alerts: %+v", event.Alerts)
+	}
+	if event.Title != "[critical] <Tokyo> CPU 告警" {
+		t.Errorf("Expected the configured template, got %q", event.Title)
+	}
+
+	// The channel's own HTML template escapes values
+	values, _ := url.ParseQuery(string(form.Body))
+	if values.Get("title") != "CPU on <Tokyo>" || values.Get("message") != "<b>&lt;Tokyo&gt;</b> at 95%" || values.Get("format") != FormatHTML {
+		t.Errorf("Expected the channel template, got %v", values)
+	}
+	if values.Get("alert_id") != "a1" || values.Get("status") != "firing" || values.Get("version") != "1" || form.Header.Get("X-Vstats-Signature") != "" {
+		t.Errorf("Unexpected form fields: %v", values)
+	}
+
+	if err := validateTemplates(map[string]AlertTemplate{"cpu": {Title: "{{ .ServerName", Body: "x"}}); err == nil {
+		t.Error("Expected a malformed template to be rejected")
+	}
+	if err := validateTemplates(map[string]AlertTemplate{"cpu": {Title: "x", Body: "x", Format: "rtf"}}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
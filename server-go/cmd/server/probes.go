@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// Probe Targets
+// ============================================================================
+
+// dnsRecordTypes are the record types agents can query
+var dnsRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT"}
+
+// Limits of the per-target schedule
+const (
+	maxProbeIntervalSecs = 86400
+	maxProbeTimeoutSecs  = 60
+	maxProbeCount        = 20
+)
+
+// validatePingTargets checks the probe options of the ping targets and
+// normalizes them. HTTP targets configured by URL get their host from it,
+// which is what their results are stored under.
+func validatePingTargets(targets []common.PingTargetConfig) error {
+	for i := range targets {
+		t := &targets[i]
+		label := t.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+
+		switch t.Type {
+		case "", "icmp", "tcp", "tls":
+		case "http":
+			if t.URL != "" {
+				u, err := url.Parse(t.URL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("ping target %s: url must be an http or https URL", label)
+				}
+				if t.Host == "" {
+					t.Host = u.Hostname()
+				}
+			}
+			t.Method = strings.ToUpper(t.Method)
+			switch t.Method {
+			case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
+			default:
+				return fmt.Errorf("ping target %s: unsupported method %s", label, t.Method)
+			}
+			if t.ExpectedStatus != 0 && (t.ExpectedStatus < 100 || t.ExpectedStatus > 599) {
+				return fmt.Errorf("ping target %s: invalid expected_status %d", label, t.ExpectedStatus)
+			}
+		case "dns":
+			t.RecordType = strings.ToUpper(t.RecordType)
+			if t.RecordType != "" && !contains(dnsRecordTypes, t.RecordType) {
+				return fmt.Errorf("ping target %s: record_type must be one of %s", label, strings.Join(dnsRecordTypes, ", "))
+			}
+			if t.Resolver != "" {
+				host := t.Resolver
+				if h, _, err := net.SplitHostPort(t.Resolver); err == nil {
+					host = h
+				}
+				if net.ParseIP(host) == nil {
+					return fmt.Errorf("ping target %s: resolver must be an IP address with an optional port", label)
+				}
+			}
+		default:
+			return fmt.Errorf("ping target %s: unknown type %s", label, t.Type)
+		}
+
+		if t.IntervalSecs < 0 || t.IntervalSecs > maxProbeIntervalSecs {
+			return fmt.Errorf("ping target %s: interval_secs must be between 1 and %d", label, maxProbeIntervalSecs)
+		}
+		if t.TimeoutSecs < 0 || t.TimeoutSecs > maxProbeTimeoutSecs {
+			return fmt.Errorf("ping target %s: timeout_secs must be between 1 and %d", label, maxProbeTimeoutSecs)
+		}
+		if t.Count < 0 || t.Count > maxProbeCount {
+			return fmt.Errorf("ping target %s: count must be between 1 and %d", label, maxProbeCount)
+		}
+
+		// Empty ICMP and TCP rows have always been saved and skipped by agents
+		if t.Host == "" && t.Type != "" && t.Type != "icmp" && t.Type != "tcp" {
+			return fmt.Errorf("ping target %s: host is required", label)
+		}
+	}
+	return nil
+}
+
+// pingTargetSelects reports whether a ping target is assigned to a server,
+// with the same selection as agent profiles
+func pingTargetSelects(target common.PingTargetConfig, server RemoteServer, dimensions []GroupDimension) bool {
+	return ruleSelectsServer(CustomAlertRule{Servers: target.Servers, Selector: target.Dimensions}, server, dimensions)
+}
+
+// pingTargetsFor returns the ping targets assigned to a server, without the
+// assignment which agents do not need
+func pingTargetsFor(cfg *AppConfig, server RemoteServer) []common.PingTargetConfig {
+	targets := []common.PingTargetConfig{}
+	for _, target := range cfg.ProbeSettings.PingTargets {
+		if !pingTargetSelects(target, server, cfg.GroupDimensions) {
+			continue
+		}
+		target.Servers = nil
+		target.Dimensions = nil
+		targets = append(targets, target)
+	}
+	return targets
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"vstats/internal/common"
+)
+
+// TestValidatePingTargets tests checking the options of probe targets
+func TestValidatePingTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		target common.PingTargetConfig
+		valid  bool
+	}{
+		{"icmp", common.PingTargetConfig{Name: "a", Host: "1.1.1.1"}, true},
+		{"empty icmp row", common.PingTargetConfig{Type: "icmp", Port: 80}, true},
+		{"unknown type", common.PingTargetConfig{Name: "a", Host: "x", Type: "udp"}, false},
+		{"http by host", common.PingTargetConfig{Name: "a", Host: "example.com", Type: "http"}, true},
+		{"http by url", common.PingTargetConfig{Name: "a", Type: "http", URL: "https://example.com/health", Method: "head", ExpectedStatus: 204}, true},
+		{"http bad url", common.PingTargetConfig{Name: "a", Type: "http", URL: "ftp://example.com"}, false},
+		{"http bad method", common.PingTargetConfig{Name: "a", Host: "x", Type: "http", Method: "DELETE"}, false},
+		{"http bad status", common.PingTargetConfig{Name: "a", Host: "x", Type: "http", ExpectedStatus: 42}, false},
+		{"dns", common.PingTargetConfig{Name: "a", Host: "example.com", Type: "dns", Resolver: "8.8.8.8", RecordType: "aaaa"}, true},
+		{"dns resolver port", common.PingTargetConfig{Name: "a", Host: "example.com", Type: "dns", Resolver: "[2001:4860:4860::8888]:53"}, true},
+		{"dns resolver name", common.PingTargetConfig{Name: "a", Host: "example.com", Type: "dns", Resolver: "dns.google"}, false},
+		{"dns record type", common.PingTargetConfig{Name: "a", Host: "example.com", Type: "dns", RecordType: "SRV"}, false},
+		{"tls without host", common.PingTargetConfig{Name: "a", Type: "tls"}, false},
+		{"schedule", common.PingTargetConfig{Name: "a", Host: "x", IntervalSecs: 60, TimeoutSecs: 5, Count: 10}, true},
+		{"interval", common.PingTargetConfig{Name: "a", Host: "x", IntervalSecs: 100000}, false},
+		{"timeout", common.PingTargetConfig{Name: "a", Host: "x", TimeoutSecs: -1}, false},
+		{"count", common.PingTargetConfig{Name: "a", Host: "x", Count: 50}, false},
+	}
+	for _, tt := range tests {
+		targets := []common.PingTargetConfig{tt.target}
+		err := validatePingTargets(targets)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+
+	targets := []common.PingTargetConfig{{Name: "a", Type: "http", URL: "https://example.com:8443/", Method: "head"}}
+	if err := validatePingTargets(targets); err != nil {
+		t.Fatal(err)
+	}
+	if targets[0].Host != "example.com" || targets[0].Method != "HEAD" {
+		t.Errorf("Expected the host from the URL and an upper case method, got %+v", targets[0])
+	}
+}
+
+// TestCertExpiryRule tests alerting on the certificate expiry of a probe
+func TestCertExpiryRule(t *testing.T) {
+	expr, err := compileAlertExpr(`ping[name="site"].cert_expiry_days < 14`)
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	days := func(d float64) *float64 { return &d }
+	metrics := &SystemMetrics{Ping: &PingMetrics{Targets: []PingTarget{
+		{Name: "hk", Host: "1.1.1.1", Status: "ok"},
+		{Name: "site", Host: "example.com", Type: "tls", Status: "ok", CertExpiryDays: days(9.5)},
+	}}}
+	result, err := expr.Eval(metricsEnv(metrics))
+	if err != nil || !result.Matched || result.Value != 9.5 || result.Threshold != 14 {
+		t.Errorf("Expected the rule to match with 9.5 days, got %+v (%v)", result, err)
+	}
+
+	metrics.Ping.Targets[1].CertExpiryDays = days(60)
+	if result, _ := expr.Eval(metricsEnv(metrics)); result.Matched {
+		t.Error("Expected no match for a certificate valid for 60 days")
+	}
+}
+
+// TestPingTargetAssignment tests sending agents only their own ping targets
+func TestPingTargetAssignment(t *testing.T) {
+	state := &AppState{
+		Config: &AppConfig{
+			GroupDimensions: []GroupDimension{{ID: "d1", Key: "region", Options: []GroupOption{{ID: "o1", Name: "Asia"}, {ID: "o2", Name: "Europe"}}}},
+			Servers: []RemoteServer{
+				{ID: "s1", GroupValues: map[string]string{"d1": "o1"}},
+				{ID: "s2", GroupValues: map[string]string{"d1": "o2"}},
+				{ID: "s3"},
+			},
+			ProbeSettings: ProbeSettings{PingTargets: []common.PingTargetConfig{
+				{Name: "all", Host: "1.1.1.1"},
+				{Name: "china", Host: "114.114.114.114", Dimensions: map[string]string{"region": "Asia"}, IntervalSecs: 30},
+				{Name: "s3 only", Host: "8.8.8.8", Servers: []string{"s3"}},
+			}},
+		},
+		AgentConns: map[string]*AgentConnection{
+			"s1": {SendChan: make(chan []byte, 1)},
+			"s2": {SendChan: make(chan []byte, 1)},
+			"s3": {SendChan: make(chan []byte, 1)},
+		},
+	}
+
+	state.BroadcastPingTargets()
+
+	expected := map[string][]string{
+		"s1": {"all", "china"},
+		"s2": {"all"},
+		"s3": {"all", "s3 only"},
+	}
+	for id, want := range expected {
+		var msg common.ServerResponse
+		json.Unmarshal(<-state.AgentConns[id].SendChan, &msg)
+		var names []string
+		for _, target := range msg.PingTargets {
+			names = append(names, target.Name)
+			if target.Servers != nil || target.Dimensions != nil {
+				t.Errorf("%s: expected the assignment to be left out, got %+v", id, target)
+			}
+		}
+		if len(names) != len(want) {
+			t.Errorf("%s: expected targets %v, got %v", id, want, names)
+			continue
+		}
+		for i := range want {
+			if names[i] != want[i] {
+				t.Errorf("%s: expected targets %v, got %v", id, want, names)
+				break
+			}
+		}
+	}
+
+	if targets := pingTargetsFor(state.Config, state.Config.Servers[0]); len(targets) != 2 || targets[1].IntervalSecs != 30 {
+		t.Errorf("Expected the schedule to be kept, got %+v", targets)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Authentication Rate Limiting
+// ============================================================================
+
+// Auth scopes are limited independently so that, for example, a misconfigured
+// agent cannot lock administrators out of the dashboard
+const (
+	AuthScopeLogin = "login"
+	AuthScopeOAuth = "oauth"
+	AuthScopeAgent = "agent"
+)
+
+// Context keys used by handlers to report the outcome of an attempt
+const (
+	contextKeyAuthFailed    = "auth_failed"
+	contextKeyAuthSucceeded = "auth_succeeded"
+)
+
+// LoginProtectionConfig configures brute-force protection for authentication
+type LoginProtectionConfig struct {
+	Disabled           bool     `json:"disabled,omitempty"`
+	MaxAttempts        int      `json:"max_attempts,omitempty"`          // Failures per IP within the window before lockout (default 5)
+	WindowSeconds      int      `json:"window_seconds,omitempty"`        // Failure counting window (default 900)
+	LockoutSeconds     int      `json:"lockout_seconds,omitempty"`       // First lockout, doubled for each repeat (default 60)
+	MaxLockoutSeconds  int      `json:"max_lockout_seconds,omitempty"`   // Upper bound for lockouts (default 3600)
+	GlobalMaxPerMinute int      `json:"global_max_per_minute,omitempty"` // Failures per minute across all IPs before the scope is paused (default 100)
+	NotifyOnLockout    bool     `json:"notify_on_lockout,omitempty"`     // Send lockouts to alert channels
+	NotifyChannels     []string `json:"notify_channels,omitempty"`       // Channel IDs; empty = all enabled channels
+}
+
+// withDefaults returns a copy with unset values filled in
+func (c *LoginProtectionConfig) withDefaults() LoginProtectionConfig {
+	cfg := LoginProtectionConfig{}
+	if c != nil {
+		cfg = *c
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.WindowSeconds <= 0 {
+		cfg.WindowSeconds = 900
+	}
+	if cfg.LockoutSeconds <= 0 {
+		cfg.LockoutSeconds = 60
+	}
+	if cfg.MaxLockoutSeconds <= 0 {
+		cfg.MaxLockoutSeconds = 3600
+	}
+	if cfg.MaxLockoutSeconds < cfg.LockoutSeconds {
+		cfg.MaxLockoutSeconds = cfg.LockoutSeconds
+	}
+	if cfg.GlobalMaxPerMinute <= 0 {
+		cfg.GlobalMaxPerMinute = 100
+	}
+	return cfg
+}
+
+type limiterEntry struct {
+	failures    []time.Time
+	lockouts    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+type globalWindow struct {
+	start    time.Time
+	failures int
+}
+
+// AuthLimiter tracks failed authentication attempts per scope and client IP
+type AuthLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	global    map[string]*globalWindow
+	lastSweep time.Time
+}
+
+// LockoutEvent describes a lockout triggered by a failure
+type LockoutEvent struct {
+	Scope    string
+	IP       string
+	Global   bool
+	Duration time.Duration
+	Failures int
+}
+
+// NewAuthLimiter creates an empty limiter
+func NewAuthLimiter() *AuthLimiter {
+	return &AuthLimiter{
+		entries: make(map[string]*limiterEntry),
+		global:  make(map[string]*globalWindow),
+	}
+}
+
+var authLimiter = NewAuthLimiter()
+
+// Check returns how long a client must wait before trying again, or 0
+func (l *AuthLimiter) Check(scope, ip string, cfg LoginProtectionConfig, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if g := l.global[scope]; g != nil && now.Sub(g.start) < time.Minute && g.failures >= cfg.GlobalMaxPerMinute {
+		return g.start.Add(time.Minute).Sub(now)
+	}
+	if e := l.entries[scope+"|"+ip]; e != nil && now.Before(e.lockedUntil) {
+		return e.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// Failure records a failed attempt. Returns the lockout it triggered, if any.
+func (l *AuthLimiter) Failure(scope, ip string, cfg LoginProtectionConfig, now time.Time) *LockoutEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(cfg, now)
+
+	var event *LockoutEvent
+
+	g := l.global[scope]
+	if g == nil || now.Sub(g.start) >= time.Minute {
+		g = &globalWindow{start: now}
+		l.global[scope] = g
+	}
+	g.failures++
+	if g.failures == cfg.GlobalMaxPerMinute {
+		event = &LockoutEvent{Scope: scope, IP: ip, Global: true, Duration: g.start.Add(time.Minute).Sub(now), Failures: g.failures}
+	}
+
+	key := scope + "|" + ip
+	e := l.entries[key]
+	if e == nil {
+		e = &limiterEntry{}
+		l.entries[key] = e
+	}
+
+	// Forget earlier lockouts after a long quiet period
+	maxLockout := time.Duration(cfg.MaxLockoutSeconds) * time.Second
+	if !e.lastFailure.IsZero() && now.Sub(e.lastFailure) > 2*maxLockout {
+		e.lockouts = 0
+	}
+	e.lastFailure = now
+
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+	kept := e.failures[:0]
+	for _, t := range e.failures {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	e.failures = append(kept, now)
+
+	if len(e.failures) >= cfg.MaxAttempts {
+		// Exponential backoff: base, 2x base, 4x base ... capped
+		e.lockouts++
+		factor := math.Pow(2, float64(e.lockouts-1))
+		duration := time.Duration(float64(cfg.LockoutSeconds)*factor) * time.Second
+		if duration > maxLockout || duration <= 0 {
+			duration = maxLockout
+		}
+		e.lockedUntil = now.Add(duration)
+		failures := len(e.failures)
+		e.failures = nil
+		if event == nil {
+			event = &LockoutEvent{Scope: scope, IP: ip, Duration: duration, Failures: failures}
+		}
+	}
+
+	return event
+}
+
+// Success clears the failure history of a client
+func (l *AuthLimiter) Success(scope, ip string) {
+	l.mu.Lock()
+	delete(l.entries, scope+"|"+ip)
+	l.mu.Unlock()
+}
+
+// sweep drops entries that can no longer affect a decision. Caller holds mu.
+func (l *AuthLimiter) sweep(cfg LoginProtectionConfig, now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+	memory := 2 * time.Duration(cfg.MaxLockoutSeconds) * time.Second
+	for key, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > window && now.Sub(e.lastFailure) > memory {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// ============================================================================
+// Integration
+// ============================================================================
+
+// loginProtection returns the effective brute-force protection settings
+func (s *AppState) loginProtection() LoginProtectionConfig {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	return s.Config.LoginProtection.withDefaults()
+}
+
+// markAuthFailure records that the current request failed to authenticate
+func markAuthFailure(c *gin.Context) {
+	c.Set(contextKeyAuthFailed, true)
+}
+
+// markAuthSuccess records that the current request authenticated successfully
+func markAuthSuccess(c *gin.Context) {
+	c.Set(contextKeyAuthSucceeded, true)
+}
+
+// AuthRateLimit rejects clients that are locked out of scope and records
+// the outcome reported by the handler via markAuthFailure/markAuthSuccess
+func (s *AppState) AuthRateLimit(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := s.loginProtection()
+		if cfg.Disabled {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		if wait := authLimiter.Check(scope, ip, cfg, time.Now()); wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			if scope == AuthScopeOAuth {
+				redirectWithError(c, fmt.Sprintf("Too many failed attempts, try again in %d seconds", seconds))
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       fmt.Sprintf("Too many failed attempts, try again in %d seconds", seconds),
+				"retry_after": seconds,
+			})
+			return
+		}
+
+		c.Next()
+
+		if c.GetBool(contextKeyAuthFailed) {
+			s.recordAuthFailure(scope, ip, CurrentUsername(c), c.GetHeader("User-Agent"), cfg)
+		} else if c.GetBool(contextKeyAuthSucceeded) {
+			authLimiter.Success(scope, ip)
+		}
+	}
+}
+
+// authLockedOut reports whether ip is currently locked out of scope
+func (s *AppState) authLockedOut(scope, ip string) bool {
+	cfg := s.loginProtection()
+	return !cfg.Disabled && authLimiter.Check(scope, ip, cfg, time.Now()) > 0
+}
+
+// recordAuthFailure counts a failure and audits/notifies any resulting lockout
+func (s *AppState) recordAuthFailure(scope, ip, username, userAgent string, cfg LoginProtectionConfig) {
+	if cfg.Disabled {
+		return
+	}
+	event := authLimiter.Failure(scope, ip, cfg, time.Now())
+	if event == nil {
+		return
+	}
+
+	var details string
+	if event.Global {
+		details = fmt.Sprintf("%d failed %s attempts within a minute, pausing all %s attempts for %s",
+			event.Failures, scope, scope, formatDuration(event.Duration))
+	} else {
+		details = fmt.Sprintf("%s locked out for %s after %d failed %s attempts",
+			event.IP, formatDuration(event.Duration), event.Failures, scope)
+	}
+
+	LogAudit(AuditLogEntry{
+		Action:     AuditActionAuthLockout,
+		Category:   AuditCategoryAuth,
+		Username:   username,
+		UserIP:     ip,
+		UserAgent:  userAgent,
+		TargetType: "ip",
+		TargetID:   ip,
+		TargetName: scope,
+		Details:    details,
+		Status:     "error",
+	})
+	fmt.Printf("🔒 %s\n", details)
+
+	if cfg.NotifyOnLockout {
+		go s.notifyAuthLockout(details, cfg.NotifyChannels)
+	}
+}
+
+// notifyAuthLockout sends a lockout through the configured alert channels
+func (s *AppState) notifyAuthLockout(details string, channelIDs []string) {
+	s.ConfigMu.RLock()
+	var channels []NotificationChannel
+	if s.Config.AlertConfig != nil {
+		for _, ch := range s.Config.AlertConfig.Channels {
+			if ch.Enabled && (len(channelIDs) == 0 || contains(channelIDs, ch.ID)) {
+				channels = append(channels, ch)
+			}
+		}
+	}
+	s.ConfigMu.RUnlock()
+
+	event := messageEvent("system", "🔒 vStats: authentication lockout", details)
+	event.Severity = "warning"
+	for _, channel := range channels {
+		notifier, err := CreateNotifier(channel)
+		if err != nil {
+			fmt.Printf("⚠️ Failed to create notifier for channel %s: %v\n", channel.Name, err)
+			continue
+		}
+		if err := notifier.Send(event); err != nil {
+			fmt.Printf("⚠️ Failed to send notification via %s: %v\n", channel.Name, err)
+		}
+	}
+}
+
+// ============================================================================
+// Settings Handlers
+// ============================================================================
+
+// GetLoginProtectionSettings returns the effective brute-force protection settings
+func (s *AppState) GetLoginProtectionSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, s.loginProtection())
+}
+
+// UpdateLoginProtectionSettings replaces the brute-force protection settings
+func (s *AppState) UpdateLoginProtectionSettings(c *gin.Context) {
+	var req LoginProtectionConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.MaxAttempts < 0 || req.WindowSeconds < 0 || req.LockoutSeconds < 0 || req.MaxLockoutSeconds < 0 || req.GlobalMaxPerMinute < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Values must not be negative"})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	s.Config.LoginProtection = &req
+	SaveConfigFrom(c, s.Config)
+	s.ConfigMu.Unlock()
+
+	LogAuditFromContext(c, AuditActionSettingsUpdate, AuditCategorySettings, "settings", "login_protection", "Login Protection", "Login protection settings updated")
+
+	c.JSON(http.StatusOK, req.withDefaults())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuthLimiter tests per-IP lockout with exponential backoff
+func TestAuthLimiter(t *testing.T) {
+	cfg := (&LoginProtectionConfig{MaxAttempts: 3, LockoutSeconds: 10, MaxLockoutSeconds: 30}).withDefaults()
+	limiter := NewAuthLimiter()
+	now := time.Now()
+
+	fail := func(n int) *LockoutEvent {
+		var event *LockoutEvent
+		for i := 0; i < n; i++ {
+			event = limiter.Failure(AuthScopeLogin, "10.0.0.1", cfg, now)
+		}
+		return event
+	}
+
+	if event := fail(2); event != nil {
+		t.Fatal("Expected no lockout before max attempts")
+	}
+	if wait := limiter.Check(AuthScopeLogin, "10.0.0.1", cfg, now); wait != 0 {
+		t.Fatalf("Expected no wait, got %v", wait)
+	}
+
+	event := fail(1)
+	if event == nil || event.Duration != 10*time.Second {
+		t.Fatalf("Expected 10s lockout, got %+v", event)
+	}
+	if wait := limiter.Check(AuthScopeLogin, "10.0.0.1", cfg, now); wait != 10*time.Second {
+		t.Errorf("Expected 10s wait, got %v", wait)
+	}
+
+	t.Run("Other scopes and IPs are unaffected", func(t *testing.T) {
+		if wait := limiter.Check(AuthScopeAgent, "10.0.0.1", cfg, now); wait != 0 {
+			t.Errorf("Expected agent scope to be unaffected, got %v", wait)
+		}
+		if wait := limiter.Check(AuthScopeLogin, "10.0.0.2", cfg, now); wait != 0 {
+			t.Errorf("Expected other IP to be unaffected, got %v", wait)
+		}
+	})
+
+	t.Run("Repeated lockouts back off exponentially", func(t *testing.T) {
+		now = now.Add(11 * time.Second)
+		if event := fail(3); event == nil || event.Duration != 20*time.Second {
+			t.Fatalf("Expected 20s lockout, got %+v", event)
+		}
+		now = now.Add(21 * time.Second)
+		if event := fail(3); event == nil || event.Duration != 30*time.Second {
+			t.Fatalf("Expected lockout capped at 30s, got %+v", event)
+		}
+	})
+
+	t.Run("Success clears history", func(t *testing.T) {
+		limiter.Success(AuthScopeLogin, "10.0.0.1")
+		if wait := limiter.Check(AuthScopeLogin, "10.0.0.1", cfg, now); wait != 0 {
+			t.Errorf("Expected no wait after success, got %v", wait)
+		}
+	})
+
+	t.Run("Global limit pauses the scope", func(t *testing.T) {
+		global := (&LoginProtectionConfig{GlobalMaxPerMinute: 5}).withDefaults()
+		l := NewAuthLimiter()
+		var event *LockoutEvent
+		for i := 0; i < 5; i++ {
+			event = l.Failure(AuthScopeOAuth, "10.1.0."+string(rune('1'+i)), global, now)
+		}
+		if event == nil || !event.Global {
+			t.Fatalf("Expected global lockout event, got %+v", event)
+		}
+		if wait := l.Check(AuthScopeOAuth, "10.2.0.1", global, now); wait == 0 {
+			t.Error("Expected new IPs to be paused")
+		}
+	})
+}
+
+// TestLoginRateLimit tests that repeated failed logins are rejected with 429
+func TestLoginRateLimit(t *testing.T) {
+	oldLimiter := authLimiter
+	authLimiter = NewAuthLimiter()
+	defer func() { authLimiter = oldLimiter }()
+
+	appState := createTestAppState(t, "password")
+	appState.Config.LoginProtection = &LoginProtectionConfig{MaxAttempts: 2}
+
+	router := gin.New()
+	router.POST("/api/auth/login", appState.AuthRateLimit(AuthScopeLogin), appState.Login)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Password: password})
+		req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := login("wrong").Code; code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+	}
+
+	w := login("password")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+}
@@ -0,0 +1,758 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// Agent Rollouts
+// ============================================================================
+//
+// A rollout updates the agents picked by a selector to one version, a batch
+// at a time. A wave is finished when every agent in it has reported success
+// or failure (or timed out); failures pause the rollout when PauseOnFailure
+// is set. Rollouts live in the database and are driven by the cluster
+// leader, while update reports are recorded by whichever node the agent is
+// connected to.
+
+// Rollout states
+const (
+	RolloutRunning   = "running"
+	RolloutPaused    = "paused" // A wave had failures; waits to be resumed
+	RolloutCompleted = "completed"
+	RolloutAborted   = "aborted"
+)
+
+// Rollout target states
+const (
+	TargetPending     = "pending"     // Its wave has not started
+	TargetSent        = "sent"        // Update command sent, no report yet
+	TargetDownloading = "downloading" // Fetching and verifying the release
+	TargetRestarted   = "restarted"   // Installed, waiting for the new version to authenticate
+	TargetSucceeded   = "succeeded"
+	TargetFailed      = "failed"
+	TargetRolledBack  = "rolled_back"
+	TargetCancelled   = "cancelled" // The rollout was aborted before its wave
+)
+
+const (
+	rolloutPollInterval  = 10 * time.Second
+	rolloutTargetTimeout = 15 * time.Minute // Time an agent has to finish its update
+	rolloutMaxBatchSize  = 1000
+)
+
+var (
+	ErrRolloutNotFound = errors.New("rollout not found")
+	ErrRolloutActive   = errors.New("another rollout is still running or paused")
+	ErrRolloutState    = errors.New("rollout is not in a state that allows this")
+)
+
+// Global rollout manager
+var rolloutManager *RolloutManager
+
+// RolloutSelector picks the servers of a rollout; all set conditions must
+// match
+type RolloutSelector struct {
+	Servers    []string          `json:"servers,omitempty"`    // Server IDs
+	Dimensions map[string]string `json:"dimensions,omitempty"` // Dimension key or id (or location, provider) -> option
+	Tags       []string          `json:"tags,omitempty"`       // Any of these tags
+	Versions   []string          `json:"versions,omitempty"`   // Current agent versions
+}
+
+// Matches reports whether a server is selected
+func (sel RolloutSelector) Matches(server RemoteServer, dimensions []GroupDimension) bool {
+	if len(sel.Servers) > 0 && !contains(sel.Servers, server.ID) {
+		return false
+	}
+	if len(sel.Tags) > 0 && !containsFold(sel.Tags, server.Tag) {
+		return false
+	}
+	if len(sel.Versions) > 0 {
+		matched := false
+		for _, version := range sel.Versions {
+			if sameVersion(version, server.Version) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(sel.Dimensions) > 0 {
+		return ruleSelectsServer(CustomAlertRule{Selector: sel.Dimensions}, server, dimensions)
+	}
+	return true
+}
+
+func containsFold(slice []string, item string) bool {
+	for _, s := range slice {
+		if item != "" && strings.EqualFold(s, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameVersion compares versions with or without a 'v' prefix
+func sameVersion(a, b string) bool {
+	return a != "" && strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// Rollout updates the selected agents to Version in waves of BatchSize
+type Rollout struct {
+	ID             string          `json:"id"`
+	Version        string          `json:"version"`
+	ManifestURL    string          `json:"manifest_url,omitempty"`
+	Force          bool            `json:"force,omitempty"`
+	Selector       RolloutSelector `json:"selector"`
+	BatchSize      int             `json:"batch_size"`
+	PauseOnFailure bool            `json:"pause_on_failure"`
+	Status         string          `json:"status"`
+	Wave           int             `json:"wave"` // Current wave, from 0
+	Waves          int             `json:"waves"`
+	Message        string          `json:"message,omitempty"` // Why the rollout paused or ended
+	CreatedBy      string          `json:"created_by"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	Progress       map[string]int  `json:"progress"` // Target state -> count
+	Targets        []RolloutTarget `json:"targets,omitempty"`
+}
+
+// RolloutTarget is one agent of a rollout
+type RolloutTarget struct {
+	ServerID    string     `json:"server_id"`
+	ServerName  string     `json:"server_name"`
+	Wave        int        `json:"wave"`
+	Status      string     `json:"status"`
+	FromVersion string     `json:"from_version"`
+	ToVersion   string     `json:"to_version,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// inFlight reports whether the target's update has started and not ended
+func (t *RolloutTarget) inFlight() bool {
+	return t.Status == TargetSent || t.Status == TargetDownloading || t.Status == TargetRestarted
+}
+
+// failed reports whether the target's update ended unsuccessfully
+func (t *RolloutTarget) failed() bool {
+	return t.Status == TargetFailed || t.Status == TargetRolledBack
+}
+
+// targetStatusFor maps an agent update report to a target state
+func targetStatusFor(status string) string {
+	switch status {
+	case common.UpdateDownloading:
+		return TargetDownloading
+	case common.UpdateRestarting:
+		return TargetRestarted
+	case common.UpdateSucceeded, common.UpdateSkipped:
+		return TargetSucceeded
+	case common.UpdateFailed:
+		return TargetFailed
+	case common.UpdateRolledBack:
+		return TargetRolledBack
+	}
+	return ""
+}
+
+// ============================================================================
+// Rollout Manager
+// ============================================================================
+
+// RolloutManager stores rollouts and sends update commands wave by wave
+type RolloutManager struct {
+	state *AppState
+	db    *sql.DB
+
+	mu     sync.Mutex // Serializes state changes made on this node
+	wakeCh chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewRolloutManager creates a rollout manager
+func NewRolloutManager(state *AppState, db *sql.DB) *RolloutManager {
+	return &RolloutManager{
+		state:  state,
+		db:     db,
+		wakeCh: make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins driving rollouts
+func (m *RolloutManager) Start() {
+	m.wg.Add(1)
+	go m.loop()
+}
+
+// Stop stops driving rollouts
+func (m *RolloutManager) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+// Wake triggers a round without waiting for the next poll
+func (m *RolloutManager) Wake() {
+	select {
+	case m.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (m *RolloutManager) loop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		case <-m.wakeCh:
+		}
+		// Only the cluster leader sends commands, so waves never start twice
+		if isLeader() {
+			m.process(time.Now())
+		}
+	}
+}
+
+func (m *RolloutManager) write(fn func(*sql.DB) error) error {
+	if dbWriter != nil {
+		return dbWriter.WriteSync(fn)
+	}
+	return fn(m.db)
+}
+
+// Create selects the servers of a rollout and stores it; the first wave is
+// sent on the next round
+func (m *RolloutManager) Create(rollout Rollout) (*Rollout, error) {
+	rollout.Version = strings.TrimSpace(rollout.Version)
+	if rollout.Version == "" {
+		return nil, fmt.Errorf("version is required")
+	}
+	if rollout.BatchSize < 1 || rollout.BatchSize > rolloutMaxBatchSize {
+		return nil, fmt.Errorf("batch_size must be between 1 and %d", rolloutMaxBatchSize)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if active, err := m.activeRollout(); err != nil {
+		return nil, err
+	} else if active != "" {
+		return nil, ErrRolloutActive
+	}
+
+	// Agents already on the version are left out unless forced
+	m.state.ConfigMu.RLock()
+	var targets []RolloutTarget
+	for _, server := range m.state.Config.Servers {
+		if !rollout.Selector.Matches(server, m.state.Config.GroupDimensions) {
+			continue
+		}
+		if !rollout.Force && sameVersion(rollout.Version, server.Version) {
+			continue
+		}
+		targets = append(targets, RolloutTarget{
+			ServerID:    server.ID,
+			ServerName:  server.Name,
+			Wave:        len(targets) / rollout.BatchSize,
+			Status:      TargetPending,
+			FromVersion: server.Version,
+			ToVersion:   rollout.Version,
+		})
+	}
+	m.state.ConfigMu.RUnlock()
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no servers to update match the selector")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	rollout.ID = GenerateRandomString(12)
+	rollout.Status = RolloutRunning
+	rollout.Wave = 0
+	rollout.Waves = targets[len(targets)-1].Wave + 1
+	rollout.Message = ""
+	rollout.CreatedAt, rollout.UpdatedAt = now, now
+	rollout.FinishedAt = nil
+
+	selector, _ := json.Marshal(rollout.Selector)
+	err := m.write(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`
+			INSERT INTO agent_rollouts (id, version, manifest_url, force_update, selector, batch_size, pause_on_failure, status, wave, waves, message, created_by, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rollout.ID, rollout.Version, rollout.ManifestURL, boolToInt(rollout.Force), string(selector),
+			rollout.BatchSize, boolToInt(rollout.PauseOnFailure), rollout.Status, rollout.Wave, rollout.Waves,
+			rollout.Message, rollout.CreatedBy, now.Format(time.RFC3339), now.Format(time.RFC3339)); err != nil {
+			return err
+		}
+		for i := range targets {
+			targets[i].UpdatedAt = now
+			t := targets[i]
+			if _, err := tx.Exec(`
+				INSERT INTO agent_rollout_targets (rollout_id, server_id, server_name, wave, status, from_version, to_version, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				rollout.ID, t.ServerID, t.ServerName, t.Wave, t.Status, t.FromVersion, t.ToVersion, now.Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rollout.Targets = targets
+	rollout.Progress = rolloutProgress(targets)
+	m.Wake()
+	return &rollout, nil
+}
+
+// activeRollout returns the ID of the running or paused rollout, if any
+func (m *RolloutManager) activeRollout() (string, error) {
+	var id string
+	err := m.db.QueryRow("SELECT id FROM agent_rollouts WHERE status IN (?, ?) LIMIT 1", RolloutRunning, RolloutPaused).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+const rolloutColumns = `id, version, manifest_url, force_update, selector, batch_size, pause_on_failure, status, wave, waves, message, created_by, created_at, updated_at, finished_at`
+
+func scanRollout(scan func(...interface{}) error) (*Rollout, error) {
+	var r Rollout
+	var force, pause int
+	var selector, createdAt, updatedAt string
+	var finishedAt sql.NullString
+	if err := scan(&r.ID, &r.Version, &r.ManifestURL, &force, &selector, &r.BatchSize, &pause,
+		&r.Status, &r.Wave, &r.Waves, &r.Message, &r.CreatedBy, &createdAt, &updatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	r.Force, r.PauseOnFailure = force != 0, pause != 0
+	json.Unmarshal([]byte(selector), &r.Selector)
+	r.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	r.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	r.FinishedAt = parseNullableTime(finishedAt)
+	return &r, nil
+}
+
+// List returns all rollouts with their progress, newest first
+func (m *RolloutManager) List() ([]Rollout, error) {
+	rows, err := m.db.Query("SELECT " + rolloutColumns + " FROM agent_rollouts ORDER BY created_at DESC, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollouts := []Rollout{}
+	for rows.Next() {
+		r, err := scanRollout(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Only the counts, the targets are returned by Get
+	for i := range rollouts {
+		targets, err := m.targets(rollouts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		rollouts[i].Progress = rolloutProgress(targets)
+	}
+	return rollouts, nil
+}
+
+// Get returns a rollout with its targets
+func (m *RolloutManager) Get(id string) (*Rollout, error) {
+	r, err := scanRollout(m.db.QueryRow("SELECT "+rolloutColumns+" FROM agent_rollouts WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrRolloutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Targets, err = m.targets(id); err != nil {
+		return nil, err
+	}
+	r.Progress = rolloutProgress(r.Targets)
+	return r, nil
+}
+
+// targets returns the targets of a rollout in wave order
+func (m *RolloutManager) targets(id string) ([]RolloutTarget, error) {
+	rows, err := m.db.Query(`
+		SELECT server_id, server_name, wave, status, from_version, to_version, error, sent_at, updated_at
+		FROM agent_rollout_targets WHERE rollout_id = ? ORDER BY wave, server_name, server_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []RolloutTarget{}
+	for rows.Next() {
+		var t RolloutTarget
+		var sentAt sql.NullString
+		var updatedAt string
+		if err := rows.Scan(&t.ServerID, &t.ServerName, &t.Wave, &t.Status, &t.FromVersion, &t.ToVersion, &t.Error, &sentAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		t.SentAt = parseNullableTime(sentAt)
+		t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func rolloutProgress(targets []RolloutTarget) map[string]int {
+	progress := map[string]int{}
+	for _, t := range targets {
+		progress[t.Status]++
+	}
+	return progress
+}
+
+// Abort stops a rollout; agents that have not been sent the update are
+// cancelled, updates already in progress are still tracked
+func (m *RolloutManager) Abort(id, reason string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := m.write(func(db *sql.DB) error {
+		res, err := db.Exec(`
+			UPDATE agent_rollouts SET status = ?, message = ?, updated_at = ?, finished_at = ?
+			WHERE id = ? AND status IN (?, ?)`,
+			RolloutAborted, reason, now, now, id, RolloutRunning, RolloutPaused)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrRolloutState
+		}
+		_, err = db.Exec("UPDATE agent_rollout_targets SET status = ?, updated_at = ? WHERE rollout_id = ? AND status = ?",
+			TargetCancelled, now, id, TargetPending)
+		return err
+	})
+	if err != nil {
+		return nil, m.notFoundOr(id, err)
+	}
+	return m.Get(id)
+}
+
+// Resume continues a paused rollout with its next wave
+func (m *RolloutManager) Resume(id string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := m.write(func(db *sql.DB) error {
+		res, err := db.Exec("UPDATE agent_rollouts SET status = ?, message = '', updated_at = ? WHERE id = ? AND status = ?",
+			RolloutRunning, now, id, RolloutPaused)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrRolloutState
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, m.notFoundOr(id, err)
+	}
+	m.Wake()
+	return m.Get(id)
+}
+
+// notFoundOr returns ErrRolloutNotFound for unknown rollouts and err
+// otherwise
+func (m *RolloutManager) notFoundOr(id string, err error) error {
+	if err != ErrRolloutState {
+		return err
+	}
+	if _, getErr := m.Get(id); getErr == ErrRolloutNotFound {
+		return ErrRolloutNotFound
+	}
+	return err
+}
+
+// RecordUpdate applies an agent's update report to the rollout target it
+// belongs to, if any. Reports about another version, such as a manual
+// update to a different release, leave the target alone.
+func (m *RolloutManager) RecordUpdate(serverID string, update *AgentUpdateStatus) {
+	status := targetStatusFor(update.Status)
+	if status == "" {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := m.write(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT rollout_id, to_version FROM agent_rollout_targets
+			WHERE server_id = ? AND status IN (?, ?, ?)`,
+			serverID, TargetSent, TargetDownloading, TargetRestarted)
+		if err != nil {
+			return err
+		}
+		var rolloutIDs []string
+		for rows.Next() {
+			var rolloutID, version string
+			if err := rows.Scan(&rolloutID, &version); err != nil {
+				rows.Close()
+				return err
+			}
+			if sameVersion(update.ToVersion, version) {
+				rolloutIDs = append(rolloutIDs, rolloutID)
+			}
+		}
+		rows.Close()
+
+		for _, rolloutID := range rolloutIDs {
+			_, err := db.Exec(`
+				UPDATE agent_rollout_targets SET status = ?, error = ?, updated_at = ?
+				WHERE rollout_id = ? AND server_id = ? AND status IN (?, ?, ?)`,
+				status, update.Error, now, rolloutID, serverID, TargetSent, TargetDownloading, TargetRestarted)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Failed to record rollout progress of %s: %v\n", serverID, err)
+		return
+	}
+	if status != TargetDownloading && status != TargetRestarted {
+		m.Wake()
+	}
+}
+
+// process advances all running rollouts
+func (m *RolloutManager) process(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows, err := m.db.Query("SELECT id FROM agent_rollouts WHERE status = ?", RolloutRunning)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load rollouts: %v\n", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := m.advance(id, now); err != nil && err != ErrRolloutState {
+			fmt.Printf("⚠️ Failed to advance rollout %s: %v\n", id, err)
+		}
+	}
+}
+
+// advance sends the current wave, times out agents that stopped reporting
+// and moves on to the next wave once the current one is finished
+func (m *RolloutManager) advance(id string, now time.Time) error {
+	rollout, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	for rollout.Status == RolloutRunning {
+		var wave []*RolloutTarget
+		for i := range rollout.Targets {
+			if rollout.Targets[i].Wave == rollout.Wave {
+				wave = append(wave, &rollout.Targets[i])
+			}
+		}
+
+		busy := false
+		for _, t := range wave {
+			switch {
+			case t.Status == TargetPending:
+				if err := m.send(rollout, t, now); err != nil {
+					return err
+				}
+			case t.inFlight() && t.SentAt != nil && now.Sub(*t.SentAt) > rolloutTargetTimeout:
+				msg := fmt.Sprintf("no update result within %v", rolloutTargetTimeout)
+				if err := m.setTarget(rollout.ID, t, TargetFailed, msg, nil); err != nil {
+					return err
+				}
+			}
+			if t.inFlight() {
+				busy = true
+			}
+		}
+		if busy {
+			return nil
+		}
+
+		// The wave is finished
+		failures := 0
+		for _, t := range wave {
+			if t.failed() {
+				failures++
+			}
+		}
+		next := rollout.Wave + 1
+		switch {
+		case next >= rollout.Waves:
+			failed := 0
+			for i := range rollout.Targets {
+				if rollout.Targets[i].failed() {
+					failed++
+				}
+			}
+			message := fmt.Sprintf("%d of %d agents updated", len(rollout.Targets)-failed, len(rollout.Targets))
+			if err := m.setRollout(rollout, RolloutCompleted, rollout.Wave, message, now); err != nil {
+				return err
+			}
+			m.audit(rollout, AuditActionRolloutComplete, failed > 0, message)
+		case failures > 0 && rollout.PauseOnFailure:
+			message := fmt.Sprintf("wave %d of %d: %d of %d agents failed", rollout.Wave+1, rollout.Waves, failures, len(wave))
+			if err := m.setRollout(rollout, RolloutPaused, next, message, now); err != nil {
+				return err
+			}
+			m.audit(rollout, AuditActionRolloutPause, true, message)
+		default:
+			if err := m.setRollout(rollout, RolloutRunning, next, "", now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// send sends the update command to a target; agents that are not connected
+// fail right away
+func (m *RolloutManager) send(rollout *Rollout, t *RolloutTarget, now time.Time) error {
+	data, _ := json.Marshal(AgentCommand{
+		Type:        "command",
+		Command:     "update",
+		ManifestURL: rollout.ManifestURL,
+		Version:     rollout.Version,
+		Force:       rollout.Force,
+	})
+	// Mark it sent first so that a fast report is not lost
+	sentAt := now.UTC().Truncate(time.Second)
+	if err := m.setTarget(rollout.ID, t, TargetSent, "", &sentAt); err != nil {
+		return err
+	}
+	switch err := m.state.SendToAgent(t.ServerID, data); err {
+	case nil:
+		return nil
+	case ErrAgentNotConnected:
+		return m.setTarget(rollout.ID, t, TargetFailed, "agent is not connected", nil)
+	default:
+		return m.setTarget(rollout.ID, t, TargetFailed, "failed to send update command: "+err.Error(), nil)
+	}
+}
+
+// setTarget changes a target's state unless a report changed it meanwhile
+func (m *RolloutManager) setTarget(rolloutID string, t *RolloutTarget, status, message string, sentAt *time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := m.write(func(db *sql.DB) error {
+		var res sql.Result
+		var err error
+		if sentAt != nil {
+			res, err = db.Exec(`UPDATE agent_rollout_targets SET status = ?, error = ?, sent_at = ?, updated_at = ?
+				WHERE rollout_id = ? AND server_id = ? AND status = ?`,
+				status, message, sentAt.Format(time.RFC3339), now, rolloutID, t.ServerID, t.Status)
+		} else {
+			res, err = db.Exec(`UPDATE agent_rollout_targets SET status = ?, error = ?, updated_at = ?
+				WHERE rollout_id = ? AND server_id = ? AND status = ?`,
+				status, message, now, rolloutID, t.ServerID, t.Status)
+		}
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// Reported meanwhile; pick up the new state
+			return db.QueryRow("SELECT status, error FROM agent_rollout_targets WHERE rollout_id = ? AND server_id = ?",
+				rolloutID, t.ServerID).Scan(&status, &message)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	t.Status, t.Error = status, message
+	if sentAt != nil && status == TargetSent {
+		t.SentAt = sentAt
+	}
+	return nil
+}
+
+// setRollout changes the state and wave of a running rollout
+func (m *RolloutManager) setRollout(rollout *Rollout, status string, wave int, message string, now time.Time) error {
+	ts := now.UTC().Format(time.RFC3339)
+	var finishedAt interface{}
+	if status == RolloutCompleted {
+		finishedAt = ts
+	}
+	err := m.write(func(db *sql.DB) error {
+		res, err := db.Exec(`UPDATE agent_rollouts SET status = ?, wave = ?, message = ?, updated_at = ?, finished_at = ?
+			WHERE id = ? AND status = ?`,
+			status, wave, message, ts, finishedAt, rollout.ID, RolloutRunning)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrRolloutState // Aborted meanwhile
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	rollout.Status, rollout.Wave, rollout.Message = status, wave, message
+	return nil
+}
+
+// audit logs a change the manager made on its own
+func (m *RolloutManager) audit(rollout *Rollout, action AuditLogAction, failed bool, message string) {
+	entry := AuditLogEntry{
+		Action:     action,
+		Category:   AuditCategoryServer,
+		Username:   "system",
+		TargetType: "rollout",
+		TargetID:   rollout.ID,
+		TargetName: rollout.Version,
+		Details:    message,
+		Status:     "success",
+	}
+	if failed {
+		entry.Status = "error"
+		entry.ErrorMessage = message
+	}
+	LogAudit(entry)
+}
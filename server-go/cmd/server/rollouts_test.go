@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vstats/internal/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRolloutSelector tests picking the servers of a rollout
+func TestRolloutSelector(t *testing.T) {
+	dimensions := []GroupDimension{{ID: "d1", Key: "region", Options: []GroupOption{{ID: "o1", Name: "Asia"}}}}
+	server := RemoteServer{ID: "s1", Tag: "prod", Version: "v1.2.0", GroupValues: map[string]string{"d1": "o1"}}
+
+	tests := []struct {
+		name     string
+		selector RolloutSelector
+		want     bool
+	}{
+		{"empty selects all", RolloutSelector{}, true},
+		{"server", RolloutSelector{Servers: []string{"s2", "s1"}}, true},
+		{"other server", RolloutSelector{Servers: []string{"s2"}}, false},
+		{"tag", RolloutSelector{Tags: []string{"staging", "PROD"}}, true},
+		{"other tag", RolloutSelector{Tags: []string{"staging"}}, false},
+		{"version without prefix", RolloutSelector{Versions: []string{"1.2.0"}}, true},
+		{"other version", RolloutSelector{Versions: []string{"1.1.0"}}, false},
+		{"dimension option", RolloutSelector{Dimensions: map[string]string{"region": "asia"}}, true},
+		{"all conditions", RolloutSelector{Tags: []string{"prod"}, Dimensions: map[string]string{"region": "europe"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.selector.Matches(server, dimensions); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestRollouts tests rolling out an agent version in waves
+func TestRollouts(t *testing.T) {
+	forEachBackend(t, testRollouts)
+}
+
+func testRollouts(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter, oldManager := dbWriter, rolloutManager
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter, rolloutManager = oldWriter, oldManager
+	}()
+
+	state := &AppState{
+		Config: &AppConfig{Servers: []RemoteServer{
+			{ID: "s1", Name: "a", Tag: "prod", Version: "1.0.0"},
+			{ID: "s2", Name: "b", Tag: "prod", Version: "1.0.0"},
+			{ID: "s3", Name: "c", Tag: "prod", Version: "1.0.0"},
+			{ID: "s4", Name: "d", Tag: "prod", Version: "1.0.0"}, // Not connected
+			{ID: "s5", Name: "e", Tag: "prod", Version: "1.1.0"}, // Already updated
+			{ID: "s6", Name: "f", Tag: "dev", Version: "1.0.0"},
+		}},
+		AgentConns: make(map[string]*AgentConnection),
+	}
+	for _, id := range []string{"s1", "s2", "s3", "s5", "s6"} {
+		state.AgentConns[id] = &AgentConnection{SendChan: make(chan []byte, 10)}
+	}
+	rolloutManager = NewRolloutManager(state, helper.db)
+
+	router := gin.New()
+	router.GET("/api/rollouts", state.GetRollouts)
+	router.GET("/api/rollouts/:id", state.GetRollout)
+	router.POST("/api/rollouts", state.CreateRollout)
+	router.POST("/api/rollouts/:id/resume", state.ResumeRollout)
+	router.POST("/api/rollouts/:id/abort", state.AbortRollout)
+	request := func(method, path string, body interface{}) (*httptest.ResponseRecorder, *Rollout) {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(data)))
+		var rollout Rollout
+		json.Unmarshal(w.Body.Bytes(), &rollout)
+		return w, &rollout
+	}
+	sent := func(id string) *AgentCommand {
+		select {
+		case data := <-state.AgentConns[id].SendChan:
+			var cmd AgentCommand
+			json.Unmarshal(data, &cmd)
+			return &cmd
+		default:
+			return nil
+		}
+	}
+	report := func(id, version, status string) {
+		rolloutManager.RecordUpdate(id, &AgentUpdateStatus{Status: status, FromVersion: "1.0.0", ToVersion: version})
+	}
+	expectTargets := func(id string, want map[string]string) *Rollout {
+		t.Helper()
+		rollout, err := rolloutManager.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get rollout: %v", err)
+		}
+		for _, target := range rollout.Targets {
+			if target.Status != want[target.ServerID] {
+				t.Errorf("Expected %s to be %s, got %s (%s)", target.ServerID, want[target.ServerID], target.Status, target.Error)
+			}
+		}
+		return rollout
+	}
+
+	if w, _ := request("POST", "/api/rollouts", CreateRolloutRequest{Version: "1.1.0"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a batch size, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w, _ := request("POST", "/api/rollouts", CreateRolloutRequest{Version: "1.1.0", BatchSize: 2, Selector: RolloutSelector{Tags: []string{"none"}}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d when nothing matches, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Servers already on the version are left out
+	w, rollout := request("POST", "/api/rollouts", CreateRolloutRequest{Version: "1.1.0", BatchSize: 2, Selector: RolloutSelector{Tags: []string{"prod"}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if rollout.Waves != 2 || len(rollout.Targets) != 4 || !rollout.PauseOnFailure || rollout.Status != RolloutRunning {
+		t.Fatalf("Unexpected rollout %+v", rollout)
+	}
+	if w, _ := request("POST", "/api/rollouts", CreateRolloutRequest{Version: "1.1.0", BatchSize: 2}); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d while a rollout is running, got %d", http.StatusConflict, w.Code)
+	}
+
+	// The first wave is sent
+	now := time.Now()
+	rolloutManager.process(now)
+	if cmd := sent("s1"); cmd == nil || cmd.Command != "update" || cmd.Version != "1.1.0" {
+		t.Errorf("Expected an update command for s1, got %+v", cmd)
+	}
+	if cmd := sent("s3"); cmd != nil {
+		t.Errorf("Expected no command for the second wave yet, got %+v", cmd)
+	}
+	expectTargets(rollout.ID, map[string]string{"s1": TargetSent, "s2": TargetSent, "s3": TargetPending, "s4": TargetPending})
+
+	// Reports about another version leave the targets alone
+	report("s1", "2.0.0", common.UpdateFailed)
+	expectTargets(rollout.ID, map[string]string{"s1": TargetSent, "s2": TargetSent, "s3": TargetPending, "s4": TargetPending})
+
+	// Agent reports move the targets along; a rollback pauses the rollout
+	report("s1", "1.1.0", common.UpdateDownloading)
+	report("s2", "1.1.0", common.UpdateRestarting)
+	expectTargets(rollout.ID, map[string]string{"s1": TargetDownloading, "s2": TargetRestarted, "s3": TargetPending, "s4": TargetPending})
+	report("s1", "1.1.0", common.UpdateRestarting)
+	report("s1", "1.1.0", common.UpdateSucceeded)
+	report("s2", "1.1.0", common.UpdateRolledBack)
+	rolloutManager.process(now)
+	paused := expectTargets(rollout.ID, map[string]string{"s1": TargetSucceeded, "s2": TargetRolledBack, "s3": TargetPending, "s4": TargetPending})
+	if paused.Status != RolloutPaused || paused.Wave != 1 || paused.Message == "" {
+		t.Fatalf("Expected the rollout to pause before the second wave, got %+v", paused)
+	}
+	rolloutManager.process(now)
+	if cmd := sent("s3"); cmd != nil {
+		t.Errorf("Expected no command while paused, got %+v", cmd)
+	}
+
+	// Resuming sends the next wave; disconnected agents fail right away
+	if w, resumed := request("POST", "/api/rollouts/"+rollout.ID+"/resume", nil); w.Code != http.StatusOK || resumed.Status != RolloutRunning {
+		t.Fatalf("Expected the rollout to resume, got %d: %s", w.Code, w.Body.String())
+	}
+	rolloutManager.process(now)
+	if cmd := sent("s3"); cmd == nil {
+		t.Error("Expected an update command for s3")
+	}
+	expectTargets(rollout.ID, map[string]string{"s1": TargetSucceeded, "s2": TargetRolledBack, "s3": TargetSent, "s4": TargetFailed})
+
+	// Agents that stop reporting time out
+	rolloutManager.process(now.Add(rolloutTargetTimeout + time.Minute))
+	done := expectTargets(rollout.ID, map[string]string{"s1": TargetSucceeded, "s2": TargetRolledBack, "s3": TargetFailed, "s4": TargetFailed})
+	if done.Status != RolloutCompleted || done.FinishedAt == nil || done.Progress[TargetFailed] != 2 {
+		t.Fatalf("Expected the rollout to complete, got %+v", done)
+	}
+	if w, _ := request("POST", "/api/rollouts/"+rollout.ID+"/abort", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d aborting a completed rollout, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Aborting cancels the agents that were not sent the update
+	w, second := request("POST", "/api/rollouts", CreateRolloutRequest{Version: "1.2.0", BatchSize: 1, Force: true, Selector: RolloutSelector{Servers: []string{"s5", "s6"}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	rolloutManager.process(now)
+	if w, aborted := request("POST", "/api/rollouts/"+second.ID+"/abort", nil); w.Code != http.StatusOK || aborted.Status != RolloutAborted {
+		t.Fatalf("Expected the rollout to be aborted, got %d: %s", w.Code, w.Body.String())
+	}
+	expectTargets(second.ID, map[string]string{"s5": TargetSent, "s6": TargetCancelled})
+	report("s5", "1.2.0", common.UpdateSucceeded)
+	expectTargets(second.ID, map[string]string{"s5": TargetSucceeded, "s6": TargetCancelled})
+
+	if w, _ := request("GET", "/api/rollouts/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown rollout, got %d", http.StatusNotFound, w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/rollouts", nil))
+	var list []Rollout
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 2 || list[0].Progress == nil {
+		t.Errorf("Expected both rollouts with progress, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Session Types
+// ============================================================================
+
+// RefreshTokenPrefix marks opaque refresh tokens
+const RefreshTokenPrefix = "vsr_"
+
+// ContextKeySessionID is set by AuthMiddleware to the session (JWT jti) of the request
+const ContextKeySessionID = "session_id"
+
+const (
+	DefaultAccessTokenMinutes = 15
+	DefaultRefreshTokenDays   = 7
+	sessionTouchInterval      = time.Minute
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
+// SessionSettings controls access and refresh token lifetimes
+type SessionSettings struct {
+	AccessTokenMinutes int `json:"access_token_minutes,omitempty"` // Default: 15
+	RefreshTokenDays   int `json:"refresh_token_days,omitempty"`   // Default: 7
+}
+
+// Session represents a logged-in client. The session ID is the jti of
+// every access token issued for it.
+type Session struct {
+	ID         string   `json:"id"`
+	UserID     string   `json:"user_id,omitempty"`
+	Username   string   `json:"username"`
+	Role       UserRole `json:"role"`
+	Provider   string   `json:"provider,omitempty"`
+	IP         string   `json:"ip"`
+	UserAgent  string   `json:"user_agent"`
+	IssuedAt   string   `json:"issued_at"`
+	LastSeenAt string   `json:"last_seen_at"`
+	ExpiresAt  string   `json:"expires_at"`
+	RevokedAt  string   `json:"revoked_at,omitempty"`
+	Current    bool     `json:"current,omitempty"`
+}
+
+// TokenPair is returned by login and refresh
+type TokenPair struct {
+	SessionID        string
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// sessionTTLs returns the configured access and refresh token lifetimes
+func (s *AppState) sessionTTLs() (time.Duration, time.Duration) {
+	access := DefaultAccessTokenMinutes
+	refresh := DefaultRefreshTokenDays
+
+	s.ConfigMu.RLock()
+	if settings := s.Config.SessionSettings; settings != nil {
+		if settings.AccessTokenMinutes > 0 {
+			access = settings.AccessTokenMinutes
+		}
+		if settings.RefreshTokenDays > 0 {
+			refresh = settings.RefreshTokenDays
+		}
+	}
+	s.ConfigMu.RUnlock()
+
+	return time.Duration(access) * time.Minute, time.Duration(refresh) * 24 * time.Hour
+}
+
+// sessionsEnabled reports whether server-side sessions are available.
+// Without a database (e.g. in handler tests) tokens are stateless.
+func sessionsEnabled() bool {
+	return dbWriter != nil
+}
+
+// ============================================================================
+// Session Storage
+// ============================================================================
+
+const sessionColumns = `id, user_id, username, role, COALESCE(provider, ''), COALESCE(ip, ''), COALESCE(user_agent, ''),
+	issued_at, last_seen_at, expires_at, COALESCE(revoked_at, '')`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var sess Session
+	var role string
+	if err := row.Scan(&sess.ID, &sess.UserID, &sess.Username, &role, &sess.Provider, &sess.IP, &sess.UserAgent,
+		&sess.IssuedAt, &sess.LastSeenAt, &sess.ExpiresAt, &sess.RevokedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	sess.Role = UserRole(role)
+	return &sess, nil
+}
+
+// getSessionByID looks up a session by ID
+func getSessionByID(db *sql.DB, id string) (*Session, error) {
+	return scanSession(db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+}
+
+// getSessionByRefreshToken looks up a session by raw refresh token
+func getSessionByRefreshToken(db *sql.DB, raw string) (*Session, error) {
+	return scanSession(db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE refresh_hash = ?", hashAPIToken(raw)))
+}
+
+// listActiveSessions returns active sessions, optionally filtered to one user
+func listActiveSessions(db *sql.DB, identity *AuthIdentity) ([]Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE revoked_at IS NULL AND expires_at > ?"
+	args := []interface{}{time.Now().UTC().Format(time.RFC3339)}
+	if identity != nil {
+		query += " AND user_id = ? AND username = ?"
+		args = append(args, identity.UserID, identity.Username)
+	}
+	query += " ORDER BY last_seen_at DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, *sess)
+	}
+	return sessions, nil
+}
+
+// revokeSession revokes a single session
+func revokeSession(db *sql.DB, id string) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// revokeUserSessions revokes all sessions of a user except exceptID.
+// The built-in admin is identified by an empty user ID and its username.
+func revokeUserSessions(db *sql.DB, userID, username, exceptID string) (int64, error) {
+	query := "UPDATE sessions SET revoked_at = ? WHERE revoked_at IS NULL AND user_id = ? AND id != ?"
+	args := []interface{}{time.Now().UTC().Format(time.RFC3339), userID, exceptID}
+	if userID == "" {
+		query += " AND username = ?"
+		args = append(args, username)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ============================================================================
+// Session Lifecycle
+// ============================================================================
+
+// issueSession creates a session and returns a new access/refresh token pair
+func (s *AppState) issueSession(identity AuthIdentity, provider, ip, userAgent string) (*TokenPair, error) {
+	accessTTL, refreshTTL := s.sessionTTLs()
+
+	if !sessionsEnabled() {
+		token, expiresAt, err := generateJWTToken(identity, provider, "", accessTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &TokenPair{AccessToken: token, AccessExpiresAt: expiresAt}, nil
+	}
+
+	now := time.Now().UTC()
+	sess := &Session{
+		ID:         GenerateRandomString(32),
+		UserID:     identity.UserID,
+		Username:   identity.Username,
+		Role:       identity.Role,
+		Provider:   provider,
+		IP:         ip,
+		UserAgent:  userAgent,
+		IssuedAt:   now.Format(time.RFC3339),
+		LastSeenAt: now.Format(time.RFC3339),
+		ExpiresAt:  now.Add(refreshTTL).Format(time.RFC3339),
+	}
+	refreshToken := RefreshTokenPrefix + GenerateRandomString(48)
+
+	err := dbWriter.WriteSync(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO sessions (id, user_id, username, role, provider, ip, user_agent, issued_at, last_seen_at, expires_at, refresh_hash)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sess.ID, sess.UserID, sess.Username, string(sess.Role), sess.Provider, sess.IP, sess.UserAgent,
+			sess.IssuedAt, sess.LastSeenAt, sess.ExpiresAt, hashAPIToken(refreshToken),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := generateJWTToken(identity, provider, sess.ID, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		SessionID:        sess.ID,
+		AccessToken:      token,
+		AccessExpiresAt:  expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: now.Add(refreshTTL),
+	}, nil
+}
+
+// refreshSession rotates the refresh token of a session and issues a new access token
+func (s *AppState) refreshSession(rawRefresh, ip string) (*Session, *TokenPair, error) {
+	if !sessionsEnabled() {
+		return nil, nil, ErrSessionNotFound
+	}
+
+	sess, err := getSessionByRefreshToken(dbWriter.GetDB(), rawRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sess.RevokedAt != "" {
+		return sess, nil, ErrSessionRevoked
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, sess.ExpiresAt); err != nil || time.Now().After(expiresAt) {
+		return sess, nil, ErrSessionExpired
+	}
+
+	identity := AuthIdentity{UserID: sess.UserID, Username: sess.Username, Role: sess.Role}
+	if sess.UserID != "" {
+		u, err := getUserByID(dbWriter.GetDB(), sess.UserID)
+		if err != nil || u.Disabled {
+			dbWriter.WriteAsync(func(db *sql.DB) error { return revokeSession(db, sess.ID) })
+			return sess, nil, ErrUserNotFound
+		}
+		identity.Username = u.Username
+		identity.Role = u.Role
+	}
+
+	accessTTL, refreshTTL := s.sessionTTLs()
+	now := time.Now().UTC()
+	refreshToken := RefreshTokenPrefix + GenerateRandomString(48)
+
+	err = dbWriter.WriteSync(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			UPDATE sessions SET refresh_hash = ?, expires_at = ?, last_seen_at = ?, ip = ?, role = ?
+			WHERE id = ? AND revoked_at IS NULL`,
+			hashAPIToken(refreshToken), now.Add(refreshTTL).Format(time.RFC3339), now.Format(time.RFC3339),
+			ip, string(identity.Role), sess.ID,
+		)
+		return err
+	})
+	if err != nil {
+		return sess, nil, err
+	}
+
+	token, expiresAt, err := generateJWTToken(identity, sess.Provider, sess.ID, accessTTL)
+	if err != nil {
+		return sess, nil, err
+	}
+
+	return sess, &TokenPair{
+		SessionID:        sess.ID,
+		AccessToken:      token,
+		AccessExpiresAt:  expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: now.Add(refreshTTL),
+	}, nil
+}
+
+var (
+	sessionTouches   = make(map[string]time.Time)
+	sessionTouchesMu sync.Mutex
+)
+
+// validateSession checks that a session is active and records activity
+func validateSession(id, ip string) error {
+	sess, err := getSessionByID(dbWriter.GetDB(), id)
+	if err != nil {
+		return err
+	}
+	if sess.RevokedAt != "" {
+		return ErrSessionRevoked
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, sess.ExpiresAt); err != nil || time.Now().After(expiresAt) {
+		return ErrSessionExpired
+	}
+
+	// Throttle last_seen updates to one write per session per interval
+	now := time.Now()
+	sessionTouchesMu.Lock()
+	last := sessionTouches[id]
+	if now.Sub(last) < sessionTouchInterval {
+		sessionTouchesMu.Unlock()
+		return nil
+	}
+	sessionTouches[id] = now
+	for sid, t := range sessionTouches {
+		if now.Sub(t) > time.Hour {
+			delete(sessionTouches, sid)
+		}
+	}
+	sessionTouchesMu.Unlock()
+
+	seen := now.UTC().Format(time.RFC3339)
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE sessions SET last_seen_at = ?, ip = ? WHERE id = ?", seen, ip, id)
+		return err
+	})
+	return nil
+}
+
+// revokeBuiltinAdminSessions revokes every session of the built-in admin
+func revokeBuiltinAdminSessions() {
+	if dbWriter == nil {
+		return
+	}
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		n, err := revokeUserSessions(db, "", BuiltinAdminUsername, "")
+		if err == nil && n > 0 {
+			fmt.Printf("🔒 Revoked %d admin session(s)\n", n)
+		}
+		return err
+	})
+}
+
+// RevokeAdminSessionsOffline revokes built-in admin sessions directly in the
+// database file. Used by --reset-password, which runs outside the server.
+func RevokeAdminSessionsOffline() (int64, error) {
+	db, err := openConfiguredDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if _, err := runMigrations(db); err != nil {
+		return 0, err
+	}
+	return revokeUserSessions(db, "", BuiltinAdminUsername, "")
+}
+
+// CleanupSessions removes sessions that expired or were revoked more than a day ago
+func CleanupSessions(db *sql.DB) {
+	cutoff := time.Now().UTC().Add(-24 * time.Hour).Format(time.RFC3339)
+	db.Exec("DELETE FROM sessions WHERE expires_at < ? OR (revoked_at IS NOT NULL AND revoked_at < ?)", cutoff, cutoff)
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // SetupSignalHandler sets up signal handlers for graceful operations
-// SIGHUP: Reload password from config file
+// SIGHUP: Reload config from the config file and database
 func SetupSignalHandler(state *AppState) {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGHUP)
@@ -29,7 +29,7 @@ func SetupSignalHandler(state *AppState) {
 	}()
 }
 
-// reloadConfig reloads the configuration from disk
+// reloadConfig reloads the configuration from disk and the database
 func reloadConfig(state *AppState) {
 	path := GetConfigPath()
 	data, err := os.ReadFile(path)
@@ -43,24 +43,15 @@ func reloadConfig(state *AppState) {
 		fmt.Printf("❌ Failed to parse config: %v\n", err)
 		return
 	}
+	overlayStoredConfig(&newConfig)
 
-	// Validate the new password hash
-	if len(newConfig.AdminPasswordHash) < 4 ||
-		(newConfig.AdminPasswordHash[:3] != "$2a" && newConfig.AdminPasswordHash[:3] != "$2b") {
-		fmt.Println("❌ Invalid password hash format in config")
+	if err := applyConfig(state, &newConfig); err != nil {
+		fmt.Printf("❌ %v\n", err)
 		return
 	}
+	state.pushConfigToAgents()
 
-	// Update the config in memory
-	state.ConfigMu.Lock()
-	state.Config.AdminPasswordHash = newConfig.AdminPasswordHash
-	if newConfig.JWTSecret != "" {
-		state.Config.JWTSecret = newConfig.JWTSecret
-		InitJWTSecret(newConfig.JWTSecret)
-	}
-	state.ConfigMu.Unlock()
-
-	fmt.Println("✅ Config reloaded successfully - new password is now active")
+	fmt.Println("✅ Config reloaded successfully")
 }
 
 // SignalError represents different types of signal errors
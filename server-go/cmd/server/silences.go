@@ -0,0 +1,344 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Silences and Maintenance Windows
+// ============================================================================
+
+// Silence states reported by the API
+const (
+	SilencePending   = "pending"   // Starts in the future
+	SilenceActive    = "active"    // Suppressing notifications now
+	SilenceScheduled = "scheduled" // Recurring, outside its window
+	SilenceExpired   = "expired"
+)
+
+// silenceReloadInterval is how often silences created on other replicas are
+// picked up
+const silenceReloadInterval = 30 * time.Second
+
+// silenceRetention is how long ended silences are kept
+const silenceRetention = 30 * 24 * time.Hour
+
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// Global silence store
+var silenceStore *SilenceStore
+
+// Silence suppresses notifications for matching alerts between StartsAt and
+// EndsAt, or only inside Schedule's windows when it is set
+type Silence struct {
+	ID        string             `json:"id"`
+	Comment   string             `json:"comment"`
+	CreatedBy string             `json:"created_by"`
+	CreatedAt time.Time          `json:"created_at"`
+	Matchers  AlertMatcher       `json:"matchers"`
+	Schedule  *MaintenanceWindow `json:"schedule,omitempty"`
+	StartsAt  time.Time          `json:"starts_at"`
+	EndsAt    *time.Time         `json:"ends_at,omitempty"` // Only optional for recurring windows
+	ExpiredAt *time.Time         `json:"expired_at,omitempty"`
+	Status    string             `json:"status"`
+}
+
+// MaintenanceWindow is a daily or weekly recurring time window
+type MaintenanceWindow struct {
+	Weekdays []int  `json:"weekdays,omitempty"` // 0 = Sunday; empty means every day
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM; before Start for windows past midnight
+	Timezone string `json:"timezone,omitempty"` // IANA name, default UTC
+}
+
+// Validate checks a silence before it is stored
+func (s *Silence) Validate() error {
+	if s.Matchers.Empty() {
+		return fmt.Errorf("at least one matcher is required")
+	}
+	if s.Schedule == nil && s.EndsAt == nil {
+		return fmt.Errorf("ends_at is required")
+	}
+	if s.EndsAt != nil && !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	if s.Schedule != nil {
+		return s.Schedule.Validate()
+	}
+	return nil
+}
+
+// Validate checks the window's times, weekdays and timezone
+func (w *MaintenanceWindow) Validate() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("maintenance window start and end must differ")
+	}
+	for _, day := range w.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", w.Timezone)
+	}
+	return nil
+}
+
+// Contains reports whether t falls inside the window
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false
+	}
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return minute >= start && minute < end && w.onDay(t.Weekday())
+	}
+	// The window runs past midnight: it either started today or yesterday
+	yesterday := (t.Weekday() + 6) % 7
+	return minute >= start && w.onDay(t.Weekday()) || minute < end && w.onDay(yesterday)
+}
+
+func (w *MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// StatusAt returns the state of the silence at now
+func (s *Silence) StatusAt(now time.Time) string {
+	switch {
+	case s.ExpiredAt != nil, s.EndsAt != nil && !now.Before(*s.EndsAt):
+		return SilenceExpired
+	case now.Before(s.StartsAt):
+		return SilencePending
+	case s.Schedule != nil && !s.Schedule.Contains(now):
+		return SilenceScheduled
+	}
+	return SilenceActive
+}
+
+// ============================================================================
+// Silence Store
+// ============================================================================
+
+// SilenceStore keeps silences in the database and caches them for matching
+type SilenceStore struct {
+	db *sql.DB
+
+	mu       sync.RWMutex
+	cache    []Silence
+	loadedAt time.Time
+}
+
+// NewSilenceStore creates a silence store
+func NewSilenceStore(db *sql.DB) *SilenceStore {
+	return &SilenceStore{db: db}
+}
+
+func (s *SilenceStore) write(fn func(*sql.DB) error) error {
+	if dbWriter != nil {
+		return dbWriter.WriteSync(fn)
+	}
+	return fn(s.db)
+}
+
+// List returns all silences, newest first
+func (s *SilenceStore) List() ([]Silence, error) {
+	rows, err := s.db.Query(`
+		SELECT id, comment, created_by, created_at, matchers, schedule, starts_at, ends_at, expired_at
+		FROM silences ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	silences := []Silence{}
+	for rows.Next() {
+		var silence Silence
+		var createdAt, matchers, startsAt string
+		var schedule, endsAt, expiredAt sql.NullString
+		if err := rows.Scan(&silence.ID, &silence.Comment, &silence.CreatedBy, &createdAt,
+			&matchers, &schedule, &startsAt, &endsAt, &expiredAt); err != nil {
+			return nil, err
+		}
+		silence.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		silence.StartsAt, _ = time.Parse(time.RFC3339, startsAt)
+		json.Unmarshal([]byte(matchers), &silence.Matchers)
+		if schedule.Valid {
+			silence.Schedule = &MaintenanceWindow{}
+			json.Unmarshal([]byte(schedule.String), silence.Schedule)
+		}
+		silence.EndsAt = parseNullableTime(endsAt)
+		silence.ExpiredAt = parseNullableTime(expiredAt)
+		silence.Status = silence.StatusAt(now)
+		silences = append(silences, silence)
+	}
+	return silences, rows.Err()
+}
+
+func parseNullableTime(s sql.NullString) *time.Time {
+	if !s.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// Create stores a new silence
+func (s *SilenceStore) Create(silence Silence) (*Silence, error) {
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = time.Now()
+	}
+	if err := silence.Validate(); err != nil {
+		return nil, err
+	}
+	silence.ID = GenerateRandomString(12)
+	silence.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	silence.StartsAt = silence.StartsAt.UTC().Truncate(time.Second)
+
+	matchers, _ := json.Marshal(silence.Matchers)
+	var schedule interface{}
+	if silence.Schedule != nil {
+		data, _ := json.Marshal(silence.Schedule)
+		schedule = string(data)
+	}
+	err := s.write(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO silences (id, comment, created_by, created_at, matchers, schedule, starts_at, ends_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			silence.ID, silence.Comment, silence.CreatedBy, silence.CreatedAt.Format(time.RFC3339),
+			string(matchers), schedule, silence.StartsAt.Format(time.RFC3339), formatNullableUTC(silence.EndsAt))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+
+	silence.Status = silence.StatusAt(time.Now())
+	return &silence, nil
+}
+
+func formatNullableUTC(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Expire ends a silence now
+func (s *SilenceStore) Expire(id string) error {
+	var affected int64
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := s.write(func(db *sql.DB) error {
+		res, err := db.Exec("UPDATE silences SET expired_at = ? WHERE id = ? AND expired_at IS NULL", now, id)
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSilenceNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// invalidate makes the next match reload silences from the database
+func (s *SilenceStore) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// current returns the cached silences that have not expired
+func (s *SilenceStore) current() []Silence {
+	s.mu.RLock()
+	cache, loadedAt := s.cache, s.loadedAt
+	s.mu.RUnlock()
+	if time.Since(loadedAt) < silenceReloadInterval {
+		return cache
+	}
+
+	all, err := s.List()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load silences: %v\n", err)
+		return cache
+	}
+	cache = cache[:0:0]
+	for _, silence := range all {
+		if silence.Status != SilenceExpired {
+			cache = append(cache, silence)
+		}
+	}
+
+	s.mu.Lock()
+	s.cache, s.loadedAt = cache, time.Now()
+	s.mu.Unlock()
+	return cache
+}
+
+// Match returns the IDs of the silences suppressing an alert at now
+func (s *SilenceStore) Match(alert *AlertState, server RemoteServer, dimensions []GroupDimension, now time.Time) []string {
+	var ids []string
+	for _, silence := range s.current() {
+		if silence.StatusAt(now) == SilenceActive && silence.Matchers.Matches(alert, server, dimensions) {
+			ids = append(ids, silence.ID)
+		}
+	}
+	return ids
+}
+
+// serverInMaintenance reports whether a server's offline alerts are
+// currently silenced
+func serverInMaintenance(server RemoteServer, dimensions []GroupDimension, now time.Time) bool {
+	if silenceStore == nil {
+		return false
+	}
+	probe := &AlertState{Type: "offline", ServerID: server.ID, Severity: "critical"}
+	return len(silenceStore.Match(probe, server, dimensions, now)) > 0
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMaintenanceWindow tests recurring window matching
+func TestMaintenanceWindow(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	sunday := &MaintenanceWindow{Weekdays: []int{0}, Start: "02:00", End: "04:00", Timezone: "Asia/Shanghai"}
+	overnight := &MaintenanceWindow{Weekdays: []int{6}, Start: "23:00", End: "01:00"}
+
+	tests := []struct {
+		window *MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{sunday, time.Date(2026, 10, 18, 2, 0, 0, 0, shanghai), true},
+		{sunday, time.Date(2026, 10, 18, 3, 59, 0, 0, shanghai), true},
+		{sunday, time.Date(2026, 10, 18, 4, 0, 0, 0, shanghai), false},
+		{sunday, time.Date(2026, 10, 17, 19, 30, 0, 0, time.UTC), true}, // Sunday 03:30 in Shanghai
+		{sunday, time.Date(2026, 10, 19, 3, 0, 0, 0, shanghai), false},  // Monday
+		{overnight, time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC), true},
+		{overnight, time.Date(2026, 10, 18, 0, 30, 0, 0, time.UTC), true}, // Started on Saturday
+		{overnight, time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC), false},
+		{overnight, time.Date(2026, 10, 17, 0, 30, 0, 0, time.UTC), false}, // Friday's window does not exist
+	}
+	for _, tt := range tests {
+		if got := tt.window.Contains(tt.at); got != tt.want {
+			t.Errorf("%+v.Contains(%v) = %v, want %v", *tt.window, tt.at, got, tt.want)
+		}
+	}
+
+	for _, bad := range []MaintenanceWindow{
+		{Start: "02:00", End: "02:00"},
+		{Start: "2am", End: "04:00"},
+		{Start: "02:00", End: "04:00", Weekdays: []int{7}},
+		{Start: "02:00", End: "04:00", Timezone: "Mars/Olympus"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", bad)
+		}
+	}
+}
+
+// TestSilences tests creating silences and suppressing notifications
+func TestSilences(t *testing.T) {
+	forEachBackend(t, testSilences)
+}
+
+func testSilences(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter, oldStore := dbWriter, silenceStore
+	dbWriter = NewDBWriter(helper.db, 10)
+	silenceStore = NewSilenceStore(helper.db)
+	defer func() {
+		dbWriter.Close()
+		dbWriter, silenceStore = oldWriter, oldStore
+	}()
+
+	alertConfig := GetDefaultAlertConfig()
+	alertConfig.Enabled = true
+	alertConfig.Rules.Offline.Enabled = true
+	alertConfig.Rules.Offline.GracePeriod = 0
+	alertConfig.Channels = []NotificationChannel{
+		{ID: "hook", Type: "webhook", Name: "Hook", Enabled: true, Config: map[string]string{"url": "http://127.0.0.1:1"}},
+	}
+	state := &AppState{
+		Config: &AppConfig{
+			AlertConfig: &alertConfig,
+			GroupDimensions: []GroupDimension{
+				{ID: "dim-region", Key: "region", Name: "Region", Options: []GroupOption{{ID: "opt-asia", Name: "Asia"}}},
+			},
+			Servers: []RemoteServer{
+				{ID: "s1", Name: "Tokyo", GroupValues: map[string]string{"dim-region": "opt-asia"}},
+				{ID: "s2", Name: "Paris"},
+			},
+		},
+		AgentMetrics: make(map[string]*AgentMetricsData),
+	}
+
+	router := gin.New()
+	router.GET("/api/alerts/silences", state.GetSilences)
+	router.POST("/api/alerts/silences", state.CreateSilence)
+	router.DELETE("/api/alerts/silences/:id", state.ExpireSilence)
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(data)))
+		return w
+	}
+
+	// A silence needs matchers and an end
+	if w := request("POST", "/api/alerts/silences", Silence{Comment: "everything"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without matchers, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := request("POST", "/api/alerts/silences", Silence{Matchers: AlertMatcher{Types: []string{"cpu"}}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without an end, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	end := time.Now().Add(time.Hour)
+	w := request("POST", "/api/alerts/silences", Silence{
+		Comment:  "Asia maintenance",
+		Matchers: AlertMatcher{Dimensions: map[string]string{"region": "asia"}},
+		EndsAt:   &end,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var silence Silence
+	json.Unmarshal(w.Body.Bytes(), &silence)
+	if silence.Status != SilenceActive {
+		t.Fatalf("Expected an active silence, got %+v", silence)
+	}
+
+	// A weekly window that is not open now
+	window := &MaintenanceWindow{Weekdays: []int{int(time.Now().UTC().Add(48 * time.Hour).Weekday())}, Start: "02:00", End: "04:00"}
+	if w := request("POST", "/api/alerts/silences", Silence{Matchers: AlertMatcher{Servers: []string{"s2"}}, Schedule: window}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if !serverInMaintenance(state.Config.Servers[0], state.Config.GroupDimensions, time.Now()) {
+		t.Error("Expected s1 to be in maintenance")
+	}
+	if serverInMaintenance(state.Config.Servers[1], state.Config.GroupDimensions, time.Now()) {
+		t.Error("Expected s2 not to be in maintenance")
+	}
+
+	// Both servers go offline; only s2 is notified
+	engine := NewAlertEngine(state, helper.db)
+	engine.startedAt = time.Now().Add(-time.Hour)
+	engine.checkAlerts()
+
+	if alerts := engine.GetActiveAlerts(); len(alerts) != 2 {
+		t.Fatalf("Expected both offline alerts to fire, got %+v", alerts)
+	}
+	silenced := engine.activeAlerts["offline:s1"]
+	if len(silenced.SilencedBy) != 1 || silenced.SilencedBy[0] != silence.ID || silenced.NotifiedAt != nil {
+		t.Errorf("Expected s1's alert to be silenced, got %+v", silenced)
+	}
+	notified := func() map[string]int {
+		events, _, _ := ListNotifications(helper.db, NotificationFilter{}, 100, 0)
+		counts := map[string]int{}
+		for _, event := range events {
+			counts[event.ServerID]++
+		}
+		return counts
+	}
+	if counts := notified(); counts["s1"] != 0 || counts["s2"] != 1 {
+		t.Errorf("Expected only s2 to be notified, got %v", counts)
+	}
+
+	// Expiring the silence releases the held-back notification
+	if w := request("DELETE", "/api/alerts/silences/"+silence.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := request("DELETE", "/api/alerts/silences/"+silence.ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an expired silence, got %d", http.StatusNotFound, w.Code)
+	}
+	engine.checkAlerts()
+	if counts := notified(); counts["s1"] != 1 {
+		t.Errorf("Expected s1 to be notified after the silence expired, got %v", counts)
+	}
+
+	w = request("GET", "/api/alerts/silences?status=scheduled", nil)
+	var scheduled []Silence
+	json.Unmarshal(w.Body.Bytes(), &scheduled)
+	if len(scheduled) != 1 || scheduled[0].Schedule == nil || scheduled[0].Schedule.Start != "02:00" {
+		t.Errorf("Expected the weekly window to be listed as scheduled, got %s", w.Body.String())
+	}
+}
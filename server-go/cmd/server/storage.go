@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// ============================================================================
+// Storage Backends
+// ============================================================================
+
+// Supported database drivers
+const (
+	DatabaseDriverSQLite   = "sqlite"
+	DatabaseDriverPostgres = "postgres"
+)
+
+// DatabaseConfig selects the storage backend. SQLite is used when unset.
+type DatabaseConfig struct {
+	Driver       string `json:"driver,omitempty"`         // "sqlite" (default) or "postgres"
+	DSN          string `json:"dsn,omitempty"`            // PostgreSQL connection string, or SQLite file path
+	MaxOpenConns int    `json:"max_open_conns,omitempty"` // PostgreSQL connection pool size (default 20)
+}
+
+// Dialect covers the SQL that differs between storage backends. Everything
+// else is written once against database/sql with ? placeholders.
+type Dialect interface {
+	// Name returns the driver name
+	Name() string
+	// DDL adapts a schema statement written for SQLite
+	DDL(stmt string) string
+	// Greatest returns an expression for the larger of two values
+	Greatest(a, b string) string
+	// UnixToTimestamp formats unix seconds as an RFC3339 UTC string
+	UnixToTimestamp(expr string) string
+	// TimestampToUnix converts an RFC3339 string to unix seconds
+	TimestampToUnix(expr string) string
+	// ILike returns the case-insensitive LIKE operator
+	ILike() string
+	// BulkWriters returns how many metrics batches may be written
+	// concurrently (0 = serialize everything through the DBWriter)
+	BulkWriters() int
+	// ColumnsQuery returns a query listing the column names of the table
+	// passed as its only argument (no rows when the table is missing)
+	ColumnsQuery() string
+	// MigrationLock returns a statement that serializes schema migrations
+	// across servers sharing the database until the transaction ends
+	MigrationLock() string
+}
+
+// sqlDialect is the dialect of the open database
+var sqlDialect Dialect = sqliteDialect{}
+
+// databaseLabel describes the open database for log output
+var databaseLabel string
+
+// sqliteDialect is the default, single-file backend
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return DatabaseDriverSQLite }
+
+func (sqliteDialect) DDL(stmt string) string { return stmt }
+
+func (sqliteDialect) Greatest(a, b string) string { return "MAX(" + a + ", " + b + ")" }
+
+func (sqliteDialect) UnixToTimestamp(expr string) string {
+	return "strftime('%Y-%m-%dT%H:%M:%SZ', " + expr + ", 'unixepoch')"
+}
+
+func (sqliteDialect) TimestampToUnix(expr string) string {
+	return "CAST(strftime('%s', " + expr + ") AS INTEGER)"
+}
+
+func (sqliteDialect) ILike() string { return "LIKE" }
+
+func (sqliteDialect) BulkWriters() int { return 0 }
+
+func (sqliteDialect) ColumnsQuery() string { return "SELECT name FROM pragma_table_info(?)" }
+
+// SQLite takes the write lock on the first statement of a transaction
+func (sqliteDialect) MigrationLock() string { return "" }
+
+// isPostgresDSN reports whether dsn is a PostgreSQL connection URL
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// loadDatabaseConfig reads the database section of the config file. The
+// database is opened before the rest of the config is loaded, so nothing
+// else is touched. VSTATS_DATABASE_URL overrides the file.
+func loadDatabaseConfig() DatabaseConfig {
+	var cfg DatabaseConfig
+	if data, err := os.ReadFile(GetConfigPath()); err == nil {
+		var partial struct {
+			Database *DatabaseConfig `json:"database"`
+		}
+		if json.Unmarshal(data, &partial) == nil && partial.Database != nil {
+			cfg = *partial.Database
+		}
+	}
+
+	if url := os.Getenv("VSTATS_DATABASE_URL"); url != "" {
+		cfg.DSN = url
+		cfg.Driver = ""
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = DatabaseDriverSQLite
+		if isPostgresDSN(cfg.DSN) {
+			cfg.Driver = DatabaseDriverPostgres
+		}
+	}
+	return cfg
+}
+
+// openDatabase connects to the configured backend and selects its dialect.
+// The schema is not touched; see InitDatabase.
+func openDatabase(cfg DatabaseConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case DatabaseDriverPostgres:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("database.dsn is required for the postgres driver")
+		}
+		db, err := openPostgres(cfg.DSN, cfg.MaxOpenConns)
+		if err != nil {
+			return nil, err
+		}
+		sqlDialect = postgresDialect{}
+		databaseLabel = "postgres " + redactPostgresDSN(cfg.DSN)
+		return db, nil
+
+	case DatabaseDriverSQLite, "sqlite3":
+		path := cfg.DSN
+		if path == "" {
+			path = GetDBPath()
+		}
+		// Open database with busy_timeout as fallback
+		db, err := sql.Open("sqlite", path+"?_busy_timeout=5000")
+		if err != nil {
+			return nil, err
+		}
+
+		// Enable WAL mode for better concurrent read access
+		if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+			fmt.Printf("Warning: Failed to enable WAL mode: %v\n", err)
+		}
+
+		// Set synchronous to NORMAL for better performance while still being safe
+		if _, err := db.Exec("PRAGMA synchronous=NORMAL"); err != nil {
+			fmt.Printf("Warning: Failed to set synchronous mode: %v\n", err)
+		}
+
+		sqlDialect = sqliteDialect{}
+		databaseLabel = path
+		return db, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+}
+
+// openConfiguredDatabase opens the database selected by the config file and
+// environment. Also used by CLI commands that run outside the server.
+func openConfiguredDatabase() (*sql.DB, error) {
+	return openDatabase(loadDatabaseConfig())
+}
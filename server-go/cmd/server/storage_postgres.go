@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// ============================================================================
+// PostgreSQL Backend
+// ============================================================================
+
+// postgresDialect stores the same schema as SQLite with 64-bit integers and
+// double precision floats
+type postgresDialect struct{}
+
+var (
+	pgAutoIncrement = regexp.MustCompile(`INTEGER PRIMARY KEY AUTOINCREMENT`)
+	pgInteger       = regexp.MustCompile(`\bINTEGER\b`)
+	pgReal          = regexp.MustCompile(`\bREAL\b`)
+	pgWithoutRowID  = regexp.MustCompile(`\)\s*WITHOUT ROWID`)
+	pgNoCase        = regexp.MustCompile(`\s+COLLATE NOCASE`)
+	pgAddColumn     = regexp.MustCompile(`ADD COLUMN\s+`)
+)
+
+func (postgresDialect) Name() string { return DatabaseDriverPostgres }
+
+func (postgresDialect) DDL(stmt string) string {
+	stmt = pgAutoIncrement.ReplaceAllString(stmt, "BIGSERIAL PRIMARY KEY")
+	stmt = pgInteger.ReplaceAllString(stmt, "BIGINT")
+	stmt = pgReal.ReplaceAllString(stmt, "DOUBLE PRECISION")
+	stmt = pgWithoutRowID.ReplaceAllString(stmt, ")")
+	stmt = pgNoCase.ReplaceAllString(stmt, "")
+	stmt = pgAddColumn.ReplaceAllString(stmt, "ADD COLUMN IF NOT EXISTS ")
+	return stmt
+}
+
+func (postgresDialect) Greatest(a, b string) string { return "GREATEST(" + a + ", " + b + ")" }
+
+func (postgresDialect) UnixToTimestamp(expr string) string {
+	return `to_char(to_timestamp(` + expr + `) AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+}
+
+func (postgresDialect) TimestampToUnix(expr string) string {
+	return "CAST(EXTRACT(EPOCH FROM CAST(" + expr + " AS TIMESTAMPTZ)) AS BIGINT)"
+}
+
+func (postgresDialect) ILike() string { return "ILIKE" }
+
+func (postgresDialect) BulkWriters() int { return 4 }
+
+func (postgresDialect) ColumnsQuery() string {
+	return "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+// pgMigrationLockID is an arbitrary advisory lock key owned by vstats
+const pgMigrationLockID = 7362_7730
+
+func (postgresDialect) MigrationLock() string {
+	return "SELECT pg_advisory_xact_lock(" + strconv.Itoa(pgMigrationLockID) + ")"
+}
+
+// openPostgres connects to PostgreSQL through pgx and verifies the connection
+func openPostgres(dsn string, maxOpenConns int) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid postgres dsn: %w", err)
+	}
+
+	db := newPostgresDB(config)
+	if maxOpenConns <= 0 {
+		maxOpenConns = 20
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxOpenConns)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// newPostgresDB wraps the pgx database/sql driver so that queries can keep
+// using SQLite-style ? placeholders
+func newPostgresDB(config *pgx.ConnConfig) *sql.DB {
+	return sql.OpenDB(&pgConnector{base: stdlib.GetConnector(*config)})
+}
+
+// redactPostgresDSN returns user@host:port/database for log output
+func redactPostgresDSN(dsn string) string {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return "(invalid dsn)"
+	}
+	return fmt.Sprintf("%s@%s:%d/%s", config.User, config.Host, config.Port, config.Database)
+}
+
+type pgConnector struct {
+	base driver.Connector
+}
+
+func (c *pgConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{Conn: conn.(*stdlib.Conn)}, nil
+}
+
+func (c *pgConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// pgConn rebinds placeholders and stores booleans as integers like SQLite
+// does, so the shared schema keeps INTEGER flag columns
+type pgConn struct {
+	*stdlib.Conn
+}
+
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebindQuery(query))
+}
+
+func (c *pgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, rebindQuery(query))
+}
+
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, rebindQuery(query), args)
+}
+
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.QueryContext(ctx, rebindQuery(query), args)
+}
+
+func (c *pgConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if b, ok := nv.Value.(bool); ok {
+		nv.Value = int64(boolToInt(b))
+	}
+	return nil
+}
+
+// rebindQuery rewrites ? placeholders to $1, $2 ... leaving string
+// literals, quoted identifiers and comments untouched
+func rebindQuery(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(query[i+1:], ch)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// TestRebindQuery tests ? to $n placeholder rewriting
+func TestRebindQuery(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{`SELECT "a?" FROM t WHERE a = ?`, `SELECT "a?" FROM t WHERE a = $1`},
+		{"SELECT a -- why?\nFROM t WHERE a = ?", "SELECT a -- why?\nFROM t WHERE a = $1"},
+		{"SELECT 'it''s' WHERE a = ?", "SELECT 'it''s' WHERE a = $1"},
+	}
+	for _, tt := range tests {
+		if got := rebindQuery(tt.in); got != tt.want {
+			t.Errorf("rebindQuery(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestPostgresDDL tests translation of the SQLite schema
+func TestPostgresDDL(t *testing.T) {
+	got := postgresDialect{}.DDL(`
+		CREATE TABLE IF NOT EXISTS t (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT COLLATE NOCASE,
+			value REAL,
+			count INTEGER NOT NULL
+		) WITHOUT ROWID`)
+	for _, want := range []string{"id BIGSERIAL PRIMARY KEY", "name TEXT,", "value DOUBLE PRECISION", "count BIGINT NOT NULL"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("DDL missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "ROWID") || strings.Contains(got, "NOCASE") {
+		t.Errorf("DDL kept SQLite-only syntax:\n%s", got)
+	}
+
+	alter := postgresDialect{}.DDL("ALTER TABLE t ADD COLUMN extra INTEGER")
+	if alter != "ALTER TABLE t ADD COLUMN IF NOT EXISTS extra BIGINT" {
+		t.Errorf("Unexpected ALTER translation: %s", alter)
+	}
+}
+
+// TestLoadDatabaseConfig tests driver selection from the environment
+func TestLoadDatabaseConfig(t *testing.T) {
+	t.Setenv("VSTATS_CONFIG_PATH", t.TempDir()+"/missing.json")
+
+	t.Setenv("VSTATS_DATABASE_URL", "")
+	if cfg := loadDatabaseConfig(); cfg.Driver != DatabaseDriverSQLite {
+		t.Errorf("Expected sqlite by default, got %q", cfg.Driver)
+	}
+
+	t.Setenv("VSTATS_DATABASE_URL", "postgres://vstats@db:5432/vstats")
+	cfg := loadDatabaseConfig()
+	if cfg.Driver != DatabaseDriverPostgres || cfg.DSN != "postgres://vstats@db:5432/vstats" {
+		t.Errorf("Expected postgres from VSTATS_DATABASE_URL, got %+v", cfg)
+	}
+	if label := redactPostgresDSN("postgres://vstats:secret@db:5432/vstats"); strings.Contains(label, "secret") {
+		t.Errorf("Password leaked into label: %s", label)
+	}
+}
+
+// TestStorageBackends runs the schema and the queries with dialect-specific
+// SQL against every available backend
+func TestStorageBackends(t *testing.T) {
+	forEachBackend(t, testStorageBackend)
+}
+
+func testStorageBackend(t *testing.T, helper *TestHelper) {
+	db := helper.db
+	helper.Migrate(t)
+
+	now := time.Now().UTC().Truncate(5 * time.Second)
+	latency := 20.0
+	sample := func(ts time.Time, cpu float32) *SystemMetrics {
+		return &SystemMetrics{
+			Timestamp: ts,
+			CPU:       CpuMetrics{Usage: cpu},
+			Memory:    MemoryMetrics{UsagePercent: 50},
+			Disks:     []DiskMetrics{{UsagePercent: 30}},
+			Network:   NetworkMetrics{TotalRx: 1000, TotalTx: 2000},
+			Ping: &PingMetrics{Targets: []PingTarget{
+				{Name: "gw", Host: "10.0.0.1", LatencyMs: &latency, Status: "ok"},
+			}},
+		}
+	}
+
+	t.Run("StoreMetrics", func(t *testing.T) {
+		if err := storeMetricsInternal(db, "srv-1", sample(now, 10)); err != nil {
+			t.Fatalf("storeMetricsInternal failed: %v", err)
+		}
+		if err := storeMetricsInternal(db, "srv-1", sample(now.Add(time.Second), 30)); err != nil {
+			t.Fatalf("storeMetricsInternal failed: %v", err)
+		}
+
+		var count int
+		var cpuMax float64
+		err := db.QueryRow("SELECT sample_count, cpu_max FROM metrics_5sec WHERE server_id = ? AND bucket = ?",
+			"srv-1", now.Unix()/5).Scan(&count, &cpuMax)
+		if err != nil {
+			t.Fatalf("Failed to read metrics_5sec: %v", err)
+		}
+		if count != 2 || cpuMax != 30 {
+			t.Errorf("Expected 2 samples with max 30, got %d / %v", count, cpuMax)
+		}
+
+		items := []MetricsBufferItem{
+			{ServerID: "srv-2", Metrics: sample(now, 40)},
+			{ServerID: "srv-1", Metrics: sample(now.Add(2*time.Second), 20)},
+		}
+		if err := batchStoreMetrics(db, items); err != nil {
+			t.Fatalf("batchStoreMetrics failed: %v", err)
+		}
+	})
+
+	t.Run("FlushAggregates", func(t *testing.T) {
+		bucket := now.Unix() / 900
+		metrics := map[AggBufferKey]*common.BucketData{
+			{ServerID: "srv-1", Granularity: "15min", Bucket: bucket}: {
+				Bucket: bucket, CPUSum: 60, CPUMax: 30, MemorySum: 100, MemoryMax: 50, SampleCount: 2,
+			},
+		}
+		ping := map[PingBufferKey]*common.PingBucketData{
+			{ServerID: "srv-1", Granularity: "15min", Bucket: bucket, TargetName: "gw"}: {
+				Bucket: bucket, TargetName: "gw", TargetHost: "10.0.0.1", LatencySum: 40, LatencyMax: 25, LatencyCount: 2, OkCount: 2,
+			},
+		}
+		if err := flushAggBufferToDB(db, metrics, ping); err != nil {
+			t.Fatalf("flushAggBufferToDB failed: %v", err)
+		}
+		// Agents resend whole buckets, so a second flush replaces the row
+		if err := flushAggBufferToDB(db, metrics, ping); err != nil {
+			t.Fatalf("flushAggBufferToDB (second run) failed: %v", err)
+		}
+
+		var count int
+		db.QueryRow("SELECT sample_count FROM metrics_15min_agg WHERE server_id = ? AND bucket = ?",
+			"srv-1", bucket).Scan(&count)
+		if count != 2 {
+			t.Errorf("Expected sample_count 2, got %d", count)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		for _, rangeStr := range []string{"1h", "24h", "7d", "30d", "1y"} {
+			points, err := GetHistorySince(db, "srv-1", rangeStr, 0)
+			if err != nil {
+				t.Fatalf("GetHistorySince(%s) failed: %v", rangeStr, err)
+			}
+			for _, p := range points {
+				if _, err := time.Parse(time.RFC3339, p.Timestamp); err != nil {
+					t.Errorf("GetHistorySince(%s) returned bad timestamp %q", rangeStr, p.Timestamp)
+				}
+			}
+			if rangeStr != "30d" && rangeStr != "1y" && len(points) == 0 {
+				t.Errorf("GetHistorySince(%s) returned no points", rangeStr)
+			}
+		}
+
+		targets, err := GetPingHistorySince(db, "srv-1", "1h", 0)
+		if err != nil {
+			t.Fatalf("GetPingHistorySince failed: %v", err)
+		}
+		if len(targets) != 1 || targets[0].Name != "gw" {
+			t.Errorf("Expected one ping target, got %+v", targets)
+		}
+	})
+
+	t.Run("CaseInsensitiveLookups", func(t *testing.T) {
+		ts := now.Format(time.RFC3339)
+		user := &User{ID: "u1", Username: "Alice", PasswordHash: "x", Role: RoleViewer, CreatedAt: ts, UpdatedAt: ts}
+		if err := insertUser(db, user); err != nil {
+			t.Fatalf("insertUser failed: %v", err)
+		}
+		dup := &User{ID: "u2", Username: "alice", PasswordHash: "x", Role: RoleViewer, CreatedAt: ts, UpdatedAt: ts}
+		if err := insertUser(db, dup); err == nil {
+			t.Error("Expected usernames differing only in case to conflict")
+		}
+		if u, err := getUserByUsername(db, "ALICE"); err != nil || u.ID != "u1" {
+			t.Errorf("Expected case-insensitive lookup, got %v / %v", u, err)
+		}
+
+		_, err := db.Exec(`INSERT INTO audit_logs (timestamp, action, category, user_ip, target_name, status)
+			VALUES (?, 'login', 'auth', '127.0.0.1', 'Production DB', 'success')`, ts)
+		if err != nil {
+			t.Fatalf("Failed to insert audit log: %v", err)
+		}
+		var matches int
+		db.QueryRow("SELECT COUNT(*) FROM audit_logs WHERE target_name "+sqlDialect.ILike()+" ?", "%production%").Scan(&matches)
+		if matches != 1 {
+			t.Errorf("Expected case-insensitive search to match, got %d", matches)
+		}
+	})
+
+	t.Run("Traffic", func(t *testing.T) {
+		oldWriter := dbWriter
+		dbWriter = NewDBWriter(db, 10)
+		defer func() { dbWriter = oldWriter }()
+
+		m := NewTrafficManager(nil, db)
+		today := now.Format("2006-01-02")
+		m.updateDailyTraffic("srv-1", 100, 200, today)
+		m.updateDailyTraffic("srv-1", 50, 25, today)
+		dbWriter.Close()
+
+		var tx, rx int64
+		err := db.QueryRow("SELECT tx_bytes, rx_bytes FROM traffic_daily WHERE server_id = ? AND date = ?",
+			"srv-1", today).Scan(&tx, &rx)
+		if err != nil {
+			t.Fatalf("Failed to read traffic_daily: %v", err)
+		}
+		if tx != 150 || rx != 225 {
+			t.Errorf("Expected 150/225 bytes, got %d/%d", tx, rx)
+		}
+	})
+}
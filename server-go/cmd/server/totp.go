@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ============================================================================
+// TOTP (RFC 6238)
+// ============================================================================
+
+const (
+	totpIssuer          = "vStats"
+	totpDigits          = 6
+	totpPeriod          = 30
+	totpSkew            = 1 // Accept codes from one period before/after
+	totpRecoveryCodes   = 10
+	twoFactorChallenge  = 5 * time.Minute
+	twoFactorMaxAttempt = 5
+)
+
+var (
+	ErrTOTPNotEnrolled   = errors.New("two-factor authentication is not enrolled")
+	ErrTOTPInvalidCode   = errors.New("invalid two-factor code")
+	ErrNoPasswordAccount = errors.New("two-factor authentication is only available for password accounts")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a new random base32 secret (160 bits)
+func generateTOTPSecret() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return totpEncoding.EncodeToString(buf)
+}
+
+// totpCode computes the code for a time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// validateTOTP checks code against the secret and returns the matched time
+// step. Steps at or before lastStep are rejected to prevent replay.
+func validateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI builds the otpauth:// URI used to enroll authenticator apps
+func totpURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// generateRecoveryCodes returns new single-use recovery codes
+func generateRecoveryCodes() []string {
+	codes := make([]string, totpRecoveryCodes)
+	for i := range codes {
+		raw := strings.ToLower(GenerateRandomString(10))
+		codes[i] = raw[:5] + "-" + raw[5:]
+	}
+	return codes
+}
+
+// normalizeRecoveryCode makes recovery code comparison case and dash insensitive
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// ============================================================================
+// Two-Factor Storage
+// ============================================================================
+
+// TwoFactor holds the TOTP enrollment of a user. The built-in admin is keyed
+// by an empty user ID and its username, as with sessions.
+type TwoFactor struct {
+	UserID        string
+	Username      string
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string // SHA-256 hashes of unused recovery codes
+	LastStep      int64
+	CreatedAt     string
+	EnabledAt     string
+}
+
+// twoFactorKey identifies the account a TOTP enrollment belongs to. It is
+// empty for identities without a password account, such as unbound SSO users.
+func twoFactorKey(userID, username string) string {
+	if userID != "" {
+		return userID
+	}
+	if !strings.EqualFold(username, BuiltinAdminUsername) {
+		return ""
+	}
+	return "builtin:" + strings.ToLower(username)
+}
+
+// getTwoFactor returns the TOTP enrollment of an account
+func getTwoFactor(db *sql.DB, userID, username string) (*TwoFactor, error) {
+	key := twoFactorKey(userID, username)
+	if key == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	var tf TwoFactor
+	var enabled int
+	var codes string
+	err := db.QueryRow(`
+		SELECT user_id, username, secret, enabled, recovery_codes, last_step, created_at, COALESCE(enabled_at, '')
+		FROM user_totp WHERE account_key = ?`, key,
+	).Scan(&tf.UserID, &tf.Username, &tf.Secret, &enabled, &codes, &tf.LastStep, &tf.CreatedAt, &tf.EnabledAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTOTPNotEnrolled
+		}
+		return nil, err
+	}
+	tf.Enabled = enabled == 1
+	tf.RecoveryCodes = []string{}
+	if codes != "" {
+		tf.RecoveryCodes = strings.Split(codes, ",")
+	}
+	return &tf, nil
+}
+
+// saveTwoFactor inserts or replaces a TOTP enrollment
+func saveTwoFactor(db *sql.DB, tf *TwoFactor) error {
+	key := twoFactorKey(tf.UserID, tf.Username)
+	if key == "" {
+		return ErrNoPasswordAccount
+	}
+	var enabledAt interface{}
+	if tf.EnabledAt != "" {
+		enabledAt = tf.EnabledAt
+	}
+	_, err := db.Exec(`
+		INSERT INTO user_totp (account_key, user_id, username, secret, enabled, recovery_codes, last_step, created_at, enabled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(account_key) DO UPDATE SET
+			user_id = excluded.user_id,
+			username = excluded.username,
+			secret = excluded.secret,
+			enabled = excluded.enabled,
+			recovery_codes = excluded.recovery_codes,
+			last_step = excluded.last_step,
+			created_at = excluded.created_at,
+			enabled_at = excluded.enabled_at`,
+		key, tf.UserID, tf.Username, tf.Secret, boolToInt(tf.Enabled),
+		strings.Join(tf.RecoveryCodes, ","), tf.LastStep, tf.CreatedAt, enabledAt,
+	)
+	return err
+}
+
+// deleteTwoFactor removes a TOTP enrollment
+func deleteTwoFactor(db *sql.DB, userID, username string) (int64, error) {
+	key := twoFactorKey(userID, username)
+	if key == "" {
+		return 0, nil
+	}
+	result, err := db.Exec("DELETE FROM user_totp WHERE account_key = ?", key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// twoFactorEnabled reports whether an identity must pass a TOTP check
+func twoFactorEnabled(identity AuthIdentity) bool {
+	if dbWriter == nil {
+		return false
+	}
+	tf, err := getTwoFactor(dbWriter.GetDB(), identity.UserID, identity.Username)
+	return err == nil && tf.Enabled
+}
+
+// verifySecondFactor checks a TOTP or recovery code for an identity and
+// records its use. Returns whether a recovery code was consumed.
+func verifySecondFactor(identity AuthIdentity, code string) (bool, error) {
+	var usedRecovery bool
+	err := dbWriter.WriteSync(func(db *sql.DB) error {
+		tf, err := getTwoFactor(db, identity.UserID, identity.Username)
+		if err != nil {
+			return err
+		}
+		if !tf.Enabled {
+			return ErrTOTPNotEnrolled
+		}
+
+		if step, ok := validateTOTP(tf.Secret, code, time.Now(), tf.LastStep); ok {
+			tf.LastStep = step
+			return saveTwoFactor(db, tf)
+		}
+
+		hashed := hashAPIToken(normalizeRecoveryCode(code))
+		for i, h := range tf.RecoveryCodes {
+			if hmac.Equal([]byte(h), []byte(hashed)) {
+				tf.RecoveryCodes = append(tf.RecoveryCodes[:i], tf.RecoveryCodes[i+1:]...)
+				usedRecovery = true
+				return saveTwoFactor(db, tf)
+			}
+		}
+		return ErrTOTPInvalidCode
+	})
+	return usedRecovery, err
+}
+
+// DisableTwoFactorOffline removes the TOTP enrollment of an account directly
+// in the database file. Used by --disable-2fa, which runs outside the server.
+func DisableTwoFactorOffline(username string) (int64, error) {
+	db, err := openConfiguredDatabase()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if _, err := runMigrations(db); err != nil {
+		return 0, err
+	}
+	var n int64
+	if strings.EqualFold(username, BuiltinAdminUsername) {
+		n, err = deleteTwoFactor(db, "", BuiltinAdminUsername)
+	} else {
+		var result sql.Result
+		result, err = db.Exec("DELETE FROM user_totp WHERE user_id != '' AND LOWER(username) = LOWER(?)", username)
+		if err == nil {
+			n, err = result.RowsAffected()
+		}
+	}
+	if err != nil || n == 0 {
+		return n, err
+	}
+
+	// The server is not involved, so record the audit entry directly
+	db.Exec(`
+		INSERT INTO audit_logs (timestamp, action, category, username, user_ip, user_agent, target_type, target_id, target_name, details, status, error_message)
+		VALUES (?, ?, ?, ?, '', 'cli', 'user', ?, ?, ?, 'success', '')`,
+		time.Now().UTC().Format(time.RFC3339), string(AuditAction2FADisable), string(AuditCategoryAuth),
+		"cli", username, username, "Two-factor authentication disabled with --disable-2fa",
+	)
+	return n, nil
+}
+
+// ============================================================================
+// Login Challenges
+// ============================================================================
+
+type challengeState struct {
+	attempts  int
+	expiresAt time.Time
+}
+
+var (
+	challengeAttempts   = make(map[string]*challengeState)
+	challengeAttemptsMu sync.Mutex
+)
+
+// issueTwoFactorChallenge returns a short-lived token proving that the
+// password step of a login succeeded
+func issueTwoFactorChallenge(identity AuthIdentity) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     identity.Username,
+		"role":    string(identity.Role),
+		"purpose": "2fa",
+		"jti":     GenerateRandomString(16),
+		"exp":     time.Now().Add(twoFactorChallenge).Unix(),
+	}
+	if identity.UserID != "" {
+		claims["uid"] = identity.UserID
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(GetJWTSecret()))
+}
+
+// parseTwoFactorChallenge validates a challenge and counts an attempt against
+// it. Each challenge allows a limited number of code attempts.
+func parseTwoFactorChallenge(challenge string) (AuthIdentity, string, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(challenge, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(GetJWTSecret()), nil
+	})
+	if err != nil || !token.Valid {
+		return AuthIdentity{}, "", errors.New("invalid or expired challenge")
+	}
+	if purpose, _ := claims["purpose"].(string); purpose != "2fa" {
+		return AuthIdentity{}, "", errors.New("invalid challenge")
+	}
+
+	id, _ := claims["jti"].(string)
+	now := time.Now()
+	challengeAttemptsMu.Lock()
+	for cid, st := range challengeAttempts {
+		if now.After(st.expiresAt) {
+			delete(challengeAttempts, cid)
+		}
+	}
+	st := challengeAttempts[id]
+	if st == nil {
+		st = &challengeState{expiresAt: now.Add(twoFactorChallenge)}
+		challengeAttempts[id] = st
+	}
+	st.attempts++
+	attempts := st.attempts
+	challengeAttemptsMu.Unlock()
+	if attempts > twoFactorMaxAttempt {
+		return AuthIdentity{}, id, errors.New("too many attempts")
+	}
+
+	sub, _ := claims["sub"].(string)
+	role, _ := claims["role"].(string)
+	uid, _ := claims["uid"].(string)
+	return AuthIdentity{UserID: uid, Username: sub, Role: UserRole(role)}, id, nil
+}
+
+// finishTwoFactorChallenge marks a challenge as used so it cannot be replayed
+func finishTwoFactorChallenge(id string) {
+	challengeAttemptsMu.Lock()
+	if st := challengeAttempts[id]; st != nil {
+		st.attempts = twoFactorMaxAttempt
+	}
+	challengeAttemptsMu.Unlock()
+}
@@ -24,10 +24,27 @@ type TrafficManager struct {
 	prevCounters map[string]*networkCounter
 	countersMu   sync.Mutex
 	
+	// Whether this node was the cluster leader on the previous tick
+	wasLeader bool
+	
 	stopCh   chan struct{}
 	wg       sync.WaitGroup
 }
 
+// trafficLimitCall forwards UpdateLimit to the cluster leader
+type trafficLimitCall struct {
+	ServerID       string  `json:"server_id"`
+	MonthlyLimitGB float64 `json:"monthly_limit_gb"`
+	ThresholdType  string  `json:"threshold_type"`
+	ResetDay       int     `json:"reset_day"`
+}
+
+// trafficResetCall forwards ResetTraffic to the cluster leader
+type trafficResetCall struct {
+	ServerID string `json:"server_id"`
+	ToZero   bool   `json:"to_zero"`
+}
+
 type networkCounter struct {
 	rx        uint64
 	tx        uint64
@@ -44,15 +61,13 @@ func NewTrafficManager(state *AppState, db *sql.DB) *TrafficManager {
 		db:           db,
 		stats:        make(map[string]*TrafficStats),
 		prevCounters: make(map[string]*networkCounter),
+		wasLeader:    cluster == nil,
 		stopCh:       make(chan struct{}),
 	}
 }
 
 // Start begins the traffic monitoring
 func (m *TrafficManager) Start() {
-	// Initialize database tables
-	m.initTables()
-	
 	// Load existing stats from database
 	m.loadStats()
 	
@@ -69,63 +84,12 @@ func (m *TrafficManager) Stop() {
 	m.wg.Wait()
 	
 	// Save final stats
-	m.saveAllStats()
+	if isLeader() {
+		m.saveAllStats()
+	}
 	fmt.Println("📊 Traffic manager stopped")
 }
 
-// initTables creates the traffic-related database tables
-func (m *TrafficManager) initTables() {
-	// Current period traffic stats
-	m.db.Exec(`
-		CREATE TABLE IF NOT EXISTS traffic_stats (
-			server_id TEXT PRIMARY KEY,
-			period_start TEXT NOT NULL,
-			period_end TEXT NOT NULL,
-			reset_day INTEGER NOT NULL DEFAULT 1,
-			tx_bytes INTEGER NOT NULL DEFAULT 0,
-			rx_bytes INTEGER NOT NULL DEFAULT 0,
-			monthly_limit_gb REAL NOT NULL DEFAULT 0,
-			threshold_type TEXT NOT NULL DEFAULT 'sum',
-			baseline_tx INTEGER NOT NULL DEFAULT 0,
-			baseline_rx INTEGER NOT NULL DEFAULT 0,
-			baseline_time TEXT,
-			last_updated TEXT NOT NULL,
-			created_at TEXT DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	
-	// Historical traffic records (archived periods)
-	m.db.Exec(`
-		CREATE TABLE IF NOT EXISTS traffic_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			period_start TEXT NOT NULL,
-			period_end TEXT NOT NULL,
-			tx_bytes INTEGER NOT NULL,
-			rx_bytes INTEGER NOT NULL,
-			monthly_limit_gb REAL NOT NULL DEFAULT 0,
-			usage_percent REAL NOT NULL DEFAULT 0,
-			created_at TEXT DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(server_id, period_start)
-		)
-	`)
-	m.db.Exec("CREATE INDEX IF NOT EXISTS idx_traffic_history_server ON traffic_history(server_id, period_start)")
-	
-	// Daily traffic for detailed charts
-	m.db.Exec(`
-		CREATE TABLE IF NOT EXISTS traffic_daily (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			date TEXT NOT NULL,
-			tx_bytes INTEGER NOT NULL DEFAULT 0,
-			rx_bytes INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			UNIQUE(server_id, date)
-		)
-	`)
-	m.db.Exec("CREATE INDEX IF NOT EXISTS idx_traffic_daily_server ON traffic_daily(server_id, date)")
-}
-
 // loadStats loads current traffic stats from database
 func (m *TrafficManager) loadStats() {
 	rows, err := m.db.Query(`
@@ -164,8 +128,8 @@ func (m *TrafficManager) loadStats() {
 			stats.BaselineTime, _ = time.Parse(time.RFC3339, *baselineTime)
 		}
 		
-		// Check if period needs reset
-		if now.After(stats.PeriodEnd) {
+		// Check if period needs reset (followers leave this to the leader)
+		if now.After(stats.PeriodEnd) && isLeader() {
 			m.archiveAndReset(&stats, now)
 		}
 		
@@ -201,15 +165,39 @@ func (m *TrafficManager) monitorLoop() {
 		case <-m.stopCh:
 			return
 		case <-ticker.C:
-			m.collectTraffic()
+			if m.syncLeadership() {
+				m.collectTraffic()
+			}
 		case <-saveTicker.C:
-			m.saveAllStats()
+			if isLeader() {
+				m.saveAllStats()
+			}
 		case <-resetTicker.C:
-			m.checkPeriodResets()
+			if isLeader() {
+				m.checkPeriodResets()
+			}
 		}
 	}
 }
 
+// syncLeadership refreshes followers' stats from the database, which only
+// the leader writes, and reloads them on a node that has just become leader.
+// Returns whether this node should collect traffic.
+func (m *TrafficManager) syncLeadership() bool {
+	leader := isLeader()
+	if cluster != nil && (!leader || !m.wasLeader) {
+		m.loadStats()
+		if leader {
+			// Counters seen before taking over may be stale
+			m.countersMu.Lock()
+			m.prevCounters = make(map[string]*networkCounter)
+			m.countersMu.Unlock()
+		}
+	}
+	m.wasLeader = leader
+	return leader
+}
+
 // collectTraffic collects current traffic from all servers
 func (m *TrafficManager) collectTraffic() {
 	m.state.ConfigMu.RLock()
@@ -313,9 +301,9 @@ func (m *TrafficManager) updateDailyTraffic(serverID string, deltaTx, deltaRx ui
 			INSERT INTO traffic_daily (server_id, date, tx_bytes, rx_bytes, sample_count)
 			VALUES (?, ?, ?, ?, 1)
 			ON CONFLICT(server_id, date) DO UPDATE SET
-				tx_bytes = tx_bytes + excluded.tx_bytes,
-				rx_bytes = rx_bytes + excluded.rx_bytes,
-				sample_count = sample_count + 1
+				tx_bytes = traffic_daily.tx_bytes + excluded.tx_bytes,
+				rx_bytes = traffic_daily.rx_bytes + excluded.rx_bytes,
+				sample_count = traffic_daily.sample_count + 1
 		`, serverID, date, deltaTx, deltaRx)
 		return err
 	})
@@ -343,9 +331,15 @@ func (m *TrafficManager) archiveAndReset(stats *TrafficStats, now time.Time) {
 			usagePercent := stats.CalculatePercent()
 			dbWriter.WriteAsync(func(db *sql.DB) error {
 				_, err := db.Exec(`
-					INSERT OR REPLACE INTO traffic_history 
+					INSERT INTO traffic_history 
 					(server_id, period_start, period_end, tx_bytes, rx_bytes, monthly_limit_gb, usage_percent)
 					VALUES (?, ?, ?, ?, ?, ?, ?)
+					ON CONFLICT(server_id, period_start) DO UPDATE SET
+						period_end = excluded.period_end,
+						tx_bytes = excluded.tx_bytes,
+						rx_bytes = excluded.rx_bytes,
+						monthly_limit_gb = excluded.monthly_limit_gb,
+						usage_percent = excluded.usage_percent
 				`,
 					stats.ServerID,
 					stats.PeriodStart.Format(time.RFC3339),
@@ -480,6 +474,21 @@ func (m *TrafficManager) UpdateLimit(serverID string, monthlyLimitGB float64, th
 		thresholdType = "sum"
 	}
 	
+	// The leader owns the in-memory stats; followers pick up the change
+	// from the database once it has been saved
+	if !isLeader() {
+		err := cluster.CallLeader("traffic.update_limit", trafficLimitCall{
+			ServerID:       serverID,
+			MonthlyLimitGB: monthlyLimitGB,
+			ThresholdType:  thresholdType,
+			ResetDay:       resetDay,
+		}, nil)
+		if err == nil {
+			m.loadStats()
+		}
+		return err
+	}
+	
 	now := time.Now()
 	
 	m.statsMu.Lock()
@@ -522,6 +531,14 @@ func (m *TrafficManager) UpdateLimit(serverID string, monthlyLimitGB float64, th
 
 // ResetTraffic resets traffic for a server
 func (m *TrafficManager) ResetTraffic(serverID string, toZero bool) error {
+	if !isLeader() {
+		err := cluster.CallLeader("traffic.reset", trafficResetCall{ServerID: serverID, ToZero: toZero}, nil)
+		if err == nil {
+			m.loadStats()
+		}
+		return err
+	}
+	
 	now := time.Now()
 	
 	m.statsMu.Lock()
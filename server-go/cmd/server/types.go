@@ -21,6 +21,7 @@ type NetworkInterface = common.NetworkInterface
 type LoadAverage = common.LoadAverage
 type PingMetrics = common.PingMetrics
 type PingTarget = common.PingTarget
+type AgentUpdateStatus = common.AgentUpdateStatus
 
 // ============================================================================
 // Auth Types
@@ -32,12 +33,27 @@ type Claims struct {
 }
 
 type LoginRequest struct {
+	Username string `json:"username,omitempty"` // Empty means the built-in admin account
 	Password string `json:"password"`
 }
 
+// TwoFactorLoginRequest completes a login that requires a TOTP or recovery code
+type TwoFactorLoginRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
 type LoginResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
+	Token            string     `json:"token"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RefreshToken     string     `json:"refresh_token,omitempty"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+	Username         string     `json:"username,omitempty"`
+	Role             UserRole   `json:"role,omitempty"`
+
+	// Set instead of a token when the password was correct but a second factor is required
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
 }
 
 type ChangePasswordRequest struct {
@@ -302,6 +318,7 @@ type ServerMetricsUpdate struct {
 	GeoIP         *ServerGeoIP      `json:"geoip,omitempty"`
 	SaleStatus    string            `json:"sale_status,omitempty"`    // Sale status: "", "rent", "sell"
 	SaleContactURL string           `json:"sale_contact_url,omitempty"` // Contact URL for rent/sell
+	Maintenance   bool              `json:"maintenance,omitempty"`      // Offline alerts are silenced
 }
 
 type DeltaMessage struct {
@@ -313,6 +330,7 @@ type DeltaMessage struct {
 type CompactServerUpdate struct {
 	ID string          `json:"id"`
 	On *bool           `json:"on,omitempty"`
+	Mt *bool           `json:"mt,omitempty"` // Maintenance
 	M  *CompactMetrics `json:"m,omitempty"`
 }
 
@@ -387,17 +405,26 @@ type AgentMessage struct {
 	// Multi-granularity aggregated metrics (new)
 	Granularities []common.GranularityData `json:"granularities,omitempty"` // For multi-granularity data
 	LastMetrics   *SystemMetrics           `json:"last_metrics,omitempty"`  // Latest metrics snapshot
+	// Self-update progress
+	Update *AgentUpdateStatus `json:"update,omitempty"`
+	// Remote config acknowledgement
+	ConfigVersion string `json:"config_version,omitempty"`
+	Error         string `json:"error,omitempty"`
 }
 
 type AgentCommand struct {
 	Type        string `json:"type"`
 	Command     string `json:"command"`
 	DownloadURL string `json:"download_url,omitempty"`
+	ManifestURL string `json:"manifest_url,omitempty"`
+	Version     string `json:"version,omitempty"`
 	Force       bool   `json:"force,omitempty"`
 }
 
 type UpdateAgentRequest struct {
-	DownloadURL string `json:"download_url,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"` // Mirror of the binary, still checked against the manifest
+	ManifestURL string `json:"manifest_url,omitempty"` // Signed release manifest, defaults to the GitHub release
+	Version     string `json:"version,omitempty"`      // Release to install, defaults to the latest
 	Force       bool   `json:"force,omitempty"`
 }
 
@@ -432,6 +459,18 @@ const (
 	AuditActionPasswordChange     AuditLogAction = "password_change"
 	AuditActionOAuthLogin         AuditLogAction = "oauth_login"
 	AuditActionOAuthLoginFailed   AuditLogAction = "oauth_login_failed"
+	AuditActionUserCreate         AuditLogAction = "user_create"
+	AuditActionUserUpdate         AuditLogAction = "user_update"
+	AuditActionUserDelete         AuditLogAction = "user_delete"
+	AuditActionAPITokenCreate     AuditLogAction = "api_token_create"
+	AuditActionAPITokenRevoke     AuditLogAction = "api_token_revoke"
+	AuditActionAPITokenUse        AuditLogAction = "api_token_use"
+	AuditActionSessionRevoke      AuditLogAction = "session_revoke"
+	AuditAction2FAEnroll          AuditLogAction = "2fa_enroll"
+	AuditAction2FAVerify          AuditLogAction = "2fa_verify"
+	AuditAction2FAFail            AuditLogAction = "2fa_fail"
+	AuditAction2FADisable         AuditLogAction = "2fa_disable"
+	AuditActionAuthLockout        AuditLogAction = "auth_lockout"
 
 	// Server actions
 	AuditActionServerCreate       AuditLogAction = "server_create"
@@ -441,12 +480,20 @@ const (
 	AuditActionAgentRegister      AuditLogAction = "agent_register"
 	AuditActionAgentConnect       AuditLogAction = "agent_connect"
 	AuditActionAgentDisconnect    AuditLogAction = "agent_disconnect"
+	AuditActionAgentUpdate        AuditLogAction = "agent_update"
+	AuditActionRolloutCreate      AuditLogAction = "rollout_create"
+	AuditActionRolloutPause       AuditLogAction = "rollout_pause"
+	AuditActionRolloutResume      AuditLogAction = "rollout_resume"
+	AuditActionRolloutAbort       AuditLogAction = "rollout_abort"
+	AuditActionRolloutComplete    AuditLogAction = "rollout_complete"
+	AuditActionAgentProfilesUpdate AuditLogAction = "agent_profiles_update"
 
 	// Settings actions
 	AuditActionSettingsUpdate     AuditLogAction = "settings_update"
 	AuditActionSiteSettingsUpdate AuditLogAction = "site_settings_update"
 	AuditActionProbeSettingsUpdate AuditLogAction = "probe_settings_update"
 	AuditActionOAuthSettingsUpdate AuditLogAction = "oauth_settings_update"
+	AuditActionConfigRestore      AuditLogAction = "config_restore"
 
 	// Alert actions
 	AuditActionAlertConfigUpdate  AuditLogAction = "alert_config_update"
@@ -455,6 +502,11 @@ const (
 	AuditActionChannelDelete      AuditLogAction = "channel_delete"
 	AuditActionChannelTest        AuditLogAction = "channel_test"
 	AuditActionAlertMute          AuditLogAction = "alert_mute"
+	AuditActionAlertAck           AuditLogAction = "alert_ack"
+	AuditActionAlertUnack         AuditLogAction = "alert_unack"
+	AuditActionNotificationResend AuditLogAction = "notification_resend"
+	AuditActionSilenceCreate      AuditLogAction = "silence_create"
+	AuditActionSilenceExpire      AuditLogAction = "silence_expire"
 	AuditActionRuleUpdate         AuditLogAction = "rule_update"
 	AuditActionTemplateUpdate     AuditLogAction = "template_update"
 
@@ -476,6 +528,7 @@ type AuditLog struct {
 	Timestamp    string           `json:"timestamp"`
 	Action       AuditLogAction   `json:"action"`
 	Category     AuditLogCategory `json:"category"`
+	Username     string           `json:"username,omitempty"`
 	UserIP       string           `json:"user_ip"`
 	UserAgent    string           `json:"user_agent,omitempty"`
 	TargetType   string           `json:"target_type,omitempty"`
@@ -490,6 +543,7 @@ type AuditLog struct {
 type AuditLogEntry struct {
 	Action       AuditLogAction
 	Category     AuditLogCategory
+	Username     string
 	UserIP       string
 	UserAgent    string
 	TargetType   string
@@ -506,6 +560,7 @@ type AuditLogQuery struct {
 	Limit      int              `form:"limit"`
 	Category   AuditLogCategory `form:"category"`
 	Action     AuditLogAction   `form:"action"`
+	Username   string           `form:"username"`
 	StartDate  string           `form:"start_date"`
 	EndDate    string           `form:"end_date"`
 	Search     string           `form:"search"`
@@ -555,8 +610,9 @@ type DashboardSnapshot struct {
 
 type LastSentState struct {
 	Servers map[string]*struct {
-		Online  bool
-		Metrics *CompactMetrics
+		Online      bool
+		Maintenance bool
+		Metrics     *CompactMetrics
 	}
 }
 
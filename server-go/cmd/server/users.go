@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// User Types
+// ============================================================================
+
+// UserRole represents the permission level of a user
+type UserRole string
+
+const (
+	RoleAdmin    UserRole = "admin"    // Full access, including settings and user management
+	RoleOperator UserRole = "operator" // Manage servers, alerts and traffic, but not settings
+	RoleViewer   UserRole = "viewer"   // Read-only access
+)
+
+// BuiltinAdminUsername is the account backed by AppConfig.AdminPasswordHash
+const BuiltinAdminUsername = "admin"
+
+// ssoUsernamePrefix marks the usernames of SSO identities that are not bound
+// to a dashboard user, so that they never equal a password account
+const ssoUsernamePrefix = "sso:"
+
+// Context keys set by AuthMiddleware
+const (
+	ContextKeyUserID   = "user_id"
+	ContextKeyUsername = "username"
+	ContextKeyRole     = "role"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// User represents a dashboard account stored in the database
+type User struct {
+	ID           string   `json:"id"`
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"-"`
+	Role         UserRole `json:"role"`
+	Disabled     bool     `json:"disabled"`
+	CreatedAt    string   `json:"created_at"`
+	UpdatedAt    string   `json:"updated_at"`
+	LastLoginAt  string   `json:"last_login_at,omitempty"`
+}
+
+// AuthIdentity is the authenticated principal carried in JWT claims.
+// UserID is empty for the built-in admin and for SSO identities
+// that are not linked to a database user.
+type AuthIdentity struct {
+	UserID   string
+	Username string
+	Role     UserRole
+}
+
+// builtinAdminIdentity returns the identity of the config-backed admin account
+func builtinAdminIdentity() AuthIdentity {
+	return AuthIdentity{Username: BuiltinAdminUsername, Role: RoleAdmin}
+}
+
+// ssoUsername returns the username of an unbound SSO identity
+func ssoUsername(provider, identifier string) string {
+	return ssoUsernamePrefix + provider + ":" + identifier
+}
+
+// isSSOUsername reports whether username belongs to an unbound SSO identity
+func isSSOUsername(username string) bool {
+	return strings.HasPrefix(username, ssoUsernamePrefix)
+}
+
+// roleRank orders roles so that higher ranks include lower permissions
+func roleRank(role UserRole) int {
+	switch role {
+	case RoleAdmin:
+		return 3
+	case RoleOperator:
+		return 2
+	case RoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsValidRole reports whether role is one of the known roles
+func IsValidRole(role UserRole) bool {
+	return roleRank(role) > 0
+}
+
+// RoleAtLeast reports whether role grants at least the permissions of min
+func RoleAtLeast(role, min UserRole) bool {
+	return roleRank(role) >= roleRank(min)
+}
+
+// higherRole returns the more privileged of two roles
+func higherRole(a, b UserRole) UserRole {
+	if roleRank(b) > roleRank(a) {
+		return b
+	}
+	return a
+}
+
+// CurrentUsername returns the acting user from the request context
+func CurrentUsername(c *gin.Context) string {
+	return c.GetString(ContextKeyUsername)
+}
+
+// CurrentRole returns the role of the acting user from the request context
+func CurrentRole(c *gin.Context) UserRole {
+	return UserRole(c.GetString(ContextKeyRole))
+}
+
+// CurrentIdentity returns the acting user from the request context
+func CurrentIdentity(c *gin.Context) AuthIdentity {
+	return AuthIdentity{UserID: c.GetString(ContextKeyUserID), Username: CurrentUsername(c), Role: CurrentRole(c)}
+}
+
+// ============================================================================
+// User Storage
+// ============================================================================
+
+const userColumns = "id, username, password_hash, role, disabled, created_at, updated_at, COALESCE(last_login_at, '')"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var u User
+	var role string
+	var disabled int
+	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &role, &disabled, &u.CreatedAt, &u.UpdatedAt, &u.LastLoginAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	u.Role = UserRole(role)
+	u.Disabled = disabled != 0
+	return &u, nil
+}
+
+// getUserByUsername looks up a user by username (case-insensitive)
+func getUserByUsername(db *sql.DB, username string) (*User, error) {
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE LOWER(username) = LOWER(?)", username))
+}
+
+// getUserByID looks up a user by ID
+func getUserByID(db *sql.DB, id string) (*User, error) {
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+// listUsers returns all users ordered by username
+func listUsers(db *sql.DB) ([]User, error) {
+	rows, err := db.Query("SELECT " + userColumns + " FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			continue
+		}
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+// insertUser inserts a new user
+func insertUser(db *sql.DB, u *User) error {
+	_, err := db.Exec(`
+		INSERT INTO users (id, username, password_hash, role, disabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Username, u.PasswordHash, string(u.Role), boolToInt(u.Disabled), u.CreatedAt, u.UpdatedAt,
+	)
+	return err
+}
+
+// updateUser saves role, status and password hash of an existing user
+func updateUser(db *sql.DB, u *User) error {
+	result, err := db.Exec(`
+		UPDATE users SET password_hash = ?, role = ?, disabled = ?, updated_at = ?
+		WHERE id = ?`,
+		u.PasswordHash, string(u.Role), boolToInt(u.Disabled), u.UpdatedAt, u.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// deleteUser removes a user by ID
+func deleteUser(db *sql.DB, id string) error {
+	result, err := db.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// touchUserLogin records the last login time (fire-and-forget)
+func touchUserLogin(id string) {
+	if dbWriter == nil || id == "" {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE users SET last_login_at = ? WHERE id = ?", now, id)
+		return err
+	})
+}
+
+// lookupUser finds a database user by username, returning nil if the
+// database is unavailable or the user does not exist
+func lookupUser(username string) *User {
+	if dbWriter == nil || username == "" {
+		return nil
+	}
+	u, err := getUserByUsername(dbWriter.GetDB(), username)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ============================================================================
+// SSO Identity Mapping
+// ============================================================================
+
+// resolveSSOIdentity maps an authenticated SSO identity to a dashboard user and role.
+// Resolution order: explicit SSO binding, OIDC group role mapping, then
+// OAuthConfig.DefaultRole (admin if unset). Database users are only reached
+// through a binding, so an identifier that happens to equal a local username
+// does not log in as that user. Unbound identities get an "sso:" username
+// that cannot be mistaken for the built-in admin or a database user.
+// Returns an error if the mapped user is disabled or missing.
+func (s *AppState) resolveSSOIdentity(provider, identifier string, groups []string, oidc *OIDCProvider) (AuthIdentity, error) {
+	s.ConfigMu.RLock()
+	var bindings []SSOBinding
+	defaultRole := RoleAdmin
+	if s.Config.OAuth != nil {
+		bindings = s.Config.OAuth.Bindings
+		if IsValidRole(UserRole(s.Config.OAuth.DefaultRole)) {
+			defaultRole = UserRole(s.Config.OAuth.DefaultRole)
+		}
+	}
+	s.ConfigMu.RUnlock()
+
+	// 1. Explicit binding
+	for _, b := range bindings {
+		if (b.Provider != provider && b.ProviderID != provider) || !strings.EqualFold(b.Identifier, identifier) {
+			continue
+		}
+		username := b.Username
+		if username == "" || strings.EqualFold(username, BuiltinAdminUsername) {
+			return builtinAdminIdentity(), nil
+		}
+		u := lookupUser(username)
+		if u == nil {
+			return AuthIdentity{}, errors.New("bound user not found: " + username)
+		}
+		if u.Disabled {
+			return AuthIdentity{}, errors.New("user is disabled: " + u.Username)
+		}
+		return AuthIdentity{UserID: u.ID, Username: u.Username, Role: u.Role}, nil
+	}
+
+	// 2. OIDC group mapping
+	if oidc != nil && len(oidc.GroupRoles) > 0 {
+		var role UserRole
+		for _, group := range groups {
+			for g, r := range oidc.GroupRoles {
+				if strings.EqualFold(g, group) && IsValidRole(UserRole(r)) {
+					role = higherRole(role, UserRole(r))
+				}
+			}
+		}
+		if role != "" {
+			return AuthIdentity{Username: ssoUsername(provider, identifier), Role: role}, nil
+		}
+	}
+
+	return AuthIdentity{Username: ssoUsername(provider, identifier), Role: defaultRole}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestResolveSSOIdentity tests mapping SSO identities to dashboard users
+func TestResolveSSOIdentity(t *testing.T) {
+	forEachBackend(t, testResolveSSOIdentity)
+}
+
+func testResolveSSOIdentity(t *testing.T, helper *TestHelper) {
+	helper.Migrate(t)
+
+	oldWriter := dbWriter
+	dbWriter = NewDBWriter(helper.db, 10)
+	defer func() {
+		dbWriter.Close()
+		dbWriter = oldWriter
+	}()
+
+	ts := time.Now().UTC().Format(time.RFC3339)
+	for _, u := range []*User{
+		{ID: "u1", Username: "alice", PasswordHash: "x", Role: RoleOperator, CreatedAt: ts, UpdatedAt: ts},
+		{ID: "u2", Username: "bob", PasswordHash: "x", Role: RoleAdmin, Disabled: true, CreatedAt: ts, UpdatedAt: ts},
+	} {
+		if err := insertUser(helper.db, u); err != nil {
+			t.Fatalf("insertUser failed: %v", err)
+		}
+	}
+
+	state := createTestAppState(t, "testpassword123")
+	state.Config.OAuth = &OAuthConfig{
+		DefaultRole: string(RoleViewer),
+		Bindings: []SSOBinding{
+			{Provider: "github", Identifier: "alice-gh", Username: "alice"},
+			{Provider: "github", Identifier: "bob-gh", Username: "bob"},
+			{Provider: "github", Identifier: "owner"},
+		},
+	}
+	oidc := &OIDCProvider{GroupRoles: map[string]string{"ops": string(RoleOperator)}}
+
+	tests := []struct {
+		name       string
+		provider   string
+		identifier string
+		groups     []string
+		userID     string
+		username   string
+		role       UserRole
+		wantErr    bool
+	}{
+		{"bound user", "github", "ALICE-GH", nil, "u1", "alice", RoleOperator, false},
+		{"bound admin", "github", "owner", nil, "", BuiltinAdminUsername, RoleAdmin, false},
+		{"binding of another provider", "google", "alice-gh", nil, "", "sso:google:alice-gh", RoleViewer, false},
+		{"same name without binding", "google", "alice", nil, "", "sso:google:alice", RoleViewer, false},
+		{"same name as the admin", "github", "admin", nil, "", "sso:github:admin", RoleViewer, false},
+		{"same name with groups", "oidc", "alice", []string{"ops"}, "", "sso:oidc:alice", RoleOperator, false},
+		{"disabled user", "github", "bob-gh", nil, "", "", "", true},
+	}
+	for _, tt := range tests {
+		identity, err := state.resolveSSOIdentity(tt.provider, tt.identifier, tt.groups, oidc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error=%v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if identity.UserID != tt.userID || identity.Username != tt.username || identity.Role != tt.role {
+			t.Errorf("%s: expected user %q (%s) with role %s, got %+v", tt.name, tt.userID, tt.username, tt.role, identity)
+		}
+		if tt.username != BuiltinAdminUsername && tt.userID == "" && (hasPasswordAccount(identity) || twoFactorKey(identity.UserID, identity.Username) != "") {
+			t.Errorf("%s: expected no password account for %+v", tt.name, identity)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -152,12 +153,14 @@ func (s *AppState) sendInitialStateFresh(client *DashboardClient) {
 	index := 0
 
 	// Remote servers
+	now := time.Now()
 	for _, server := range config.Servers {
 		metricsData := agentMetrics[server.ID]
 		online := false
 		if metricsData != nil {
 			online = time.Since(metricsData.LastUpdated).Seconds() < 30
 		}
+		maintenance := serverInMaintenance(server, config.GroupDimensions, now)
 
 		version := server.Version
 		if metricsData != nil && metricsData.Metrics.Version != "" {
@@ -199,6 +202,7 @@ func (s *AppState) sendInitialStateFresh(client *DashboardClient) {
 				GeoIP:         server.GeoIP,
 				SaleStatus:    server.SaleStatus,
 				SaleContactURL: server.SaleContactURL,
+				Maintenance:   maintenance,
 			},
 		}
 		serverData, _ := json.Marshal(serverMsg)
@@ -231,11 +235,14 @@ func (s *AppState) RefreshSnapshot() {
 }
 
 // serverStateHash computes a simple hash for change detection
-func serverStateHash(online bool, metrics *SystemMetrics) uint64 {
+func serverStateHash(online, maintenance bool, metrics *SystemMetrics) uint64 {
 	h := uint64(0)
 	if online {
 		h = 1
 	}
+	if maintenance {
+		h |= 2
+	}
 	if metrics != nil {
 		// Use key metrics fields for hash
 		h ^= uint64(metrics.CPU.Usage*1000) << 8
@@ -278,6 +285,7 @@ func (s *AppState) RefreshSnapshotWithData(config *AppConfig, agentMetrics map[s
 	snapshot.InitMessage, _ = json.Marshal(initMsg)
 
 	// Build remote server messages (incremental)
+	now := time.Now()
 	for i, server := range config.Servers {
 		index := i
 		metricsData := agentMetrics[server.ID]
@@ -285,6 +293,7 @@ func (s *AppState) RefreshSnapshotWithData(config *AppConfig, agentMetrics map[s
 		if metricsData != nil {
 			online = time.Since(metricsData.LastUpdated).Seconds() < 30
 		}
+		maintenance := serverInMaintenance(server, config.GroupDimensions, now)
 
 		var metrics *SystemMetrics
 		if metricsData != nil {
@@ -294,7 +303,7 @@ func (s *AppState) RefreshSnapshotWithData(config *AppConfig, agentMetrics map[s
 			metrics = GetLastMetrics(server.ID)
 		}
 
-		currentHash := serverStateHash(online, metrics)
+		currentHash := serverStateHash(online, maintenance, metrics)
 
 		// Check if we can reuse old serialized data
 		if canIncremental && oldSnapshot.ServerHashes[server.ID] == currentHash {
@@ -336,6 +345,7 @@ func (s *AppState) RefreshSnapshotWithData(config *AppConfig, agentMetrics map[s
 				GeoIP:         server.GeoIP,
 				SaleStatus:    server.SaleStatus,
 				SaleContactURL: server.SaleContactURL,
+				Maintenance:   maintenance,
 			},
 		}
 		snapshot.ServerMessages[index], _ = json.Marshal(serverMsg)
@@ -425,6 +435,10 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 
 		switch agentMsg.Type {
 		case "auth":
+			if s.authLockedOut(AuthScopeAgent, clientIP) {
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"auth","status":"error","message":"Too many failed attempts"}`))
+				continue
+			}
 			if agentMsg.ServerID != "" && agentMsg.Token != "" {
 				s.ConfigMu.Lock()
 				var server *RemoteServer
@@ -447,15 +461,19 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 								SendChan: sendChan,
 							}
 							s.AgentConnsMu.Unlock()
+							if cluster != nil {
+								cluster.ClaimAgent(agentMsg.ServerID)
+							}
 
 							// Send auth success with probe config and last data time
 							response := map[string]interface{}{
 								"type":   "auth",
 								"status": "ok",
 							}
-							if len(s.Config.ProbeSettings.PingTargets) > 0 {
-								response["ping_targets"] = s.Config.ProbeSettings.PingTargets
+							if targets := pingTargetsFor(s.Config, *server); len(targets) > 0 {
+								response["ping_targets"] = targets
 							}
+							response["agent_config"] = agentConfigFor(s.Config, *server)
 							
 							// Get traffic config for this server
 							if trafficManager != nil {
@@ -492,6 +510,11 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 				}
 				s.ConfigMu.Unlock()
 			}
+			if authenticatedServerID == "" {
+				s.recordAuthFailure(AuthScopeAgent, clientIP, agentMsg.ServerID, c.GetHeader("User-Agent"), s.loginProtection())
+			} else {
+				authLimiter.Success(AuthScopeAgent, clientIP)
+			}
 
 		case "metrics":
 			if authenticatedServerID != "" && agentMsg.Metrics != nil {
@@ -552,13 +575,7 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 				s.ConfigMu.Unlock()
 
 				// Update in-memory state
-				s.AgentMetricsMu.Lock()
-				s.AgentMetrics[authenticatedServerID] = &AgentMetricsData{
-					ServerID:    authenticatedServerID,
-					Metrics:     *agentMsg.Metrics,
-					LastUpdated: time.Now(),
-				}
-				s.AgentMetricsMu.Unlock()
+				s.setAgentMetrics(authenticatedServerID, agentMsg.Metrics)
 			} else {
 				conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"Not authenticated"}`))
 			}
@@ -597,13 +614,17 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 
 			// Update in-memory state with last metrics if provided
 			if agentMsg.LastMetrics != nil {
-				s.AgentMetricsMu.Lock()
-				s.AgentMetrics[authenticatedServerID] = &AgentMetricsData{
-					ServerID:    authenticatedServerID,
-					Metrics:     *agentMsg.LastMetrics,
-					LastUpdated: time.Now(),
-				}
-				s.AgentMetricsMu.Unlock()
+				s.setAgentMetrics(authenticatedServerID, agentMsg.LastMetrics)
+			}
+
+		case "update_status":
+			if authenticatedServerID != "" && agentMsg.Update != nil {
+				s.recordAgentUpdate(authenticatedServerID, agentMsg.Update)
+			}
+
+		case "config_ack":
+			if authenticatedServerID != "" {
+				s.recordConfigAck(authenticatedServerID, agentMsg.ConfigVersion, agentMsg.Error)
 			}
 		}
 	}
@@ -615,6 +636,68 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 		s.AgentConnsMu.Lock()
 		delete(s.AgentConns, authenticatedServerID)
 		s.AgentConnsMu.Unlock()
+		if cluster != nil {
+			cluster.ReleaseAgent(authenticatedServerID)
+		}
+	}
+}
+
+// setAgentMetrics records the latest metrics of an agent connected to this
+// node and shares them with the rest of the cluster
+func (s *AppState) setAgentMetrics(serverID string, metrics *SystemMetrics) {
+	data := &AgentMetricsData{
+		ServerID:    serverID,
+		Metrics:     *metrics,
+		LastUpdated: time.Now(),
+	}
+	s.AgentMetricsMu.Lock()
+	s.AgentMetrics[serverID] = data
+	s.AgentMetricsMu.Unlock()
+
+	if cluster != nil {
+		cluster.PublishMetrics(data)
+	}
+}
+
+var (
+	ErrAgentNotConnected = errors.New("agent is not connected")
+	ErrAgentBusy         = errors.New("agent send queue is full")
+)
+
+// SendToAgent queues a message for an agent. In cluster mode the message is
+// routed to the node holding the agent's connection.
+func (s *AppState) SendToAgent(serverID string, data []byte) error {
+	err := s.sendToLocalAgent(serverID, data)
+	if err != ErrAgentNotConnected || cluster == nil {
+		return err
+	}
+
+	owner := cluster.AgentOwner(serverID)
+	if owner == "" || owner == cluster.NodeID() {
+		return ErrAgentNotConnected
+	}
+	return cluster.Call(owner, "agent.send", agentSendRequest{ServerID: serverID, Data: data}, nil)
+}
+
+// agentSendRequest asks the owning node to forward a message to its agent
+type agentSendRequest struct {
+	ServerID string `json:"server_id"`
+	Data     []byte `json:"data"`
+}
+
+func (s *AppState) sendToLocalAgent(serverID string, data []byte) error {
+	s.AgentConnsMu.RLock()
+	conn := s.AgentConns[serverID]
+	s.AgentConnsMu.RUnlock()
+
+	if conn == nil {
+		return ErrAgentNotConnected
+	}
+	select {
+	case conn.SendChan <- data:
+		return nil
+	default:
+		return ErrAgentBusy
 	}
 }
 
@@ -667,23 +750,11 @@ func (s *AppState) handleBatchMetrics(serverID string, msg *AgentMessage) (accep
 	if len(msg.BatchItems) > 0 {
 		lastItem := msg.BatchItems[len(msg.BatchItems)-1]
 		if lastItem.Metrics != nil {
-			s.AgentMetricsMu.Lock()
-			s.AgentMetrics[serverID] = &AgentMetricsData{
-				ServerID:    serverID,
-				Metrics:     *lastItem.Metrics,
-				LastUpdated: time.Now(),
-			}
-			s.AgentMetricsMu.Unlock()
+			s.setAgentMetrics(serverID, lastItem.Metrics)
 		}
 	} else if len(msg.Aggregated) > 0 && msg.Aggregated[len(msg.Aggregated)-1].LastMetrics != nil {
 		lastAgg := msg.Aggregated[len(msg.Aggregated)-1]
-		s.AgentMetricsMu.Lock()
-		s.AgentMetrics[serverID] = &AgentMetricsData{
-			ServerID:    serverID,
-			Metrics:     *lastAgg.LastMetrics,
-			LastUpdated: time.Now(),
-		}
-		s.AgentMetricsMu.Unlock()
+		s.setAgentMetrics(serverID, lastAgg.LastMetrics)
 	}
 
 	return accepted, rejected
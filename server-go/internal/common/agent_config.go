@@ -0,0 +1,80 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ============================================================================
+// Remote Agent Configuration
+// ============================================================================
+
+// AgentSettings are the agent settings that can be managed from the server.
+// Zero values keep the agent's own setting.
+type AgentSettings struct {
+	IntervalSecs      uint64            `json:"interval_secs,omitempty"`       // Metrics interval
+	MaxOfflineRecords int               `json:"max_offline_records,omitempty"` // Offline storage limit
+	AggregationSecs   int               `json:"aggregation_secs,omitempty"`    // Age at which offline metrics are aggregated
+	BatchSize         int               `json:"batch_size,omitempty"`          // Metrics per batch when syncing offline data
+	Collectors        CollectorSettings `json:"collectors"`
+}
+
+// CollectorSettings switches optional collectors on or off; nil keeps the
+// agent's own setting, which defaults to on
+type CollectorSettings struct {
+	GPU           *bool `json:"gpu,omitempty"`
+	MemoryModules *bool `json:"memory_modules,omitempty"` // dmidecode / WMI, may be slow
+	DiskIO        *bool `json:"disk_io,omitempty"`        // Disk read/write speeds
+}
+
+// Merge overrides the settings with the ones set in o
+func (s *AgentSettings) Merge(o AgentSettings) {
+	if o.IntervalSecs != 0 {
+		s.IntervalSecs = o.IntervalSecs
+	}
+	if o.MaxOfflineRecords != 0 {
+		s.MaxOfflineRecords = o.MaxOfflineRecords
+	}
+	if o.AggregationSecs != 0 {
+		s.AggregationSecs = o.AggregationSecs
+	}
+	if o.BatchSize != 0 {
+		s.BatchSize = o.BatchSize
+	}
+	if o.Collectors.GPU != nil {
+		s.Collectors.GPU = o.Collectors.GPU
+	}
+	if o.Collectors.MemoryModules != nil {
+		s.Collectors.MemoryModules = o.Collectors.MemoryModules
+	}
+	if o.Collectors.DiskIO != nil {
+		s.Collectors.DiskIO = o.Collectors.DiskIO
+	}
+}
+
+// Version identifies the settings; it changes whenever they do
+func (s AgentSettings) Version() string {
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Enabled reports whether a collector setting is on
+func Enabled(setting *bool) bool {
+	return setting == nil || *setting
+}
+
+// RemoteAgentConfig is the agent configuration sent by the server at
+// authentication and whenever it changes
+type RemoteAgentConfig struct {
+	Version string `json:"version"`
+	AgentSettings
+}
+
+// ConfigAckMessage reports which remote config version the agent applied
+type ConfigAckMessage struct {
+	Type          string `json:"type"` // "config_ack"
+	ConfigVersion string `json:"config_version"`
+	Error         string `json:"error,omitempty"` // Settings that could not be applied
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// Agent Release Manifests
+// ============================================================================
+//
+// A release manifest lists the agent binaries of a release with their
+// SHA-256 sums. It is signed with the release ed25519 key and the base64
+// signature is published next to it as <manifest>.sig. Agents only install
+// binaries listed in a manifest signed by one of the keys built into them.
+
+// AgentManifestName is the file name of the manifest in a release
+const AgentManifestName = "vstats-agent-manifest.json"
+
+// ReleaseManifest lists the agent binaries of a release
+type ReleaseManifest struct {
+	Version string                 `json:"version"`
+	Files   map[string]ReleaseFile `json:"files"` // Keyed by "<os>-<arch>"
+}
+
+// ReleaseFile is an agent binary of a release
+type ReleaseFile struct {
+	Name   string `json:"name"`          // File name, relative to the manifest
+	URL    string `json:"url,omitempty"` // Absolute download URL, when not next to the manifest
+	SHA256 string `json:"sha256"`        // Hex SHA-256 of the binary
+	Size   int64  `json:"size"`
+}
+
+// PlatformKey returns the key of a platform in ReleaseManifest.Files
+func PlatformKey(goos, goarch string) string {
+	return goos + "-" + goarch
+}
+
+// SignManifest returns the base64 signature of a manifest
+func SignManifest(data []byte, key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+}
+
+// VerifyManifest checks the signature of a manifest against the trusted keys
+// and parses it
+func VerifyManifest(data []byte, signature string, keys []ed25519.PublicKey) (*ReleaseManifest, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no trusted release keys")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, errors.New("malformed manifest signature")
+	}
+	verified := false
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("manifest signature does not match any trusted release key")
+	}
+
+	var manifest ReleaseManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version == "" || len(manifest.Files) == 0 {
+		return nil, errors.New("manifest has no version or files")
+	}
+	return &manifest, nil
+}
+
+// ParsePublicKeys parses comma separated base64 ed25519 public keys
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(item)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid release key %q", item)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
+// ============================================================================
+// Agent Update Status
+// ============================================================================
+
+// Agent update statuses
+const (
+	UpdateDownloading = "downloading" // Fetching and verifying the release
+	UpdateRestarting  = "restarting"  // Installed, restarting into the new version
+	UpdateSucceeded   = "succeeded"   // The new version authenticated within the deadline
+	UpdateSkipped     = "skipped"     // Already on the release version
+	UpdateFailed      = "failed"      // Not installed; the agent keeps running
+	UpdateRolledBack  = "rolled_back" // The new version was replaced by the backup
+)
+
+// AgentUpdateStatus is an agent's report on a self-update
+type AgentUpdateStatus struct {
+	Status      string `json:"status"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Time        string `json:"time"` // RFC3339
+}
+
+// UpdateStatusMessage reports the progress of a self-update to the server
+type UpdateStatusMessage struct {
+	Type   string            `json:"type"` // "update_status"
+	Update AgentUpdateStatus `json:"update"`
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return public, private
+}
+
+// TestVerifyManifest tests checking manifest signatures against trusted keys
+func TestVerifyManifest(t *testing.T) {
+	public, private := newTestKey(t)
+	otherPublic, otherPrivate := newTestKey(t)
+
+	manifest := ReleaseManifest{Version: "1.2.3", Files: map[string]ReleaseFile{
+		PlatformKey("linux", "amd64"): {Name: "vstats-agent-linux-amd64", SHA256: "ab", Size: 1},
+	}}
+	data, _ := json.Marshal(manifest)
+	empty, _ := json.Marshal(ReleaseManifest{Version: "1.2.3"})
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-2] = ' '
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signature string
+		keys      []ed25519.PublicKey
+		valid     bool
+	}{
+		{"valid", data, SignManifest(data, private), []ed25519.PublicKey{public}, true},
+		{"any trusted key", data, SignManifest(data, private), []ed25519.PublicKey{otherPublic, public}, true},
+		{"signature with newline", data, SignManifest(data, private) + "\n", []ed25519.PublicKey{public}, true},
+		{"no keys", data, SignManifest(data, private), nil, false},
+		{"wrong key", data, SignManifest(data, otherPrivate), []ed25519.PublicKey{public}, false},
+		{"bad signature", tampered, SignManifest(data, private), []ed25519.PublicKey{public}, false},
+		{"malformed signature", data, "not base64!", []ed25519.PublicKey{public}, false},
+		{"short signature", data, base64.StdEncoding.EncodeToString([]byte("short")), []ed25519.PublicKey{public}, false},
+		{"signed garbage", []byte("garbage"), SignManifest([]byte("garbage"), private), []ed25519.PublicKey{public}, false},
+		{"no files", empty, SignManifest(empty, private), []ed25519.PublicKey{public}, false},
+	}
+	for _, tt := range tests {
+		got, err := VerifyManifest(tt.data, tt.signature, tt.keys)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+			continue
+		}
+		if tt.valid && (got.Version != "1.2.3" || got.Files["linux-amd64"].Name != "vstats-agent-linux-amd64") {
+			t.Errorf("%s: unexpected manifest %+v", tt.name, got)
+		}
+	}
+}
+
+// TestParsePublicKeys tests parsing the built-in release keys
+func TestParsePublicKeys(t *testing.T) {
+	a, _ := newTestKey(t)
+	b, _ := newTestKey(t)
+	encodedA := base64.StdEncoding.EncodeToString(a)
+	encodedB := base64.StdEncoding.EncodeToString(b)
+
+	tests := []struct {
+		name  string
+		input string
+		count int
+		valid bool
+	}{
+		{"empty", "", 0, true},
+		{"one", encodedA, 1, true},
+		{"several with spaces", " " + encodedA + " , " + encodedB + ",", 2, true},
+		{"not base64", "not a key", 0, false},
+		{"wrong length", base64.StdEncoding.EncodeToString([]byte("short")), 0, false},
+		{"one bad key", encodedA + ",x", 0, false},
+	}
+	for _, tt := range tests {
+		keys, err := ParsePublicKeys(tt.input)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+			continue
+		}
+		if len(keys) != tt.count {
+			t.Errorf("%s: expected %d keys, got %d", tt.name, tt.count, len(keys))
+		}
+	}
+
+	keys, _ := ParsePublicKeys(encodedA + "," + encodedB)
+	if !keys[0].Equal(a) || !keys[1].Equal(b) {
+		t.Error("Expected the keys in order")
+	}
+}
@@ -135,11 +135,25 @@ type PingMetrics struct {
 type PingTarget struct {
 	Name       string   `json:"name"`
 	Host       string   `json:"host"`
-	Type       string   `json:"type,omitempty"` // "icmp" or "tcp"
+	Type       string   `json:"type,omitempty"` // "icmp", "tcp", "http", "dns" or "tls"
 	Port       int      `json:"port,omitempty"` // Port for TCP connections
 	LatencyMs  *float64 `json:"latency_ms"`
 	PacketLoss float64  `json:"packet_loss"`
 	Status     string   `json:"status"`
+	// HTTP, DNS and TLS probe details
+	Error          string        `json:"error,omitempty"`            // Why the probe failed
+	StatusCode     int           `json:"status_code,omitempty"`      // HTTP response status
+	Timings        *ProbeTimings `json:"timings,omitempty"`          // HTTP latency breakdown
+	Answers        []string      `json:"answers,omitempty"`          // DNS answers
+	CertExpiryDays *float64      `json:"cert_expiry_days,omitempty"` // Days until the TLS certificate expires
+}
+
+// ProbeTimings is the latency breakdown of an HTTP probe in milliseconds
+type ProbeTimings struct {
+	DNSMs     float64 `json:"dns_ms"`
+	ConnectMs float64 `json:"connect_ms"`
+	TLSMs     float64 `json:"tls_ms,omitempty"`
+	TTFBMs    float64 `json:"ttfb_ms"` // From sending the request to the first response byte
 }
 
 // PingTargetAgg represents aggregated ping data for a time bucket (computed by Agent)
@@ -157,8 +171,24 @@ type PingTargetAgg struct {
 type PingTargetConfig struct {
 	Name string `json:"name"`
 	Host string `json:"host"`
-	Type string `json:"type,omitempty"` // "icmp" or "tcp", default "icmp"
-	Port int    `json:"port,omitempty"` // Port for TCP connections, default 80
+	Type string `json:"type,omitempty"` // "icmp", "tcp", "http", "dns" or "tls", default "icmp"
+	Port int    `json:"port,omitempty"` // Port for TCP connections, default 80 (443 for tls)
+	// HTTP probes
+	URL            string `json:"url,omitempty"`             // Default https://<host>/
+	Method         string `json:"method,omitempty"`          // Default GET
+	ExpectedStatus int    `json:"expected_status,omitempty"` // Default any 2xx or 3xx
+	BodyContains   string `json:"body_contains,omitempty"`   // Required substring of the response body
+	// DNS probes, Host is the name to resolve
+	Resolver   string `json:"resolver,omitempty"`    // Resolver address, default the system resolver
+	RecordType string `json:"record_type,omitempty"` // A, AAAA, CNAME, MX, NS or TXT, default A
+	Expected   string `json:"expected,omitempty"`    // Required answer
+	// Scheduling, zero values use the defaults
+	IntervalSecs int `json:"interval_secs,omitempty"` // Default the metrics interval
+	TimeoutSecs  int `json:"timeout_secs,omitempty"`  // Wait per packet, connection or request
+	Count        int `json:"count,omitempty"`         // ICMP packets or TCP connections per run, default 3 and 1
+	// Assignment, resolved by the server; empty runs the target on every agent
+	Servers    []string          `json:"servers,omitempty"`
+	Dimensions map[string]string `json:"dimensions,omitempty"` // Dimension key or id -> option id or name
 }
 
 // ============================================================================
@@ -28,11 +28,15 @@ type ServerResponse struct {
 	Status      string             `json:"status,omitempty"`
 	Message     string             `json:"message,omitempty"`
 	Command     string             `json:"command,omitempty"`
-	DownloadURL string             `json:"download_url,omitempty"`
+	DownloadURL string             `json:"download_url,omitempty"` // Mirror of the release binary, still checked against the manifest
+	ManifestURL string             `json:"manifest_url,omitempty"` // Signed release manifest; defaults to the GitHub release
+	Version     string             `json:"version,omitempty"`      // Release to update to; defaults to the latest
 	Force       bool               `json:"force,omitempty"`
 	PingTargets []PingTargetConfig `json:"ping_targets,omitempty"`
 	// Traffic config
 	TrafficConfig *TrafficConfig `json:"traffic_config,omitempty"`
+	// Agent settings managed from the server
+	AgentConfig *RemoteAgentConfig `json:"agent_config,omitempty"`
 	// Batch metrics response fields
 	BatchID   string  `json:"batch_id,omitempty"`
 	Accepted  int     `json:"accepted,omitempty"`
@@ -22,6 +22,15 @@ const CHANNEL_TYPES = [
   { value: 'webhook', label: 'Webhook', icon: '🔗' },
   { value: 'bark', label: 'Bark (iOS)', icon: '🔔' },
   { value: 'serverchan', label: 'ServerChan', icon: '💬' },
+  { value: 'slack', label: 'Slack', icon: '💼' },
+  { value: 'teams', label: 'Microsoft Teams', icon: '👥' },
+  { value: 'matrix', label: 'Matrix', icon: '🟩' },
+  { value: 'ntfy', label: 'ntfy', icon: '📣' },
+  { value: 'gotify', label: 'Gotify', icon: '📨' },
+  { value: 'pagerduty', label: 'PagerDuty', icon: '🚨' },
+  { value: 'dingtalk', label: 'DingTalk', icon: '📌' },
+  { value: 'feishu', label: 'Feishu / Lark', icon: '🪶' },
+  { value: 'wecom', label: 'WeCom', icon: '🏢' },
 ];
 
 const CHANNEL_CONFIG_FIELDS: Record<string, { key: string; label: string; labelZh: string; type?: string; placeholder?: string }[]> = {
@@ -45,6 +54,7 @@ const CHANNEL_CONFIG_FIELDS: Record<string, { key: string; label: string; labelZ
   webhook: [
     { key: 'url', label: 'Webhook URL', labelZh: 'Webhook 地址', placeholder: 'https://your-server.com/webhook' },
     { key: 'method', label: 'HTTP Method', labelZh: 'HTTP 方法', placeholder: 'POST' },
+    { key: 'secret', label: 'Signing Secret (optional)', labelZh: '签名密钥 (可选)', type: 'password' },
   ],
   bark: [
     { key: 'device_key', label: 'Device Key', labelZh: '设备密钥', placeholder: 'Your Bark device key' },
@@ -54,6 +64,45 @@ const CHANNEL_CONFIG_FIELDS: Record<string, { key: string; label: string; labelZ
     { key: 'send_key', label: 'Send Key', labelZh: 'SendKey', placeholder: 'SCT...' },
     { key: 'channel', label: 'Channel (optional)', labelZh: '渠道 (可选)', placeholder: '9' },
   ],
+  slack: [
+    { key: 'webhook_url', label: 'Webhook URL', labelZh: 'Webhook 地址', placeholder: 'https://hooks.slack.com/services/...' },
+    { key: 'channel', label: 'Channel (optional)', labelZh: '频道 (可选)', placeholder: '#ops' },
+  ],
+  teams: [
+    { key: 'webhook_url', label: 'Webhook URL', labelZh: 'Webhook 地址', placeholder: 'https://....webhook.office.com/...' },
+  ],
+  matrix: [
+    { key: 'homeserver', label: 'Homeserver', labelZh: 'Homeserver 地址', placeholder: 'https://matrix.org' },
+    { key: 'access_token', label: 'Access Token', labelZh: 'Access Token', type: 'password' },
+    { key: 'room_id', label: 'Room ID', labelZh: '房间 ID', placeholder: '!abcdef:matrix.org' },
+  ],
+  ntfy: [
+    { key: 'topic', label: 'Topic', labelZh: '主题', placeholder: 'vstats-alerts' },
+    { key: 'server_url', label: 'Server URL (optional)', labelZh: '服务器地址 (可选)', placeholder: 'https://ntfy.sh' },
+    { key: 'token', label: 'Access Token (optional)', labelZh: 'Access Token (可选)', type: 'password' },
+    { key: 'priority', label: 'Priority 1-5 (optional)', labelZh: '优先级 1-5 (可选)', placeholder: '4' },
+  ],
+  gotify: [
+    { key: 'server_url', label: 'Server URL', labelZh: '服务器地址', placeholder: 'https://gotify.example.com' },
+    { key: 'app_token', label: 'App Token', labelZh: '应用 Token', type: 'password' },
+    { key: 'priority', label: 'Priority (optional)', labelZh: '优先级 (可选)', placeholder: '按告警级别' },
+  ],
+  pagerduty: [
+    { key: 'routing_key', label: 'Integration Key', labelZh: '集成密钥 (Routing Key)', type: 'password' },
+    { key: 'severity', label: 'Severity (optional)', labelZh: '严重程度 (可选)', placeholder: '按告警级别' },
+  ],
+  dingtalk: [
+    { key: 'webhook_url', label: 'Webhook URL', labelZh: 'Webhook 地址', placeholder: 'https://oapi.dingtalk.com/robot/send?access_token=...' },
+    { key: 'secret', label: 'Signing Secret (optional)', labelZh: '加签密钥 (可选)', type: 'password', placeholder: 'SEC...' },
+    { key: 'at_mobiles', label: 'Mention Mobiles (optional)', labelZh: '@手机号 (可选)', placeholder: '13800000000, 13900000000' },
+  ],
+  feishu: [
+    { key: 'webhook_url', label: 'Webhook URL', labelZh: 'Webhook 地址', placeholder: 'https://open.feishu.cn/open-apis/bot/v2/hook/...' },
+    { key: 'secret', label: 'Signing Secret (optional)', labelZh: '签名密钥 (可选)', type: 'password' },
+  ],
+  wecom: [
+    { key: 'webhook_url', label: 'Webhook URL', labelZh: 'Webhook 地址', placeholder: 'https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=...' },
+  ],
 };
 
 export default function AlertSettings({ token }: AlertSettingsProps) {
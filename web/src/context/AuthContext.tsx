@@ -1,4 +1,4 @@
-import { createContext, useContext, useState, useEffect, type ReactNode } from 'react';
+import { createContext, useContext, useState, useEffect, useCallback, type ReactNode } from 'react';
 
 interface OIDCProviderInfo {
   id: string;
@@ -12,21 +12,44 @@ interface OAuthProviders {
   cloudflare?: boolean;
 }
 
+// 'two_factor' means the password was accepted and a TOTP or recovery code is required
+export type LoginResult = 'ok' | 'two_factor' | 'failed';
+
 interface AuthContextType {
   isAuthenticated: boolean;
   token: string | null;
-  login: (password: string) => Promise<boolean>;
+  login: (password: string) => Promise<LoginResult>;
+  verifyTwoFactor: (code: string) => Promise<boolean>;
   logout: () => void;
   isLoading: boolean;
   oauthProviders: OAuthProviders;
   startOAuthLogin: (provider: string) => Promise<void>;
-  handleOAuthCallback: (token: string, expiresAt: number, provider: string, user: string) => void;
+  handleOAuthCallback: (token: string, expiresAt: number, provider: string, user: string, refreshToken?: string | null) => void;
   oauthUser: string | null;
   oauthProvider: string | null;
 }
 
 const AuthContext = createContext<AuthContextType | null>(null);
 
+// Access tokens are short-lived; refresh this long before they expire
+const REFRESH_MARGIN_MS = 60 * 1000;
+
+function storeTokens(token: string, expiresAt: number, refreshToken?: string | null) {
+  localStorage.setItem('vstats_token', token);
+  localStorage.setItem('vstats_token_expires', expiresAt.toString());
+  if (refreshToken) {
+    localStorage.setItem('vstats_refresh_token', refreshToken);
+  }
+}
+
+function clearStoredTokens() {
+  localStorage.removeItem('vstats_token');
+  localStorage.removeItem('vstats_token_expires');
+  localStorage.removeItem('vstats_refresh_token');
+  localStorage.removeItem('vstats_oauth_user');
+  localStorage.removeItem('vstats_oauth_provider');
+}
+
 export function AuthProvider({ children }: { children: ReactNode }) {
   const [token, setToken] = useState<string | null>(() => localStorage.getItem('vstats_token'));
   const [isLoading, setIsLoading] = useState(true);
@@ -50,6 +73,36 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     fetchProviders();
   }, []);
 
+  // Exchange the refresh token for a new access token
+  const refreshSession = useCallback(async (): Promise<boolean> => {
+    const refreshToken = localStorage.getItem('vstats_refresh_token');
+    if (!refreshToken) return false;
+    try {
+      const res = await fetch('/api/auth/refresh', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken })
+      });
+      if (!res.ok) return false;
+      const data = await res.json();
+      storeTokens(data.token, Math.floor(new Date(data.expires_at).getTime() / 1000), data.refresh_token);
+      setToken(data.token);
+      return true;
+    } catch {
+      return false;
+    }
+  }, []);
+
+  // Refresh the access token shortly before it expires
+  useEffect(() => {
+    if (!token) return;
+    const expires = parseInt(localStorage.getItem('vstats_token_expires') || '0');
+    if (!expires || !localStorage.getItem('vstats_refresh_token')) return;
+    const delay = Math.max(expires * 1000 - Date.now() - REFRESH_MARGIN_MS, 0);
+    const timer = setTimeout(() => { refreshSession(); }, delay);
+    return () => clearTimeout(timer);
+  }, [token, refreshSession]);
+
   useEffect(() => {
     // Verify token on mount
     const verifyToken = async () => {
@@ -58,13 +111,11 @@ export function AuthProvider({ children }: { children: ReactNode }) {
           const res = await fetch('/api/auth/verify', {
             headers: { Authorization: `Bearer ${token}` }
           });
-          if (!res.ok) {
+          if (!res.ok && !(await refreshSession())) {
             setToken(null);
             setOauthUser(null);
             setOauthProvider(null);
-            localStorage.removeItem('vstats_token');
-            localStorage.removeItem('vstats_oauth_user');
-            localStorage.removeItem('vstats_oauth_provider');
+            clearStoredTokens();
           }
         } catch {
           // Keep token if server is unreachable
@@ -73,9 +124,21 @@ export function AuthProvider({ children }: { children: ReactNode }) {
       setIsLoading(false);
     };
     verifyToken();
-  }, [token]);
+  }, [token, refreshSession]);
+
+  // Pending two-factor challenge between the password and code steps
+  const [challenge, setChallenge] = useState<string | null>(null);
+
+  const applyLogin = (data: { token: string; expires_at: string; refresh_token?: string }) => {
+    setToken(data.token);
+    setOauthUser(null);
+    setOauthProvider(null);
+    storeTokens(data.token, Math.floor(new Date(data.expires_at).getTime() / 1000), data.refresh_token);
+    localStorage.removeItem('vstats_oauth_user');
+    localStorage.removeItem('vstats_oauth_provider');
+  };
 
-  const login = async (password: string): Promise<boolean> => {
+  const login = async (password: string): Promise<LoginResult> => {
     try {
       const res = await fetch('/api/auth/login', {
         method: 'POST',
@@ -85,12 +148,30 @@ export function AuthProvider({ children }: { children: ReactNode }) {
       
       if (res.ok) {
         const data = await res.json();
-        setToken(data.token);
-        setOauthUser(null);
-        setOauthProvider(null);
-        localStorage.setItem('vstats_token', data.token);
-        localStorage.removeItem('vstats_oauth_user');
-        localStorage.removeItem('vstats_oauth_provider');
+        if (data.two_factor_required) {
+          setChallenge(data.challenge);
+          return 'two_factor';
+        }
+        applyLogin(data);
+        return 'ok';
+      }
+      return 'failed';
+    } catch {
+      return 'failed';
+    }
+  };
+
+  const verifyTwoFactor = async (code: string): Promise<boolean> => {
+    if (!challenge) return false;
+    try {
+      const res = await fetch('/api/auth/login/2fa', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ challenge, code })
+      });
+      if (res.ok) {
+        applyLogin(await res.json());
+        setChallenge(null);
         return true;
       }
       return false;
@@ -128,24 +209,27 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     }
   };
 
-  const handleOAuthCallback = (newToken: string, expiresAt: number, provider: string, user: string) => {
+  const handleOAuthCallback = (newToken: string, expiresAt: number, provider: string, user: string, refreshToken?: string | null) => {
     setToken(newToken);
     setOauthUser(user);
     setOauthProvider(provider);
-    localStorage.setItem('vstats_token', newToken);
+    storeTokens(newToken, expiresAt, refreshToken);
     localStorage.setItem('vstats_oauth_user', user);
     localStorage.setItem('vstats_oauth_provider', provider);
-    localStorage.setItem('vstats_token_expires', expiresAt.toString());
   };
 
   const logout = () => {
+    // Revoke the server-side session; local state is cleared regardless
+    if (token) {
+      fetch('/api/auth/logout', {
+        method: 'POST',
+        headers: { Authorization: `Bearer ${token}` }
+      }).catch(() => {});
+    }
     setToken(null);
     setOauthUser(null);
     setOauthProvider(null);
-    localStorage.removeItem('vstats_token');
-    localStorage.removeItem('vstats_oauth_user');
-    localStorage.removeItem('vstats_oauth_provider');
-    localStorage.removeItem('vstats_token_expires');
+    clearStoredTokens();
   };
 
   return (
@@ -153,6 +237,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
       isAuthenticated: !!token, 
       token, 
       login, 
+      verifyTwoFactor,
       logout,
       isLoading,
       oauthProviders,
@@ -155,6 +155,10 @@ export default {
     forgotPassword: 'Passwort vergessen? Führen Sie aus',
     pleaseEnterPassword: 'Bitte geben Sie ein Passwort ein',
     invalidPassword: 'Ungültiges Passwort',
+    twoFactorCode: 'Zwei-Faktor-Code',
+    twoFactorPlaceholder: '6-stelliger Code oder Wiederherstellungscode',
+    pleaseEnterCode: 'Bitte geben Sie Ihren Code ein',
+    invalidCode: 'Ungültiger Code',
     oauthFailed: 'OAuth-Anmeldung fehlgeschlagen',
   },
 
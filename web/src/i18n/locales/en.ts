@@ -179,6 +179,10 @@ export default {
     forgotPassword: 'Forgot password? Run',
     pleaseEnterPassword: 'Please enter a password',
     invalidPassword: 'Invalid password',
+    twoFactorCode: 'Two-Factor Code',
+    twoFactorPlaceholder: '6-digit code or recovery code',
+    pleaseEnterCode: 'Please enter your code',
+    invalidCode: 'Invalid code',
     oauthFailed: 'OAuth login failed',
   },
 
@@ -155,6 +155,10 @@ export default {
     forgotPassword: '¿Olvidó su contraseña? Ejecute',
     pleaseEnterPassword: 'Por favor ingrese una contraseña',
     invalidPassword: 'Contraseña inválida',
+    twoFactorCode: 'Código de dos factores',
+    twoFactorPlaceholder: 'Código de 6 dígitos o código de recuperación',
+    pleaseEnterCode: 'Por favor ingrese su código',
+    invalidCode: 'Código inválido',
     oauthFailed: 'Error de inicio de sesión OAuth',
   },
 
@@ -155,6 +155,10 @@ export default {
     forgotPassword: 'Mot de passe oublié ? Exécutez',
     pleaseEnterPassword: 'Veuillez entrer un mot de passe',
     invalidPassword: 'Mot de passe invalide',
+    twoFactorCode: 'Code à deux facteurs',
+    twoFactorPlaceholder: 'Code à 6 chiffres ou code de récupération',
+    pleaseEnterCode: 'Veuillez entrer votre code',
+    invalidCode: 'Code invalide',
     oauthFailed: 'Échec de la connexion OAuth',
   },
 
@@ -155,6 +155,10 @@ export default {
     forgotPassword: 'パスワードを忘れた場合は実行:',
     pleaseEnterPassword: 'パスワードを入力してください',
     invalidPassword: 'パスワードが正しくありません',
+    twoFactorCode: '二要素認証コード',
+    twoFactorPlaceholder: '6桁のコードまたはリカバリーコード',
+    pleaseEnterCode: 'コードを入力してください',
+    invalidCode: 'コードが無効です',
     oauthFailed: 'OAuthログインに失敗しました',
   },
 
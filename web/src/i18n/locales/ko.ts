@@ -155,6 +155,10 @@ export default {
     forgotPassword: '비밀번호를 잊으셨나요? 실행:',
     pleaseEnterPassword: '비밀번호를 입력하세요',
     invalidPassword: '잘못된 비밀번호',
+    twoFactorCode: '2단계 인증 코드',
+    twoFactorPlaceholder: '6자리 코드 또는 복구 코드',
+    pleaseEnterCode: '코드를 입력하세요',
+    invalidCode: '잘못된 코드입니다',
     oauthFailed: 'OAuth 로그인 실패',
   },
 
@@ -155,6 +155,10 @@ export default {
     forgotPassword: 'Esqueceu a senha? Execute',
     pleaseEnterPassword: 'Por favor, digite uma senha',
     invalidPassword: 'Senha inválida',
+    twoFactorCode: 'Código de dois fatores',
+    twoFactorPlaceholder: 'Código de 6 dígitos ou código de recuperação',
+    pleaseEnterCode: 'Por favor, digite seu código',
+    invalidCode: 'Código inválido',
     oauthFailed: 'Falha no login OAuth',
   },
 
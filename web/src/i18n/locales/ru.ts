@@ -155,6 +155,10 @@ export default {
     forgotPassword: 'Забыли пароль? Выполните',
     pleaseEnterPassword: 'Пожалуйста, введите пароль',
     invalidPassword: 'Неверный пароль',
+    twoFactorCode: 'Код двухфакторной аутентификации',
+    twoFactorPlaceholder: '6-значный код или код восстановления',
+    pleaseEnterCode: 'Пожалуйста, введите код',
+    invalidCode: 'Неверный код',
     oauthFailed: 'Ошибка OAuth входа',
   },
 
@@ -179,6 +179,10 @@ export default {
     forgotPassword: '忘记密码？运行',
     pleaseEnterPassword: '请输入密码',
     invalidPassword: '密码错误',
+    twoFactorCode: '两步验证码',
+    twoFactorPlaceholder: '6 位验证码或恢复码',
+    pleaseEnterCode: '请输入验证码',
+    invalidCode: '验证码无效',
     oauthFailed: 'OAuth 登录失败',
   },
 
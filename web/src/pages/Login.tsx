@@ -39,10 +39,12 @@ const CloudflareIcon = () => (
 export default function Login() {
   const { t } = useTranslation();
   const [password, setPassword] = useState('');
+  const [code, setCode] = useState('');
+  const [needsCode, setNeedsCode] = useState(false);
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
   const [oauthLoading, setOauthLoading] = useState<string | null>(null);
-  const { login, oauthProviders, startOAuthLogin } = useAuth();
+  const { login, verifyTwoFactor, oauthProviders, startOAuthLogin } = useAuth();
   const navigate = useNavigate();
 
   const hasOAuthProviders = oauthProviders.github || oauthProviders.google || 
@@ -51,6 +53,21 @@ export default function Login() {
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError('');
+
+    if (needsCode) {
+      if (!code) {
+        setError(t('login.pleaseEnterCode'));
+        return;
+      }
+      setLoading(true);
+      if (await verifyTwoFactor(code)) {
+        navigate('/settings', { replace: true });
+      } else {
+        setError(t('login.invalidCode'));
+      }
+      setLoading(false);
+      return;
+    }
     
     const formData = new FormData(e.target as HTMLFormElement);
     const inputPassword = (formData.get('password') as string) || password;
@@ -62,11 +79,13 @@ export default function Login() {
     
     setLoading(true);
 
-    const success = await login(inputPassword);
+    const result = await login(inputPassword);
     
-    if (success) {
+    if (result === 'ok') {
       // Use replace to avoid going back to login page
       navigate('/settings', { replace: true });
+    } else if (result === 'two_factor') {
+      setNeedsCode(true);
     } else {
       setError(t('login.invalidPassword'));
     }
@@ -231,20 +250,39 @@ export default function Login() {
             )}
 
             <form onSubmit={handleSubmit} className="space-y-6">
-              <div className="space-y-2">
-                <label className="block text-sm font-semibold text-slate-700">
-                  {t('login.password')}
-                </label>
-                <input
-                  type="password"
-                  name="password"
-                  value={password}
-                  onChange={(e) => setPassword(e.target.value)}
-                  className="w-full px-4 py-3.5 rounded-xl bg-slate-50 border border-slate-200 text-slate-900 placeholder-slate-400 focus:outline-none focus:border-emerald-500 focus:ring-4 focus:ring-emerald-500/15 transition-all"
-                  placeholder={t('login.passwordPlaceholder')}
-                  autoFocus={!hasOAuthProviders}
-                />
-              </div>
+              {needsCode ? (
+                <div className="space-y-2">
+                  <label className="block text-sm font-semibold text-slate-700">
+                    {t('login.twoFactorCode')}
+                  </label>
+                  <input
+                    type="text"
+                    name="code"
+                    inputMode="numeric"
+                    autoComplete="one-time-code"
+                    value={code}
+                    onChange={(e) => setCode(e.target.value)}
+                    className="w-full px-4 py-3.5 rounded-xl bg-slate-50 border border-slate-200 text-slate-900 placeholder-slate-400 focus:outline-none focus:border-emerald-500 focus:ring-4 focus:ring-emerald-500/15 transition-all"
+                    placeholder={t('login.twoFactorPlaceholder')}
+                    autoFocus
+                  />
+                </div>
+              ) : (
+                <div className="space-y-2">
+                  <label className="block text-sm font-semibold text-slate-700">
+                    {t('login.password')}
+                  </label>
+                  <input
+                    type="password"
+                    name="password"
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                    className="w-full px-4 py-3.5 rounded-xl bg-slate-50 border border-slate-200 text-slate-900 placeholder-slate-400 focus:outline-none focus:border-emerald-500 focus:ring-4 focus:ring-emerald-500/15 transition-all"
+                    placeholder={t('login.passwordPlaceholder')}
+                    autoFocus={!hasOAuthProviders}
+                  />
+                </div>
+              )}
 
               {error && (
                 <div className="p-3 rounded-xl bg-red-50 border border-red-200 text-red-600 text-sm flex items-center gap-2">
@@ -1,20 +1,24 @@
 import { useEffect, useState } from 'react';
-import { useNavigate, useSearchParams } from 'react-router-dom';
+import { useLocation, useNavigate, useSearchParams } from 'react-router-dom';
 import { useTranslation } from 'react-i18next';
 import { useAuth } from '../context/AuthContext';
 
 export default function OAuthCallback() {
   const { t } = useTranslation();
   const [searchParams] = useSearchParams();
+  const { hash } = useLocation();
   const navigate = useNavigate();
   const { handleOAuthCallback } = useAuth();
   const [error, setError] = useState<string | null>(null);
 
   useEffect(() => {
-    const token = searchParams.get('token');
-    const expires = searchParams.get('expires');
-    const provider = searchParams.get('provider');
-    const user = searchParams.get('user');
+    // Tokens arrive in the URL fragment so they never reach server or proxy logs
+    const params = new URLSearchParams(hash.replace(/^#/, ''));
+    const token = params.get('token');
+    const expires = params.get('expires');
+    const provider = params.get('provider');
+    const user = params.get('user');
+    const refresh = params.get('refresh');
     const errorMsg = searchParams.get('error');
 
     if (errorMsg) {
@@ -24,12 +28,12 @@ export default function OAuthCallback() {
 
     if (token && expires && provider && user) {
       // Store the token and redirect to settings
-      handleOAuthCallback(token, parseInt(expires), provider, decodeURIComponent(user));
+      handleOAuthCallback(token, parseInt(expires), provider, user, refresh);
       navigate('/settings', { replace: true });
     } else {
       setError(t('oauth.invalidParams'));
     }
-  }, [searchParams, handleOAuthCallback, navigate, t]);
+  }, [searchParams, hash, handleOAuthCallback, navigate, t]);
 
   if (error) {
     return (
@@ -44,12 +44,37 @@ export interface RemoteServer {
   traffic_reset_day?: number; // Day of month to reset (1-28)
 }
 
+// Agent self-update report (GET /api/servers/:id/update)
+export interface AgentUpdateStatus {
+  status: 'downloading' | 'restarting' | 'succeeded' | 'skipped' | 'failed' | 'rolled_back';
+  from_version: string;
+  to_version?: string;
+  error?: string;
+  time: string;
+}
+
 // Ping target configuration
 export interface PingTargetConfig {
   name: string;
   host: string;
-  type?: string; // "icmp" or "tcp", default "icmp"
-  port?: number; // Port for TCP connections, default 80
+  type?: string; // "icmp", "tcp", "http", "dns" or "tls", default "icmp"
+  port?: number; // Port for TCP connections, default 80 (443 for tls)
+  // HTTP probes
+  url?: string;
+  method?: string;
+  expected_status?: number;
+  body_contains?: string;
+  // DNS probes
+  resolver?: string;
+  record_type?: string;
+  expected?: string;
+  // Scheduling
+  interval_secs?: number;
+  timeout_secs?: number;
+  count?: number;
+  // Assignment, empty runs on every agent
+  servers?: string[];
+  dimensions?: Record<string, string>;
 }
 
 // Probe settings
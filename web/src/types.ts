@@ -229,11 +229,12 @@ export interface AlertConfig {
 
 export interface NotificationChannel {
   id: string;
-  type: 'email' | 'telegram' | 'discord' | 'webhook' | 'bark' | 'serverchan';
+  type: 'email' | 'telegram' | 'discord' | 'webhook' | 'bark' | 'serverchan' | 'slack' | 'teams' | 'matrix' | 'ntfy' | 'gotify' | 'pagerduty' | 'dingtalk' | 'feishu' | 'wecom';
   name: string;
   enabled: boolean;
   config: Record<string, string>;
   priority?: number;
+  templates?: Record<string, AlertTemplate>;
 }
 
 export interface AlertRules {